@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/bench"
+	"github.com/joaopgrassi/otel-recipes/internal/common/compose"
+	"github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+	"github.com/joaopgrassi/otel-recipes/internal/common/waitfor"
+)
+
+// Time allowed to start the stack, warm up and drive the load of each run
+const benchRunTimeout time.Duration = 20 * time.Minute
+
+// Disables the SDKs configured from the environment, for the run without instrumentation
+const sdkDisabledOverride = `services:
+  %s:
+    environment:
+      OTEL_SDK_DISABLED: "true"
+`
+
+type benchOptions struct {
+	sample  string
+	root    string
+	service string
+	url     string
+	output  string
+	load    bench.Load
+}
+
+// The machine-readable artifact of a benchmark
+type benchReport struct {
+	Recipe         string         `json:"recipe"`
+	Path           string         `json:"path"`
+	Url            string         `json:"url"`
+	Concurrency    int            `json:"concurrency"`
+	GeneratedAt    time.Time      `json:"generatedAt"`
+	Instrumented   *bench.Result  `json:"instrumented"`
+	Uninstrumented *bench.Result  `json:"uninstrumented"`
+	Overhead       bench.Overhead `json:"overhead"`
+}
+
+// Measures the overhead of the instrumentation of a sample and returns the exit code: 0 if both runs
+// completed, 1 if a run failed and 2 for invalid arguments
+func benchmark(args []string) int {
+	o, err := parseBenchArgs(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	r, err := recipes.Find(o.root, o.sample)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	override, err := os.CreateTemp("", "otel-recipes-bench-*.yml")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.Remove(override.Name())
+	_, err = fmt.Fprintf(override, sdkDisabledOverride, o.service)
+	if cerr := override.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	rep := &benchReport{
+		Recipe:      r.ID,
+		Path:        r.Path(o.root),
+		Url:         o.url,
+		Concurrency: o.load.Concurrency,
+		GeneratedAt: time.Now().UTC(),
+	}
+	// the runs don't overlap, so they don't compete for the CPU
+	rep.Instrumented, err = benchRun(r, o, "instrumented", "docker-compose.yml")
+	if err == nil {
+		rep.Uninstrumented, err = benchRun(r, o, "uninstrumented", "docker-compose.yml", override.Name())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	rep.Overhead = bench.Compare(rep.Instrumented, rep.Uninstrumented)
+
+	out := io.Writer(os.Stdout)
+	if o.output != "" {
+		f, err := os.Create(o.output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rep); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Starts the compose stack of the recipe with the files, drives the load against the sample and tears it down
+func benchRun(r *recipes.Recipe, o *benchOptions, name string, files ...string) (*bench.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), benchRunTimeout)
+	defer cancel()
+
+	stack := compose.New(r.Dir, compose.WithFiles(files...))
+	fmt.Fprintf(os.Stderr, "Starting the %s run of %s\n", name, r.ID)
+	defer func() {
+		if err := stack.Down(context.Background()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed tearing down the compose stack of %s: %v\n", r.ID, err)
+		}
+	}()
+	if err := stack.Start(ctx); err != nil {
+		return nil, err
+	}
+	if err := stack.WaitHealthy(ctx); err != nil {
+		return nil, err
+	}
+	if err := waitfor.WaitForHTTP(ctx, o.url); err != nil {
+		return nil, fmt.Errorf("the sample did not become ready: %w", err)
+	}
+	container, err := stack.ContainerID(ctx, o.service)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := bench.Run(ctx, o.load, container)
+	if err != nil {
+		return nil, fmt.Errorf("the %s run failed: %w", name, err)
+	}
+	fmt.Fprintf(os.Stderr, "%s: p50 %.2fms, p99 %.2fms, %.3fms CPU per request, %d errors\n",
+		name, res.Latency.P50, res.Latency.P99, res.CpuPerRequest, res.Errors)
+	return res, nil
+}
+
+func parseBenchArgs(args []string) (*benchOptions, error) {
+	o := &benchOptions{}
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.StringVar(&o.sample, "sample", "", "The id of the recipe to benchmark, e.g. go.gin-api.traces (required)")
+	fs.StringVar(&o.root, "root", "", "The root of the otel-recipes repository. Defaults to the repository of the working directory")
+	fs.StringVar(&o.service, "service", "app", "The compose service of the sample")
+	fs.StringVar(&o.url, "url", "http://localhost:8080/", "The endpoint of the sample the load is driven against")
+	fs.StringVar(&o.output, "output", "", "The file to write the JSON results to. Defaults to stdout")
+	fs.IntVar(&o.load.Requests, "requests", 1000, "The number of measured requests of each run")
+	fs.IntVar(&o.load.Concurrency, "concurrency", 10, "The number of requests in flight at once")
+	fs.IntVar(&o.load.Warmup, "warmup", 100, "The requests sent before measuring each run")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: otel-recipes bench --sample <id> [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if o.sample == "" {
+		return nil, errors.New("missing --sample")
+	}
+	if o.load.Requests <= 0 || o.load.Concurrency <= 0 || o.load.Warmup < 0 {
+		return nil, errors.New("--requests and --concurrency must be positive, --warmup not negative")
+	}
+	if !strings.HasPrefix(o.url, "http://") && !strings.HasPrefix(o.url, "https://") {
+		return nil, fmt.Errorf("invalid --url %q", o.url)
+	}
+	if o.root == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		if o.root, err = recipes.FindRoot(cwd); err != nil {
+			return nil, fmt.Errorf("%w. Set the repository with --root", err)
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,47 @@
+// Command otel-recipes helps contributors work on the recipes, e.g. validating the
+// telemetry of a sample without knowing the test flags:
+//
+//	otel-recipes verify --sample go.console.traces --signal trace
+//	otel-recipes new --lang go --signal trace --name gin-api
+//	otel-recipes bench --sample go.gin-api.traces --url http://localhost:8080/hello
+//	otel-recipes export-site --results report.json
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: otel-recipes <command> [flags]
+
+Commands:
+  verify       Validates the telemetry exported by a running sample
+  new          Generates the skeleton of a new recipe
+  bench        Measures the overhead of the instrumentation of a sample
+  export-site  Writes the recipes consumed by the website
+
+Run otel-recipes <command> -h for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "verify":
+		os.Exit(verify(os.Args[2:]))
+	case "new":
+		os.Exit(newRecipe(os.Args[2:]))
+	case "bench":
+		os.Exit(benchmark(os.Args[2:]))
+	case "export-site":
+		os.Exit(exportSite(os.Args[2:]))
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
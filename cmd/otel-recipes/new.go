@@ -0,0 +1,192 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// The app file of each language, linked from the steps of the recipefile.json
+var appFiles = map[string]string{
+	"go":     "app.go",
+	"python": "app.py",
+	"js":     "app.js",
+	"csharp": "App.cs",
+	"java":   "app/src/main/java/otel/recipes/App.java",
+}
+
+// The name of the go test and of its file for each signal, as in the existing recipes
+var testNames = map[string]string{
+	"traces":  "TestTraceGeneratedFromSample",
+	"metrics": "TestMetricsGeneratedFromSample",
+	"logs":    "TestLogGeneratedFromSample",
+}
+
+// The values the templates are rendered with
+type recipeTemplate struct {
+	ID          string
+	Lang        string
+	Signal      string
+	Name        string
+	DisplayName string
+	// The recipe folder relative to the repository root, e.g. src/go/traces/console
+	Path     string
+	AppFile  string
+	TestName string
+}
+
+// Generates the skeleton of a new recipe and returns the exit code
+func newRecipe(args []string) int {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	lang := fs.String("lang", "", "The languageId of the recipe. One of: csharp, go, java, js, python (required)")
+	signal := fs.String("signal", "", "The signal of the recipe. One of: trace, metric, log (required)")
+	name := fs.String("name", "console", "The name of the recipe app, used as its folder, e.g. console, gin-api")
+	root := fs.String("root", "", "The root of the otel-recipes repository. Defaults to the repository of the working directory")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: otel-recipes new --lang <lang> --signal <signal> [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	rt, err := newRecipeTemplate(*lang, *signal, *name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *root == "" {
+		cwd, err := os.Getwd()
+		if err == nil {
+			*root, err = recipes.FindRoot(cwd)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v. Set the repository with --root\n", err)
+			return 2
+		}
+	}
+
+	dir := filepath.Join(*root, filepath.FromSlash(rt.Path))
+	if _, err := os.Stat(dir); err == nil {
+		fmt.Fprintf(os.Stderr, "The recipe folder %s already exists\n", rt.Path)
+		return 2
+	}
+
+	files, err := rt.render(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("Created the recipe %s in %s:\n", rt.ID, rt.Path)
+	for _, f := range files {
+		fmt.Printf("  %s\n", f)
+	}
+	fmt.Printf(`
+Next steps:
+  1. Instrument the app in %[1]s/%[2]s and list its dependencies in the recipefile.json
+  2. Adjust the expected telemetry in %[1]s/test/expected.yaml
+  3. Run go mod tidy in %[1]s/test
+  4. Start the recipe with docker compose up -d --build and run otel-recipes verify --sample %[3]s
+
+The recipe is tested by the CI once a pull request changes it, as it has a Dockerfile.
+`, rt.Path, rt.AppFile, rt.ID)
+	return 0
+}
+
+func newRecipeTemplate(lang, signal, name string) (*recipeTemplate, error) {
+	appFile, ok := appFiles[lang]
+	if !ok {
+		return nil, fmt.Errorf("invalid --lang %q. One of: csharp, go, java, js, python", lang)
+	}
+	s, ok := signals[strings.ToLower(signal)]
+	if !ok {
+		return nil, fmt.Errorf("invalid --signal %q. One of: trace, metric, log", signal)
+	}
+	if name == "" || strings.ContainsAny(name, `/\. `) {
+		return nil, fmt.Errorf("invalid --name %q. Use a folder name, e.g. console", name)
+	}
+
+	words := strings.Split(name, "-")
+	for i, w := range words {
+		words[i] = strings.ToUpper(w[:1]) + w[1:]
+	}
+	return &recipeTemplate{
+		ID:          strings.Join([]string{lang, name, s}, "."),
+		Lang:        lang,
+		Signal:      s,
+		Name:        name,
+		DisplayName: strings.Join(words, " ") + " App",
+		Path:        path.Join("src", lang, s, name),
+		AppFile:     appFile,
+		TestName:    testNames[s],
+	}, nil
+}
+
+// Renders the templates shared by all recipes, the ones of the language and the test module into dir.
+// Returns the created files, relative to dir
+func (rt *recipeTemplate) render(dir string) ([]string, error) {
+	var created []string
+	for _, src := range []struct{ from, to string }{
+		{"templates/common", ""},
+		{"templates/" + rt.Lang, ""},
+		{"templates/test", "test"},
+	} {
+		err := fs.WalkDir(templates, src.from, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			rel := strings.TrimSuffix(strings.TrimPrefix(p, src.from+"/"), ".tmpl")
+			if rel == "test.go" {
+				rel = rt.Signal + "_test.go"
+			}
+			rel = path.Join(src.to, rel)
+
+			if err := rt.renderFile(p, filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+				return fmt.Errorf("failed creating %s: %w", rel, err)
+			}
+			created = append(created, rel)
+			return nil
+		})
+		if err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+func (rt *recipeTemplate) renderFile(tmpl, dst string) error {
+	t, err := template.ParseFS(templates, tmpl)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := t.Execute(f, rt); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
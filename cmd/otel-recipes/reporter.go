@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+// Runs the assertions of the verify command outside go test. Each assertion reports to its own reporter,
+// printing its output like go test: only when it failed, or always in verbose mode
+type reporter struct {
+	name    string
+	parent  *reporter
+	w       io.Writer
+	verbose bool
+
+	mu       sync.Mutex
+	output   []string
+	failed   bool
+	skipped  bool
+	cleanups []func()
+}
+
+var _ tu.Runner = (*reporter)(nil)
+
+func newReporter(name string, w io.Writer, verbose bool) *reporter {
+	return &reporter{name: name, w: w, verbose: verbose}
+}
+
+func (r *reporter) Name() string { return r.name }
+
+func (r *reporter) Helper() {}
+
+func (r *reporter) Cleanup(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cleanups = append(r.cleanups, f)
+}
+
+// No deadline: the retries are bounded by their policy
+func (r *reporter) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (r *reporter) TempDir() string {
+	dir, err := os.MkdirTemp("", "otel-recipes-verify-")
+	if err != nil {
+		r.Fatalf("Failed creating a temporary directory: %v", err)
+	}
+	r.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func (r *reporter) Log(args ...any) { r.log(fmt.Sprintln(args...)) }
+
+func (r *reporter) Logf(format string, args ...any) { r.log(fmt.Sprintf(format, args...)) }
+
+func (r *reporter) Error(args ...any) {
+	r.Log(args...)
+	r.fail()
+}
+
+func (r *reporter) Errorf(format string, args ...any) {
+	r.Logf(format, args...)
+	r.fail()
+}
+
+func (r *reporter) Fatal(args ...any) {
+	r.Log(args...)
+	r.FailNow()
+}
+
+func (r *reporter) Fatalf(format string, args ...any) {
+	r.Logf(format, args...)
+	r.FailNow()
+}
+
+// Stops the assertion, which runs in its own goroutine
+func (r *reporter) FailNow() {
+	r.fail()
+	runtime.Goexit()
+}
+
+func (r *reporter) Failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failed
+}
+
+func (r *reporter) Skip(args ...any) {
+	r.Log(args...)
+	r.mu.Lock()
+	r.skipped = true
+	r.mu.Unlock()
+	runtime.Goexit()
+}
+
+func (r *reporter) Skipped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.skipped
+}
+
+func (r *reporter) Run(name string, f func(t tu.TestingT)) bool {
+	sub := &reporter{name: r.name + "/" + name, parent: r, w: r.w, verbose: r.verbose}
+	sub.run(f)
+	return !sub.Failed()
+}
+
+// Runs f and its cleanups, then prints the outcome. A failed subtest fails its parent
+func (r *reporter) run(f func(t tu.TestingT)) {
+	start := time.Now()
+	r.call(func() { f(r) })
+	r.mu.Lock()
+	cleanups := r.cleanups
+	r.mu.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		r.call(cleanups[i])
+	}
+
+	if r.parent != nil && r.Failed() {
+		r.parent.fail()
+	}
+	r.print(time.Since(start))
+}
+
+// Calls f in its own goroutine, so FailNow and Skip can stop it, recovering its panics
+func (r *reporter) call(f func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() {
+			if p := recover(); p != nil {
+				r.Errorf("panic: %v\n%s", p, debug.Stack())
+			}
+		}()
+		f()
+	}()
+	<-done
+}
+
+func (r *reporter) log(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output = append(r.output, strings.TrimSuffix(s, "\n"))
+}
+
+func (r *reporter) fail() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = true
+}
+
+func (r *reporter) print(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := "PASS"
+	switch {
+	case r.failed:
+		status = "FAIL"
+	case r.skipped:
+		status = "SKIP"
+	}
+	if !r.failed && !r.verbose {
+		return
+	}
+
+	fmt.Fprintf(r.w, "--- %s: %s (%.2fs)\n", status, r.name, d.Seconds())
+	for _, o := range r.output {
+		fmt.Fprintf(r.w, "    %s\n", strings.ReplaceAll(o, "\n", "\n    "))
+	}
+}
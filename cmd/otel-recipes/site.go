@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+	"github.com/joaopgrassi/otel-recipes/internal/common/report"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+// The file the website embeds, relative to the repository root
+const siteDataFile string = "src/site/src/lib/store/data.json"
+
+type siteOptions struct {
+	root    string
+	results string
+	output  string
+}
+
+// What the harness verifies of a recipe, shown by the website next to the recipe
+type siteVerification struct {
+	// The status of the recipe in the last validation run, e.g. passed. Empty if it wasn't validated
+	Status     string     `json:"status,omitempty"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+	// The names of the spans and metrics and the number of logs asserted by the expected telemetry file
+	Spans   []string `json:"spans,omitempty"`
+	Metrics []string `json:"metrics,omitempty"`
+	Logs    int      `json:"logs,omitempty"`
+}
+
+// Writes the recipes consumed by the website: the fields of each recipefile.json, plus what the harness
+// verifies of the recipe. Returns the exit code: 0 if written, 1 if a recipe couldn't be read and 2 for
+// invalid arguments
+func exportSite(args []string) int {
+	o, err := parseSiteArgs(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	results := map[string]*report.Sample{}
+	var verifiedAt time.Time
+	if o.results != "" {
+		f, err := os.Open(o.results)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		rep, err := report.ReadJSON(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --results %s: %v\n", o.results, err)
+			return 2
+		}
+		for _, s := range rep.Samples {
+			results[s.Path] = s
+		}
+		verifiedAt = rep.GeneratedAt
+	}
+
+	all, err := recipes.DiscoverAll(o.root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// a stable order, so the file only changes with the recipes
+	slices.SortFunc(all, func(a, b *recipes.Recipe) int { return strings.Compare(a.ID, b.ID) })
+
+	data := make([]map[string]any, 0, len(all))
+	for _, r := range all {
+		entry, err := siteRecipe(r, results[r.Path(o.root)], verifiedAt)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		data = append(data, entry)
+	}
+
+	out := io.Writer(os.Stdout)
+	if o.output != "-" {
+		f, err := os.Create(o.output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	// minified, as it is embedded in the website
+	if err := json.NewEncoder(out).Encode(data); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// The recipefile.json of the recipe with the verification added. The other fields are kept as they are,
+// so the website can use new fields of the schema without changing the export
+func siteRecipe(r *recipes.Recipe, result *report.Sample, verifiedAt time.Time) (map[string]any, error) {
+	raw, err := os.ReadFile(filepath.Join(r.Dir, "recipefile.json"))
+	if err != nil {
+		return nil, err
+	}
+	entry := map[string]any{}
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, fmt.Errorf("invalid recipefile.json in %s: %w", r.Dir, err)
+	}
+
+	v := &siteVerification{}
+	if result != nil {
+		v.Status = result.Status
+		if !verifiedAt.IsZero() {
+			v.VerifiedAt = &verifiedAt
+		}
+	}
+	if r.SpecPath() != "" {
+		spec, err := r.LoadSpec("")
+		if err != nil {
+			return nil, err
+		}
+		v.Spans, v.Metrics, v.Logs = specTelemetry(spec)
+	}
+	if v.Status != "" || v.Spans != nil || v.Metrics != nil || v.Logs > 0 {
+		entry["verification"] = v
+	}
+	return entry, nil
+}
+
+func specTelemetry(spec *tu.Spec) (spans, metrics []string, logs int) {
+	add := func(ss []tu.SpanSpec) {
+		for _, s := range ss {
+			if !slices.Contains(spans, s.Name) {
+				spans = append(spans, s.Name)
+			}
+		}
+	}
+	add(spec.Spans)
+	for _, tr := range spec.Traces {
+		add(tr.Spans)
+	}
+	for _, set := range spec.SpanSets {
+		add(set.Spans)
+	}
+	for _, m := range spec.Metrics {
+		metrics = append(metrics, m.Name)
+	}
+	return spans, metrics, len(spec.Logs)
+}
+
+func parseSiteArgs(args []string) (*siteOptions, error) {
+	o := &siteOptions{}
+	fs := flag.NewFlagSet("export-site", flag.ContinueOnError)
+	fs.StringVar(&o.root, "root", "", "The root of the otel-recipes repository. Defaults to the repository of the working directory")
+	fs.StringVar(&o.results, "results", "", "The JSON report of the last validation run of the samples, to add the status of each recipe")
+	fs.StringVar(&o.output, "output", "", "The file to write to, - for stdout. Defaults to "+siteDataFile+" in the repository")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: otel-recipes export-site [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if o.root == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		if o.root, err = recipes.FindRoot(cwd); err != nil {
+			return nil, fmt.Errorf("%w. Set the repository with --root", err)
+		}
+	}
+	if o.output == "" {
+		o.output = filepath.Join(o.root, filepath.FromSlash(siteDataFile))
+	}
+	return o, nil
+}
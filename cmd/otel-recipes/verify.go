@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/compose"
+	"github.com/joaopgrassi/otel-recipes/internal/common/containers"
+	"github.com/joaopgrassi/otel-recipes/internal/common/otlpsink"
+	"github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+	"github.com/joaopgrassi/otel-recipes/internal/common/report"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+const (
+	textOutput string = "text"
+	jsonOutput string = "json"
+	htmlOutput string = "html"
+)
+
+// The signals accepted by --signal and the signal of the recipefile.json they stand for
+var signals = map[string]string{
+	"trace":   "traces",
+	"traces":  "traces",
+	"metric":  "metrics",
+	"metrics": "metrics",
+	"log":     "logs",
+	"logs":    "logs",
+}
+
+// The signals of the recipefile.json and the ones of the assertions of the expected telemetry files
+var specSignals = map[string]string{
+	"traces":  tu.TraceSignal,
+	"metrics": tu.MetricsSignal,
+	"logs":    tu.LogsSignal,
+}
+
+type verifyOptions struct {
+	sample  string
+	signal  string
+	output  string
+	root    string
+	compose bool
+	verbose bool
+	// Passed to the test flags, e.g. -trace-backend=tempo
+	testArgs []string
+}
+
+// Runs the validation of a sample and returns the exit code: 0 if all the assertions
+// passed, 1 if any failed and 2 for invalid arguments
+func verify(args []string) int {
+	o, err := parseVerifyArgs(args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	r, err := recipes.Find(o.root, o.sample)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if o.signal != "" && !slices.Contains(r.Signals(), o.signal) {
+		fmt.Fprintf(os.Stderr, "Recipe %s exports %s, not %s\n", r.ID, strings.Join(r.Signals(), ", "), o.signal)
+		return 2
+	}
+
+	var spec *tu.Spec
+	if r.SpecPath() != "" {
+		if spec, err = r.LoadSpec(""); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	// only the result goes to stdout in JSON and HTML mode, the test output goes to stderr
+	out, testOut := os.Stdout, os.Stdout
+	if o.output != textOutput {
+		testOut = os.Stderr
+	}
+
+	sr := report.NewSample(r, r.Path(o.root))
+	test := func(t tu.TestingT) {
+		tu.UseLogAttrs(t, "sample", r.ID)
+		start := time.Now()
+		t.Cleanup(func() {
+			sr.Finish(t, start)
+			if err := printResult(out, o.output, sr); err != nil {
+				t.Errorf("Failed printing the result: %v", err)
+			}
+		})
+
+		c := tu.GetConfig()
+		if o.compose && c.TraceStart == "" || r.Manifest != nil && r.Manifest.Backend != "" {
+			run := *c
+			if o.compose && run.TraceStart == "" {
+				// the back-ends may keep the traces of the previous runs
+				run.TraceStart = tu.TraceStartNow()
+			}
+			if r.Manifest != nil && r.Manifest.Backend != "" {
+				run.TraceBackend = r.Manifest.Backend
+			}
+			c = &run
+			tu.UseConfig(t, c)
+		}
+		if o.compose {
+			var opts []compose.Option
+			if spec != nil && spec.ResourceEnv != nil {
+				opts = append(opts, compose.WithServiceEnv(spec.ResourceEnv.SampleService(), spec.ResourceEnv.Env(spec.ServiceName)...))
+			}
+			if spec != nil && spec.ExporterEnv != nil {
+				// the sample exports to a sink of the run instead, which becomes its back-end
+				e := spec.ExporterEnv
+				endpoint := otlpsink.Capture(t).Endpoint(containers.HostGateway, e.Protocol)
+				opts = append(opts, compose.WithServiceEnv(e.SampleService(), e.Env(endpoint)...),
+					compose.WithExtraHosts(e.SampleService(), containers.HostGateway+":host-gateway"))
+			}
+			compose.Up(t, r.Dir, opts...)
+		}
+
+		if o.output == htmlOutput {
+			// captured from a cleanup, so the page renders the traces even when an assertion stops the test
+			t.Cleanup(func() {
+				if err := sr.AddTelemetry(tu.CaptureTelemetry(t, r.ID)); err != nil {
+					tu.Logger(t).Warn("Failed adding the telemetry to the report", "error", err)
+				}
+			})
+		}
+
+		if spec != nil {
+			var signals []string
+			if o.signal != "" {
+				signals = append(signals, specSignals[o.signal])
+			}
+			sr.AddAssertions(tu.AssertSpec(t, spec, signals...))
+			return
+		}
+
+		// samples with assertions written in Go are validated by their own test module
+		results, output, err := recipes.RunTests(context.Background(), r, c, o.testArgs...)
+		if o.verbose || err != nil {
+			t.Log(output)
+		}
+		if err != nil {
+			t.Errorf("Tests in %s failed: %v", r.TestDir(), err)
+		}
+		sr.AddAssertions(results)
+	}
+
+	root := newReporter(r.ID, testOut, o.verbose)
+	root.run(test)
+	if root.Failed() {
+		return 1
+	}
+	return 0
+}
+
+func parseVerifyArgs(args []string) (*verifyOptions, error) {
+	o := &verifyOptions{}
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.StringVar(&o.sample, "sample", "", "The id of the recipe to verify, e.g. go.console.traces (required)")
+	signal := fs.String("signal", "", "The signal to verify. One of: trace, metric, log. Defaults to the signal of the recipe")
+	fs.StringVar(&o.output, "output", textOutput, "The output format. One of: text, json, html")
+	fs.StringVar(&o.root, "root", "", "The root of the otel-recipes repository. Defaults to the repository of the working directory")
+	fs.BoolVar(&o.compose, "compose", false, "Start the compose stack of the recipe before verifying it")
+	fs.BoolVar(&o.verbose, "verbose", false, "Print the output of each assertion")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: otel-recipes verify --sample <id> [flags] [-- test flags]\n\n")
+		fs.PrintDefaults()
+	}
+
+	// everything after -- is passed to the test flags
+	for i, a := range args {
+		if a == "--" {
+			o.testArgs = args[i+1:]
+			args = args[:i]
+			break
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	// the flags of the test utils, e.g. -trace-backend, registered on the default flag set
+	if err := flag.CommandLine.Parse(o.testArgs); err != nil {
+		return nil, err
+	}
+
+	if o.sample == "" {
+		return nil, errors.New("missing --sample")
+	}
+	if *signal != "" {
+		s, ok := signals[strings.ToLower(*signal)]
+		if !ok {
+			return nil, fmt.Errorf("invalid --signal %q. One of: trace, metric, log", *signal)
+		}
+		o.signal = s
+	}
+	if o.output != textOutput && o.output != jsonOutput && o.output != htmlOutput {
+		return nil, fmt.Errorf("invalid --output %q. One of: text, json, html", o.output)
+	}
+	if o.root == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		if o.root, err = recipes.FindRoot(cwd); err != nil {
+			return nil, fmt.Errorf("%w. Set the repository with --root", err)
+		}
+	}
+	return o, nil
+}
+
+func printResult(w io.Writer, output string, sr *report.Sample) error {
+	if output != textOutput {
+		rep := &report.Report{}
+		rep.Add(sr)
+		if output == htmlOutput {
+			return rep.WriteHTML(w)
+		}
+		return rep.WriteJSON(w)
+	}
+
+	fmt.Fprintf(w, "\n%s (%s)\n", sr.Recipe, sr.Path)
+	failed := 0
+	for _, a := range sr.Assertions {
+		mark := "ok  "
+		if !a.Passed {
+			mark = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "  %s %s\n", mark, a.Name)
+	}
+	_, err := fmt.Fprintf(w, "%s: %d assertions, %d failed in %.1fs\n", strings.ToUpper(sr.Status), len(sr.Assertions), failed, sr.Duration)
+	return err
+}
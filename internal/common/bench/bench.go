@@ -0,0 +1,276 @@
+// Package bench measures the overhead of the instrumentation of a sample: it drives a fixed
+// request load against the sample API and records the latencies and the CPU time the sample
+// container consumed, so runs with and without instrumentation can be compared.
+package bench // import "github.com/joaopgrassi/otel-recipes/internal/common/bench"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRequests    int           = 1000
+	defaultConcurrency int           = 10
+	requestTimeout     time.Duration = 10 * time.Second
+)
+
+// The load to drive against the sample
+type Load struct {
+	// The address of the endpoint, e.g. http://localhost:8080/hello
+	Url string
+	// The number of measured requests. Defaults to 1000
+	Requests int
+	// The number of requests in flight at once. Defaults to 10
+	Concurrency int
+	// Requests sent before measuring, e.g. for the JIT and the connection pools. Not part of the results
+	Warmup int
+}
+
+// The outcome of a run of the load
+type Result struct {
+	Requests int `json:"requests"`
+	// Requests that failed or answered with a status of 400 or higher
+	Errors     int     `json:"errors"`
+	Duration   float64 `json:"durationSeconds"`
+	Rps        float64 `json:"requestsPerSecond"`
+	Latency    Latency `json:"latencyMs"`
+	CpuSeconds float64 `json:"cpuSeconds"`
+	// The CPU time per request, in milliseconds
+	CpuPerRequest float64 `json:"cpuMsPerRequest"`
+}
+
+// Latency percentiles, in milliseconds
+type Latency struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// Sends the requests of the load and measures them. If container is set, the CPU time it consumed
+// while the measured requests ran is recorded too
+func Run(ctx context.Context, load Load, container string) (*Result, error) {
+	if load.Requests <= 0 {
+		load.Requests = defaultRequests
+	}
+	if load.Concurrency <= 0 {
+		load.Concurrency = defaultConcurrency
+	}
+	client := &http.Client{
+		Timeout:   requestTimeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: load.Concurrency},
+	}
+
+	if _, _, err := drive(ctx, client, load.Url, load.Warmup, load.Concurrency); err != nil {
+		return nil, err
+	}
+
+	var cpuBefore time.Duration
+	if container != "" {
+		var err error
+		if cpuBefore, err = ContainerCpuUsage(ctx, container); err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	latencies, errors, err := drive(ctx, client, load.Url, load.Requests, load.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+
+	res := &Result{
+		Requests: load.Requests,
+		Errors:   errors,
+		Duration: elapsed.Seconds(),
+		Rps:      float64(load.Requests) / elapsed.Seconds(),
+		Latency:  summarize(latencies),
+	}
+	if container != "" {
+		cpuAfter, err := ContainerCpuUsage(ctx, container)
+		if err != nil {
+			return nil, err
+		}
+		res.CpuSeconds = (cpuAfter - cpuBefore).Seconds()
+		res.CpuPerRequest = float64((cpuAfter - cpuBefore).Microseconds()) / 1000 / float64(load.Requests)
+	}
+	return res, nil
+}
+
+// The overhead of the instrumentation, i.e. the instrumented run minus the uninstrumented one.
+// The relative deltas are in percent of the uninstrumented values
+type Overhead struct {
+	LatencyP50Ms      float64 `json:"latencyP50Ms"`
+	LatencyP99Ms      float64 `json:"latencyP99Ms"`
+	LatencyP50Percent float64 `json:"latencyP50Percent"`
+	LatencyP99Percent float64 `json:"latencyP99Percent"`
+	CpuMsPerRequest   float64 `json:"cpuMsPerRequest"`
+	CpuPercent        float64 `json:"cpuPercent"`
+}
+
+// Compares a run of the instrumented sample with one of the sample without instrumentation
+func Compare(instrumented, uninstrumented *Result) Overhead {
+	percent := func(with, without float64) float64 {
+		if without == 0 {
+			return 0
+		}
+		return (with - without) / without * 100
+	}
+	return Overhead{
+		LatencyP50Ms:      instrumented.Latency.P50 - uninstrumented.Latency.P50,
+		LatencyP99Ms:      instrumented.Latency.P99 - uninstrumented.Latency.P99,
+		LatencyP50Percent: percent(instrumented.Latency.P50, uninstrumented.Latency.P50),
+		LatencyP99Percent: percent(instrumented.Latency.P99, uninstrumented.Latency.P99),
+		CpuMsPerRequest:   instrumented.CpuPerRequest - uninstrumented.CpuPerRequest,
+		CpuPercent:        percent(instrumented.CpuPerRequest, uninstrumented.CpuPerRequest),
+	}
+}
+
+// Sends n requests from concurrency workers. Returns the latency of each request and how many failed
+func drive(ctx context.Context, client *http.Client, url string, n, concurrency int) ([]time.Duration, int, error) {
+	if n <= 0 {
+		return nil, 0, nil
+	}
+	if _, err := http.NewRequest(http.MethodGet, url, nil); err != nil {
+		return nil, 0, fmt.Errorf("invalid url %s: %w", url, err)
+	}
+
+	jobs := make(chan struct{})
+	latencies := make([]time.Duration, 0, n)
+	errors := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				start := time.Now()
+				err := get(ctx, client, url)
+				d := time.Since(start)
+
+				mu.Lock()
+				latencies = append(latencies, d)
+				if err != nil {
+					errors++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- struct{}{}:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return latencies, errors, err
+}
+
+func get(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	// drain the body, so the connection is reused
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("status code %d", res.StatusCode)
+	}
+	return nil
+}
+
+func summarize(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sorted := slices.Clone(latencies)
+	slices.Sort(sorted)
+
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+	percentile := func(p float64) float64 {
+		i := int(float64(len(sorted)-1) * p)
+		return ms(sorted[i])
+	}
+	return Latency{
+		Mean: ms(total / time.Duration(len(sorted))),
+		P50:  percentile(0.5),
+		P90:  percentile(0.9),
+		P99:  percentile(0.99),
+		Max:  ms(sorted[len(sorted)-1]),
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Returns the CPU time the container consumed since it started, read from the docker engine API.
+// The engine is reached at the unix socket of DOCKER_HOST, or /var/run/docker.sock
+func ContainerCpuUsage(ctx context.Context, container string) (time.Duration, error) {
+	socket := "/var/run/docker.sock"
+	if host := os.Getenv("DOCKER_HOST"); strings.HasPrefix(host, "unix://") {
+		socket = strings.TrimPrefix(host, "unix://")
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/"+container+"/stats?stream=false&one-shot=true", nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed reading the stats of container %s: %w", container, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return 0, fmt.Errorf("failed reading the stats of container %s: status code %d: %s", container, res.StatusCode, body)
+	}
+
+	var stats struct {
+		CpuStats struct {
+			CpuUsage struct {
+				// in nanoseconds
+				TotalUsage uint64 `json:"total_usage"`
+			} `json:"cpu_usage"`
+		} `json:"cpu_stats"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		return 0, fmt.Errorf("invalid stats of container %s: %w", container, err)
+	}
+	return time.Duration(stats.CpuStats.CpuUsage.TotalUsage), nil
+}
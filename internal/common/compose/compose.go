@@ -0,0 +1,362 @@
+// Package compose manages the docker compose stack of a recipe (the sample, the collector
+// and the back-ends) from the Go tests, so no shell orchestration is needed before go test runs.
+// It drives the docker compose CLI, which must be installed.
+package compose // import "github.com/joaopgrassi/otel-recipes/internal/common/compose"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/runner"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultFile string = "docker-compose.yml"
+	// Time allowed to start the stack in Up. Building the sample images can take a while
+	defaultStartTimeout time.Duration = 10 * time.Minute
+	pollInterval        time.Duration = time.Second
+)
+
+// A docker compose stack, usually the one in the folder of a recipe
+type Stack struct {
+	dir     string
+	project string
+	files   []string
+	env     []string
+	command []string
+
+	dynamicPorts []string
+	ports        map[string]int
+	// The environment variables set on the containers of the services, written to an override file on Start
+	serviceEnv map[string][]string
+	// The extra hosts of the containers of the services, e.g. host.docker.internal:host-gateway
+	serviceHosts map[string][]string
+	override     string
+}
+
+type Option func(*Stack)
+
+// Sets the compose project name. Defaults to a name derived from the recipe path,
+// e.g. go-traces-console, so the stacks of recipes in folders with the same name don't clash
+func WithProjectName(name string) Option {
+	return func(s *Stack) { s.project = name }
+}
+
+// Sets the compose files, relative to the stack folder. Defaults to docker-compose.yml
+func WithFiles(files ...string) Option {
+	return func(s *Stack) { s.files = files }
+}
+
+// Adds environment variables used for the variable substitution in the compose files, e.g. OTELCOL_ARGS=...
+func WithEnv(env ...string) Option {
+	return func(s *Stack) { s.env = append(s.env, env...) }
+}
+
+// Sets environment variables on the container of the service, e.g. OTEL_SERVICE_NAME=... on the sample, overriding
+// the ones of the compose files. They are set via an override compose file, so the compose files don't need to
+// reference them
+func WithServiceEnv(service string, env ...string) Option {
+	return func(s *Stack) {
+		if s.serviceEnv == nil {
+			s.serviceEnv = make(map[string][]string)
+		}
+		s.serviceEnv[service] = append(s.serviceEnv[service], env...)
+	}
+}
+
+// Adds hosts to the /etc/hosts of the container of the service, e.g. host.docker.internal:host-gateway for the
+// sample to export to an OTLP sink of the test on Linux. They are set via the override file of WithServiceEnv
+func WithExtraHosts(service string, hosts ...string) Option {
+	return func(s *Stack) {
+		if s.serviceHosts == nil {
+			s.serviceHosts = make(map[string][]string)
+		}
+		s.serviceHosts[service] = append(s.serviceHosts[service], hosts...)
+	}
+}
+
+// Sets the variables to free ports of the host when the stack starts, for the ports published in the compose
+// files, e.g. "${SAMPLE_PORT:-8080}:8080", so the stacks of several recipes can run side by side. The ports
+// are then given by Port
+func WithDynamicPorts(vars ...string) Option {
+	return func(s *Stack) { s.dynamicPorts = append(s.dynamicPorts, vars...) }
+}
+
+// Sets the CLI used to run compose. Defaults to "docker compose"
+func WithCommand(command ...string) Option {
+	return func(s *Stack) { s.command = command }
+}
+
+func New(dir string, opts ...Option) *Stack {
+	s := &Stack{
+		dir:     dir,
+		project: projectName(dir),
+		files:   []string{defaultFile},
+		command: []string{"docker", "compose"},
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Starts the stack of the recipe in dir, waits until its services are up and tears it down once
+// the test and its subtests complete. Meant to be called at the start of a test or from a TestMain:
+//
+//	compose.Up(t, "..")
+func Up(t tu.TestingT, dir string, opts ...Option) *Stack {
+	s := New(dir, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultStartTimeout)
+	defer cancel()
+
+	tu.Logger(t).Info("Starting the compose stack", "project", s.project, "dir", s.dir)
+	t.Cleanup(func() {
+		if err := s.Down(context.Background()); err != nil {
+			t.Errorf("Failed tearing down the compose stack %s: %v", s.project, err)
+		}
+	})
+
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("Failed starting the compose stack %s: %v", s.project, err)
+	}
+	tu.AddArtifact(t, "compose/"+s.project+".log", func() ([]byte, error) {
+		logs, err := s.Logs(context.Background())
+		return []byte(logs), err
+	})
+	if err := s.WaitHealthy(ctx); err != nil {
+		t.Fatalf("The compose stack %s did not become healthy: %v", s.project, err)
+	}
+	return s
+}
+
+// Builds the images and starts all the services in the background
+func (s *Stack) Start(ctx context.Context) error {
+	if len(s.dynamicPorts) > 0 && s.ports == nil {
+		free, err := runner.FreePorts(len(s.dynamicPorts))
+		if err != nil {
+			return fmt.Errorf("failed allocating the ports of the stack: %w", err)
+		}
+		s.ports = make(map[string]int, len(free))
+		for i, name := range s.dynamicPorts {
+			s.ports[name] = free[i]
+			s.env = append(s.env, fmt.Sprintf("%s=%d", name, free[i]))
+		}
+	}
+	if len(s.serviceEnv)+len(s.serviceHosts) > 0 && s.override == "" {
+		override, err := writeOverride(s.serviceEnv, s.serviceHosts)
+		if err != nil {
+			return err
+		}
+		s.override = override
+	}
+	_, err := s.run(ctx, "up", "--detach", "--build")
+	return err
+}
+
+// Writes a compose file setting the environment variables and the extra hosts of the services, merged with the
+// ones of the stack
+func writeOverride(serviceEnv, serviceHosts map[string][]string) (string, error) {
+	services := make(map[string]map[string]any, len(serviceEnv))
+	service := func(name string) map[string]any {
+		if services[name] == nil {
+			services[name] = make(map[string]any)
+		}
+		return services[name]
+	}
+	for name, env := range serviceEnv {
+		vars := make(map[string]string, len(env))
+		for _, e := range env {
+			k, v, _ := strings.Cut(e, "=")
+			vars[k] = v
+		}
+		service(name)["environment"] = vars
+	}
+	for name, hosts := range serviceHosts {
+		service(name)["extra_hosts"] = hosts
+	}
+	data, err := yaml.Marshal(map[string]any{"services": services})
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "compose-override-*.yml")
+	if err != nil {
+		return "", fmt.Errorf("failed writing the compose override file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return "", fmt.Errorf("failed writing the compose override file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// Returns the host port allocated to the variable of WithDynamicPorts, or 0 before the stack started
+func (s *Stack) Port(name string) int {
+	return s.ports[name]
+}
+
+// Stops and removes the containers, networks and volumes of the stack
+func (s *Stack) Down(ctx context.Context) error {
+	_, err := s.run(ctx, "down", "--volumes", "--remove-orphans")
+	if s.override != "" && err == nil {
+		os.Remove(s.override)
+		s.override = ""
+	}
+	return err
+}
+
+// Returns the logs of the given services, or of all of them
+func (s *Stack) Logs(ctx context.Context, services ...string) (string, error) {
+	return s.run(ctx, append([]string{"logs", "--no-color"}, services...)...)
+}
+
+// Returns the id of the container of the service, e.g. to read its stats
+func (s *Stack) ContainerID(ctx context.Context, service string) (string, error) {
+	out, err := s.run(ctx, "ps", "--quiet", service)
+	if err != nil {
+		return "", err
+	}
+	id, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	if id == "" {
+		return "", fmt.Errorf("service %s has no container", service)
+	}
+	return id, nil
+}
+
+// The state of a container as reported by docker compose ps
+type ServiceState struct {
+	Service string `json:"Service"`
+	// e.g. running, exited
+	State string `json:"State"`
+	// healthy, unhealthy, starting or empty if the service has no health check
+	Health   string `json:"Health"`
+	ExitCode int    `json:"ExitCode"`
+}
+
+// A service is ready when it runs and its health check, if any, passes. Services that
+// exited successfully are ready too, e.g. console samples exporting their telemetry once
+func (st ServiceState) ready() (bool, error) {
+	switch st.State {
+	case "running":
+		if st.Health == "unhealthy" {
+			return false, fmt.Errorf("service %s is unhealthy", st.Service)
+		}
+		return st.Health == "" || st.Health == "healthy", nil
+	case "exited":
+		if st.ExitCode != 0 {
+			return false, fmt.Errorf("service %s exited with code %d", st.Service, st.ExitCode)
+		}
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// Returns the state of the containers of the stack
+func (s *Stack) Ps(ctx context.Context) ([]ServiceState, error) {
+	out, err := s.run(ctx, "ps", "--all", "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	return parsePs([]byte(out))
+}
+
+// Older compose versions print a JSON array, newer ones a JSON object per line
+func parsePs(out []byte) ([]ServiceState, error) {
+	out = bytes.TrimSpace(out)
+	var states []ServiceState
+	if bytes.HasPrefix(out, []byte("[")) {
+		err := json.Unmarshal(out, &states)
+		return states, err
+	}
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var st ServiceState
+		if err := json.Unmarshal(line, &st); err != nil {
+			return nil, fmt.Errorf("invalid docker compose ps output: %w", err)
+		}
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+// Waits until all the services of the stack are ready, or the context is done
+func (s *Stack) WaitHealthy(ctx context.Context) error {
+	for {
+		states, err := s.Ps(ctx)
+		if err != nil {
+			return err
+		}
+
+		ready := len(states) > 0
+		for _, st := range states {
+			ok, err := st.ready()
+			if err != nil {
+				return err
+			}
+			ready = ready && ok
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("services not ready: %w", ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (s *Stack) run(ctx context.Context, args ...string) (string, error) {
+	cmdArgs := append([]string{}, s.command[1:]...)
+	cmdArgs = append(cmdArgs, "--project-name", s.project)
+	for _, f := range s.files {
+		cmdArgs = append(cmdArgs, "--file", f)
+	}
+	if s.override != "" {
+		cmdArgs = append(cmdArgs, "--file", s.override)
+	}
+	cmdArgs = append(cmdArgs, args...)
+
+	cmd := exec.CommandContext(ctx, s.command[0], cmdArgs...)
+	cmd.Dir = s.dir
+	cmd.Env = append(os.Environ(), s.env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", s.command[0], strings.Join(cmdArgs, " "), err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+var invalidProjectChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// Derives the project name from the last folders of the recipe path, e.g. src/go/traces/console -> go-traces-console
+func projectName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+
+	parts := strings.Split(filepath.ToSlash(abs), "/")
+	if len(parts) > 3 {
+		parts = parts[len(parts)-3:]
+	}
+	name := invalidProjectChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-")
+	return strings.Trim(name, "-_")
+}
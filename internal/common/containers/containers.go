@@ -0,0 +1,149 @@
+// Package containers starts the back-ends and the collector used by the recipe tests as docker
+// containers with dynamic host ports, so the tests don't depend on infrastructure already running
+// on fixed localhost ports. It drives the docker CLI, which must be installed.
+package containers // import "github.com/joaopgrassi/otel-recipes/internal/common/containers"
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/dockerlogs"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+// A container to run. Ports are published on random host ports
+type Request struct {
+	Image string
+	// The network to attach the container to, and the names it can be reached by in it
+	Network string
+	Aliases []string
+	Env     []string
+	// The container ports to publish, e.g. 4319/tcp
+	Ports []string
+	// Bind mounts in the host:container format, optionally with :ro. The host path can be a Windows one, e.g. C:\certs:/certs
+	Mounts []string
+	Cmd    []string
+}
+
+type Container struct {
+	id    string
+	ports map[string]string
+}
+
+// Starts a container in the background and resolves the host addresses of its published ports
+func Run(ctx context.Context, req Request) (*Container, error) {
+	args := append([]string{"run", "--detach"}, platformArgs()...)
+	if req.Network != "" {
+		args = append(args, "--network", req.Network)
+		for _, a := range req.Aliases {
+			args = append(args, "--network-alias", a)
+		}
+	}
+	for _, e := range req.Env {
+		args = append(args, "--env", e)
+	}
+	for _, p := range req.Ports {
+		args = append(args, "--publish", publishArg(p))
+	}
+	for _, m := range req.Mounts {
+		mount, err := mountArg(m)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--mount", mount)
+	}
+	args = append(args, req.Image)
+	args = append(args, req.Cmd...)
+
+	out, err := docker(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Container{id: strings.TrimSpace(out), ports: make(map[string]string)}
+	for _, p := range req.Ports {
+		addr, err := c.hostAddr(ctx, p)
+		if err != nil {
+			_ = c.Stop(ctx)
+			return nil, err
+		}
+		c.ports[p] = addr
+	}
+	return c, nil
+}
+
+func (c *Container) ID() string {
+	return c.id
+}
+
+// Returns the host address a published port can be reached at, e.g. 127.0.0.1:49153 for 4319/tcp, or the
+// address of the DOCKER_HOST for a remote daemon
+func (c *Container) Addr(port string) string {
+	return c.ports[port]
+}
+
+// The values the resource detectors of a sample running in the container are expected to find
+func (c *Container) DetectedResource(ctx context.Context) (*tu.DetectedResource, error) {
+	return InspectDetectedResource(ctx, c.id)
+}
+
+// Same as Container.DetectedResource for a container not started by this package, e.g. the sample
+// container of a compose file by its name
+func InspectDetectedResource(ctx context.Context, container string) (*tu.DetectedResource, error) {
+	out, err := docker(ctx, "inspect", "--format", "{{.Id}} {{.Config.Hostname}}", container)
+	if err != nil {
+		return nil, err
+	}
+	id, hostname, _ := strings.Cut(strings.TrimSpace(out), " ")
+	return &tu.DetectedResource{HostName: hostname, ContainerID: id}, nil
+}
+
+// Removes the container, stopping it if needed
+func (c *Container) Stop(ctx context.Context) error {
+	_, err := docker(ctx, "rm", "--force", "--volumes", c.id)
+	return err
+}
+
+// The logs printed so far by the container, its stdout and stderr interleaved
+func (c *Container) Logs(ctx context.Context) (string, error) {
+	return dockerlogs.Logs(ctx, c.id)
+}
+
+func (c *Container) hostAddr(ctx context.Context, port string) (string, error) {
+	out, err := docker(ctx, "port", c.id, port)
+	if err != nil {
+		return "", err
+	}
+	// one line per host IP the port is bound to, e.g. 127.0.0.1:49153
+	addr, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	if addr == "" {
+		return "", fmt.Errorf("port %s of container %s is not published", port, c.id)
+	}
+	return reachableAddr(addr), nil
+}
+
+// Creates a bridge network the containers can reach each other in by their aliases
+func CreateNetwork(ctx context.Context, name string) error {
+	_, err := docker(ctx, "network", "create", name)
+	return err
+}
+
+func RemoveNetwork(ctx context.Context, name string) error {
+	_, err := docker(ctx, "network", "rm", name)
+	return err
+}
+
+func docker(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,363 @@
+package containers // import "github.com/joaopgrassi/otel-recipes/internal/common/containers"
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	"github.com/joaopgrassi/otel-recipes/internal/common/waitfor"
+)
+
+// The images used by the compose files of the recipes
+const (
+	OtlpBackendImage string = "ghcr.io/joaopgrassi/otel-recipes/otlp-backend:latest"
+	CollectorImage   string = "otel/opentelemetry-collector-contrib:0.99.0"
+	JaegerImage      string = "jaegertracing/all-in-one:1.57"
+	KafkaImage       string = "apache/kafka:3.7.0"
+)
+
+const (
+	otlpBackendPort    string        = "4319/tcp"
+	otlpGrpcPort       string        = "4317/tcp"
+	otlpHttpPort       string        = "4318/tcp"
+	jaegerQueryPort    string        = "16686/tcp"
+	jaegerGrpcPort     string        = "16685/tcp"
+	healthCheckPort    string        = "13133/tcp"
+	defaultStartupTime time.Duration = 2 * time.Minute
+)
+
+// The folder the certificates of WithTLS are mounted at in the collector, e.g. /etc/otel-certs/server.crt
+const CertsDir string = "/etc/otel-certs"
+
+// The containers started by StartInfra
+type Infra struct {
+	Network     string
+	OtlpBackend *Container
+	Collector   *Container
+	// Only set when started with WithJaeger
+	Jaeger *Container
+	// Only set when started with WithKafka
+	Kafka          *Container
+	KafkaCollector *Container
+	// Only set when started with WithGateway
+	Gateway *Container
+	// Only set when started with WithTLS or WithMutualTLS
+	Certs *tu.Certs
+
+	mtls bool
+}
+
+type infraOptions struct {
+	collectorConfig string
+	jaeger          bool
+	kafkaConfig     string
+	gatewayConfig   string
+	certs           *tu.Certs
+	mtls            bool
+}
+
+type Option func(*infraOptions)
+
+// Sets the collector configuration. Defaults to the collector-config.yaml of the recipe, i.e. ../collector-config.yaml
+// from the recipe test module. The containers keep the names used in the compose files, so the exporters of
+// the configuration can keep using e.g. http://otlp-backend:4319
+func WithCollectorConfig(path string) Option {
+	return func(o *infraOptions) { o.collectorConfig = path }
+}
+
+// Also starts Jaeger all-in-one, reachable from the collector at jaeger:4317
+func WithJaeger() Option {
+	return func(o *infraOptions) { o.jaeger = true }
+}
+
+// Also starts a single node Kafka, reachable at kafka:9092, and a second collector with the given configuration,
+// reachable at collector-kafka. The collector of the recipe then exports to Kafka, e.g. via the kafka exporter,
+// and the second collector consumes the topic and exports to the back-ends. Its configuration must enable
+// the health_check extension, which is used to know when it is ready
+func WithKafka(consumerConfig string) Option {
+	return func(o *infraOptions) { o.kafkaConfig = consumerConfig }
+}
+
+// Also starts a gateway collector with the given configuration, reachable at collector-gateway. The collector
+// of the recipe is then the agent, exporting to the gateway, e.g. to http://collector-gateway:4318, which exports
+// to the back-ends. Its configuration must enable the health_check extension, which is used to know when it is ready
+func WithGateway(config string) Option {
+	return func(o *infraOptions) { o.gatewayConfig = config }
+}
+
+// Mounts the certificates in the collector at CertsDir, for a collector configuration whose receivers only
+// accept TLS. The endpoints of the collector on the host are then https. The configuration must enable
+// the health_check extension, which is used to know when the collector is ready
+func WithTLS(certs *tu.Certs) Option {
+	return func(o *infraOptions) { o.certs = certs }
+}
+
+// Same as WithTLS, for a collector configuration also requiring the client certificate, i.e. mTLS
+func WithMutualTLS(certs *tu.Certs) Option {
+	return func(o *infraOptions) { o.certs, o.mtls = certs, true }
+}
+
+// Starts the OTLP back-end and the collector (and optionally Jaeger) in a new network, waits until they
+// are ready and removes them once the test completes. The test then uses the back-ends via UseConfig.
+// The sample app exports to the collector via OtlpGrpcEndpoint or OtlpHttpEndpoint.
+func StartInfra(t *testing.T, opts ...Option) *Infra {
+	o := &infraOptions{collectorConfig: filepath.Join("..", "collector-config.yaml")}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultStartupTime)
+	defer cancel()
+
+	infra := &Infra{Network: "otel-recipes-" + randomSuffix()}
+	if err := CreateNetwork(ctx, infra.Network); err != nil {
+		t.Fatalf("Failed creating the docker network: %v", err)
+	}
+	t.Cleanup(func() { infra.stop(t) })
+
+	var err error
+	infra.OtlpBackend, err = Run(ctx, Request{
+		Image:   OtlpBackendImage,
+		Network: infra.Network,
+		Aliases: []string{"otlp-backend"},
+		Ports:   []string{otlpBackendPort},
+	})
+	if err != nil {
+		t.Fatalf("Failed starting the OTLP back-end: %v", err)
+	}
+
+	if o.jaeger {
+		infra.Jaeger, err = Run(ctx, Request{
+			Image:   JaegerImage,
+			Network: infra.Network,
+			Aliases: []string{"jaeger"},
+			Env:     []string{"COLLECTOR_OTLP_ENABLED=true"},
+			Ports:   []string{jaegerQueryPort, jaegerGrpcPort},
+		})
+		if err != nil {
+			t.Fatalf("Failed starting Jaeger: %v", err)
+		}
+	}
+
+	// the kafka exporter fails to start if the broker is not reachable, so it is started before the collectors
+	if o.kafkaConfig != "" {
+		infra.startKafka(ctx, t, o.kafkaConfig)
+	}
+
+	// the agent can then export as soon as it starts
+	if o.gatewayConfig != "" {
+		infra.startGateway(ctx, t, o.gatewayConfig)
+	}
+
+	config, err := filepath.Abs(o.collectorConfig)
+	if err != nil {
+		t.Fatalf("Invalid collector configuration path: %v", err)
+	}
+	collector := Request{
+		Image:   CollectorImage,
+		Network: infra.Network,
+		Aliases: []string{"collector-otel-recipes"},
+		Ports:   []string{otlpGrpcPort, otlpHttpPort},
+		Mounts:  []string{config + ":/etc/collector-config.yaml"},
+		Cmd:     []string{"--config=/etc/collector-config.yaml"},
+	}
+	if o.certs != nil {
+		infra.Certs, infra.mtls = o.certs, o.mtls
+		collector.Ports = append(collector.Ports, healthCheckPort)
+		collector.Mounts = append(collector.Mounts, o.certs.Dir+":"+CertsDir+":ro")
+	}
+	infra.Collector, err = Run(ctx, collector)
+	if err != nil {
+		t.Fatalf("Failed starting the collector: %v", err)
+	}
+	infra.addArtifacts(t)
+
+	if err := waitfor.WaitForHTTP(ctx, "http://"+infra.OtlpBackend.Addr(otlpBackendPort)+"/getotlp"); err != nil {
+		t.Fatalf("The OTLP back-end did not become ready: %v", err)
+	}
+	// the receivers of a TLS collector can't be probed without the certificates, so its health check is
+	collectorReady := infra.OtlpHttpEndpoint() + "/v1/traces"
+	if infra.Certs != nil {
+		collectorReady = "http://" + infra.Collector.Addr(healthCheckPort)
+	}
+	if err := waitfor.WaitForHTTP(ctx, collectorReady); err != nil {
+		t.Fatalf("The collector did not become ready: %v", err)
+	}
+	if infra.Jaeger != nil {
+		if err := waitfor.WaitForHTTP(ctx, infra.JaegerQueryUrl()); err != nil {
+			t.Fatalf("Jaeger did not become ready: %v", err)
+		}
+	}
+
+	c := *tu.GetConfig()
+	c.OtlpBackendUrl = "http://" + infra.OtlpBackend.Addr(otlpBackendPort)
+	if infra.Jaeger != nil {
+		c.JaegerUrl = infra.JaegerQueryUrl()
+		c.JaegerGrpcUrl = infra.Jaeger.Addr(jaegerGrpcPort)
+	}
+	// the scenarios of the tail sampling tests are sent in plaintext
+	if infra.Certs == nil {
+		c.CollectorUrl = infra.OtlpHttpEndpoint()
+	}
+	tu.UseConfig(t, &c)
+
+	return infra
+}
+
+// The OTLP gRPC endpoint of the collector on the host, e.g. for OTEL_EXPORTER_OTLP_ENDPOINT
+func (i *Infra) OtlpGrpcEndpoint() string {
+	return i.scheme() + i.Collector.Addr(otlpGrpcPort)
+}
+
+func (i *Infra) OtlpHttpEndpoint() string {
+	return i.scheme() + i.Collector.Addr(otlpHttpPort)
+}
+
+func (i *Infra) scheme() string {
+	if i.Certs != nil {
+		return "https://"
+	}
+	return "http://"
+}
+
+// Asserts both OTLP receivers of the collector only accept TLS, and with WithMutualTLS only from clients
+// presenting the client certificate, so the sample can't have exported in plaintext. See tu.AssertTLSEndpoint
+func (i *Infra) AssertTLSOnly(t *testing.T) {
+	t.Helper()
+	if i.Certs == nil {
+		t.Fatal("The collector was not started with WithTLS or WithMutualTLS")
+	}
+	for _, port := range []string{otlpGrpcPort, otlpHttpPort} {
+		tu.AssertTLSEndpoint(t, i.Collector.Addr(port), i.Certs, i.mtls)
+	}
+}
+
+// The address of the Jaeger UI and query API, or empty if Jaeger was not started
+func (i *Infra) JaegerQueryUrl() string {
+	if i.Jaeger == nil {
+		return ""
+	}
+	return "http://" + i.Jaeger.Addr(jaegerQueryPort)
+}
+
+// Adds the logs of the containers to the artifacts of the test, see tu.AddArtifact
+func (i *Infra) addArtifacts(t *testing.T) {
+	for name, c := range map[string]*Container{
+		"otlp-backend":    i.OtlpBackend,
+		"collector":       i.Collector,
+		"jaeger":          i.Jaeger,
+		"kafka":           i.Kafka,
+		"kafka-collector": i.KafkaCollector,
+		"gateway":         i.Gateway,
+	} {
+		if c == nil {
+			continue
+		}
+		tu.AddArtifact(t, "containers/"+name+".log", func() ([]byte, error) {
+			logs, err := c.Logs(context.Background())
+			return []byte(logs), err
+		})
+	}
+}
+
+func (i *Infra) stop(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []*Container{i.Collector, i.Gateway, i.KafkaCollector, i.Kafka, i.Jaeger, i.OtlpBackend} {
+		if c == nil {
+			continue
+		}
+		if t.Failed() {
+			if logs, err := c.Logs(ctx); err == nil {
+				t.Logf("Logs of container %s:\n%s", c.ID(), logs)
+			}
+		}
+		if err := c.Stop(ctx); err != nil {
+			t.Errorf("Failed removing container %s: %v", c.ID(), err)
+		}
+	}
+	if err := RemoveNetwork(ctx, i.Network); err != nil {
+		t.Errorf("Failed removing the docker network %s: %v", i.Network, err)
+	}
+}
+
+func (i *Infra) startKafka(ctx context.Context, t *testing.T, consumerConfig string) {
+	var err error
+	i.Kafka, err = Run(ctx, Request{
+		Image:   KafkaImage,
+		Network: i.Network,
+		Aliases: []string{"kafka"},
+		Env: []string{
+			"KAFKA_NODE_ID=1",
+			"KAFKA_PROCESS_ROLES=broker,controller",
+			"KAFKA_LISTENERS=PLAINTEXT://:9092,CONTROLLER://:9093",
+			"KAFKA_ADVERTISED_LISTENERS=PLAINTEXT://kafka:9092",
+			"KAFKA_CONTROLLER_LISTENER_NAMES=CONTROLLER",
+			"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP=CONTROLLER:PLAINTEXT,PLAINTEXT:PLAINTEXT",
+			"KAFKA_CONTROLLER_QUORUM_VOTERS=1@localhost:9093",
+			"KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR=1",
+			"KAFKA_TRANSACTION_STATE_LOG_REPLICATION_FACTOR=1",
+			"KAFKA_TRANSACTION_STATE_LOG_MIN_ISR=1",
+			"KAFKA_GROUP_INITIAL_REBALANCE_DELAY_MS=0",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed starting Kafka: %v", err)
+	}
+	// the broker is only reachable inside the network, as it advertises kafka:9092
+	if err := waitfor.WaitForContainerLogLine(ctx, i.Kafka.ID(), "Kafka Server started"); err != nil {
+		t.Fatalf("Kafka did not become ready: %v", err)
+	}
+
+	config, err := filepath.Abs(consumerConfig)
+	if err != nil {
+		t.Fatalf("Invalid Kafka collector configuration path: %v", err)
+	}
+	i.KafkaCollector, err = Run(ctx, Request{
+		Image:   CollectorImage,
+		Network: i.Network,
+		Aliases: []string{"collector-kafka"},
+		Ports:   []string{healthCheckPort},
+		Mounts:  []string{config + ":/etc/collector-config.yaml"},
+		Cmd:     []string{"--config=/etc/collector-config.yaml"},
+	})
+	if err != nil {
+		t.Fatalf("Failed starting the Kafka collector: %v", err)
+	}
+	if err := waitfor.WaitForHTTP(ctx, "http://"+i.KafkaCollector.Addr(healthCheckPort)); err != nil {
+		t.Fatalf("The Kafka collector did not become ready: %v", err)
+	}
+}
+
+func randomSuffix() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprint(time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+func (i *Infra) startGateway(ctx context.Context, t *testing.T, gatewayConfig string) {
+	config, err := filepath.Abs(gatewayConfig)
+	if err != nil {
+		t.Fatalf("Invalid gateway collector configuration path: %v", err)
+	}
+	i.Gateway, err = Run(ctx, Request{
+		Image:   CollectorImage,
+		Network: i.Network,
+		Aliases: []string{"collector-gateway"},
+		Ports:   []string{healthCheckPort},
+		Mounts:  []string{config + ":/etc/collector-config.yaml"},
+		Cmd:     []string{"--config=/etc/collector-config.yaml"},
+	})
+	if err != nil {
+		t.Fatalf("Failed starting the gateway collector: %v", err)
+	}
+	if err := waitfor.WaitForHTTP(ctx, "http://"+i.Gateway.Addr(healthCheckPort)); err != nil {
+		t.Fatalf("The gateway collector did not become ready: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package containers // import "github.com/joaopgrassi/otel-recipes/internal/common/containers"
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"runtime"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+// The name the containers reach the host by, e.g. to export to an OTLP sink or call a sample app running natively
+// in the test. Docker Desktop on macOS and Windows resolves it, on Linux Run maps it to the gateway of the host
+const HostGateway string = "host.docker.internal"
+
+// The docker run arguments making the container work the same on Linux, macOS and Windows
+func platformArgs() []string {
+	if runtime.GOOS == "linux" {
+		return []string{"--add-host", HostGateway + ":host-gateway"}
+	}
+	return nil
+}
+
+// Publishes the container port on a random port of the loopback interface, or of all the interfaces of a remote
+// docker host, as the tests reach it from another machine
+func publishArg(port string) string {
+	if tu.DockerHost() != "localhost" {
+		return port
+	}
+	return "127.0.0.1::" + port
+}
+
+// Resolves the address reported by docker port to the one reachable from the tests, e.g. 0.0.0.0:49153 to
+// 192.168.64.2:49153 for a remote docker host
+func reachableAddr(addr string) string {
+	host := tu.DockerHost()
+	if host == "localhost" {
+		return addr
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// A bind mount in the host:container[:ro] format. The host path may start with a Windows drive, e.g. C:\recipes
+var mountFormat = regexp.MustCompile(`^(.+?):(/[^:]*)(?::(ro|rw))?$`)
+
+// Converts the bind mount to a --mount argument, which unlike --volume doesn't mistake the drive of a
+// Windows path for the separator
+func mountArg(m string) (string, error) {
+	parts := mountFormat.FindStringSubmatch(m)
+	if parts == nil {
+		return "", fmt.Errorf("invalid mount %q, expected host:container[:ro]", m)
+	}
+	arg := "type=bind,source=" + parts[1] + ",target=" + parts[2]
+	if parts[3] == "ro" {
+		arg += ",readonly"
+	}
+	return arg, nil
+}
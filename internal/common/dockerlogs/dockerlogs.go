@@ -0,0 +1,209 @@
+// Package dockerlogs reads the logs of docker containers, e.g. of a sample started by compose, and extracts
+// values from them: the submatches of the lines matching a regular expression, or the JSON objects printed
+// as lines. It drives the docker CLI, which must be installed.
+package dockerlogs // import "github.com/joaopgrassi/otel-recipes/internal/common/dockerlogs"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Returns the logs the container printed so far, its stdout and stderr interleaved. The container is given
+// by its name or id, e.g. the one of compose.Stack.ContainerID
+func Logs(ctx context.Context, container string) (string, error) {
+	cmd := exec.CommandContext(ctx, "docker", "logs", container)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("docker logs %s: %w: %s", container, err, out)
+	}
+	return string(out), nil
+}
+
+// The logs of a container, followed from its start until the container stops or the stream is closed
+type Stream struct {
+	container string
+	cmd       *exec.Cmd
+	cancel    context.CancelFunc
+
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+	// Closed and replaced each time a line is added
+	changed chan struct{}
+	done    chan struct{}
+	err     error
+}
+
+// Starts following the logs of the container. The lines already printed are read first, so no line is
+// missed when the container started before. Close the stream once done
+func Follow(ctx context.Context, container string) (*Stream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream{container: container, cancel: cancel, changed: make(chan struct{}), done: make(chan struct{})}
+	s.cmd = exec.CommandContext(ctx, "docker", "logs", "--follow", container)
+	s.cmd.Stdout = s
+	s.cmd.Stderr = s
+	if err := s.cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("docker logs --follow %s: %w", container, err)
+	}
+	go func() {
+		err := s.cmd.Wait()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if len(s.partial) > 0 {
+			s.addLine(string(s.partial))
+			s.partial = nil
+		}
+		if err != nil && ctx.Err() == nil {
+			s.err = fmt.Errorf("docker logs --follow %s: %w", container, err)
+		}
+		close(s.done)
+	}()
+	return s, nil
+}
+
+func (s *Stream) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partial = append(s.partial, b...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		s.addLine(string(bytes.TrimRight(s.partial[:i], "\r")))
+		s.partial = s.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+func (s *Stream) addLine(line string) {
+	s.lines = append(s.lines, line)
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// The lines read so far
+func (s *Stream) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+func (s *Stream) String() string {
+	lines := s.Lines()
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Same as String, failing if the logs could not be followed. Matches the output of a tu.ConsoleBackend:
+//
+//	tu.SetTraceBackend(tu.NewConsoleBackend(stream.Output))
+func (s *Stream) Output() (string, error) {
+	s.mu.Lock()
+	err := s.err
+	s.mu.Unlock()
+	return s.String(), err
+}
+
+// Waits until a line matches the pattern, e.g. "Now listening on: (.+)", and returns the match and its
+// submatches. Fails if the container stops, or the context is done, before
+func (s *Stream) WaitFor(ctx context.Context, pattern string) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	for checked := 0; ; {
+		s.mu.Lock()
+		for ; checked < len(s.lines); checked++ {
+			if m := re.FindStringSubmatch(s.lines[checked]); m != nil {
+				s.mu.Unlock()
+				return m, nil
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-s.done:
+			// the lines added before the stream ended
+			s.mu.Lock()
+			ended := checked == len(s.lines)
+			err := s.err
+			s.mu.Unlock()
+			if ended {
+				return nil, errors.Join(fmt.Errorf("the logs of %s ended without a line matching %s", s.container, pattern), err)
+			}
+		case <-ctx.Done():
+			return nil, fmt.Errorf("no line of the logs of %s matching %s: %w", s.container, pattern, ctx.Err())
+		}
+	}
+}
+
+// Stops following the logs. The lines read so far are kept
+func (s *Stream) Close() error {
+	s.cancel()
+	<-s.done
+	return s.err
+}
+
+// Returns the match and submatches of each line matching the pattern, e.g. `trace_id=(\w+)`
+func Match(lines []string, pattern string) ([][]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var res [][]string
+	for _, l := range lines {
+		if m := re.FindStringSubmatch(l); m != nil {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// Returns the JSON objects printed as lines, e.g. by structured loggers. The text before the object is
+// skipped, e.g. the prefix of the service in the compose logs. The other lines are ignored
+func JSONObjects(lines []string) []map[string]any {
+	var res []map[string]any
+	for _, l := range lines {
+		i := strings.IndexByte(l, '{')
+		if i < 0 {
+			continue
+		}
+		dec := json.NewDecoder(strings.NewReader(l[i:]))
+		dec.UseNumber()
+		var obj map[string]any
+		if err := dec.Decode(&obj); err == nil && !dec.More() {
+			res = append(res, obj)
+		}
+	}
+	return res
+}
+
+// Decodes the JSON objects printed as lines into values of T, e.g. a struct of the fields of a log. The
+// lines not decoding into T are ignored
+func DecodeJSON[T any](lines []string) []T {
+	var res []T
+	for _, obj := range JSONObjects(lines) {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			continue
+		}
+		var v T
+		if err := json.Unmarshal(data, &v); err == nil {
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -4,13 +4,26 @@ go 1.22.1
 
 require go.opentelemetry.io/proto/otlp v1.2.0
 
-require google.golang.org/protobuf v1.34.0
+require (
+	github.com/prometheus/client_model v0.6.1
+	github.com/prometheus/common v0.53.0
+	google.golang.org/grpc v1.63.0
+	google.golang.org/protobuf v1.34.0
+)
 
-require github.com/google/go-cmp v0.5.8 // indirect
+require (
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.19.1 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240227224415-6ceb2ff114de // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240227224415-6ceb2ff114de // indirect
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.9.0
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
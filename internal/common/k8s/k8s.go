@@ -0,0 +1,310 @@
+// Package k8s runs Kubernetes flavored recipes, e.g. the ones using the OpenTelemetry operator or the
+// k8sattributes processor, in a kind cluster from the Go tests. It deploys the manifests of the recipe,
+// port-forwards the OTLP back-end and points the test utils to it, so the same assertions as for the
+// compose recipes can be used. It drives the kind and kubectl CLIs, which must be installed.
+package k8s // import "github.com/joaopgrassi/otel-recipes/internal/common/k8s"
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+const (
+	defaultManifests string = "k8s"
+	defaultNamespace string = "otel-recipes"
+	defaultBackend   string = "service/otlp-backend"
+	otlpBackendPort  int    = 4319
+	// Time allowed to create the cluster and deploy the recipe in Up. Pulling the images can take a while
+	defaultStartTimeout time.Duration = 10 * time.Minute
+)
+
+// A kind cluster the manifests of a recipe are deployed to
+type Cluster struct {
+	name       string
+	kubeconfig string
+	kindConfig string
+	existing   bool
+	namespace  string
+	manifests  []string
+	images     []string
+	backend    string
+	dir        string
+	forwards   []*exec.Cmd
+}
+
+type Option func(*Cluster)
+
+// Sets the name of the kind cluster. Defaults to a name derived from the recipe path, e.g. go-traces-k8s
+func WithClusterName(name string) Option {
+	return func(c *Cluster) { c.name = name }
+}
+
+// Uses a kind cluster that already exists instead of creating one, e.g. to iterate on a recipe locally.
+// The cluster is kept once the test completes, only the namespace is removed
+func WithExistingCluster(name string) Option {
+	return func(c *Cluster) { c.name, c.existing = name, true }
+}
+
+// Sets the kind configuration the cluster is created with, relative to the recipe folder
+func WithKindConfig(path string) Option {
+	return func(c *Cluster) { c.kindConfig = path }
+}
+
+// Sets the namespace the manifests are applied to, when they don't set one. Defaults to otel-recipes
+func WithNamespace(namespace string) Option {
+	return func(c *Cluster) { c.namespace = namespace }
+}
+
+// Sets the manifest files or folders, relative to the recipe folder, applied in order. Defaults to the k8s folder
+func WithManifests(paths ...string) Option {
+	return func(c *Cluster) { c.manifests = paths }
+}
+
+// Loads images from the local docker daemon into the cluster before applying the manifests, e.g. the images
+// of the sample built with docker build. The manifests must use imagePullPolicy: IfNotPresent or Never for them
+func WithImages(images ...string) Option {
+	return func(c *Cluster) { c.images = append(c.images, images...) }
+}
+
+// Sets the resource of the OTLP back-end to port-forward, e.g. deployment/otlp-backend. Defaults to service/otlp-backend
+func WithBackend(resource string) Option {
+	return func(c *Cluster) { c.backend = resource }
+}
+
+func New(dir string, opts ...Option) *Cluster {
+	c := &Cluster{
+		name:      clusterName(dir),
+		namespace: defaultNamespace,
+		manifests: []string{defaultManifests},
+		backend:   defaultBackend,
+		dir:       dir,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	if !c.existing {
+		// a kubeconfig of its own, so the current context of the user is left untouched
+		c.kubeconfig = filepath.Join(os.TempDir(), "otel-recipes-"+c.name+".kubeconfig")
+	}
+	return c
+}
+
+// Creates the cluster, deploys the recipe in dir and waits until its deployments are available. The OTLP
+// back-end is port-forwarded and used by the test utils, and everything is removed once the test completes:
+//
+//	k8s.Up(t, "..", k8s.WithImages("go-k8s-sample:latest"))
+//	tu.AssertSpecFile(t, tu.DefaultSpecFile)
+func Up(t *testing.T, dir string, opts ...Option) *Cluster {
+	c := New(dir, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultStartTimeout)
+	defer cancel()
+
+	tu.Logger(t).Info("Deploying the recipe to the kind cluster", "dir", c.dir, "cluster", c.name)
+	t.Cleanup(func() {
+		if t.Failed() {
+			if logs, err := c.Logs(context.Background()); err == nil {
+				t.Logf("Logs of the pods in namespace %s:\n%s", c.namespace, logs)
+			}
+		}
+		if err := c.Down(context.Background()); err != nil {
+			t.Errorf("Failed tearing down the kind cluster %s: %v", c.name, err)
+		}
+	})
+
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Failed deploying the recipe to the kind cluster %s: %v", c.name, err)
+	}
+	if err := c.WaitAvailable(ctx); err != nil {
+		t.Fatalf("The recipe did not become available in the kind cluster %s: %v", c.name, err)
+	}
+
+	addr, err := c.PortForward(ctx, c.backend, otlpBackendPort)
+	if err != nil {
+		t.Fatalf("Failed port-forwarding the OTLP back-end: %v", err)
+	}
+	config := *tu.GetConfig()
+	config.OtlpBackendUrl = "http://" + addr
+	tu.UseConfig(t, &config)
+
+	return c
+}
+
+// Creates the cluster unless it exists, loads the images and applies the manifests
+func (c *Cluster) Start(ctx context.Context) error {
+	if !c.existing {
+		args := []string{"create", "cluster", "--name", c.name, "--kubeconfig", c.kubeconfig, "--wait", "2m"}
+		if c.kindConfig != "" {
+			args = append(args, "--config", c.kindConfig)
+		}
+		if _, err := c.kind(ctx, args...); err != nil {
+			return err
+		}
+	}
+	for _, image := range c.images {
+		if _, err := c.kind(ctx, "load", "docker-image", image, "--name", c.name); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.Kubectl(ctx, "create", "namespace", c.namespace); err != nil && !strings.Contains(err.Error(), "AlreadyExists") {
+		return err
+	}
+	for _, m := range c.manifests {
+		if _, err := c.Kubectl(ctx, "apply", "--namespace", c.namespace, "--filename", m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stops the port-forwards and deletes the cluster, or only the namespace of an existing cluster
+func (c *Cluster) Down(ctx context.Context) error {
+	for _, cmd := range c.forwards {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+	c.forwards = nil
+
+	if c.existing {
+		_, err := c.Kubectl(ctx, "delete", "namespace", c.namespace, "--ignore-not-found")
+		return err
+	}
+	_, err := c.kind(ctx, "delete", "cluster", "--name", c.name, "--kubeconfig", c.kubeconfig)
+	_ = os.Remove(c.kubeconfig)
+	return err
+}
+
+// Waits until the deployments of the namespace are available, or the context is done
+func (c *Cluster) WaitAvailable(ctx context.Context) error {
+	out, err := c.Kubectl(ctx, "get", "deployments", "--namespace", c.namespace, "--output", "name")
+	if err != nil || strings.TrimSpace(out) == "" {
+		return err
+	}
+	timeout := defaultStartTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	_, err = c.Kubectl(ctx, "wait", "deployment", "--all", "--namespace", c.namespace,
+		"--for", "condition=Available", "--timeout", timeout.Round(time.Second).String())
+	return err
+}
+
+var forwardingLine = regexp.MustCompile(`Forwarding from 127\.0\.0\.1:(\d+) ->`)
+
+// Forwards a random local port to the port of the resource, e.g. service/otlp-backend, until Down.
+// Returns the local address, e.g. 127.0.0.1:53781
+func (c *Cluster) PortForward(ctx context.Context, resource string, port int) (string, error) {
+	// not bound to ctx, as it must outlive the start of the cluster
+	cmd := exec.Command("kubectl", c.kubectlArgs("port-forward", "--namespace", c.namespace,
+		"--address", "127.0.0.1", resource, fmt.Sprintf(":%d", port))...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	c.forwards = append(c.forwards, cmd)
+
+	found := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if m := forwardingLine.FindStringSubmatch(scanner.Text()); m != nil {
+				found <- "127.0.0.1:" + m[1]
+				break
+			}
+		}
+		// keep reading, so kubectl doesn't block writing to the pipe
+		_, _ = io.Copy(io.Discard, stdout)
+		close(found)
+	}()
+
+	select {
+	case addr, ok := <-found:
+		if !ok {
+			return "", fmt.Errorf("kubectl port-forward %s exited: %s", resource, stderr.String())
+		}
+		return addr, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("port-forwarding %s: %w", resource, ctx.Err())
+	}
+}
+
+// Returns the logs of all the containers of the pods in the namespace
+func (c *Cluster) Logs(ctx context.Context) (string, error) {
+	out, err := c.Kubectl(ctx, "get", "pods", "--namespace", c.namespace, "--output", "name")
+	if err != nil {
+		return "", err
+	}
+	var logs strings.Builder
+	for _, pod := range strings.Fields(out) {
+		l, err := c.Kubectl(ctx, "logs", "--namespace", c.namespace, "--all-containers", "--prefix", pod)
+		if err != nil {
+			l = err.Error()
+		}
+		logs.WriteString(l)
+	}
+	return logs.String(), nil
+}
+
+// Runs kubectl against the cluster, e.g. to check the pods were mutated by the operator
+func (c *Cluster) Kubectl(ctx context.Context, args ...string) (string, error) {
+	return run(ctx, c.dir, "kubectl", c.kubectlArgs(args...)...)
+}
+
+func (c *Cluster) kubectlArgs(args ...string) []string {
+	if c.kubeconfig != "" {
+		return append([]string{"--kubeconfig", c.kubeconfig}, args...)
+	}
+	return append([]string{"--context", "kind-" + c.name}, args...)
+}
+
+func (c *Cluster) kind(ctx context.Context, args ...string) (string, error) {
+	return run(ctx, c.dir, "kind", args...)
+}
+
+func run(ctx context.Context, dir, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+var invalidClusterChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// Derives the cluster name from the last folders of the recipe path, e.g. src/go/traces/k8s -> go-traces-k8s
+func clusterName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+
+	parts := strings.Split(filepath.ToSlash(abs), "/")
+	if len(parts) > 3 {
+		parts = parts[len(parts)-3:]
+	}
+	name := invalidClusterChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-")
+	return strings.Trim(name, "-")
+}
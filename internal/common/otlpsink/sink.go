@@ -0,0 +1,487 @@
+// Package otlpsink provides an in-process OTLP gRPC and HTTP receiver that keeps the received
+// telemetry in-memory. It allows the recipe tests to validate the exported telemetry
+// without an external back-end, and how the exporters sent it.
+package otlpsink // import "github.com/joaopgrassi/otel-recipes/internal/common/otlpsink"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	// registers the gzip compressor, for the exporters configured with OTEL_EXPORTER_OTLP_COMPRESSION=gzip
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Sink is an OTLP gRPC receiver for traces, metrics and logs, and optionally an OTLP/HTTP one, see StartHTTP.
+// It implements the testutils TraceBackend, MetricsBackend, LogsBackend and ExportRecorder.
+type Sink struct {
+	server   *grpc.Server
+	listener net.Listener
+
+	httpServer   *http.Server
+	httpListener net.Listener
+
+	mu              sync.Mutex
+	resourceSpans   map[string][]*otlptrace.ResourceSpans
+	resourceMetrics map[string][]*otlpmetrics.ResourceMetrics
+	resourceLogs    map[string][]*otlplogs.ResourceLogs
+	exports         []testutils.ExportRequest
+	// closed and replaced every time new data is received
+	received chan struct{}
+}
+
+// Starts the receiver listening on the given address, e.g. "0.0.0.0:4317".
+// Use ":0" to listen on a random free port, see Addr.
+func Start(addr string) (*Sink, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sink{
+		server:          grpc.NewServer(grpc.StatsHandler(compressionHandler{})),
+		listener:        lis,
+		resourceSpans:   make(map[string][]*otlptrace.ResourceSpans),
+		resourceMetrics: make(map[string][]*otlpmetrics.ResourceMetrics),
+		resourceLogs:    make(map[string][]*otlplogs.ResourceLogs),
+		received:        make(chan struct{}),
+	}
+	coltracepb.RegisterTraceServiceServer(s.server, traceService{sink: s})
+	colmetricspb.RegisterMetricsServiceServer(s.server, metricsService{sink: s})
+	collogspb.RegisterLogsServiceServer(s.server, logsService{sink: s})
+
+	go func() { _ = s.server.Serve(lis) }()
+	return s, nil
+}
+
+// Starts a sink on random free ports receiving both gRPC and HTTP, for the test only, and sets it as the
+// capture endpoint of the test. Point the exporters of the sample to it via Endpoint:
+//
+//	sink := otlpsink.Capture(t)
+//	env := tu.ExporterEnv(sink.Endpoint(containers.HostGateway, "http/protobuf"), cfg)
+func Capture(t testutils.TestingT) *Sink {
+	s, err := Start("0.0.0.0:0")
+	if err != nil {
+		t.Fatalf("Failed starting the OTLP sink: %v", err)
+	}
+	t.Cleanup(s.Stop)
+	if err := s.StartHTTP("0.0.0.0:0"); err != nil {
+		t.Fatalf("Failed starting the OTLP/HTTP receiver of the sink: %v", err)
+	}
+	testutils.UseExporterCapture(t, s)
+	return s
+}
+
+// Starts the OTLP/HTTP receiver listening on the given address, e.g. "0.0.0.0:4318". It accepts protobuf and
+// JSON requests, optionally gzip compressed, on /v1/traces, /v1/metrics and /v1/logs
+func (s *Sink) StartHTTP(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/traces", httpHandler(s, "traces", s.addTraces))
+	mux.Handle("/v1/metrics", httpHandler(s, "metrics", s.addMetrics))
+	mux.Handle("/v1/logs", httpHandler(s, "logs", s.addLogs))
+	s.httpServer = &http.Server{Handler: mux}
+	s.httpListener = lis
+
+	go func() { _ = s.httpServer.Serve(lis) }()
+	return nil
+}
+
+// The address the receiver is listening on
+func (s *Sink) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// The address the OTLP/HTTP receiver is listening on, or empty if not started
+func (s *Sink) HTTPAddr() string {
+	if s.httpListener == nil {
+		return ""
+	}
+	return s.httpListener.Addr().String()
+}
+
+// The URL the exporters using the protocol reach the sink at via the host, e.g. http://host.docker.internal:4318
+// for http/protobuf, as set in OTEL_EXPORTER_OTLP_ENDPOINT
+func (s *Sink) Endpoint(host, protocol string) string {
+	addr := s.Addr()
+	if protocol != "grpc" {
+		addr = s.HTTPAddr()
+	}
+	_, port, _ := net.SplitHostPort(addr)
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+func (s *Sink) Stop() {
+	s.server.GracefulStop()
+	if s.httpServer != nil {
+		_ = s.httpServer.Shutdown(context.Background())
+	}
+}
+
+// Clears all the received telemetry
+func (s *Sink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resourceSpans = make(map[string][]*otlptrace.ResourceSpans)
+	s.resourceMetrics = make(map[string][]*otlpmetrics.ResourceMetrics)
+	s.resourceLogs = make(map[string][]*otlplogs.ResourceLogs)
+	s.exports = nil
+}
+
+// The exports received so far, with the properties of their connection
+func (s *Sink) ExportRequests() []testutils.ExportRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.exports)
+}
+
+// The gRPC services all define an Export method, so each signal is registered via its own type
+type traceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	sink *Sink
+}
+
+func (ts traceService) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	ts.sink.addTraces(req, grpcExport(ctx, "traces"))
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+type metricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	sink *Sink
+}
+
+func (m metricsService) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	m.sink.addMetrics(req, grpcExport(ctx, "metrics"))
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+type logsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	sink *Sink
+}
+
+func (l logsService) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	l.sink.addLogs(req, grpcExport(ctx, "logs"))
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func (s *Sink) addTraces(req *coltracepb.ExportTraceServiceRequest, e testutils.ExportRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rs := range req.GetResourceSpans() {
+		sn := serviceName(rs.GetResource())
+		s.resourceSpans[sn] = append(s.resourceSpans[sn], rs)
+		e.ServiceNames = appendService(e.ServiceNames, sn)
+	}
+	s.exports = append(s.exports, e)
+	s.notify()
+}
+
+func (s *Sink) addMetrics(req *colmetricspb.ExportMetricsServiceRequest, e testutils.ExportRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rm := range req.GetResourceMetrics() {
+		sn := serviceName(rm.GetResource())
+		s.resourceMetrics[sn] = append(s.resourceMetrics[sn], rm)
+		e.ServiceNames = appendService(e.ServiceNames, sn)
+	}
+	s.exports = append(s.exports, e)
+	s.notify()
+}
+
+func (s *Sink) addLogs(req *collogspb.ExportLogsServiceRequest, e testutils.ExportRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rl := range req.GetResourceLogs() {
+		sn := serviceName(rl.GetResource())
+		s.resourceLogs[sn] = append(s.resourceLogs[sn], rl)
+		e.ServiceNames = appendService(e.ServiceNames, sn)
+	}
+	s.exports = append(s.exports, e)
+	s.notify()
+}
+
+func appendService(names []string, name string) []string {
+	if slices.Contains(names, name) {
+		return names
+	}
+	return append(names, name)
+}
+
+// The export received via gRPC, with the metadata and the compression of the call
+func grpcExport(ctx context.Context, signal string) testutils.ExportRequest {
+	e := testutils.ExportRequest{Signal: signal, Protocol: "grpc"}
+	md, _ := metadata.FromIncomingContext(ctx)
+	e.Headers = md
+	if c, ok := ctx.Value(compressionKey{}).(*string); ok && *c != "identity" {
+		e.Compression = *c
+	}
+	return e
+}
+
+type compressionKey struct{}
+
+// Keeps the compression of the calls, which gRPC doesn't expose to the handlers, in their context
+type compressionHandler struct{}
+
+func (compressionHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, compressionKey{}, new(string))
+}
+
+// The header is handled with the context returned by TagRPC, before the call is
+func (compressionHandler) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	if h, ok := rs.(*stats.InHeader); ok {
+		if c, ok := ctx.Value(compressionKey{}).(*string); ok {
+			*c = h.Compression
+		}
+	}
+}
+
+func (compressionHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (compressionHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// Handles the OTLP/HTTP requests of a signal, unmarshalled into a new T
+func httpHandler[T any, PT interface {
+	*T
+	proto.Message
+}](s *Sink, signal string, add func(PT, testutils.ExportRequest)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		e := testutils.ExportRequest{Signal: signal, Headers: make(map[string][]string, len(r.Header))}
+		for k, v := range r.Header {
+			e.Headers[strings.ToLower(k)] = v
+		}
+
+		body, err := readHTTPBody(r, &e)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		req := PT(new(T))
+		switch ct {
+		case "application/json":
+			e.Protocol = "http/json"
+			if body, err = base64JSONIds(body); err == nil {
+				err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, req)
+			}
+		case "application/x-protobuf":
+			e.Protocol = "http/protobuf"
+			err = proto.Unmarshal(body, req)
+		default:
+			http.Error(w, fmt.Sprintf("unsupported content type %q", ct), http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s request: %v", signal, err), http.StatusBadRequest)
+			return
+		}
+		add(req, e)
+
+		// the response is an empty Export*ServiceResponse, in the encoding of the request
+		w.Header().Set("Content-Type", ct)
+		if ct == "application/json" {
+			_, _ = w.Write([]byte("{}"))
+		}
+	}
+}
+
+// Reads the body of the request, decompressing it per its Content-Encoding
+func readHTTPBody(r *http.Request, e *testutils.ExportRequest) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch enc := r.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		e.Compression = enc
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		return io.ReadAll(zr)
+	default:
+		return nil, errors.New("unsupported content encoding " + enc)
+	}
+}
+
+// The keys of the trace and span ids of the spans, links, log records and exemplars, in both the JSON names
+// and the proto names protojson accepts
+var jsonIdKeys = map[string]bool{
+	"traceId": true, "spanId": true, "parentSpanId": true,
+	"trace_id": true, "span_id": true, "parent_span_id": true,
+}
+
+// The OTLP JSON encodes the ids in hex, while protojson decodes the bytes from base64. Re-encodes the ids of
+// the request in base64, failing on the ids not in hex, so protojson decodes them as they were sent
+func base64JSONIds(body []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	// so the numbers are encoded back as they were sent
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if err := base64Ids(v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func base64Ids(v any) error {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, e := range val {
+			if s, ok := e.(string); ok && jsonIdKeys[k] {
+				id, err := hex.DecodeString(s)
+				if err != nil {
+					return fmt.Errorf("invalid %s %q, expected hex: %w", k, s, err)
+				}
+				val[k] = base64.StdEncoding.EncodeToString(id)
+				continue
+			}
+			if err := base64Ids(e); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, e := range val {
+			if err := base64Ids(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// must be called with the lock held
+func (s *Sink) notify() {
+	close(s.received)
+	s.received = make(chan struct{})
+}
+
+func (s *Sink) GetTraces(serviceName string, _ testutils.TraceQueryOptions) (*otlptrace.ResourceSpans, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.resourceSpans[serviceName]
+	if len(all) == 0 {
+		return nil, nil
+	}
+
+	res := &otlptrace.ResourceSpans{Resource: all[0].GetResource(), SchemaUrl: all[0].GetSchemaUrl()}
+	for _, rs := range all {
+		res.ScopeSpans = append(res.ScopeSpans, rs.GetScopeSpans()...)
+	}
+	return res, nil
+}
+
+func (s *Sink) GetMetrics(serviceName string) (*otlpmetrics.ResourceMetrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.resourceMetrics[serviceName]
+	if len(all) == 0 {
+		return nil, nil
+	}
+
+	res := &otlpmetrics.ResourceMetrics{Resource: all[0].GetResource(), SchemaUrl: all[0].GetSchemaUrl()}
+	for _, rm := range all {
+		res.ScopeMetrics = append(res.ScopeMetrics, rm.GetScopeMetrics()...)
+	}
+	return res, nil
+}
+
+func (s *Sink) GetLogs(serviceName string) (*otlplogs.ResourceLogs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.resourceLogs[serviceName]
+	if len(all) == 0 {
+		return nil, nil
+	}
+
+	res := &otlplogs.ResourceLogs{Resource: all[0].GetResource(), SchemaUrl: all[0].GetSchemaUrl()}
+	for _, rl := range all {
+		res.ScopeLogs = append(res.ScopeLogs, rl.GetScopeLogs()...)
+	}
+	return res, nil
+}
+
+// Blocks until spans for the service are received or the context is done
+func (s *Sink) WaitForTraces(ctx context.Context, serviceName string) (*otlptrace.ResourceSpans, error) {
+	for {
+		s.mu.Lock()
+		received := s.received
+		s.mu.Unlock()
+
+		if rs, _ := s.GetTraces(serviceName, testutils.TraceQueryOptions{}); rs != nil {
+			return rs, nil
+		}
+
+		select {
+		case <-received:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Uses the sink as the back-end for all signals in the testutils
+func (s *Sink) Use() {
+	testutils.SetTraceBackend(s)
+	testutils.SetMetricsBackend(s)
+	testutils.SetLogsBackend(s)
+}
+
+func serviceName(r *otlpresource.Resource) string {
+	for _, attr := range r.GetAttributes() {
+		if attr.GetKey() == "service.name" {
+			return attr.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,238 @@
+package otlpsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	testTraceId  = "5b8aa5a2d2c872e8321cf37308d69df2"
+	testSpanId   = "051581bf3cb55c13"
+	testParentId = "5fb397be34d26b51"
+	testLinkSpan = "efe159833c5bf9d1"
+)
+
+func startTestSink(t *testing.T) *Sink {
+	s, err := Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	if err := s.StartHTTP("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func postJSON(t *testing.T, s *Sink, signal, body string) int {
+	t.Helper()
+	res, err := http.Post("http://"+s.HTTPAddr()+"/v1/"+signal, "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// The ids of the JSON requests are decoded from hex, as the OTLP JSON encodes them
+func TestHTTPJSONIds(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal string
+		body   string
+		check  func(t *testing.T, s *Sink)
+	}{
+		{
+			name:   "span, parent and link",
+			signal: "traces",
+			body: `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"dice"}}]},` +
+				`"scopeSpans":[{"scope":{"name":"dice"},"spans":[{"traceId":"` + testTraceId + `","spanId":"` + testSpanId + `",` +
+				`"parentSpanId":"` + testParentId + `","name":"roll","kind":1,"startTimeUnixNano":"1714644062114304000",` +
+				`"endTimeUnixNano":"1714644062114561000","attributes":[{"key":"traceId","value":{"stringValue":"not an id"}}],` +
+				`"links":[{"traceId":"` + testTraceId + `","spanId":"` + testLinkSpan + `"}]}]}]}]}`,
+			check: func(t *testing.T, s *Sink) {
+				rs, _ := s.GetTraces("dice", testutils.TraceQueryOptions{})
+				span := rs.GetScopeSpans()[0].GetSpans()[0]
+				want := &otlptrace.Span{
+					TraceId:           mustHex(t, testTraceId),
+					SpanId:            mustHex(t, testSpanId),
+					ParentSpanId:      mustHex(t, testParentId),
+					Name:              "roll",
+					Kind:              otlptrace.Span_SPAN_KIND_INTERNAL,
+					StartTimeUnixNano: 1714644062114304000,
+					EndTimeUnixNano:   1714644062114561000,
+					// the attributes named like the ids are kept
+					Attributes: []*otlpcommon.KeyValue{testutils.StringAttribute("traceId", "not an id")},
+					Links:      []*otlptrace.Span_Link{{TraceId: mustHex(t, testTraceId), SpanId: mustHex(t, testLinkSpan)}},
+				}
+				if !proto.Equal(want, span) {
+					t.Errorf("Unexpected span\nwant: %v\ngot:  %v", want, span)
+				}
+			},
+		},
+		{
+			// an empty parent is a root span
+			name:   "root span in proto names",
+			signal: "traces",
+			body: `{"resource_spans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"dice"}}]},` +
+				`"scope_spans":[{"spans":[{"trace_id":"` + testTraceId + `","span_id":"` + testSpanId + `","parent_span_id":"","name":"roll"}]}]}]}`,
+			check: func(t *testing.T, s *Sink) {
+				rs, _ := s.GetTraces("dice", testutils.TraceQueryOptions{})
+				span := rs.GetScopeSpans()[0].GetSpans()[0]
+				if hex.EncodeToString(span.TraceId) != testTraceId || hex.EncodeToString(span.SpanId) != testSpanId || len(span.ParentSpanId) != 0 {
+					t.Errorf("Unexpected ids %x %x %x", span.TraceId, span.SpanId, span.ParentSpanId)
+				}
+			},
+		},
+		{
+			name:   "log record",
+			signal: "logs",
+			body: `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"dice"}}]},` +
+				`"scopeLogs":[{"logRecords":[{"timeUnixNano":"1714644062114400000","body":{"stringValue":"Rolled a 4"},` +
+				`"traceId":"` + testTraceId + `","spanId":"` + testSpanId + `"}]}]}]}`,
+			check: func(t *testing.T, s *Sink) {
+				rl, _ := s.GetLogs("dice")
+				l := rl.GetScopeLogs()[0].GetLogRecords()[0]
+				if hex.EncodeToString(l.TraceId) != testTraceId || hex.EncodeToString(l.SpanId) != testSpanId {
+					t.Errorf("Unexpected ids %x %x", l.TraceId, l.SpanId)
+				}
+				if l.TimeUnixNano != 1714644062114400000 {
+					t.Errorf("Unexpected timestamp %d", l.TimeUnixNano)
+				}
+			},
+		},
+		{
+			name:   "exemplar",
+			signal: "metrics",
+			body: `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"dice"}}]},` +
+				`"scopeMetrics":[{"metrics":[{"name":"dice.rolls","sum":{"aggregationTemporality":2,"isMonotonic":true,` +
+				`"dataPoints":[{"asInt":"9007199254740993","exemplars":[{"asInt":"4","traceId":"` + testTraceId + `","spanId":"` + testSpanId + `"}]}]}}]}]}]}`,
+			check: func(t *testing.T, s *Sink) {
+				rm, _ := s.GetMetrics("dice")
+				dp := rm.GetScopeMetrics()[0].GetMetrics()[0].GetSum().GetDataPoints()[0]
+				// the numbers are kept as sent
+				if dp.GetAsInt() != 9007199254740993 {
+					t.Errorf("Unexpected value %d", dp.GetAsInt())
+				}
+				e := dp.GetExemplars()[0]
+				if hex.EncodeToString(e.TraceId) != testTraceId || hex.EncodeToString(e.SpanId) != testSpanId {
+					t.Errorf("Unexpected ids %x %x", e.TraceId, e.SpanId)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startTestSink(t)
+			if status := postJSON(t, s, tt.signal, tt.body); status != http.StatusOK {
+				t.Fatalf("Expected the export to succeed, got %d", status)
+			}
+			tt.check(t, s)
+			if reqs := s.ExportRequests(); len(reqs) != 1 || reqs[0].Protocol != "http/json" {
+				t.Errorf("Unexpected exports %v", reqs)
+			}
+		})
+	}
+}
+
+func TestHTTPJSONInvalidIds(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+	}{
+		// the base64 of an id, as protojson would encode it
+		{"base64", "W4qlotLIcugyHPNzCNad8g=="},
+		{"not hex", "zz8aa5a2d2c872e8321cf37308d69df2"},
+		{"odd length", "5b8aa5a2d2c872e8321cf37308d69df"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := startTestSink(t)
+			body := `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"dice"}}]},` +
+				`"scopeSpans":[{"spans":[{"traceId":"` + tt.id + `","spanId":"` + testSpanId + `","name":"roll"}]}]}]}`
+			if status := postJSON(t, s, "traces", body); status != http.StatusBadRequest {
+				t.Errorf("Expected the export to be rejected, got %d", status)
+			}
+			if rs, _ := s.GetTraces("dice", testutils.TraceQueryOptions{}); rs != nil {
+				t.Errorf("Unexpected spans %v", rs)
+			}
+		})
+	}
+}
+
+// The spans exported over gRPC, HTTP protobuf and HTTP JSON are received the same
+func TestExportProtocols(t *testing.T) {
+	s := startTestSink(t)
+	span := &otlptrace.Span{
+		TraceId:           mustHex(t, testTraceId),
+		SpanId:            mustHex(t, testSpanId),
+		ParentSpanId:      mustHex(t, testParentId),
+		Name:              "roll",
+		StartTimeUnixNano: 1714644062114304000,
+		EndTimeUnixNano:   1714644062114561000,
+	}
+	req := &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*otlptrace.ResourceSpans{{
+		Resource:   &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{testutils.StringAttribute("service.name", "dice")}},
+		ScopeSpans: []*otlptrace.ScopeSpans{{Spans: []*otlptrace.Span{span}}},
+	}}}
+
+	conn, err := grpc.NewClient(s.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := coltracepb.NewTraceServiceClient(conn).Export(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Post("http://"+s.HTTPAddr()+"/v1/traces", "application/x-protobuf", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if status := postJSON(t, s, "traces", `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"dice"}}]},`+
+		`"scopeSpans":[{"spans":[{"traceId":"`+testTraceId+`","spanId":"`+testSpanId+`","parentSpanId":"`+testParentId+`",`+
+		`"name":"roll","startTimeUnixNano":"1714644062114304000","endTimeUnixNano":"1714644062114561000"}]}]}]}`); status != http.StatusOK {
+		t.Fatalf("Expected the export to succeed, got %d", status)
+	}
+
+	rs, _ := s.GetTraces("dice", testutils.TraceQueryOptions{})
+	var protocols []string
+	for _, e := range s.ExportRequests() {
+		protocols = append(protocols, e.Protocol)
+	}
+	if len(protocols) != 3 {
+		t.Fatalf("Expected 3 exports, got %v", protocols)
+	}
+	for i, ss := range rs.GetScopeSpans() {
+		if got := ss.GetSpans()[0]; !proto.Equal(span, got) {
+			t.Errorf("Unexpected span of the %s export\nwant: %v\ngot:  %v", protocols[i], span, got)
+		}
+	}
+}
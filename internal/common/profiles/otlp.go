@@ -0,0 +1,181 @@
+package profiles // import "github.com/joaopgrassi/otel-recipes/internal/common/profiles"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// The OTLP profiles are still in development and the generated Go types are not released with the OTLP
+// protos the test utils use. So only the fields read are declared, supporting both the v1experimental
+// messages, with the profile nested in a container, and the v1development ones
+type profilesData struct {
+	ResourceProfiles []struct {
+		Resource      json.RawMessage `json:"resource"`
+		ScopeProfiles []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			Profiles []struct {
+				otlpProfile
+				// v1experimental
+				Profile *otlpProfile `json:"profile"`
+			} `json:"profiles"`
+		} `json:"scopeProfiles"`
+	} `json:"resourceProfiles"`
+	// The string table shared by the profiles, since v1development 1.7
+	Dictionary struct {
+		StringTable []string `json:"stringTable"`
+	} `json:"dictionary"`
+}
+
+type otlpProfile struct {
+	// An array of value types, or a single one since v1development 1.7
+	SampleType  json.RawMessage `json:"sampleType"`
+	Sample      []otlpSample    `json:"sample"`
+	StringTable []string        `json:"stringTable"`
+}
+
+type otlpSample struct {
+	Value []jsonInt `json:"value"`
+	// Since v1development 1.7
+	Values []jsonInt `json:"values"`
+}
+
+type otlpValueType struct {
+	Type         jsonInt `json:"type"`
+	Unit         jsonInt `json:"unit"`
+	TypeStrindex jsonInt `json:"typeStrindex"`
+	UnitStrindex jsonInt `json:"unitStrindex"`
+}
+
+// The 64 bits integers are strings in OTLP JSON, the 32 bits ones numbers
+type jsonInt int64
+
+func (i *jsonInt) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(string(bytes.Trim(data, `"`)), 10, 64)
+	*i = jsonInt(n)
+	return err
+}
+
+// The file exporters write one OTLP JSON message per line, which can get big with the stack traces
+const maxOtlpFileLineSize int = 64 * 1024 * 1024
+
+// Reads the profiles of the service from an OTLP JSON lines file, e.g. written by the collector's file exporter
+// with the profiles pipeline enabled. A missing file is not an error, as the exporter may not have flushed yet
+func ReadOtlpFile(path, serviceName string) ([]*Profile, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var res []*Profile
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxOtlpFileLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		profiles, err := decodeOtlpProfiles(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP JSON line in %s: %w", path, err)
+		}
+		for _, p := range profiles {
+			if getServiceName(p.Resource) == serviceName {
+				res = append(res, p)
+			}
+		}
+	}
+	return res, scanner.Err()
+}
+
+func decodeOtlpProfiles(data []byte) ([]*Profile, error) {
+	var pd profilesData
+	if err := json.Unmarshal(data, &pd); err != nil {
+		return nil, err
+	}
+
+	var res []*Profile
+	for _, rp := range pd.ResourceProfiles {
+		r := &otlpresource.Resource{}
+		if len(rp.Resource) > 0 {
+			if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(rp.Resource, r); err != nil {
+				return nil, err
+			}
+		}
+		for _, sp := range rp.ScopeProfiles {
+			for _, c := range sp.Profiles {
+				op := &c.otlpProfile
+				if c.Profile != nil {
+					op = c.Profile
+				}
+				stringTable := op.StringTable
+				if len(stringTable) == 0 {
+					stringTable = pd.Dictionary.StringTable
+				}
+				p, err := toProfile(op, stringTable)
+				if err != nil {
+					return nil, err
+				}
+				p.Resource, p.Scope = r, sp.Scope.Name
+				res = append(res, p)
+			}
+		}
+	}
+	return res, nil
+}
+
+func toProfile(op *otlpProfile, stringTable []string) (*Profile, error) {
+	p := &Profile{Samples: len(op.Sample)}
+	for _, s := range op.Sample {
+		values := s.Value
+		if len(values) == 0 {
+			values = s.Values
+		}
+		if len(values) > 0 {
+			p.Total += int64(values[0])
+		}
+	}
+
+	var types []otlpValueType
+	if bytes.HasPrefix(bytes.TrimSpace(op.SampleType), []byte("[")) {
+		if err := json.Unmarshal(op.SampleType, &types); err != nil {
+			return nil, err
+		}
+	} else if len(op.SampleType) > 0 {
+		var vt otlpValueType
+		if err := json.Unmarshal(op.SampleType, &vt); err != nil {
+			return nil, err
+		}
+		types = append(types, vt)
+	}
+	if len(types) > 0 {
+		typ, unit := types[0].Type+types[0].TypeStrindex, types[0].Unit+types[0].UnitStrindex
+		if typ < 0 || unit < 0 || int(typ) >= len(stringTable) || int(unit) >= len(stringTable) {
+			return nil, errors.New("sample type out of the string table")
+		}
+		p.Type = stringTable[typ] + "/" + stringTable[unit]
+	}
+	return p, nil
+}
+
+func getServiceName(r *otlpresource.Resource) string {
+	for _, kv := range r.GetAttributes() {
+		if kv.GetKey() == "service.name" {
+			return kv.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package profiles // import "github.com/joaopgrassi/otel-recipes/internal/common/profiles"
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The fields of the pprof messages read, see https://github.com/google/pprof/blob/main/proto/profile.proto
+const (
+	pprofSampleType  protowire.Number = 1
+	pprofSample      protowire.Number = 2
+	pprofStringTable protowire.Number = 6
+
+	pprofValueTypeType protowire.Number = 1
+	pprofValueTypeUnit protowire.Number = 2
+
+	pprofSampleValue protowire.Number = 2
+)
+
+var httpClient = &http.Client{Timeout: 60 * time.Second}
+
+// Fetches a pprof profile, e.g. from the /debug/pprof/profile?seconds=5 endpoint of a Go recipe or of the
+// collector's pprof extension. pprof profiles have no resource
+func Scrape(uri string) (*Profile, error) {
+	res, err := httpClient.Get(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed scraping the pprof profile: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading the pprof profile of %s: %w", uri, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed scraping the pprof profile: %s returned %d", uri, res.StatusCode)
+	}
+	return DecodePprof(body)
+}
+
+// Decodes a pprof profile, gzip compressed or not
+func DecodePprof(data []byte) (*Profile, error) {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pprof profile: %w", err)
+		}
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("invalid pprof profile: %w", err)
+		}
+	}
+
+	var stringTable []string
+	var sampleTypes [][2]uint64
+	p := &Profile{}
+	err := decodeFields(data, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == pprofStringTable && typ == protowire.BytesType:
+			stringTable = append(stringTable, string(v))
+		case num == pprofSampleType && typ == protowire.BytesType:
+			var st [2]uint64
+			err := decodeFields(v, func(num protowire.Number, typ protowire.Type, _ []byte, n uint64) error {
+				if typ == protowire.VarintType && (num == pprofValueTypeType || num == pprofValueTypeUnit) {
+					st[num-1] = n
+				}
+				return nil
+			})
+			sampleTypes = append(sampleTypes, st)
+			return err
+		case num == pprofSample && typ == protowire.BytesType:
+			p.Samples++
+			value, err := firstSampleValue(v)
+			p.Total += value
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sampleTypes) > 0 {
+		typ, unit := sampleTypes[0][0], sampleTypes[0][1]
+		if typ >= uint64(len(stringTable)) || unit >= uint64(len(stringTable)) {
+			return nil, errors.New("invalid pprof profile: sample type out of the string table")
+		}
+		p.Type = stringTable[typ] + "/" + stringTable[unit]
+	}
+	return p, nil
+}
+
+// The first value of the sample, either packed or not
+func firstSampleValue(sample []byte) (int64, error) {
+	var value int64
+	found := false
+	err := decodeFields(sample, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		if num != pprofSampleValue || found {
+			return nil
+		}
+		switch typ {
+		case protowire.VarintType:
+			value, found = int64(n), true
+		case protowire.BytesType:
+			if len(v) == 0 {
+				return nil
+			}
+			n, l := protowire.ConsumeVarint(v)
+			if l < 0 {
+				return protowire.ParseError(l)
+			}
+			value, found = int64(n), true
+		}
+		return nil
+	})
+	return value, err
+}
+
+// Calls onField with each field of the message: the content of the length-delimited ones, or the value of
+// the varints. The other wire types are skipped
+func decodeFields(data []byte, onField func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(data) > 0 {
+		num, typ, l := protowire.ConsumeTag(data)
+		if l < 0 {
+			return fmt.Errorf("invalid pprof profile: %w", protowire.ParseError(l))
+		}
+		data = data[l:]
+
+		var v []byte
+		var n uint64
+		switch typ {
+		case protowire.BytesType:
+			v, l = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			n, l = protowire.ConsumeVarint(data)
+		default:
+			l = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if l < 0 {
+			return fmt.Errorf("invalid pprof profile: %w", protowire.ParseError(l))
+		}
+		data = data[l:]
+		if err := onField(num, typ, v, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
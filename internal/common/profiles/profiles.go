@@ -0,0 +1,116 @@
+// Package profiles asserts the profiles exported by the profiling recipes, either as OTLP profiles read from
+// the file written by the collector or as pprof profiles scraped from the recipe. The profiles signal is
+// experimental in OpenTelemetry, so is the package.
+package profiles // import "github.com/joaopgrassi/otel-recipes/internal/common/profiles"
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// Where the profiles are read from: the OTLP JSON lines file of the collector's file exporter, or else the
+// pprof endpoint of the recipe
+var profilesFile = flag.String("profiles-file", "", "Path to the OTLP JSON lines file containing the exported profiles")
+var pprofUrl = flag.String("pprof-url", "", "URL of the pprof profile to scrape, e.g. http://localhost:6060/debug/pprof/profile?seconds=5")
+
+// A profile with the aggregates of its samples
+type Profile struct {
+	// Nil for a pprof profile
+	Resource *otlpresource.Resource
+	Scope    string
+	// The type and unit of the first sample type, e.g. cpu/nanoseconds or samples/count
+	Type    string
+	Samples int
+	// The sum of the first value of the samples
+	Total int64
+}
+
+func (p *Profile) String() string {
+	return fmt.Sprintf("%s profile with %d samples", p.Type, p.Samples)
+}
+
+type TestCase struct {
+	serviceName        string
+	resourceAttributes []*otlpcommon.KeyValue
+	profileType        string
+	minSamples         int
+}
+
+func NewTestCase(serviceName string) *TestCase {
+	return &TestCase{serviceName: serviceName, minSamples: 1}
+}
+
+// Sets the resource attributes the profiles are expected to be exported with. Only OTLP profiles have a resource
+func (tc *TestCase) WithResourceAttributes(attributes ...*otlpcommon.KeyValue) *TestCase {
+	tc.resourceAttributes = attributes
+	return tc
+}
+
+// Expects a profile of the type, e.g. cpu/nanoseconds
+func (tc *TestCase) WithType(profileType string) *TestCase {
+	tc.profileType = profileType
+	return tc
+}
+
+// Expects a profile with at least n samples. Defaults to 1
+func (tc *TestCase) WithMinSamples(n int) *TestCase {
+	tc.minSamples = n
+	return tc
+}
+
+// Asserts the service exported a profile of the test case, read from -profiles-file or else scraped from
+// -pprof-url until found. Returns the profile
+func AssertProfile(t *testing.T, tc *TestCase) *Profile {
+	if *profilesFile == "" && *pprofUrl == "" {
+		t.Fatal("Set -profiles-file or -pprof-url to read the profiles from")
+	}
+	if *profilesFile == "" && len(tc.resourceAttributes) > 0 {
+		t.Fatal("The resource attributes can only be asserted for OTLP profiles, set -profiles-file")
+	}
+
+	var profiles []*Profile
+	var actual *Profile
+	found := tu.Eventually(t, "Profile of "+tc.serviceName, func() bool {
+		var err error
+		profiles, err = readProfiles(tc.serviceName)
+		if err != nil {
+			tu.Logger(t).Warn("Failed reading the profiles", "error", err)
+			return false
+		}
+		actual = findProfile(profiles, tc)
+		return actual != nil
+	})
+	if !found {
+		t.Fatalf("Could not find a profile of %s with at least %d samples of type %q. Profiles: %v", tc.serviceName, tc.minSamples, tc.profileType, profiles)
+	}
+
+	if actual.Resource != nil {
+		tu.AssertResourceAttributes(t, actual.Resource, tc.resourceAttributes...)
+	}
+	return actual
+}
+
+func readProfiles(serviceName string) ([]*Profile, error) {
+	if *profilesFile != "" {
+		return ReadOtlpFile(*profilesFile, serviceName)
+	}
+	p, err := Scrape(*pprofUrl)
+	if err != nil {
+		return nil, err
+	}
+	return []*Profile{p}, nil
+}
+
+func findProfile(profiles []*Profile, tc *TestCase) *Profile {
+	for _, p := range profiles {
+		if (tc.profileType == "" || p.Type == tc.profileType) && p.Samples >= tc.minSamples {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package recipes // import "github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+// An event written by go test -json
+type testEvent struct {
+	Action string
+	Test   string
+	Output string
+}
+
+// Runs go test in the recipe's test module and returns the outcome of each of its tests.
+// The addresses of the configuration are passed via environment variables and args are
+// passed to the test binary, e.g. -trace-backend=tempo. The output is returned as printed by go test
+func RunTests(ctx context.Context, r *Recipe, c *tu.Config, args ...string) ([]tu.AssertionResult, string, error) {
+	if c.TraceBackend != "" {
+		// the back-end of the configuration takes precedence over the flag, as in-process
+		args = append(args, "-trace-backend="+c.TraceBackend)
+	}
+	cmd := exec.CommandContext(ctx, "go", append([]string{"test", "-count=1", "-json", "."}, args...)...)
+	cmd.Dir = r.TestDir()
+	cmd.Env = append(os.Environ(),
+		"OTLP_BACKEND_URL="+c.OtlpBackendUrl,
+		"SAMPLE_API_URL="+c.SampleApiUrl,
+		"SAMPLE_GRPC_URL="+c.SampleGrpcUrl,
+		"COLLECTOR_URL="+c.CollectorUrl,
+		"PROMETHEUS_EXPORTER_URL="+c.PrometheusExporterUrl,
+		"PROMETHEUS_URL="+c.PrometheusUrl,
+		"TEMPO_URL="+c.TempoUrl,
+		"ZIPKIN_URL="+c.ZipkinUrl,
+		"JAEGER_URL="+c.JaegerUrl,
+		"JAEGER_GRPC_URL="+c.JaegerGrpcUrl,
+		"TRACE_LIMIT="+c.TraceLimit,
+		"TRACE_LOOKBACK="+c.TraceLookback,
+		"TRACE_START="+c.TraceStart,
+		"SDK_VERSION="+c.SdkVersion,
+	)
+	out, err := cmd.CombinedOutput()
+
+	var results []tu.AssertionResult
+	var output strings.Builder
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		var e testEvent
+		if json.Unmarshal(line, &e) != nil {
+			// e.g. build errors, which are not written as JSON
+			output.Write(line)
+			output.WriteString("\n")
+			continue
+		}
+		output.WriteString(e.Output)
+		if e.Test != "" && (e.Action == "pass" || e.Action == "fail") {
+			results = append(results, tu.AssertionResult{Name: e.Test, Passed: e.Action == "pass"})
+		}
+	}
+	return results, output.String(), err
+}
@@ -0,0 +1,122 @@
+package recipes // import "github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	"gopkg.in/yaml.v3"
+)
+
+const manifestFileName string = "recipe.yaml"
+
+// The signals a recipe can export
+var manifestSignals = []string{"traces", "metrics", "logs", "profiles"}
+
+// The recipe.yaml next to the recipefile.json, describing how the harness validates the recipe. While the
+// recipefile.json feeds the website, the manifest replaces the flags and constants of the harness:
+//
+//	name: go.ginapi.traces
+//	language: go
+//	signals: [traces]
+//	backend: otlp
+//	endpoints:
+//	  - path: /helloworld
+//	expected: test/expected.yaml
+type Manifest struct {
+	// The id of the recipe, also the service.name it exports its telemetry with
+	Name     string   `yaml:"name"`
+	Language string   `yaml:"language"`
+	Signals  []string `yaml:"signals"`
+	// The back-end the traces are queried from, e.g. jaeger. See testutils.RegisterTraceBackend. Empty uses
+	// the -trace-backend flag
+	Backend string `yaml:"backend"`
+	// Called on the sample API, in order, before the requests of the expected telemetry file
+	Endpoints []tu.RequestSpec `yaml:"endpoints"`
+	// The expected telemetry file, relative to the recipe folder. Defaults to test/expected.yaml if it exists
+	Expected string `yaml:"expected"`
+}
+
+// Reads and validates the recipe.yaml in dir. Returns an error wrapping os.ErrNotExist if there is none
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", manifestFileName, dir, err)
+	}
+	if err := m.validate(dir); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", manifestFileName, dir, err)
+	}
+	return m, nil
+}
+
+func (m *Manifest) validate(dir string) error {
+	if m.Name == "" {
+		return errors.New("missing name")
+	}
+	if !slices.Contains(tu.LanguageIds(), m.Language) {
+		return fmt.Errorf("unknown language %q, expected one of %v", m.Language, tu.LanguageIds())
+	}
+	if len(m.Signals) == 0 {
+		return errors.New("missing signals")
+	}
+	for _, s := range m.Signals {
+		if !slices.Contains(manifestSignals, s) {
+			return fmt.Errorf("unknown signal %q, expected one of %v", s, manifestSignals)
+		}
+	}
+	if m.Backend != "" && !slices.Contains(tu.TraceBackendNames(), m.Backend) {
+		return fmt.Errorf("unknown backend %q, expected one of %v", m.Backend, tu.TraceBackendNames())
+	}
+	for _, e := range m.Endpoints {
+		if !strings.HasPrefix(e.Path, "/") {
+			return fmt.Errorf("endpoint path %q must start with /", e.Path)
+		}
+	}
+
+	if m.Expected != "" {
+		if _, err := os.Stat(filepath.Join(dir, m.Expected)); err != nil {
+			return fmt.Errorf("expected telemetry file %s not found", m.Expected)
+		}
+	} else if len(m.Endpoints) > 0 && m.SpecPath(dir) == "" {
+		// the recipes validated by their own Go tests call the sample API themselves
+		return errors.New("endpoints need an expected telemetry file")
+	}
+	return nil
+}
+
+// The path of the expected telemetry file of the recipe in dir, or empty if it has none
+func (m *Manifest) SpecPath(dir string) string {
+	if m.Expected != "" {
+		return filepath.Join(dir, m.Expected)
+	}
+	path := filepath.Join(dir, "test", tu.DefaultSpecFile)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// Loads the expected telemetry file of the recipe with the overrides of its language and of the SDK version
+// applied, see testutils.LoadSpecForSdk. The endpoints of its recipe.yaml are called before the requests of the file
+func (r *Recipe) LoadSpec(sdkVersion string) (*tu.Spec, error) {
+	path := r.SpecPath()
+	if path == "" {
+		return nil, fmt.Errorf("recipe %s has no expected telemetry file", r.ID)
+	}
+	spec, err := tu.LoadSpecForSdk(path, r.LanguageID, sdkVersion)
+	if err != nil {
+		return nil, err
+	}
+	if r.Manifest != nil {
+		spec.Requests = append(slices.Clone(r.Manifest.Endpoints), spec.Requests...)
+	}
+	return spec, nil
+}
@@ -0,0 +1,172 @@
+// Package recipes finds the recipes of the repository, i.e. the folders with a recipefile.json,
+// reads their recipe.yaml manifests and runs the tests of their test modules.
+package recipes // import "github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+const (
+	recipeFileName string = "recipefile.json"
+	// Marks the root of the repository
+	schemaFileName string = "otel-recipes-schema.json"
+)
+
+// The fields of the recipefile.json used by the tooling
+type Recipe struct {
+	// Also the service.name the sample exports its telemetry with
+	ID         string `json:"id"`
+	LanguageID string `json:"languageId"`
+	// One of: traces, metrics, logs
+	Signal string `json:"signal"`
+
+	// The absolute path of the recipe folder
+	Dir string `json:"-"`
+	// The recipe.yaml of the recipe, nil if it has none
+	Manifest *Manifest `json:"-"`
+}
+
+// The folder of the recipe's test module
+func (r *Recipe) TestDir() string {
+	return filepath.Join(r.Dir, "test")
+}
+
+// The path of the recipe folder relative to the repository root, e.g. src/go/traces/console
+func (r *Recipe) Path(root string) string {
+	rel, err := filepath.Rel(root, r.Dir)
+	if err != nil {
+		return r.Dir
+	}
+	return filepath.ToSlash(rel)
+}
+
+// The signals the recipe exports: the ones of its recipe.yaml, or else the one of its recipefile.json
+func (r *Recipe) Signals() []string {
+	if r.Manifest != nil {
+		return r.Manifest.Signals
+	}
+	return []string{r.Signal}
+}
+
+// The path of the recipe's expected telemetry file, or empty if it is validated by the Go tests of its test module
+func (r *Recipe) SpecPath() string {
+	if r.Manifest != nil {
+		return r.Manifest.SpecPath(r.Dir)
+	}
+	path := filepath.Join(r.TestDir(), tu.DefaultSpecFile)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// Reads the recipefile.json in dir, and the recipe.yaml if there is one
+func Load(dir string) (*Recipe, error) {
+	data, err := os.ReadFile(filepath.Join(dir, recipeFileName))
+	if err != nil {
+		return nil, err
+	}
+	r := &Recipe{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("invalid %s in %s: %w", recipeFileName, dir, err)
+	}
+	if r.Dir, err = filepath.Abs(dir); err != nil {
+		return nil, err
+	}
+
+	m, err := LoadManifest(r.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case m.Name != r.ID:
+		return nil, fmt.Errorf("invalid %s in %s: name %s differs from the id %s of the %s", manifestFileName, dir, m.Name, r.ID, recipeFileName)
+	case m.Language != r.LanguageID:
+		return nil, fmt.Errorf("invalid %s in %s: language %s differs from the languageId %s of the %s", manifestFileName, dir, m.Language, r.LanguageID, recipeFileName)
+	case !slices.Contains(m.Signals, r.Signal):
+		return nil, fmt.Errorf("invalid %s in %s: signals %v miss the signal %s of the %s", manifestFileName, dir, m.Signals, r.Signal, recipeFileName)
+	}
+	r.Manifest = m
+	return r, nil
+}
+
+// Finds the recipes with a test module, i.e. the folders with a recipefile.json and a test/go.mod,
+// in the src folder of the repository
+func Discover(root string) ([]*Recipe, error) {
+	return discover(root, true)
+}
+
+// Finds all the recipes in the src folder of the repository, including the ones without a test module
+func DiscoverAll(root string) ([]*Recipe, error) {
+	return discover(root, false)
+}
+
+func discover(root string, withTests bool) ([]*Recipe, error) {
+	var res []*Recipe
+	err := filepath.WalkDir(filepath.Join(root, "src"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == "node_modules" || d.Name() == "site") {
+			return filepath.SkipDir
+		}
+		if d.Name() != recipeFileName {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		if _, err := os.Stat(filepath.Join(dir, "test", "go.mod")); withTests && err != nil {
+			return nil
+		}
+		r, err := Load(dir)
+		if err != nil {
+			return err
+		}
+		res = append(res, r)
+		return nil
+	})
+	return res, err
+}
+
+// Finds the recipe with the given id, e.g. go.console.traces
+func Find(root, id string) (*Recipe, error) {
+	all, err := Discover(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range all {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("no recipe with id %s found in %s", id, root)
+}
+
+// Walks up from dir until the root of the repository
+func FindRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, schemaFileName)); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("not inside the otel-recipes repository")
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,223 @@
+package report // import "github.com/joaopgrassi/otel-recipes/internal/common/report"
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+//go:embed html.tmpl
+var htmlTemplate string
+
+var htmlPage = template.Must(template.New("report").Parse(htmlTemplate))
+
+type htmlReport struct {
+	GeneratedAt string
+	// The number of samples per status, in the order of statuses
+	Counts  []htmlCount
+	Samples []htmlSample
+}
+
+type htmlCount struct {
+	Status string
+	Count  int
+}
+
+type htmlSample struct {
+	*Sample
+	Failed int
+	Traces []htmlTrace
+	// Set when the traces of the report could not be read
+	TraceError string
+}
+
+type htmlTrace struct {
+	ID       string
+	Duration string
+	Spans    []htmlSpan
+}
+
+// A span of the waterfall, positioned relative to the duration of its trace
+type htmlSpan struct {
+	Name       string
+	Kind       string
+	Depth      int
+	Offset     float64
+	Width      float64
+	Duration   string
+	Error      bool
+	Attributes string
+}
+
+// The statuses in the order they are summarized
+var statuses = []string{StatusPassed, StatusFailed, StatusFlaky, StatusQuarantined, StatusSkipped}
+
+// Writes a static HTML page with a table of the assertions of each sample and a waterfall of the traces found
+// in the back-ends, when the report has the telemetry of the samples (see Sample.AddTelemetry)
+func (r *Report) WriteHTML(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	page := htmlReport{GeneratedAt: time.Now().UTC().Format(time.RFC3339)}
+	counts := map[string]int{}
+	for _, s := range r.Samples {
+		counts[s.Status]++
+		hs := htmlSample{Sample: s}
+		for _, a := range s.Assertions {
+			if !a.Passed {
+				hs.Failed++
+			}
+		}
+		if data, ok := s.Telemetry[tu.TraceSignal]; ok {
+			traces, err := waterfall(data)
+			if err != nil {
+				hs.TraceError = err.Error()
+			}
+			hs.Traces = traces
+		}
+		page.Samples = append(page.Samples, hs)
+	}
+	for _, s := range statuses {
+		if counts[s] > 0 {
+			page.Counts = append(page.Counts, htmlCount{Status: s, Count: counts[s]})
+		}
+	}
+	return htmlPage.Execute(w, page)
+}
+
+// Groups the spans of the OTLP JSON by trace and orders them as a tree: each span is followed by its
+// children, by start time. Spans whose parent is not in the telemetry are rendered as roots
+func waterfall(data []byte) ([]htmlTrace, error) {
+	rs := &otlptrace.ResourceSpans{}
+	if err := protojson.Unmarshal(data, rs); err != nil {
+		return nil, fmt.Errorf("invalid traces: %w", err)
+	}
+
+	byTrace := map[string][]*otlptrace.Span{}
+	var ids []string
+	for _, ss := range rs.GetScopeSpans() {
+		for _, s := range ss.GetSpans() {
+			id := hex.EncodeToString(s.GetTraceId())
+			if _, ok := byTrace[id]; !ok {
+				ids = append(ids, id)
+			}
+			byTrace[id] = append(byTrace[id], s)
+		}
+	}
+
+	var traces []htmlTrace
+	for _, id := range ids {
+		traces = append(traces, traceWaterfall(id, byTrace[id]))
+	}
+	slices.SortStableFunc(traces, func(a, b htmlTrace) int { return strings.Compare(a.ID, b.ID) })
+	return traces, nil
+}
+
+func traceWaterfall(id string, spans []*otlptrace.Span) htmlTrace {
+	slices.SortStableFunc(spans, func(a, b *otlptrace.Span) int {
+		return cmp.Compare(a.GetStartTimeUnixNano(), b.GetStartTimeUnixNano())
+	})
+	start, end := spans[0].GetStartTimeUnixNano(), spans[0].GetEndTimeUnixNano()
+	known := map[string]bool{}
+	for _, s := range spans {
+		start, end = min(start, s.GetStartTimeUnixNano()), max(end, s.GetEndTimeUnixNano())
+		known[string(s.GetSpanId())] = true
+	}
+	total := float64(max(end-start, 1))
+
+	children := map[string][]*otlptrace.Span{}
+	var roots []*otlptrace.Span
+	for _, s := range spans {
+		if parent := string(s.GetParentSpanId()); parent != "" && known[parent] {
+			children[parent] = append(children[parent], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+
+	t := htmlTrace{ID: id, Duration: formatDuration(end - start)}
+	var visit func(s *otlptrace.Span, depth int)
+	visit = func(s *otlptrace.Span, depth int) {
+		duration := s.GetEndTimeUnixNano() - min(s.GetStartTimeUnixNano(), s.GetEndTimeUnixNano())
+		t.Spans = append(t.Spans, htmlSpan{
+			Name:       s.GetName(),
+			Kind:       strings.ToLower(strings.TrimPrefix(s.GetKind().String(), "SPAN_KIND_")),
+			Depth:      depth,
+			Offset:     float64(s.GetStartTimeUnixNano()-start) / total * 100,
+			Width:      max(float64(duration)/total*100, 0.5),
+			Duration:   formatDuration(duration),
+			Error:      s.GetStatus().GetCode() == otlptrace.Status_STATUS_CODE_ERROR,
+			Attributes: strings.TrimSpace(attributesText(s.GetAttributes()) + "\n" + droppedText(s)),
+		})
+		for _, c := range children[string(s.GetSpanId())] {
+			visit(c, depth+1)
+		}
+	}
+	for _, s := range roots {
+		visit(s, 0)
+	}
+	return t
+}
+
+func formatDuration(nanos uint64) string {
+	return time.Duration(nanos).Round(time.Microsecond).String()
+}
+
+// The attributes of a span, one key=value per line, shown when hovering the span
+func attributesText(attrs []*otlpcommon.KeyValue) string {
+	var b strings.Builder
+	for _, a := range attrs {
+		fmt.Fprintf(&b, "%s=%s\n", a.GetKey(), anyValueText(a.GetValue()))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// The counts of the attributes, events and links of the span dropped by the SDK limits, if any
+func droppedText(s *otlptrace.Span) string {
+	var dropped []string
+	for _, c := range []struct {
+		what  string
+		count uint32
+	}{
+		{"attributes", s.GetDroppedAttributesCount()},
+		{"events", s.GetDroppedEventsCount()},
+		{"links", s.GetDroppedLinksCount()},
+	} {
+		if c.count > 0 {
+			dropped = append(dropped, fmt.Sprintf("%d %s", c.count, c.what))
+		}
+	}
+	if len(dropped) == 0 {
+		return ""
+	}
+	return "dropped: " + strings.Join(dropped, ", ")
+}
+
+func anyValueText(v *otlpcommon.AnyValue) string {
+	switch v.GetValue().(type) {
+	case *otlpcommon.AnyValue_StringValue:
+		return v.GetStringValue()
+	case *otlpcommon.AnyValue_BoolValue:
+		return fmt.Sprint(v.GetBoolValue())
+	case *otlpcommon.AnyValue_IntValue:
+		return fmt.Sprint(v.GetIntValue())
+	case *otlpcommon.AnyValue_DoubleValue:
+		return fmt.Sprint(v.GetDoubleValue())
+	case *otlpcommon.AnyValue_BytesValue:
+		return hex.EncodeToString(v.GetBytesValue())
+	default:
+		data, _ := protojson.Marshal(v)
+		return string(data)
+	}
+}
@@ -0,0 +1,97 @@
+package report // import "github.com/joaopgrassi/otel-recipes/internal/common/report"
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     float64         `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	// The failed attempts of an assertion that passed when rerun, as reported by the surefire plugin
+	FlakyFailures []junitFailure `xml:"flakyFailure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// Writes one suite per sample, with a test case per assertion. Samples failing or skipped
+// before any assertion ran get a single test case with the status of the sample. The failures
+// of quarantined samples are reported as skipped, so they don't fail the CI jobs reading the report
+func (r *Report) WriteJUnit(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var res junitTestSuites
+	for _, s := range r.Samples {
+		suite := junitTestSuite{Name: s.Path, Time: s.Duration}
+
+		cases := s.Assertions
+		if len(cases) == 0 {
+			cases = []Assertion{{Name: s.Path, Passed: s.Status != StatusFailed && s.Status != StatusQuarantined}}
+		}
+		for _, a := range cases {
+			tc := junitTestCase{Name: a.Name, ClassName: s.Recipe}
+			switch {
+			case !a.Passed && s.Status == StatusQuarantined:
+				tc.Skipped = &junitSkipped{Message: "quarantined, failed in all the attempts"}
+				suite.Skipped++
+			case !a.Passed:
+				tc.Failure = &junitFailure{Message: "assertion failed, see the test output"}
+				suite.Failures++
+			case len(s.Assertions) == 0 && s.Status == StatusSkipped:
+				tc.Skipped = &junitSkipped{}
+				suite.Skipped++
+			}
+			for _, at := range s.Attempts {
+				if s.Status == StatusFlaky && !attemptPassed(at, a.Name) {
+					tc.FlakyFailures = append(tc.FlakyFailures, junitFailure{Message: "failed in a previous attempt"})
+				}
+			}
+			suite.Cases = append(suite.Cases, tc)
+			suite.Tests++
+		}
+		res.Suites = append(res.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(res)
+}
+
+// Whether the assertion passed in the attempt. Attempts failing before any assertion ran fail all of them
+func attemptPassed(at Attempt, name string) bool {
+	if at.Status == StatusPassed {
+		return true
+	}
+	for _, a := range at.Assertions {
+		if a.Name == name {
+			return a.Passed
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+// Package report holds the results of validating the samples, e.g. by the samples runner or the
+// otel-recipes CLI, and writes them as JSON (for the website and CI dashboards), JUnit XML or an HTML page.
+package report // import "github.com/joaopgrassi/otel-recipes/internal/common/report"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	StatusPassed  string = "passed"
+	StatusFailed  string = "failed"
+	StatusSkipped string = "skipped"
+	// Failed, then passed when validated again
+	StatusFlaky string = "flaky"
+	// Failed in all the attempts, but known to be flaky, so it doesn't fail the run
+	StatusQuarantined string = "quarantined"
+)
+
+// The results of a validation run. Samples can be added concurrently
+type Report struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	Samples     []*Sample `json:"samples"`
+
+	mu sync.Mutex
+}
+
+type Sample struct {
+	// The id in the recipefile.json, which is also the service.name of the sample
+	Recipe     string      `json:"recipe"`
+	Path       string      `json:"path"`
+	Language   string      `json:"language"`
+	Signal     string      `json:"signal"`
+	Status     string      `json:"status"`
+	Duration   float64     `json:"durationSeconds"`
+	Assertions []Assertion `json:"assertions"`
+	// The OTLP JSON of the traces, metrics and logs found in the back-ends
+	Telemetry map[string]json.RawMessage `json:"telemetry,omitempty"`
+	// The validations of the sample, when it is validated again after failing. The assertions
+	// and the telemetry of the sample are the ones of the last attempt
+	Attempts    []Attempt `json:"attempts,omitempty"`
+	Quarantined bool      `json:"quarantined,omitempty"`
+}
+
+type Attempt struct {
+	Status     string      `json:"status"`
+	Duration   float64     `json:"durationSeconds"`
+	Assertions []Assertion `json:"assertions"`
+}
+
+type Assertion struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+}
+
+// Creates the report of a sample at path, relative to the repository root. The recipe may be nil,
+// e.g. for samples without a recipefile.json
+func NewSample(r *recipes.Recipe, path string) *Sample {
+	s := &Sample{Path: path}
+	if r != nil {
+		s.Recipe = r.ID
+		s.Language = r.LanguageID
+		s.Signal = r.Signal
+	}
+	return s
+}
+
+func (s *Sample) AddAssertions(results []tu.AssertionResult) {
+	for _, r := range results {
+		s.Assertions = append(s.Assertions, Assertion{Name: r.Name, Passed: r.Passed})
+	}
+}
+
+// Adds the OTLP JSON of the signals found in the back-ends
+func (s *Sample) AddTelemetry(c *tu.CapturedTelemetry) error {
+	s.Telemetry = make(map[string]json.RawMessage)
+	for signal, m := range map[string]proto.Message{tu.TraceSignal: c.Traces, tu.MetricsSignal: c.Metrics, tu.LogsSignal: c.Logs} {
+		if !m.ProtoReflect().IsValid() {
+			continue
+		}
+		data, err := protojson.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed marshaling the %s of %s: %w", signal, s.Recipe, err)
+		}
+		s.Telemetry[signal] = data
+	}
+	return nil
+}
+
+// Records an attempt to validate the sample, e.g. the report of the sample validated in another process.
+// The assertions and the telemetry of the sample become the ones of the attempt
+func (s *Sample) AddAttempt(a *Sample) {
+	s.Attempts = append(s.Attempts, Attempt{Status: a.Status, Duration: a.Duration, Assertions: a.Assertions})
+	s.Assertions, s.Telemetry = a.Assertions, a.Telemetry
+}
+
+// Sets the status and the duration of the sample from the test that validated it, or from its attempts.
+// Meant to be called from a t.Cleanup, once the test and its subtests completed
+func (s *Sample) Finish(t tu.TestingT, start time.Time) {
+	s.Duration = time.Since(start).Seconds()
+	if len(s.Attempts) > 0 && !t.Skipped() {
+		s.Status = s.attemptsStatus()
+		return
+	}
+	switch {
+	case t.Skipped():
+		s.Status = StatusSkipped
+	case t.Failed():
+		s.Status = StatusFailed
+	default:
+		s.Status = StatusPassed
+	}
+}
+
+func (s *Sample) attemptsStatus() string {
+	last := s.Attempts[len(s.Attempts)-1].Status
+	switch {
+	case last == StatusPassed && len(s.Attempts) > 1:
+		return StatusFlaky
+	case last == StatusPassed || last == StatusSkipped:
+		return last
+	case s.Quarantined:
+		return StatusQuarantined
+	default:
+		return StatusFailed
+	}
+}
+
+func (r *Report) Add(s *Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Samples = append(r.Samples, s)
+}
+
+// Reads a report written by WriteJSON
+func ReadJSON(r io.Reader) (*Report, error) {
+	rep := &Report{}
+	if err := json.NewDecoder(r).Decode(rep); err != nil {
+		return nil, fmt.Errorf("invalid report: %w", err)
+	}
+	return rep, nil
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.GeneratedAt = time.Now().UTC()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,107 @@
+// Package retry implements exponential backoff retries with jitter, bounded
+// by a max elapsed time and by the context deadline.
+package retry // import "github.com/joaopgrassi/otel-recipes/internal/common/retry"
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Returned when the operation did not succeed within the policy's max elapsed time
+var ErrExhausted = errors.New("retry policy exhausted")
+
+type Policy struct {
+	// Wait before the second attempt
+	InitialInterval time.Duration
+	// Upper bound for the wait between two attempts
+	MaxInterval time.Duration
+	// Factor the wait is multiplied by after each attempt
+	Multiplier float64
+	// Randomization factor (0 to 1) applied to each wait, e.g. 0.2 means +/-20%
+	Jitter float64
+	// Total time after which no more attempts are made. Zero means no limit
+	// other than the context deadline
+	MaxElapsedTime time.Duration
+}
+
+// The default policy roughly matches the fixed schedule the tests used
+// before: first retry after 1s, giving up after about 80s
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialInterval: 1 * time.Second,
+		MaxInterval:     30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxElapsedTime:  80 * time.Second,
+	}
+}
+
+// Operation returns done=true once it succeeded. A non-nil error stops the retries.
+type Operation func() (done bool, err error)
+
+// Called before waiting for the next attempt
+type Notify func(attempt int, wait time.Duration)
+
+func Do(ctx context.Context, p Policy, op Operation) error {
+	return DoNotify(ctx, p, op, nil)
+}
+
+// Runs the operation until it is done, it fails, the policy is exhausted or the context is done
+func DoNotify(ctx context.Context, p Policy, op Operation, notify Notify) error {
+	start := time.Now()
+	wait := p.InitialInterval
+
+	for attempt := 1; ; attempt++ {
+		done, err := op()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		next := p.jitter(wait)
+		if p.MaxElapsedTime > 0 && time.Since(start)+next > p.MaxElapsedTime {
+			return ErrExhausted
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(next).After(deadline) {
+			return ErrExhausted
+		}
+
+		if notify != nil {
+			notify(attempt, next)
+		}
+
+		timer := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		wait = p.nextInterval(wait)
+	}
+}
+
+func (p Policy) nextInterval(wait time.Duration) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	next := time.Duration(float64(wait) * multiplier)
+	if p.MaxInterval > 0 && next > p.MaxInterval {
+		return p.MaxInterval
+	}
+	return next
+}
+
+func (p Policy) jitter(wait time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return wait
+	}
+	delta := p.Jitter * float64(wait)
+	return time.Duration(float64(wait) - delta + rand.Float64()*2*delta)
+}
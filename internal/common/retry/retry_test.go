@@ -0,0 +1,167 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNextInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Policy
+		wait time.Duration
+		want time.Duration
+	}{
+		{"doubled", Policy{Multiplier: 2, MaxInterval: 30 * time.Second}, time.Second, 2 * time.Second},
+		{"capped", Policy{Multiplier: 2, MaxInterval: 30 * time.Second}, 20 * time.Second, 30 * time.Second},
+		{"at the cap", Policy{Multiplier: 2, MaxInterval: 30 * time.Second}, 30 * time.Second, 30 * time.Second},
+		{"no cap", Policy{Multiplier: 3}, 20 * time.Second, 60 * time.Second},
+		{"fractional multiplier", Policy{Multiplier: 1.5}, time.Second, 1500 * time.Millisecond},
+		{"multiplier below 1", Policy{Multiplier: 0.5}, time.Second, time.Second},
+		{"no multiplier", Policy{}, time.Second, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.nextInterval(tt.wait); got != tt.want {
+				t.Errorf("nextInterval(%v) = %v, want %v", tt.wait, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		jitter   float64
+		min, max time.Duration
+	}{
+		{"none", 0, time.Second, time.Second},
+		{"negative", -0.5, time.Second, time.Second},
+		{"20%", 0.2, 800 * time.Millisecond, 1200 * time.Millisecond},
+		{"full", 1, 0, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Policy{Jitter: tt.jitter}
+			for i := 0; i < 1000; i++ {
+				if got := p.jitter(time.Second); got < tt.min || got > tt.max {
+					t.Fatalf("jitter(1s) = %v, want within [%v, %v]", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestDoNotify(t *testing.T) {
+	errOp := errors.New("op failed")
+	tests := []struct {
+		name string
+		p    Policy
+		// the attempt the operation is done at, or fails at if err is set. Zero never ends it
+		doneAt int
+		err    error
+		// timeout of the context, zero for none
+		timeout      time.Duration
+		want         error
+		wantAttempts int
+	}{
+		{
+			name:         "done at once",
+			p:            Policy{InitialInterval: time.Millisecond},
+			doneAt:       1,
+			wantAttempts: 1,
+		},
+		{
+			name:         "done after retries",
+			p:            Policy{InitialInterval: time.Millisecond, Multiplier: 2},
+			doneAt:       3,
+			wantAttempts: 3,
+		},
+		{
+			name:         "operation error",
+			p:            Policy{InitialInterval: time.Millisecond},
+			doneAt:       2,
+			err:          errOp,
+			want:         errOp,
+			wantAttempts: 2,
+		},
+		{
+			// waits of 20ms, 40ms, 80ms: the fourth wait would end after 300ms
+			name:         "max elapsed time",
+			p:            Policy{InitialInterval: 20 * time.Millisecond, Multiplier: 2, MaxElapsedTime: 250 * time.Millisecond},
+			want:         ErrExhausted,
+			wantAttempts: 4,
+		},
+		{
+			name:         "wait beyond the max elapsed time",
+			p:            Policy{InitialInterval: time.Hour, MaxElapsedTime: time.Minute},
+			want:         ErrExhausted,
+			wantAttempts: 1,
+		},
+		{
+			name:         "wait beyond the context deadline",
+			p:            Policy{InitialInterval: time.Hour},
+			timeout:      time.Minute,
+			want:         ErrExhausted,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			attempts, notified := 0, 0
+			err := DoNotify(ctx, tt.p, func() (bool, error) {
+				attempts++
+				if attempts == tt.doneAt {
+					return tt.err == nil, tt.err
+				}
+				return false, nil
+			}, func(attempt int, wait time.Duration) {
+				notified++
+				if attempt != notified {
+					t.Errorf("notified of attempt %d, want %d", attempt, notified)
+				}
+			})
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("DoNotify() = %v, want %v", err, tt.want)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			// every attempt but the last one is followed by a wait
+			if notified != tt.wantAttempts-1 {
+				t.Errorf("notified %d times, want %d", notified, tt.wantAttempts-1)
+			}
+		})
+	}
+}
+
+func TestDoNotifyCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	attempts := 0
+	err := DoNotify(ctx, Policy{InitialInterval: time.Hour}, func() (bool, error) {
+		attempts++
+		return false, nil
+	}, func(int, time.Duration) { cancel() })
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DoNotify() = %v, want %v", err, context.Canceled)
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1", attempts)
+	}
+}
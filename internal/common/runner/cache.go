@@ -0,0 +1,144 @@
+package runner // import "github.com/joaopgrassi/otel-recipes/internal/common/runner"
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var rebuild = flag.Bool("rebuild", false, "Build the images of the sample apps even if an image of the same build context exists")
+
+// The length of the hash tagging the built images, e.g. otel-recipes-go-traces-gin-api:3f2a9c1b7d4e
+const cacheTagLength int = 12
+
+// Builds the image of the app unless an image of the same build context exists, so validating an unchanged
+// recipe again skips the build. Returns the image tagged with the hash of its build context
+func buildImage(ctx context.Context, image, dir, dockerfile string) (string, error) {
+	hash, err := contextHash(dir, dockerfile)
+	if err != nil {
+		return "", fmt.Errorf("failed hashing the build context of %s: %w", dir, err)
+	}
+	tagged := cacheTag(image, hash)
+	if !*rebuild {
+		if _, err := docker(ctx, "image", "inspect", "--format", "{{.Id}}", tagged); err == nil {
+			return tagged, nil
+		}
+	}
+	_, err = docker(ctx, "build", "--quiet", "--tag", image, "--tag", tagged, "--file", filepath.Join(dir, dockerfile), dir)
+	return tagged, err
+}
+
+// Tags the image with the hash in place of its tag, if any, e.g. otel-recipes-go:3f2a9c1b7d4e for otel-recipes-go:latest
+func cacheTag(image, hash string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image + ":" + hash[:cacheTagLength]
+}
+
+// Hashes the path, mode and content of the files docker sends as build context, i.e. the ones of dir not
+// excluded by its .dockerignore, and the Dockerfile
+func contextHash(dir, dockerfile string) (string, error) {
+	ignored, err := readDockerignore(dir)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "dockerfile %s\n", filepath.ToSlash(dockerfile))
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		// the Dockerfile is always sent, even if ignored
+		if rel != filepath.ToSlash(dockerfile) && ignored(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %s\n", rel, info.Mode())
+		if !info.Mode().IsRegular() {
+			if info.Mode()&fs.ModeSymlink != 0 {
+				target, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(h, "-> %s\n", target)
+			}
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(h, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Reads the patterns of the .dockerignore in dir, if any. The exceptions starting with ! are not supported, so
+// with any of them nothing is ignored: the hash covers more files than sent, which only rebuilds the image more often
+func readDockerignore(dir string) (func(rel string) bool, error) {
+	var patterns []string
+	f, err := os.Open(filepath.Join(dir, ".dockerignore"))
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "!") {
+				patterns = nil
+				break
+			}
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			patterns = append(patterns, strings.Trim(path.Clean(filepath.ToSlash(line)), "/"))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return func(rel string) bool {
+		for _, p := range patterns {
+			// a pattern matching a folder excludes its content, which is skipped with the folder
+			if matched, _ := path.Match(p, rel); matched {
+				return true
+			}
+			if strings.HasPrefix(p, "**/") {
+				if matched, _ := path.Match(strings.TrimPrefix(p, "**/"), path.Base(rel)); matched {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
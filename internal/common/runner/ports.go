@@ -0,0 +1,61 @@
+package runner // import "github.com/joaopgrassi/otel-recipes/internal/common/runner"
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+// Returns n distinct TCP ports free on the host, so the apps and back-ends of recipes validated in parallel
+// don't collide on the default ones, e.g. 8080 or 4317. The ports are only free when returned: another
+// process can still take one before the app listens on it
+func FreePorts(n int) ([]int, error) {
+	listeners := make([]net.Listener, 0, n)
+	defer func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}()
+
+	ports := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		// kept open until all are allocated, so the same port is not returned twice
+		listeners = append(listeners, l)
+		ports = append(ports, l.Addr().(*net.TCPAddr).Port)
+	}
+	return ports, nil
+}
+
+func FreePort() (int, error) {
+	ports, err := FreePorts(1)
+	if err != nil {
+		return 0, err
+	}
+	return ports[0], nil
+}
+
+// Renders the Go template of a configuration file, e.g. a collector-config.yaml listening on
+// {{ .OTLP_GRPC_PORT }}, into a file of the test's temporary folder. Returns the path of the rendered file
+func RenderConfig(t *testing.T, src string, data any) string {
+	tmpl, err := template.New(filepath.Base(src)).Option("missingkey=error").ParseFiles(src)
+	if err != nil {
+		t.Fatalf("Invalid configuration template %s: %v", src, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("Failed rendering the configuration template %s: %v", src, err)
+	}
+
+	dst := filepath.Join(t.TempDir(), filepath.Base(src))
+	if err := os.WriteFile(dst, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("Failed writing the rendered configuration %s: %v", dst, err)
+	}
+	return dst
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package runner // import "github.com/joaopgrassi/otel-recipes/internal/common/runner"
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Starts the process in its own process group, so its children, e.g. the binary built by go run, are
+// interrupted and killed with it
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func interruptProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+}
+
+func killProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func resolveCommand(dir, name string) string {
+	return name
+}
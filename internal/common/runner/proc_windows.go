@@ -0,0 +1,42 @@
+//go:build windows
+
+package runner // import "github.com/joaopgrassi/otel-recipes/internal/common/runner"
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// Windows has no interrupt signal for the processes of another console, so they are killed right away
+func interruptProcess(cmd *exec.Cmd) error {
+	return errors.New("interrupting a process is not supported on Windows")
+}
+
+// Kills the process and its children, e.g. the binary built by go run, which Process.Kill would leave running
+func killProcess(cmd *exec.Cmd) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// Runs the Windows variant of a script of the sample, e.g. gradlew.bat for ./gradlew
+func resolveCommand(dir, name string) string {
+	if filepath.Ext(name) != "" || filepath.Base(name) == name {
+		return name
+	}
+	for _, ext := range []string{".bat", ".cmd"} {
+		if _, err := os.Stat(filepath.Join(dir, name+ext)); err == nil {
+			return name + ext
+		}
+	}
+	return name
+}
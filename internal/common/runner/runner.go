@@ -0,0 +1,325 @@
+// Package runner builds, starts and stops the sample application of a recipe from the Go tests, either as
+// a docker container built from its Dockerfile or as a native process, so the harness owns the whole
+// lifecycle of the recipe instead of scripts run before go test. The docker apps need the docker CLI.
+package runner // import "github.com/joaopgrassi/otel-recipes/internal/common/runner"
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/containers"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+const (
+	defaultDockerfile string = "Dockerfile"
+	// Time allowed to build and start the app in Run. Building the images can take a while
+	defaultStartTimeout time.Duration = 10 * time.Minute
+	// Time a native process has to exit after being interrupted, before it is killed
+	stopTimeout time.Duration = 10 * time.Second
+	// Time the output is still read after a native process exited, as its children can keep it open
+	outputTimeout time.Duration = 2 * time.Second
+)
+
+// A sample application to run
+type App struct {
+	// The folder of the sample, where the native process runs and the image is built
+	Dir string
+	// The command of a native process, e.g. go run . or dotnet run. Empty builds and runs the Dockerfile in Dir.
+	// On Windows, the .bat or .cmd variant of a script of the sample is run, e.g. gradlew.bat for ./gradlew
+	Cmd []string
+	// The Dockerfile, relative to Dir. Defaults to Dockerfile
+	Dockerfile string
+	// The name of the built image. Defaults to a name derived from the sample path, e.g. otel-recipes-go-traces-console.
+	// The image is also tagged with the hash of its build context, so it is only built again once the context changed
+	Image string
+	Env   []string
+	// Environment variables set to free ports of the host for a native app, e.g. PORT, so several apps
+	// listen side by side. The ports are then given by Process.Port
+	DynamicPorts []string
+	// The docker network to attach the container to, e.g. the one of containers.StartInfra, and the
+	// container ports to publish on random host ports, e.g. 8080/tcp
+	Network string
+	Ports   []string
+}
+
+func (a App) native() bool {
+	return len(a.Cmd) > 0
+}
+
+// A running sample application
+type Process struct {
+	app       App
+	cmd       *exec.Cmd
+	container *containers.Container
+	output    *output
+	ports     map[string]int
+
+	done chan struct{}
+	err  error
+}
+
+// Builds the app if needed and starts it in the background. Each line it prints is passed to onLine
+// as it is printed, e.g. to log it, and kept for Logs
+func Start(ctx context.Context, app App, onLine func(line string)) (*Process, error) {
+	p := &Process{app: app, output: &output{onLine: onLine}, done: make(chan struct{})}
+	if app.native() {
+		return p, p.startNative()
+	}
+	return p, p.startContainer(ctx)
+}
+
+// Builds and starts the app, streaming its output to the test log at debug level, and stops it once the
+// test and its subtests complete. The output is printed if the test failed:
+//
+//	runner.Run(t, runner.App{Dir: "..", Cmd: []string{"go", "run", "."}})
+func Run(t *testing.T, app App) *Process {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultStartTimeout)
+	defer cancel()
+
+	tu.Logger(t).Info("Starting the sample app", "dir", app.Dir, "cmd", strings.Join(app.Cmd, " "))
+	p, err := Start(ctx, app, func(line string) {
+		tu.Logger(t).Debug("Sample app output", "line", line)
+	})
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("Output of the sample app:\n%s", p.Logs())
+		}
+		if err := p.Stop(context.Background()); err != nil {
+			t.Errorf("Failed stopping the sample app: %v", err)
+		}
+	})
+	tu.AddArtifact(t, "app.log", func() ([]byte, error) { return []byte(p.Logs()), nil })
+	if err != nil {
+		t.Fatalf("Failed starting the sample app in %s: %v", app.Dir, err)
+	}
+	return p
+}
+
+func (p *Process) startNative() error {
+	free, err := FreePorts(len(p.app.DynamicPorts))
+	if err != nil {
+		close(p.done)
+		return err
+	}
+	p.ports = make(map[string]int, len(free))
+	env := append(os.Environ(), p.app.Env...)
+	for i, name := range p.app.DynamicPorts {
+		p.ports[name] = free[i]
+		env = append(env, fmt.Sprintf("%s=%d", name, free[i]))
+	}
+
+	p.cmd = exec.Command(resolveCommand(p.app.Dir, p.app.Cmd[0]), p.app.Cmd[1:]...)
+	p.cmd.Dir = p.app.Dir
+	setProcessGroup(p.cmd)
+	p.cmd.Env = env
+	p.cmd.Stdout, p.cmd.Stderr = p.output, p.output
+	p.cmd.WaitDelay = outputTimeout
+	if err := p.cmd.Start(); err != nil {
+		close(p.done)
+		return err
+	}
+	go func() {
+		p.err = p.cmd.Wait()
+		p.output.flush()
+		close(p.done)
+	}()
+	return nil
+}
+
+func (p *Process) startContainer(ctx context.Context) error {
+	image := p.app.Image
+	if image == "" {
+		image = imageName(p.app.Dir)
+	}
+	dockerfile := p.app.Dockerfile
+	if dockerfile == "" {
+		dockerfile = defaultDockerfile
+	}
+	image, err := buildImage(ctx, image, p.app.Dir, dockerfile)
+	if err != nil {
+		close(p.done)
+		return err
+	}
+
+	p.container, err = containers.Run(ctx, containers.Request{Image: image, Network: p.app.Network, Env: p.app.Env, Ports: p.app.Ports})
+	if err != nil {
+		close(p.done)
+		return err
+	}
+
+	// follows the output until the container exits or is removed
+	p.cmd = exec.Command("docker", "logs", "--follow", p.container.ID())
+	p.cmd.Stdout, p.cmd.Stderr = p.output, p.output
+	if err := p.cmd.Start(); err != nil {
+		close(p.done)
+		return err
+	}
+	go func() {
+		_ = p.cmd.Wait()
+		p.output.flush()
+		close(p.done)
+	}()
+	return nil
+}
+
+// The output of the app printed so far, stdout and stderr interleaved
+func (p *Process) Logs() string {
+	return p.output.String()
+}
+
+// Returns the host address a published port of a docker app can be reached at, e.g. 127.0.0.1:49153 for 8080/tcp
+func (p *Process) Addr(port string) string {
+	if p.container == nil {
+		return ""
+	}
+	return p.container.Addr(port)
+}
+
+// Returns the port allocated to the environment variable of DynamicPorts, or 0
+func (p *Process) Port(env string) int {
+	return p.ports[env]
+}
+
+// Waits until the app exits, e.g. console samples exporting their telemetry once. Fails if it exited with
+// a code other than 0
+func (p *Process) Wait(ctx context.Context) error {
+	if p.container != nil {
+		out, err := docker(ctx, "wait", p.container.ID())
+		if err != nil {
+			return err
+		}
+		if code, err := strconv.Atoi(strings.TrimSpace(out)); err != nil || code != 0 {
+			return fmt.Errorf("the sample app exited with code %s", strings.TrimSpace(out))
+		}
+		return nil
+	}
+
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stops the app: the container is removed and the native process interrupted, then killed if it does not
+// exit in time, together with the processes it started. Stopping an app which already exited is not an error
+func (p *Process) Stop(ctx context.Context) error {
+	if p.container != nil {
+		err := p.container.Stop(ctx)
+		<-p.done
+		return err
+	}
+	if p.cmd == nil || p.cmd.Process == nil {
+		return nil
+	}
+
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+	// not supported on Windows, where the process is killed right away
+	if err := interruptProcess(p.cmd); err != nil {
+		_ = killProcess(p.cmd)
+	}
+	select {
+	case <-p.done:
+		// the children may ignore the interrupt, e.g. the ones started in the background by a shell
+		_ = killProcess(p.cmd)
+	case <-time.After(stopTimeout):
+		if err := killProcess(p.cmd); err != nil && !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH) {
+			return err
+		}
+		<-p.done
+	}
+	return nil
+}
+
+// Keeps the output of the app and passes each complete line to onLine
+type output struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	partial []byte
+	onLine  func(string)
+}
+
+func (o *output) Write(b []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf.Write(b)
+	o.partial = append(o.partial, b...)
+	for {
+		i := bytes.IndexByte(o.partial, '\n')
+		if i < 0 {
+			break
+		}
+		o.emit(string(bytes.TrimRight(o.partial[:i], "\r")))
+		o.partial = o.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+// Passes the last line, not terminated by a new line
+func (o *output) flush() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.partial) > 0 {
+		o.emit(string(o.partial))
+		o.partial = nil
+	}
+}
+
+func (o *output) emit(line string) {
+	if o.onLine != nil {
+		o.onLine(line)
+	}
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+var invalidImageChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// Derives the image name from the last folders of the sample path, e.g. src/go/traces/console -> otel-recipes-go-traces-console
+func imageName(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+
+	parts := strings.Split(filepath.ToSlash(abs), "/")
+	if len(parts) > 3 {
+		parts = parts[len(parts)-3:]
+	}
+	name := invalidImageChars.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-")
+	return "otel-recipes-" + strings.Trim(name, "-_.")
+}
+
+func docker(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.String(), nil
+}
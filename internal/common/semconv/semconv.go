@@ -0,0 +1,239 @@
+// Package semconv validates the attributes recorded by the recipes against a bundled
+// subset of the OpenTelemetry semantic conventions registry (see registry.yaml).
+package semconv // import "github.com/joaopgrassi/otel-recipes/internal/common/semconv"
+
+import (
+	_ "embed"
+	"fmt"
+	"slices"
+	"strings"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed registry.yaml
+var bundledRegistry []byte
+
+type Severity int
+
+const (
+	// The attribute is allowed but should be changed, e.g. it is deprecated
+	Warning Severity = iota
+	// The attribute does not conform to the semantic conventions
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+type Violation struct {
+	Key      string
+	Reason   string
+	Severity Severity
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("[%s] %s: %s", v.Severity, v.Key, v.Reason)
+}
+
+type Attribute struct {
+	Name string `yaml:"name"`
+	// One of: string, int, double, boolean, string[], int[], double[], boolean[]
+	Type string `yaml:"type"`
+	// The deprecation note. Empty if the attribute is not deprecated
+	Deprecated string `yaml:"deprecated"`
+}
+
+// Group holds the attributes required for a kind of span, e.g. HTTP server spans
+type Group struct {
+	ID string `yaml:"id"`
+	// One of the span kinds in lowercase (server, client, ...). Empty matches any kind
+	Kind     string   `yaml:"kind"`
+	When     []string `yaml:"when"`
+	Required []string `yaml:"required"`
+}
+
+// Event holds the attributes required for the log records of an event, identified by their event.name
+type Event struct {
+	Name     string   `yaml:"name"`
+	Required []string `yaml:"required"`
+	// At least one of the attributes is required
+	AnyOf []string `yaml:"anyOf"`
+}
+
+type Registry struct {
+	Version    string      `yaml:"version"`
+	Attributes []Attribute `yaml:"attributes"`
+	Groups     []Group     `yaml:"groups"`
+	Events     []Event     `yaml:"events"`
+
+	byName     map[string]Attribute
+	namespaces map[string]bool
+	events     map[string]Event
+}
+
+// Loads the registry bundled with the package
+func Default() *Registry {
+	r, err := Load(bundledRegistry)
+	if err != nil {
+		panic(fmt.Sprintf("invalid bundled semantic conventions registry: %v", err))
+	}
+	return r
+}
+
+func Load(data []byte) (*Registry, error) {
+	r := &Registry{}
+	if err := yaml.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+
+	r.byName = make(map[string]Attribute, len(r.Attributes))
+	r.namespaces = make(map[string]bool)
+	for _, a := range r.Attributes {
+		r.byName[a.Name] = a
+		r.namespaces[namespace(a.Name)] = true
+	}
+	r.events = make(map[string]Event, len(r.Events))
+	for _, e := range r.Events {
+		r.events[e.Name] = e
+	}
+	return r, nil
+}
+
+// Validates the attributes of a span, including the ones required for its kind
+func (r *Registry) ValidateSpan(span *otlptrace.Span) []Violation {
+	violations := r.ValidateAttributes(span.GetAttributes())
+
+	keys := make(map[string]bool, len(span.GetAttributes()))
+	for _, kv := range span.GetAttributes() {
+		keys[kv.GetKey()] = true
+	}
+
+	kind := strings.ToLower(strings.TrimPrefix(span.GetKind().String(), "SPAN_KIND_"))
+	for _, g := range r.Groups {
+		if !g.appliesTo(kind, keys) {
+			continue
+		}
+		for _, req := range g.Required {
+			if !keys[req] {
+				violations = append(violations, Violation{
+					Key:      req,
+					Reason:   fmt.Sprintf("attribute is required for %s spans", g.ID),
+					Severity: Error,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// Validates the attributes of the log record of an event, including the ones required for it.
+// Events not in the registry, e.g. the custom ones of a recipe, only have their attributes validated
+func (r *Registry) ValidateEvent(name string, attributes []*otlpcommon.KeyValue) []Violation {
+	violations := r.ValidateAttributes(attributes)
+
+	e, found := r.events[name]
+	if !found {
+		return violations
+	}
+	keys := make(map[string]bool, len(attributes))
+	for _, kv := range attributes {
+		keys[kv.GetKey()] = true
+	}
+	for _, req := range e.Required {
+		if !keys[req] {
+			violations = append(violations, Violation{
+				Key:      req,
+				Reason:   fmt.Sprintf("attribute is required for %s events", e.Name),
+				Severity: Error,
+			})
+		}
+	}
+	if len(e.AnyOf) > 0 && !slices.ContainsFunc(e.AnyOf, func(k string) bool { return keys[k] }) {
+		violations = append(violations, Violation{
+			Key:      strings.Join(e.AnyOf, "|"),
+			Reason:   fmt.Sprintf("one of the attributes is required for %s events", e.Name),
+			Severity: Error,
+		})
+	}
+	return violations
+}
+
+// Validates the attribute names and types. Attributes outside the namespaces known
+// to the registry (e.g. custom ones like foo) are not validated.
+func (r *Registry) ValidateAttributes(attributes []*otlpcommon.KeyValue) []Violation {
+	var violations []Violation
+	for _, kv := range attributes {
+		a, found := r.byName[kv.GetKey()]
+		if !found {
+			if r.namespaces[namespace(kv.GetKey())] {
+				violations = append(violations, Violation{
+					Key:      kv.GetKey(),
+					Reason:   fmt.Sprintf("attribute is not defined in semantic conventions %s", r.Version),
+					Severity: Warning,
+				})
+			}
+			continue
+		}
+
+		if a.Deprecated != "" {
+			violations = append(violations, Violation{Key: a.Name, Reason: "attribute is deprecated. " + a.Deprecated, Severity: Warning})
+		}
+
+		if actual := valueType(kv.GetValue()); actual != a.Type && !(actual == "array" && strings.HasSuffix(a.Type, "[]")) {
+			violations = append(violations, Violation{
+				Key:      a.Name,
+				Reason:   fmt.Sprintf("attribute has type %s, expected %s", actual, a.Type),
+				Severity: Error,
+			})
+		}
+	}
+	return violations
+}
+
+func (g Group) appliesTo(kind string, keys map[string]bool) bool {
+	if g.Kind != "" && g.Kind != kind {
+		return false
+	}
+	for _, k := range g.When {
+		if !keys[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func namespace(key string) string {
+	ns, _, _ := strings.Cut(key, ".")
+	return ns
+}
+
+func valueType(v *otlpcommon.AnyValue) string {
+	switch val := v.GetValue().(type) {
+	case *otlpcommon.AnyValue_StringValue:
+		return "string"
+	case *otlpcommon.AnyValue_IntValue:
+		return "int"
+	case *otlpcommon.AnyValue_DoubleValue:
+		return "double"
+	case *otlpcommon.AnyValue_BoolValue:
+		return "boolean"
+	case *otlpcommon.AnyValue_ArrayValue:
+		if len(val.ArrayValue.GetValues()) == 0 {
+			return "array"
+		}
+		return valueType(val.ArrayValue.GetValues()[0]) + "[]"
+	case *otlpcommon.AnyValue_KvlistValue:
+		return "map"
+	case *otlpcommon.AnyValue_BytesValue:
+		return "bytes"
+	default:
+		return "empty"
+	}
+}
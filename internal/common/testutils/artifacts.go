@@ -0,0 +1,132 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"archive/zip"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var artifactsDir = flag.String("artifacts-dir", "", "Folder a zip of the telemetry and the container logs of each failed test is written to")
+
+// The files collected for a test, written once it completed
+type artifactBundle struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// Bundles keyed by the name of the test they are collected for
+var bundles sync.Map
+
+// Adds a file to the artifacts of the test, e.g. the logs of a container. It is only collected if the test or one of
+// its subtests failed and -artifacts-dir is set, from a cleanup of the test, so the container must still be running:
+// add the artifact once the container started, as the cleanups run in the reverse order. The artifacts of a test are
+// written to a zip in -artifacts-dir named after it, which the test output references
+func AddArtifact(t TestingT, name string, collect func() ([]byte, error)) {
+	if *artifactsDir == "" {
+		return
+	}
+	b := getOrCreateBundle(t)
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		data, err := collect()
+		if err != nil {
+			Logger(t).Warn("Failed collecting the artifact", "name", name, "error", err)
+			return
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.files[name] = data
+	})
+}
+
+// Adds the telemetry of the service found in the back-ends to the artifacts of the test, as OTLP JSON files
+func AddTelemetryArtifacts(t TestingT, serviceName string) {
+	var captured *CapturedTelemetry
+	capture := func() *CapturedTelemetry {
+		if captured == nil {
+			captured = CaptureTelemetry(t, serviceName)
+		}
+		return captured
+	}
+	for _, a := range []struct {
+		signal string
+		get    func(c *CapturedTelemetry) proto.Message
+	}{
+		{TraceSignal, func(c *CapturedTelemetry) proto.Message { return c.Traces }},
+		{MetricsSignal, func(c *CapturedTelemetry) proto.Message { return c.Metrics }},
+		{LogsSignal, func(c *CapturedTelemetry) proto.Message { return c.Logs }},
+	} {
+		AddArtifact(t, "telemetry/"+a.signal+".json", func() ([]byte, error) {
+			m := a.get(capture())
+			if !m.ProtoReflect().IsValid() {
+				return []byte("null\n"), nil
+			}
+			return protojson.MarshalOptions{Multiline: true}.Marshal(m)
+		})
+	}
+}
+
+// Creates the bundle of the test on the first artifact. Its cleanup is then registered before the ones
+// collecting the artifacts, so it runs after them
+func getOrCreateBundle(t TestingT) *artifactBundle {
+	b, loaded := bundles.LoadOrStore(t.Name(), &artifactBundle{files: make(map[string][]byte)})
+	bundle := b.(*artifactBundle)
+	if !loaded {
+		t.Cleanup(func() {
+			bundles.Delete(t.Name())
+			if !t.Failed() || len(bundle.files) == 0 {
+				return
+			}
+			path, err := bundle.write(t.Name())
+			if err != nil {
+				t.Errorf("Failed writing the artifacts: %v", err)
+				return
+			}
+			t.Logf("The telemetry and the logs of the failure are in %s", path)
+		})
+	}
+	return bundle
+}
+
+var invalidArtifactChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func (b *artifactBundle) write(testName string) (string, error) {
+	if err := os.MkdirAll(*artifactsDir, 0o755); err != nil {
+		return "", err
+	}
+	path, err := filepath.Abs(filepath.Join(*artifactsDir, invalidArtifactChars.ReplaceAllString(testName, "_")+".zip"))
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	z := zip.NewWriter(f)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for name, data := range b.files {
+		w, err := z.Create(name)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(data); err != nil {
+			return "", fmt.Errorf("failed writing %s: %w", name, err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		return "", err
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,217 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// The types of the attribute values, as named in the OpenTelemetry specification
+type AttributeType string
+
+const (
+	StringAttributeType  AttributeType = "string"
+	BoolAttributeType    AttributeType = "bool"
+	Int64AttributeType   AttributeType = "int64"
+	Float64AttributeType AttributeType = "float64"
+	ArrayAttributeType   AttributeType = "array"
+	// Not allowed in attributes by the specification, but found e.g. in log bodies
+	MapAttributeType   AttributeType = "map"
+	BytesAttributeType AttributeType = "bytes"
+	EmptyAttributeType AttributeType = "empty"
+)
+
+// The types allowed for attribute values
+var attributeTypes = []AttributeType{StringAttributeType, BoolAttributeType, Int64AttributeType, Float64AttributeType, ArrayAttributeType}
+
+func AttributeTypeOf(v *otlpcommon.AnyValue) AttributeType {
+	switch v.GetValue().(type) {
+	case *otlpcommon.AnyValue_StringValue:
+		return StringAttributeType
+	case *otlpcommon.AnyValue_BoolValue:
+		return BoolAttributeType
+	case *otlpcommon.AnyValue_IntValue:
+		return Int64AttributeType
+	case *otlpcommon.AnyValue_DoubleValue:
+		return Float64AttributeType
+	case *otlpcommon.AnyValue_ArrayValue:
+		return ArrayAttributeType
+	case *otlpcommon.AnyValue_KvlistValue:
+		return MapAttributeType
+	case *otlpcommon.AnyValue_BytesValue:
+		return BytesAttributeType
+	default:
+		return EmptyAttributeType
+	}
+}
+
+// Asserts the attribute is found with the expected value and type, e.g. the int64 3 and not the string "3"
+func AssertAttribute(t TestingT, attributes []*otlpcommon.KeyValue, exp *otlpcommon.KeyValue) bool {
+	actual := findAttribute(attributes, exp.GetKey())
+	if actual == nil {
+		return assert.Fail(t, "Attribute not found", "Attribute %s %s not found in %v", exp.GetKey(), formatExpectedValue(exp.GetValue()), attributes)
+	}
+	if isAttributePattern(exp) {
+		if !matchAttributeValue(exp.GetValue(), actual.GetValue()) {
+			return assert.Fail(t, "Unexpected attribute value", "Attribute %s is %v, expected a value %s", exp.GetKey(),
+				formatAnyValue(actual.GetValue()), formatExpectedValue(exp.GetValue()))
+		}
+		return true
+	}
+	if typ := AttributeTypeOf(exp.GetValue()); typ != AttributeTypeOf(actual.GetValue()) {
+		return assert.Fail(t, "Unexpected attribute type", "Attribute %s is the %s %v, expected the %s %v", exp.GetKey(),
+			AttributeTypeOf(actual.GetValue()), formatAnyValue(actual.GetValue()), typ, formatAnyValue(exp.GetValue()))
+	}
+	if !proto.Equal(exp.GetValue(), actual.GetValue()) {
+		return assert.Fail(t, "Unexpected attribute value", "Attribute %s is %v, expected %v", exp.GetKey(),
+			formatAnyValue(actual.GetValue()), formatAnyValue(exp.GetValue()))
+	}
+	return true
+}
+
+// Asserts the attribute is found with a value of the given type, e.g. for attributes whose value
+// depends on the run, like the http.response.status_code of a request
+func AssertAttributeType(t TestingT, attributes []*otlpcommon.KeyValue, key string, typ AttributeType) bool {
+	actual := findAttribute(attributes, key)
+	if actual == nil {
+		return assert.Fail(t, "Attribute not found", "Attribute %s not found in %v", key, attributes)
+	}
+	return assert.Equal(t, typ, AttributeTypeOf(actual.GetValue()), "Unexpected type of attribute %s=%v", key, formatAnyValue(actual.GetValue()))
+}
+
+// Asserts the attribute is not found, e.g. for recipes redacting or dropping attributes
+func AssertNoAttribute(t TestingT, attributes []*otlpcommon.KeyValue, key string) bool {
+	if actual := findAttribute(attributes, key); actual != nil {
+		return assert.Fail(t, "Unexpected attribute", "Attribute %s=%v was expected to be absent", key, formatAnyValue(actual.GetValue()))
+	}
+	return true
+}
+
+func findAttribute(attributes []*otlpcommon.KeyValue, key string) *otlpcommon.KeyValue {
+	for _, kv := range attributes {
+		if kv.GetKey() == key {
+			return kv
+		}
+	}
+	return nil
+}
+
+// Formats the value for the failure messages. Strings are quoted, so "3" is told apart from 3
+func formatAnyValue(v *otlpcommon.AnyValue) any {
+	switch val := v.GetValue().(type) {
+	case *otlpcommon.AnyValue_StringValue:
+		return fmt.Sprintf("%q", val.StringValue)
+	case *otlpcommon.AnyValue_BoolValue:
+		return val.BoolValue
+	case *otlpcommon.AnyValue_IntValue:
+		return val.IntValue
+	case *otlpcommon.AnyValue_DoubleValue:
+		return val.DoubleValue
+	case *otlpcommon.AnyValue_ArrayValue:
+		res := make([]any, 0, len(val.ArrayValue.GetValues()))
+		for _, e := range val.ArrayValue.GetValues() {
+			res = append(res, formatAnyValue(e))
+		}
+		return res
+	case *otlpcommon.AnyValue_KvlistValue:
+		values := make([]string, 0, len(val.KvlistValue.GetValues()))
+		for _, kv := range val.KvlistValue.GetValues() {
+			values = append(values, fmt.Sprintf("%s: %v", kv.GetKey(), formatAnyValue(kv.GetValue())))
+		}
+		return "{" + strings.Join(values, ", ") + "}"
+	default:
+		return v
+	}
+}
+
+// Keys of the single entry map values standing for a pattern the actual value must match, instead of the
+// value itself. See RegexAttribute and ContainsAttribute
+const (
+	regexPatternKey    string = "~regex"
+	containsPatternKey string = "~contains"
+)
+
+var patterns sync.Map
+
+// An expected attribute whose value must match the regular expression, e.g. http.url with a port varying
+// between runs: ^http://localhost:[0-9]+/helloworld$. Values other than strings are matched in their text
+// form, e.g. 8080 or true. Panics if the pattern is invalid
+func RegexAttribute(key, pattern string) *otlpcommon.KeyValue {
+	regexp.MustCompile(pattern)
+	return patternAttribute(key, regexPatternKey, pattern)
+}
+
+// An expected attribute whose value must contain the substring. See RegexAttribute
+func ContainsAttribute(key, substring string) *otlpcommon.KeyValue {
+	return patternAttribute(key, containsPatternKey, substring)
+}
+
+func patternAttribute(key, kind, pattern string) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{Key: key, Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_KvlistValue{
+		KvlistValue: &otlpcommon.KeyValueList{Values: []*otlpcommon.KeyValue{StringAttribute(kind, pattern)}},
+	}}}
+}
+
+// Returns the kind and the pattern of an expected value created by RegexAttribute or ContainsAttribute
+func valuePattern(v *otlpcommon.AnyValue) (string, string, bool) {
+	kv := v.GetKvlistValue().GetValues()
+	if len(kv) != 1 || kv[0].GetKey() != regexPatternKey && kv[0].GetKey() != containsPatternKey {
+		return "", "", false
+	}
+	return kv[0].GetKey(), kv[0].GetValue().GetStringValue(), true
+}
+
+func isAttributePattern(kv *otlpcommon.KeyValue) bool {
+	_, _, ok := valuePattern(kv.GetValue())
+	return ok
+}
+
+// Whether the actual value is the expected one or matches its pattern
+func matchAttributeValue(exp, actual *otlpcommon.AnyValue) bool {
+	kind, pattern, ok := valuePattern(exp)
+	if !ok {
+		return AttributeTypeOf(exp) == AttributeTypeOf(actual) && proto.Equal(exp, actual)
+	}
+	var text string
+	switch val := actual.GetValue().(type) {
+	case *otlpcommon.AnyValue_StringValue:
+		text = val.StringValue
+	case *otlpcommon.AnyValue_BoolValue:
+		text = strconv.FormatBool(val.BoolValue)
+	case *otlpcommon.AnyValue_IntValue:
+		text = strconv.FormatInt(val.IntValue, 10)
+	case *otlpcommon.AnyValue_DoubleValue:
+		text = strconv.FormatFloat(val.DoubleValue, 'g', -1, 64)
+	default:
+		return false
+	}
+	if kind == containsPatternKey {
+		return strings.Contains(text, pattern)
+	}
+	re, found := patterns.Load(pattern)
+	if !found {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return false
+		}
+		re, _ = patterns.LoadOrStore(pattern, compiled)
+	}
+	return re.(*regexp.Regexp).MatchString(text)
+}
+
+// Formats the expected value with its type for the failure messages, e.g. string "bar" or matching ^/hello
+func formatExpectedValue(v *otlpcommon.AnyValue) string {
+	if kind, pattern, ok := valuePattern(v); ok {
+		if kind == containsPatternKey {
+			return fmt.Sprintf("containing %q", pattern)
+		}
+		return "matching " + pattern
+	}
+	return fmt.Sprintf("%s %v", AttributeTypeOf(v), formatAnyValue(v))
+}
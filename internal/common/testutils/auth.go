@@ -0,0 +1,70 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// The schemes of the credentials the OTLP back-end can require, via AUTH_BEARER_TOKEN or AUTH_BASIC_USERNAME
+// and AUTH_BASIC_PASSWORD
+var authSchemes = []string{"bearer", "basic"}
+
+// How many OTLP exports the OTLP back-end accepted and rejected for their credentials
+type AuthStats struct {
+	// The scheme of the credentials required. Empty if the back-end doesn't require any
+	Scheme   string `json:"scheme"`
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	// Why the last export was rejected, e.g. invalid bearer token
+	LastRejection string `json:"lastRejection"`
+}
+
+func (b *OtlpBackend) GetAuthStats() (*AuthStats, error) {
+	req, err := http.NewRequest(http.MethodGet, b.uri+"/getauth", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, body, err := doHttp(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting the authentication stats from OTLP backend: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, newHttpStatusError(req.URL.String(), res.StatusCode)
+	}
+	s := &AuthStats{}
+	if err := json.Unmarshal(body, s); err != nil {
+		return nil, fmt.Errorf("error reading the authentication stats from OTLP backend: %w", err)
+	}
+	return s, nil
+}
+
+// Asserts the exporter sending to the OTLP back-end, i.e. of the sample or its collector, sent the credentials
+// the back-end requires with the scheme, e.g. bearer: the back-end accepted exports and rejected none
+func AssertExporterAuthenticated(t TestingT, scheme string) {
+	b := NewOtlpBackend(getConfig(t).OtlpBackendUrl)
+	var s *AuthStats
+	found := Eventually(t, "Authenticated export", func() bool {
+		var err error
+		if s, err = b.GetAuthStats(); err != nil {
+			checkBackendError(t, "otlp", err)
+			return false
+		}
+		return s.Accepted > 0 || s.Rejected > 0
+	})
+	if !found {
+		t.Fatalf("The OTLP back-end received no export")
+	}
+
+	if s.Scheme != scheme {
+		t.Fatalf("The OTLP back-end requires %q credentials, expected %q. Set AUTH_BEARER_TOKEN or AUTH_BASIC_USERNAME in its environment", s.Scheme, scheme)
+	}
+	if s.Rejected > 0 {
+		t.Errorf("The OTLP back-end rejected %d of %d exports, the last one for: %s", s.Rejected, s.Accepted+s.Rejected, s.LastRejection)
+	}
+}
+
+func validAuthScheme(scheme string) bool {
+	return slices.Contains(authSchemes, scheme)
+}
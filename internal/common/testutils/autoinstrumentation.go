@@ -0,0 +1,82 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+
+// The zero-code instrumentations of the recipes
+const (
+	JavaAgent       string = "java-agent"
+	PythonAutoInstr string = "python"
+	GoEbpfAutoInstr string = "go-ebpf"
+)
+
+// The instrumentation scopes the spans of each zero-code instrumentation are produced by. Their names
+// carry the instrumented library and often its version, e.g. io.opentelemetry.spring-webmvc-6.0
+var autoInstrumentationScopes = map[string]string{
+	JavaAgent:       "io.opentelemetry.*",
+	PythonAutoInstr: "opentelemetry.instrumentation.*",
+	GoEbpfAutoInstr: "go.opentelemetry.io/auto/*",
+}
+
+// The spans a zero-code instrumentation is expected to produce, e.g. the server span of the framework and
+// the client span of the HTTP library. As the spans differ between the versions of the instrumentations,
+// e.g. GET vs GET /hello, several alternative sets can be given, of which one must be found in a trace.
+// Other spans of the trace, e.g. internal spans of the framework, are ignored
+type SpanSetTestCase struct {
+	serviceName     string
+	instrumentation string
+	alternatives    [][]*TraceTestCase
+}
+
+// Creates a test case for the spans of the service produced by the instrumentation, e.g. JavaAgent.
+// Spans without an expected scope must come from the scopes of the instrumentation. Empty skips the check
+func NewSpanSetTestCase(serviceName, instrumentation string) *SpanSetTestCase {
+	return &SpanSetTestCase{serviceName: serviceName, instrumentation: instrumentation}
+}
+
+// Adds a set of spans expected together in a trace
+func (tc *SpanSetTestCase) WithSpans(spans ...*TraceTestCase) *SpanSetTestCase {
+	scope := autoInstrumentationScopes[tc.instrumentation]
+	for _, s := range spans {
+		if s.scopeName == "" {
+			s.WithScope(scope)
+		}
+	}
+	tc.alternatives = append(tc.alternatives, spans)
+	return tc
+}
+
+// Asserts the service exported a trace containing the spans of one of the sets, in the order they were added
+func AssertSpanSet(t TestingT, tc *SpanSetTestCase) {
+	if len(tc.alternatives) == 0 {
+		t.Fatalf("No spans expected from %s", tc.serviceName)
+	}
+
+	var rs *otlptrace.ResourceSpans
+	var expected []*TraceTestCase
+	var spans []*otlptrace.Span
+	found := Eventually(t, "Span set", func() bool {
+		rs = getTrace(t, tc.serviceName, TraceQueryOptions{})
+		for _, alt := range tc.alternatives {
+			for _, trace := range groupSpansByTrace(rs) {
+				if spans = matchTraceSpans(alt, trace); spans != nil {
+					expected = alt
+					return true
+				}
+			}
+		}
+		return false
+	})
+
+	if !found {
+		traces := diffTraces(rs)
+		for _, alt := range tc.alternatives {
+			t.Errorf("Could not find a trace of %s matching %v. Closest trace:\n%s",
+				tc.serviceName, spanNames(alt), spansDiff(alt, closestTrace(alt, traces)))
+		}
+		t.FailNow()
+	}
+
+	for i, exp := range expected {
+		assertSpan(t, exp, spans[i], rs)
+	}
+}
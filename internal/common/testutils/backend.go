@@ -0,0 +1,290 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Name of the back-end the traces are queried from. See RegisterTraceBackend
+var traceBackendName = flag.String("trace-backend", "otlp", "The back-end to query the traces from")
+
+// Optional filters a TraceBackend can use to narrow down the query.
+// Back-ends that don't support a filter are free to ignore it.
+type TraceQueryOptions struct {
+	SpanName string
+	// String attributes of the queried span, for the back-ends able to filter by them, e.g. Jaeger. The
+	// others ignore them, the spans being matched once fetched anyway
+	Tags map[string]string
+	// Max number of traces fetched, the most recent ones. Zero uses the limit of the back-end
+	Limit int
+	// Only the traces started this long before End, e.g. 10m. Ignored if Start is set. Defaults to 1h
+	Lookback time.Duration
+	// The window the traces started in. Defaults to the Lookback until now
+	Start, End time.Time
+}
+
+// TraceBackend is a source of the spans exported by the sample applications.
+// GetTraces returns all the spans found for the service merged into a single
+// ResourceSpans or nil if no spans were found (yet).
+type TraceBackend interface {
+	GetTraces(serviceName string, opts TraceQueryOptions) (*otlptrace.ResourceSpans, error)
+}
+
+// MetricsBackend is a source of the metrics exported by the sample applications.
+// Returns nil if no metrics were found (yet).
+type MetricsBackend interface {
+	GetMetrics(serviceName string) (*otlpmetrics.ResourceMetrics, error)
+}
+
+// LogsBackend is a source of the logs exported by the sample applications.
+// Returns nil if no logs were found (yet).
+type LogsBackend interface {
+	GetLogs(serviceName string) (*otlplogs.ResourceLogs, error)
+}
+
+var traceBackends = map[string]func(c *Config) TraceBackend{
+	"otlp": func(c *Config) TraceBackend { return NewOtlpBackend(c.OtlpBackendUrl) },
+}
+
+// Guards the registered and the global back-ends, set lazily by the parallel tests
+var backendsMu sync.Mutex
+
+// The back-end set via SetTraceBackend. Takes precedence over the -trace-backend and -traces-file flags
+var traceBackend TraceBackend
+
+var metricsBackend MetricsBackend
+var logsBackend LogsBackend
+
+// The back-ends created from the global configuration, for the tests without their own (see UseConfig)
+var defaultTraceBackend TraceBackend
+var defaultMetricsBackend MetricsBackend
+var defaultLogsBackend LogsBackend
+
+// Makes a back-end available to be selected via the -trace-backend flag.
+// The factory creates the back-end from the addresses of the test configuration
+func RegisterTraceBackend(name string, factory func(c *Config) TraceBackend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	traceBackends[name] = factory
+}
+
+// Sets the back-end used by the tests, e.g. from a TestMain
+func SetTraceBackend(b TraceBackend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	traceBackend = b
+}
+
+// Sets the back-end the metrics are fetched from. Defaults to the OTLP back-end,
+// or the file given by the -metrics-file flag
+func SetMetricsBackend(b MetricsBackend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	metricsBackend = b
+}
+
+// Sets the back-end the logs are fetched from. Defaults to the OTLP back-end,
+// or the file given by the -logs-file flag
+func SetLogsBackend(b LogsBackend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	logsBackend = b
+}
+
+func TraceBackendNames() []string {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	names := make([]string, 0, len(traceBackends))
+	for n := range traceBackends {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the back-end set via SetTraceBackend, or else the one of the file flags, or nil
+func globalTraceBackend() TraceBackend {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if traceBackend == nil && *tracesFile != "" {
+		traceBackend = NewOtlpFileBackend(*tracesFile)
+	}
+	if traceBackend == nil && *consoleOutput != "" {
+		traceBackend = NewConsoleFileBackend(*consoleOutput)
+	}
+	return traceBackend
+}
+
+func getTraceBackend(t TestingT) TraceBackend {
+	if b := globalTraceBackend(); b != nil {
+		return b
+	}
+
+	name := getConfig(t).TraceBackend
+	if name == "" {
+		name = *traceBackendName
+	}
+	backendsMu.Lock()
+	factory, found := traceBackends[name]
+	backendsMu.Unlock()
+	if !found {
+		t.Fatalf("Unknown trace back-end: %s", name)
+	}
+
+	// tests with their own configuration (see UseConfig) get their own back-end
+	if s := findConfigScope(t); s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.traceBackend == nil {
+			s.traceBackend = factory(s.config)
+		}
+		return s.traceBackend
+	}
+
+	c := GetConfig()
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if defaultTraceBackend == nil {
+		defaultTraceBackend = factory(c)
+	}
+	return defaultTraceBackend
+}
+
+// Returns the back-end set via SetMetricsBackend, or else the one of the file flags, or nil
+func globalMetricsBackend() MetricsBackend {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if metricsBackend == nil && *metricsFile != "" {
+		metricsBackend = NewOtlpFileBackend(*metricsFile)
+	}
+	if metricsBackend == nil && *consoleOutput != "" {
+		metricsBackend = NewConsoleFileBackend(*consoleOutput)
+	}
+	return metricsBackend
+}
+
+func getMetricsBackend(t TestingT) MetricsBackend {
+	if b := globalMetricsBackend(); b != nil {
+		return b
+	}
+
+	if s := findConfigScope(t); s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.metricsBackend == nil {
+			s.metricsBackend = NewOtlpBackend(s.config.OtlpBackendUrl)
+		}
+		return s.metricsBackend
+	}
+
+	c := GetConfig()
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if defaultMetricsBackend == nil {
+		defaultMetricsBackend = NewOtlpBackend(c.OtlpBackendUrl)
+	}
+	return defaultMetricsBackend
+}
+
+// Returns the back-end set via SetLogsBackend, or else the one of the file flags, or nil
+func globalLogsBackend() LogsBackend {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if logsBackend == nil && *logsFile != "" {
+		logsBackend = NewOtlpFileBackend(*logsFile)
+	}
+	if logsBackend == nil && *consoleOutput != "" {
+		logsBackend = NewConsoleFileBackend(*consoleOutput)
+	}
+	return logsBackend
+}
+
+func getLogsBackend(t TestingT) LogsBackend {
+	if b := globalLogsBackend(); b != nil {
+		return b
+	}
+
+	if s := findConfigScope(t); s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.logsBackend == nil {
+			s.logsBackend = NewOtlpBackend(s.config.OtlpBackendUrl)
+		}
+		return s.logsBackend
+	}
+
+	c := GetConfig()
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if defaultLogsBackend == nil {
+		defaultLogsBackend = NewOtlpBackend(c.OtlpBackendUrl)
+	}
+	return defaultLogsBackend
+}
+
+// Merges the spans of all ResourceSpans into a single one, keeping the first resource
+func mergeResourceSpans(all []*otlptrace.ResourceSpans) *otlptrace.ResourceSpans {
+	if len(all) == 0 {
+		return nil
+	}
+
+	res := &otlptrace.ResourceSpans{Resource: all[0].GetResource(), SchemaUrl: all[0].GetSchemaUrl()}
+	for _, rs := range all {
+		res.ScopeSpans = append(res.ScopeSpans, rs.GetScopeSpans()...)
+	}
+	return res
+}
+
+type httpStatusError struct {
+	uri        string
+	statusCode int
+}
+
+func newHttpStatusError(uri string, statusCode int) error {
+	return &httpStatusError{uri: uri, statusCode: statusCode}
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d from %s", e.statusCode, e.uri)
+}
+
+// Whether fetching the telemetry can succeed on a later attempt: the back-end answered with a 5xx or 429,
+// refused or dropped the connection, timed out or sent a partial response, e.g. while it is starting
+func isTransientError(err error) bool {
+	var se *httpStatusError
+	if errors.As(err, &se) {
+		return se.statusCode >= http.StatusInternalServerError || se.statusCode == http.StatusTooManyRequests
+	}
+	// e.g. the gRPC query API of Jaeger
+	if c := status.Code(err); c == codes.Unavailable || c == codes.DeadlineExceeded || c == codes.ResourceExhausted {
+		return true
+	}
+	var ne net.Error
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout()
+}
+
+// Fails the test unless the error is transient, in which case it is only logged and
+// the telemetry is reported as not found yet, so the retries of the callers try again
+func checkBackendError(t TestingT, backend string, err error) {
+	if !isTransientError(err) {
+		t.Fatalf("Failed getting telemetry from the %s back-end: %v", backend, err)
+	}
+	Logger(t).Warn("The back-end is not available yet", "backend", backend, "error", err)
+}
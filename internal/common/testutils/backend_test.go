@@ -0,0 +1,67 @@
+package testutils
+
+import "testing"
+
+func TestGetTraceBackendScoped(t *testing.T) {
+	unscoped := getTraceBackend(t)
+	if b := getTraceBackend(t); b != unscoped {
+		t.Errorf("the back-end of the global configuration was created twice")
+	}
+
+	for _, url := range []string{"http://localhost:4001", "http://localhost:4002"} {
+		t.Run(url, func(t *testing.T) {
+			t.Parallel()
+			c := *GetConfig()
+			c.OtlpBackendUrl = url
+			UseConfig(t, &c)
+
+			b := getTraceBackend(t)
+			if b == unscoped {
+				t.Fatalf("got the back-end of the global configuration instead of the one of %s", url)
+			}
+			if got := b.(*OtlpBackend).uri; got != url {
+				t.Errorf("got the back-end of %s, want %s", got, url)
+			}
+			if getTraceBackend(t) != b {
+				t.Errorf("the back-end of the scope was created twice")
+			}
+		})
+	}
+}
+
+func TestGetMetricsAndLogsBackendScoped(t *testing.T) {
+	unscopedMetrics, unscopedLogs := getMetricsBackend(t), getLogsBackend(t)
+
+	t.Run("scoped", func(t *testing.T) {
+		c := *GetConfig()
+		c.OtlpBackendUrl = "http://localhost:4003"
+		UseConfig(t, &c)
+
+		if m := getMetricsBackend(t); m == unscopedMetrics || m.(*OtlpBackend).uri != c.OtlpBackendUrl {
+			t.Errorf("got the metrics back-end of the global configuration")
+		}
+		if l := getLogsBackend(t); l == unscopedLogs || l.(*OtlpBackend).uri != c.OtlpBackendUrl {
+			t.Errorf("got the logs back-end of the global configuration")
+		}
+	})
+}
+
+func TestTraceBackendNames(t *testing.T) {
+	RegisterTraceBackend("test", func(c *Config) TraceBackend { return NewOtlpBackend(c.OtlpBackendUrl) })
+	t.Cleanup(func() {
+		backendsMu.Lock()
+		defer backendsMu.Unlock()
+		delete(traceBackends, "test")
+	})
+
+	names := TraceBackendNames()
+	for _, want := range []string{"jaeger", "otlp", "test"} {
+		found := false
+		for _, n := range names {
+			found = found || n == want
+		}
+		if !found {
+			t.Errorf("%q not in %v", want, names)
+		}
+	}
+}
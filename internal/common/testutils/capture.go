@@ -0,0 +1,32 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// The telemetry of a sample as found in the back-ends. Signals not found are nil
+type CapturedTelemetry struct {
+	Traces  *otlptrace.ResourceSpans
+	Metrics *otlpmetrics.ResourceMetrics
+	Logs    *otlplogs.ResourceLogs
+}
+
+// Fetches all the telemetry of the sample once, e.g. to attach it to a report.
+// Unlike the assertions it does not retry and errors are only logged, so it never fails the test
+func CaptureTelemetry(t TestingT, serviceName string) *CapturedTelemetry {
+	c := &CapturedTelemetry{}
+	var err error
+
+	if c.Traces, err = queryTraces(t, serviceName, TraceQueryOptions{}); err != nil {
+		Logger(t).Warn("Failed capturing the telemetry", "signal", "traces", "service", serviceName, "error", err)
+	}
+	if c.Metrics, err = getMetricsBackend(t).GetMetrics(serviceName); err != nil {
+		Logger(t).Warn("Failed capturing the telemetry", "signal", "metrics", "service", serviceName, "error", err)
+	}
+	if c.Logs, err = getLogsBackend(t).GetLogs(serviceName); err != nil {
+		Logger(t).Warn("Failed capturing the telemetry", "signal", "logs", "service", serviceName, "error", err)
+	}
+	return c
+}
@@ -0,0 +1,104 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+	"strings"
+
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Expects each span of the traces of the service to be a root or to have its parent in the same trace, e.g. to
+// catch a sample starting its spans from a context.Background() instead of the context of the request
+type CompleteTracesTestCase struct {
+	serviceName string
+	services    []string
+	// The span ids of the propagated contexts, whose spans are not exported
+	remoteParents map[string]bool
+}
+
+func NewCompleteTracesTestCase(serviceName string) *CompleteTracesTestCase {
+	return &CompleteTracesTestCase{serviceName: serviceName, remoteParents: make(map[string]bool)}
+}
+
+// Fetches the spans of the other services of the traces too, e.g. the backend called by a frontend, which can
+// be the parents of the spans of the service and are checked as well
+func (tc *CompleteTracesTestCase) WithServices(services ...string) *CompleteTracesTestCase {
+	tc.services = append(tc.services, services...)
+	return tc
+}
+
+// Accepts the spans whose parent is the span of a context sent to the sample, see SampleRequest.WithSpanContext
+func (tc *CompleteTracesTestCase) WithRemoteParents(contexts ...*SpanContext) *CompleteTracesTestCase {
+	for _, c := range contexts {
+		tc.remoteParents[string(c.SpanID)] = true
+	}
+	return tc
+}
+
+// Asserts no span of the traces of the service is an orphan, i.e. references a parent missing from its trace.
+// The parents may be exported after their children, so the orphans are retried. A parent flagged as remote in
+// the span flags is in another process, and is only required when its service is added with WithServices
+func AssertCompleteTraces(t TestingT, tc *CompleteTracesTestCase) {
+	GetTraceWithRetry(t, tc.serviceName)
+
+	var orphans []string
+	found := Eventually(t, "Parents of the spans of "+tc.serviceName, func() bool {
+		orphans = findOrphanSpans(t, tc)
+		return len(orphans) == 0
+	})
+	if !found {
+		t.Errorf("The traces of %s have %d spans whose parent is missing from the trace:\n%s",
+			tc.serviceName, len(orphans), strings.Join(orphans, "\n"))
+	}
+}
+
+// Lists the spans of the service, or of the other services of its traces, whose parent is not found
+func findOrphanSpans(t TestingT, tc *CompleteTracesTestCase) []string {
+	type serviceSpan struct {
+		service string
+		span    *otlptrace.Span
+	}
+	services := append([]string{tc.serviceName}, tc.services...)
+	byTrace := make(map[string]map[string]serviceSpan)
+	var spans []serviceSpan
+	for i, svc := range services {
+		for _, s := range allSpans(getTrace(t, svc, TraceQueryOptions{})) {
+			id := string(s.GetTraceId())
+			if _, found := byTrace[id]; !found {
+				// only the traces of the service are checked
+				if i > 0 {
+					continue
+				}
+				byTrace[id] = make(map[string]serviceSpan)
+			}
+			ss := serviceSpan{service: svc, span: s}
+			byTrace[id][string(s.GetSpanId())] = ss
+			spans = append(spans, ss)
+		}
+	}
+
+	var orphans []string
+	for _, s := range spans {
+		parent := string(s.span.GetParentSpanId())
+		if parent == "" || tc.remoteParents[parent] {
+			continue
+		}
+		if _, found := byTrace[string(s.span.GetTraceId())][parent]; found {
+			continue
+		}
+		if len(tc.services) == 0 && hasRemoteParent(s.span) {
+			continue
+		}
+		orphans = append(orphans, fmt.Sprintf("- span %s of %s in trace %x: parent %x not found",
+			s.span.GetName(), s.service, s.span.GetTraceId(), s.span.GetParentSpanId()))
+	}
+	return orphans
+}
+
+// Whether the SDK flagged the parent of the span as remote. Not set by the older SDKs, nor by the Jaeger
+// and Zipkin back-ends
+func hasRemoteParent(s *otlptrace.Span) bool {
+	flags := s.GetFlags()
+	return flags&uint32(otlptrace.SpanFlags_SPAN_FLAGS_CONTEXT_HAS_IS_REMOTE_MASK) != 0 &&
+		flags&uint32(otlptrace.SpanFlags_SPAN_FLAGS_CONTEXT_IS_REMOTE_MASK) != 0
+}
@@ -0,0 +1,121 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Address of the sample API running inside compose
+const SampleApiUri string = "http://localhost:8080"
+
+// Address of the gRPC sample API running inside compose
+const SampleGrpcUri string = "localhost:50051"
+
+// Config holds the addresses of the back-ends and of the sample application.
+// Each address is resolved from its flag, then its environment variable and
+// falls back to the default address of the compose setup, on the DockerHost.
+type Config struct {
+	OtlpBackendUrl        string
+	SampleApiUrl          string
+	SampleGrpcUrl         string
+	PrometheusExporterUrl string
+	PrometheusUrl         string
+	TempoUrl              string
+	ZipkinUrl             string
+	JaegerUrl             string
+	JaegerGrpcUrl         string
+	CollectorUrl          string
+	// Limit the traces queried from the back-ends, the most recent ones. Empty uses the limit of the back-end
+	TraceLimit string
+	// Only query the traces started since this long ago, e.g. 10m. Empty defaults to 1h
+	TraceLookback string
+	// Only query the traces started since this time, in RFC 3339, e.g. when the compose stack was started
+	TraceStart string
+	// The OTel SDK version the sample was built with, selecting the sdkOverrides of the expected telemetry file
+	SdkVersion string
+	// The back-end the traces are queried from, see RegisterTraceBackend. Empty uses the -trace-backend flag
+	TraceBackend string
+}
+
+type configEntry struct {
+	flag   *string
+	envVar string
+	def    string
+}
+
+var configEntries = map[string]configEntry{
+	"otlp-backend-url":        {flag.String("otlp-backend-url", "", "Address of the OTLP back-end (env OTLP_BACKEND_URL)"), "OTLP_BACKEND_URL", OtlpBackendUri},
+	"sample-api-url":          {flag.String("sample-api-url", "", "Address of the sample API (env SAMPLE_API_URL)"), "SAMPLE_API_URL", SampleApiUri},
+	"sample-grpc-url":         {flag.String("sample-grpc-url", "", "Address of the gRPC sample API (env SAMPLE_GRPC_URL)"), "SAMPLE_GRPC_URL", SampleGrpcUri},
+	"prometheus-exporter-url": {flag.String("prometheus-exporter-url", "", "Address of the collector Prometheus exporter (env PROMETHEUS_EXPORTER_URL)"), "PROMETHEUS_EXPORTER_URL", PrometheusExporterUri},
+	"prometheus-url":          {flag.String("prometheus-url", "", "Address of the Prometheus HTTP API (env PROMETHEUS_URL)"), "PROMETHEUS_URL", PrometheusUri},
+	"tempo-url":               {flag.String("tempo-url", "", "Address of the Tempo HTTP API (env TEMPO_URL)"), "TEMPO_URL", TempoUri},
+	"zipkin-url":              {flag.String("zipkin-url", "", "Address of the Zipkin HTTP API (env ZIPKIN_URL)"), "ZIPKIN_URL", ZipkinUri},
+	"jaeger-url":              {flag.String("jaeger-url", "", "Address of the Jaeger query HTTP API (env JAEGER_URL)"), "JAEGER_URL", JaegerUri},
+	"jaeger-grpc-url":         {flag.String("jaeger-grpc-url", "", "Address of the Jaeger query gRPC API (env JAEGER_GRPC_URL)"), "JAEGER_GRPC_URL", JaegerGrpcUri},
+	"collector-url":           {flag.String("collector-url", "", "Address of the OTLP/HTTP receiver of the collector (env COLLECTOR_URL)"), "COLLECTOR_URL", CollectorUri},
+	"trace-limit":             {flag.String("trace-limit", "", "Max number of traces queried from the back-ends (env TRACE_LIMIT)"), "TRACE_LIMIT", ""},
+	"trace-lookback":          {flag.String("trace-lookback", "", "Only query the traces started since this long ago, e.g. 10m (env TRACE_LOOKBACK)"), "TRACE_LOOKBACK", ""},
+	"trace-start":             {flag.String("trace-start", "", "Only query the traces started since this RFC 3339 time (env TRACE_START)"), "TRACE_START", ""},
+	"sdk-version":             {flag.String("sdk-version", "", "The OTel SDK version the sample was built with, e.g. 1.24.0 (env SDK_VERSION)"), "SDK_VERSION", ""},
+}
+
+var (
+	configMu sync.Mutex
+	config   *Config
+)
+
+// Returns the configuration of the tests. Must be called after the flags are parsed,
+// i.e. from within a test
+func GetConfig() *Config {
+	configMu.Lock()
+	defer configMu.Unlock()
+	if config == nil {
+		config = &Config{
+			OtlpBackendUrl:        resolveConfig("otlp-backend-url"),
+			SampleApiUrl:          resolveConfig("sample-api-url"),
+			SampleGrpcUrl:         resolveConfig("sample-grpc-url"),
+			PrometheusExporterUrl: resolveConfig("prometheus-exporter-url"),
+			PrometheusUrl:         resolveConfig("prometheus-url"),
+			TempoUrl:              resolveConfig("tempo-url"),
+			ZipkinUrl:             resolveConfig("zipkin-url"),
+			JaegerUrl:             resolveConfig("jaeger-url"),
+			JaegerGrpcUrl:         resolveConfig("jaeger-grpc-url"),
+			CollectorUrl:          resolveConfig("collector-url"),
+			TraceLimit:            resolveConfig("trace-limit"),
+			TraceLookback:         resolveConfig("trace-lookback"),
+			TraceStart:            resolveConfig("trace-start"),
+			SdkVersion:            resolveConfig("sdk-version"),
+		}
+	}
+	return config
+}
+
+// Overrides the configuration of the tests, e.g. from a TestMain
+func SetConfig(c *Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config = c
+}
+
+// Returns the address of the given path of the sample API, e.g. SampleApiUrl("/helloworld")
+func SampleApiUrl(path string) string {
+	return sampleApiUrl(GetConfig(), path)
+}
+
+func sampleApiUrl(c *Config, path string) string {
+	return strings.TrimSuffix(c.SampleApiUrl, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+func resolveConfig(name string) string {
+	e := configEntries[name]
+	if *e.flag != "" {
+		return *e.flag
+	}
+	if v := os.Getenv(e.envVar); v != "" {
+		return v
+	}
+	return onDockerHost(e.def)
+}
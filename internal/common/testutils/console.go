@@ -0,0 +1,456 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/dockerlogs"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Path to a file with the output of a sample exporting with a console exporter, e.g. written by docker logs.
+// When set, all the signals are read from it instead of the OTLP back-end
+var consoleOutput = flag.String("console-output", "", "Path to a file with the output of a sample printing its telemetry with a console exporter")
+
+// Bounds reading the logs of a container on each query
+const consoleLogsTimeout time.Duration = 30 * time.Second
+
+// The telemetry printed by the console exporters of a sample, one resource per printed span, metric or log record
+type ConsoleTelemetry struct {
+	Traces  *otlptrace.TracesData
+	Metrics *otlpmetrics.MetricsData
+	Logs    *otlplogs.LogsData
+}
+
+// TraceBackend, MetricsBackend and LogsBackend reading the telemetry a sample prints with a console (stdout)
+// exporter. The output is read again on each query, so the assertions retry until the exporter printed
+type ConsoleBackend struct {
+	output func() (string, error)
+}
+
+// Creates a back-end parsing the output returned by output, e.g. the Logs of a runner.Process
+func NewConsoleBackend(output func() (string, error)) *ConsoleBackend {
+	return &ConsoleBackend{output: output}
+}
+
+// Creates a back-end parsing the output written to the file. A missing file is no telemetry yet
+func NewConsoleFileBackend(path string) *ConsoleBackend {
+	return NewConsoleBackend(func() (string, error) {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return string(data), err
+	})
+}
+
+// Creates a back-end parsing the logs of the docker container, by its name or id, e.g. a sample of a compose file
+func NewConsoleContainerBackend(container string) *ConsoleBackend {
+	return NewConsoleBackend(func() (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), consoleLogsTimeout)
+		defer cancel()
+		return dockerlogs.Logs(ctx, container)
+	})
+}
+
+func (b *ConsoleBackend) parse() (*ConsoleTelemetry, error) {
+	out, err := b.output()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading the console output: %w", err)
+	}
+	return ParseConsoleOutput(out)
+}
+
+func (b *ConsoleBackend) GetTraces(serviceName string, _ TraceQueryOptions) (*otlptrace.ResourceSpans, error) {
+	c, err := b.parse()
+	if err != nil {
+		return nil, err
+	}
+	var all []*otlptrace.ResourceSpans
+	for _, rs := range c.Traces.GetResourceSpans() {
+		if r, ok := consoleResource(rs.GetResource(), serviceName); ok {
+			rs.Resource = r
+			all = append(all, rs)
+		}
+	}
+	return mergeResourceSpans(all), nil
+}
+
+func (b *ConsoleBackend) GetMetrics(serviceName string) (*otlpmetrics.ResourceMetrics, error) {
+	c, err := b.parse()
+	if err != nil {
+		return nil, err
+	}
+	var res *otlpmetrics.ResourceMetrics
+	for _, rm := range c.Metrics.GetResourceMetrics() {
+		r, ok := consoleResource(rm.GetResource(), serviceName)
+		if !ok {
+			continue
+		}
+		if res == nil {
+			res = &otlpmetrics.ResourceMetrics{Resource: r, SchemaUrl: rm.GetSchemaUrl()}
+		}
+		res.ScopeMetrics = append(res.ScopeMetrics, rm.GetScopeMetrics()...)
+	}
+	return res, nil
+}
+
+func (b *ConsoleBackend) GetLogs(serviceName string) (*otlplogs.ResourceLogs, error) {
+	c, err := b.parse()
+	if err != nil {
+		return nil, err
+	}
+	var res *otlplogs.ResourceLogs
+	for _, rl := range c.Logs.GetResourceLogs() {
+		r, ok := consoleResource(rl.GetResource(), serviceName)
+		if !ok {
+			continue
+		}
+		if res == nil {
+			res = &otlplogs.ResourceLogs{Resource: r, SchemaUrl: rl.GetSchemaUrl()}
+		}
+		res.ScopeLogs = append(res.ScopeLogs, rl.GetScopeLogs()...)
+	}
+	return res, nil
+}
+
+// Whether the printed telemetry is of the service. Some exporters, e.g. the JavaScript metrics one, don't
+// print the resource: the output being the one of the sample, their telemetry is attributed to the service
+func consoleResource(r *otlpresource.Resource, serviceName string) (*otlpresource.Resource, bool) {
+	if name := getServiceName(r); name != "" {
+		return r, name == serviceName
+	}
+	res := &otlpresource.Resource{DroppedAttributesCount: r.GetDroppedAttributesCount()}
+	res.Attributes = append(append(res.Attributes, r.GetAttributes()...), StringAttribute("service.name", serviceName))
+	return res, true
+}
+
+// Parses the spans, metrics and logs printed by the console exporters in the output of a sample. The other
+// lines of the output, e.g. the logs of the sample, are skipped. Supported are the output of:
+//   - the Go stdouttrace, stdoutmetric and stdoutlog exporters
+//   - the Python ConsoleSpanExporter, ConsoleMetricExporter and ConsoleLogExporter
+//   - the JavaScript ConsoleSpanExporter, ConsoleMetricExporter and ConsoleLogRecordExporter
+//   - the .NET console exporter, of activities and log records
+//   - the exporters printing OTLP JSON, one message per line, e.g. the Java logging-otlp ones
+func ParseConsoleOutput(output string) (*ConsoleTelemetry, error) {
+	c := &ConsoleTelemetry{Traces: &otlptrace.TracesData{}, Metrics: &otlpmetrics.MetricsData{}, Logs: &otlplogs.LogsData{}}
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(line, dotnetActivityStart), strings.HasPrefix(line, dotnetLogRecordStart):
+			end := dotnetBlockEnd(lines, i)
+			if err := c.addDotnet(lines[i:end]); err != nil {
+				return nil, err
+			}
+			i = end - 1
+		case strings.HasPrefix(line, "{"):
+			end, ok := objectEnd(lines, i)
+			if !ok {
+				continue
+			}
+			if err := c.addObject(strings.Join(lines[i:end], "\n")); err != nil {
+				return nil, err
+			}
+			i = end - 1
+		default:
+			// e.g. the OTLP JSON logged by the Java logging-otlp exporters, after the level of the log
+			if j := strings.Index(line, `{"resource`); j > 0 {
+				if err := c.addObject(line[j:]); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return c, nil
+}
+
+// Returns the index after the line closing the object opened on the line at start, counting the braces
+// and brackets outside of the strings
+func objectEnd(lines []string, start int) (int, bool) {
+	depth := 0
+	var quote rune
+	escaped := false
+	for i := start; i < len(lines); i++ {
+		for _, r := range lines[i] {
+			switch {
+			case escaped:
+				escaped = false
+			case quote != 0 && r == '\\':
+				escaped = true
+			case quote != 0:
+				if r == quote {
+					quote = 0
+				}
+			case r == '"' || r == '\'' || r == '`':
+				quote = r
+			case r == '{' || r == '[':
+				depth++
+			case r == '}' || r == ']':
+				depth--
+			}
+		}
+		if depth <= 0 {
+			return i + 1, depth == 0
+		}
+	}
+	return 0, false
+}
+
+// Adds the telemetry printed as a JSON object, or as a JavaScript object by the JavaScript exporters
+func (c *ConsoleTelemetry) addObject(text string) error {
+	data := []byte(text)
+	var obj map[string]any
+	if err := decodeJSON(data, &obj); err != nil {
+		js, err := jsObjectToJSON(text)
+		if err != nil {
+			return nil
+		}
+		if err := decodeJSON(js, &obj); err != nil {
+			return nil
+		}
+		return c.addJs(obj)
+	}
+
+	switch {
+	case obj["resourceSpans"] != nil:
+		td := &otlptrace.TracesData{}
+		if err := protojson.Unmarshal(data, td); err != nil {
+			return fmt.Errorf("invalid OTLP JSON traces in the console output: %w", err)
+		}
+		for _, rs := range td.GetResourceSpans() {
+			for _, ss := range rs.GetScopeSpans() {
+				for _, span := range ss.GetSpans() {
+					span.TraceId, span.SpanId, span.ParentSpanId = otlpJsonId(span.TraceId, 16), otlpJsonId(span.SpanId, 8), otlpJsonId(span.ParentSpanId, 8)
+					for _, l := range span.GetLinks() {
+						l.TraceId, l.SpanId = otlpJsonId(l.TraceId, 16), otlpJsonId(l.SpanId, 8)
+					}
+				}
+			}
+		}
+		c.Traces.ResourceSpans = append(c.Traces.ResourceSpans, td.GetResourceSpans()...)
+	case obj["resourceMetrics"] != nil:
+		md := &otlpmetrics.MetricsData{}
+		if err := protojson.Unmarshal(data, md); err != nil {
+			return fmt.Errorf("invalid OTLP JSON metrics in the console output: %w", err)
+		}
+		c.Metrics.ResourceMetrics = append(c.Metrics.ResourceMetrics, md.GetResourceMetrics()...)
+	case obj["resourceLogs"] != nil:
+		ld := &otlplogs.LogsData{}
+		if err := protojson.Unmarshal(data, ld); err != nil {
+			return fmt.Errorf("invalid OTLP JSON logs in the console output: %w", err)
+		}
+		for _, rl := range ld.GetResourceLogs() {
+			for _, sl := range rl.GetScopeLogs() {
+				for _, l := range sl.GetLogRecords() {
+					l.TraceId, l.SpanId = otlpJsonId(l.TraceId, 16), otlpJsonId(l.SpanId, 8)
+				}
+			}
+		}
+		c.Logs.ResourceLogs = append(c.Logs.ResourceLogs, ld.GetResourceLogs()...)
+	case hasKeys(obj, "SpanContext", "Name"), hasKeys(obj, "Resource", "ScopeMetrics"),
+		hasKeys(obj, "Body", "Severity"), hasKeys(obj, "Body", "SeverityText"):
+		return c.addGo(data, obj)
+	case hasKeys(obj, "context", "name", "kind"), hasKeys(obj, "resource_metrics"),
+		hasKeys(obj, "body", "severity_text"), hasKeys(obj, "body", "severity_number"):
+		return c.addPython(obj)
+	}
+	return nil
+}
+
+func (c *ConsoleTelemetry) addSpan(r *otlpresource.Resource, scope *otlpcommon.InstrumentationScope, s *otlptrace.Span) {
+	c.Traces.ResourceSpans = append(c.Traces.ResourceSpans, &otlptrace.ResourceSpans{
+		Resource:   r,
+		ScopeSpans: []*otlptrace.ScopeSpans{{Scope: scope, Spans: []*otlptrace.Span{s}}},
+	})
+}
+
+func (c *ConsoleTelemetry) addMetrics(r *otlpresource.Resource, scope *otlpcommon.InstrumentationScope, metrics ...*otlpmetrics.Metric) {
+	c.Metrics.ResourceMetrics = append(c.Metrics.ResourceMetrics, &otlpmetrics.ResourceMetrics{
+		Resource:     r,
+		ScopeMetrics: []*otlpmetrics.ScopeMetrics{{Scope: scope, Metrics: metrics}},
+	})
+}
+
+func (c *ConsoleTelemetry) addLog(r *otlpresource.Resource, scope *otlpcommon.InstrumentationScope, l *otlplogs.LogRecord) {
+	c.Logs.ResourceLogs = append(c.Logs.ResourceLogs, &otlplogs.ResourceLogs{
+		Resource:  r,
+		ScopeLogs: []*otlplogs.ScopeLogs{{Scope: scope, LogRecords: []*otlplogs.LogRecord{l}}},
+	})
+}
+
+// Decodes the JSON keeping the numbers as json.Number, to tell the integers from the doubles
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the object")
+	}
+	return nil
+}
+
+// Converts a decoded JSON value, e.g. an attribute printed by the Python exporters, to an OTLP value
+func jsonAnyValue(v any) *otlpcommon.AnyValue {
+	switch val := v.(type) {
+	case string:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: val}}
+	case bool:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: val}}
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: i}}
+		}
+		f, _ := val.Float64()
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: f}}
+	case []any:
+		arr := &otlpcommon.ArrayValue{}
+		for _, e := range val {
+			arr.Values = append(arr.Values, jsonAnyValue(e))
+		}
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: arr}}
+	case map[string]any:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_KvlistValue{KvlistValue: &otlpcommon.KeyValueList{Values: jsonAttributes(val)}}}
+	default:
+		return &otlpcommon.AnyValue{}
+	}
+}
+
+// Converts the attributes printed as a JSON object, in the order of their keys
+func jsonAttributes(m map[string]any) []*otlpcommon.KeyValue {
+	var res []*otlpcommon.KeyValue
+	for _, k := range sortedKeys(m) {
+		res = append(res, &otlpcommon.KeyValue{Key: k, Value: jsonAnyValue(m[k])})
+	}
+	return res
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Converts an attribute printed as text, e.g. by the .NET exporter, guessing its type as its printed value
+// doesn't tell, e.g. 1 may be the int64 1 or the string "1"
+func textAnyValue(s string) *otlpcommon.AnyValue {
+	if b, err := strconv.ParseBool(s); err == nil && (strings.EqualFold(s, "true") || strings.EqualFold(s, "false")) {
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: b}}
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: i}}
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && strings.ContainsAny(s, ".eE") {
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: f}}
+	}
+	return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: s}}
+}
+
+// Decodes a trace or span id printed in hex, e.g. 0x5b8aa5a2d2c872e8321cf37308d69df2 by Python. Returns nil
+// for an empty or all zeros id, which the exporters print for the spans without parent
+func parseConsoleId(s string, size int) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+	if strings.Trim(s, "0") == "" {
+		return nil, nil
+	}
+	if len(s) < size*2 {
+		s = strings.Repeat("0", size*2-len(s)) + s
+	}
+	id, err := hex.DecodeString(s)
+	if err != nil || len(id) != size {
+		return nil, fmt.Errorf("invalid id %q in the console output", s)
+	}
+	return id, nil
+}
+
+// The OTLP JSON encodes the ids in hex, which protojson decodes as base64, e.g. into 24 bytes for a trace id
+func otlpJsonId(id []byte, size int) []byte {
+	if len(id) != size*3/2 {
+		return id
+	}
+	if decoded, err := hex.DecodeString(base64.StdEncoding.EncodeToString(id)); err == nil {
+		return decoded
+	}
+	return id
+}
+
+func consoleSpanKind(kind string) otlptrace.Span_SpanKind {
+	if k, found := spanKinds[strings.ToLower(kind)]; found {
+		return k
+	}
+	return otlptrace.Span_SPAN_KIND_UNSPECIFIED
+}
+
+func consoleStatus(code, description string) *otlptrace.Status {
+	c, found := statusCodes[strings.ToLower(code)]
+	if !found {
+		return nil
+	}
+	return &otlptrace.Status{Code: c, Message: description}
+}
+
+func hasKeys(obj map[string]any, keys ...string) bool {
+	for _, k := range keys {
+		if _, found := obj[k]; !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Accessors of the values of a decoded JSON object, returning the zero value for missing keys or other types
+func jsonString(obj map[string]any, key string) string {
+	s, _ := obj[key].(string)
+	return s
+}
+
+func jsonObject(obj map[string]any, key string) map[string]any {
+	o, _ := obj[key].(map[string]any)
+	return o
+}
+
+func jsonArray(obj map[string]any, key string) []any {
+	a, _ := obj[key].([]any)
+	return a
+}
+
+func jsonInt(obj map[string]any, key string) int64 {
+	n, _ := obj[key].(json.Number)
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return int64(f)
+}
+
+func jsonFloat(obj map[string]any, key string) float64 {
+	n, _ := obj[key].(json.Number)
+	f, _ := n.Float64()
+	return f
+}
+
+func jsonBool(obj map[string]any, key string) bool {
+	b, _ := obj[key].(bool)
+	return b
+}
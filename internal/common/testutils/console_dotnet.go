@@ -0,0 +1,278 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// The first lines of the activities and log records printed by the .NET console exporter
+const (
+	dotnetActivityStart  = "Activity.TraceId:"
+	dotnetLogRecordStart = "LogRecord.Timestamp:"
+)
+
+// The prefixes of the lines of a block, besides the indented ones
+var dotnetBlockPrefixes = []string{"Activity.", "LogRecord.", "StatusCode:", "Resource associated with", "Instrumentation scope"}
+
+// The header of an event, e.g. Feeding [5/2/2024 10:01:02 AM +00:00], whose time is printed in the culture of the sample
+var dotnetEvent = regexp.MustCompile(`^(.*) \[(.+)\]$`)
+
+var dotnetEventTimeLayouts = []string{"1/2/2006 3:04:05 PM -07:00", "2006-01-02T15:04:05.9999999-07:00", "02/01/2006 15:04:05 -07:00"}
+
+// The severities of the log records, of which 2 to 4 are printed with a suffix, e.g. Info2
+var dotnetSeverities = map[string]otlplogs.SeverityNumber{
+	"Trace": otlplogs.SeverityNumber_SEVERITY_NUMBER_TRACE,
+	"Debug": otlplogs.SeverityNumber_SEVERITY_NUMBER_DEBUG,
+	"Info":  otlplogs.SeverityNumber_SEVERITY_NUMBER_INFO,
+	"Warn":  otlplogs.SeverityNumber_SEVERITY_NUMBER_WARN,
+	"Error": otlplogs.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	"Fatal": otlplogs.SeverityNumber_SEVERITY_NUMBER_FATAL,
+}
+
+// Returns the index after the last line of the block starting at start. The empty line before the resource
+// of a log record is part of it, and so are its attributes, printed without indentation
+func dotnetBlockEnd(lines []string, start int) int {
+	i := start + 1
+	inResource := false
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, dotnetActivityStart) || strings.HasPrefix(trimmed, dotnetLogRecordStart) {
+			return i
+		}
+		if trimmed == "" {
+			if i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), "Resource associated with") {
+				continue
+			}
+			return i
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || (inResource && dotnetResourceAttribute(line)) {
+			continue
+		}
+		inResource = strings.HasPrefix(trimmed, "Resource associated with")
+		known := false
+		for _, p := range dotnetBlockPrefixes {
+			known = known || strings.HasPrefix(trimmed, p)
+		}
+		if !known {
+			return i
+		}
+	}
+	return i
+}
+
+// Whether the line not indented is an attribute of the resource of a log record, e.g. service.name: dice
+func dotnetResourceAttribute(line string) bool {
+	key, _, found := strings.Cut(line, ": ")
+	return found && key != "" && !strings.ContainsAny(key, " \t")
+}
+
+// A block split in its fields, e.g. Activity.DisplayName, and its sections of indented lines, e.g. Activity.Tags
+type dotnetBlock struct {
+	fields   map[string]string
+	sections map[string][]string
+}
+
+func parseDotnetBlock(lines []string) *dotnetBlock {
+	b := &dotnetBlock{fields: map[string]string{}, sections: map[string][]string{}}
+	section := ""
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") ||
+			(strings.HasPrefix(section, "Resource associated with") && dotnetResourceAttribute(line)) {
+			b.sections[section] = append(b.sections[section], strings.TrimRight(line, " \t"))
+			continue
+		}
+		line = strings.TrimSpace(line)
+		// e.g. LogRecord.Attributes (Key:Value):
+		if strings.HasSuffix(line, ":") {
+			section = strings.TrimSuffix(line, ":")
+			continue
+		}
+		key, value, _ := strings.Cut(line, ":")
+		b.fields[key] = strings.TrimSpace(value)
+	}
+	return b
+}
+
+// The attributes of the lines of a section, key: value, whose types are guessed from their values
+func (b *dotnetBlock) attributes(section string) []*otlpcommon.KeyValue {
+	var res []*otlpcommon.KeyValue
+	for _, line := range b.sections[section] {
+		res = append(res, dotnetAttribute(line))
+	}
+	return res
+}
+
+// The section of the resource, e.g. "Resource associated with Activity"
+func (b *dotnetBlock) resource() *otlpresource.Resource {
+	r := &otlpresource.Resource{}
+	for name := range b.sections {
+		if strings.HasPrefix(name, "Resource associated with") {
+			r.Attributes = b.attributes(name)
+		}
+	}
+	return r
+}
+
+func dotnetAttribute(line string) *otlpcommon.KeyValue {
+	key, value, _ := strings.Cut(strings.TrimSpace(line), ": ")
+	return &otlpcommon.KeyValue{Key: strings.TrimSuffix(key, ":"), Value: textAnyValue(value)}
+}
+
+func (c *ConsoleTelemetry) addDotnet(lines []string) error {
+	b := parseDotnetBlock(lines)
+	if _, found := b.fields["Activity.TraceId"]; found {
+		return c.addDotnetActivity(b)
+	}
+	return c.addDotnetLogRecord(b)
+}
+
+func (c *ConsoleTelemetry) addDotnetActivity(b *dotnetBlock) error {
+	start := dotnetTimestamp(b.fields["Activity.StartTime"])
+	span := &otlptrace.Span{
+		Name:              b.fields["Activity.DisplayName"],
+		Kind:              consoleSpanKind(b.fields["Activity.Kind"]),
+		StartTimeUnixNano: start,
+		EndTimeUnixNano:   start + uint64(dotnetDuration(b.fields["Activity.Duration"])),
+		Attributes:        b.attributes("Activity.Tags"),
+	}
+	// Activity.StatusCode before v1.5.0 of the exporter
+	code := b.fields["StatusCode"]
+	if code == "" {
+		code = b.fields["Activity.StatusCode"]
+	}
+	span.Status = consoleStatus(code, b.fields["Activity.StatusDescription"])
+	var err error
+	if span.TraceId, err = parseConsoleId(b.fields["Activity.TraceId"], 16); err != nil {
+		return err
+	}
+	if span.SpanId, err = parseConsoleId(b.fields["Activity.SpanId"], 8); err != nil {
+		return err
+	}
+	if span.ParentSpanId, err = parseConsoleId(b.fields["Activity.ParentSpanId"], 8); err != nil {
+		return err
+	}
+	for _, line := range b.sections["Activity.Events"] {
+		// the attributes of an event are indented under it
+		if strings.HasPrefix(line, "        ") && len(span.Events) > 0 {
+			e := span.Events[len(span.Events)-1]
+			e.Attributes = append(e.Attributes, dotnetAttribute(line))
+			continue
+		}
+		name, ts := strings.TrimSpace(line), uint64(0)
+		if m := dotnetEvent.FindStringSubmatch(name); m != nil {
+			name, ts = m[1], dotnetEventTime(m[2])
+		}
+		span.Events = append(span.Events, &otlptrace.Span_Event{Name: name, TimeUnixNano: ts})
+	}
+	for _, line := range b.sections["Activity.Links"] {
+		if strings.HasPrefix(line, "        ") && len(span.Links) > 0 {
+			l := span.Links[len(span.Links)-1]
+			l.Attributes = append(l.Attributes, dotnetAttribute(line))
+			continue
+		}
+		ids := strings.Fields(line)
+		if len(ids) != 2 {
+			continue
+		}
+		link := &otlptrace.Span_Link{}
+		if link.TraceId, err = parseConsoleId(ids[0], 16); err != nil {
+			return err
+		}
+		if link.SpanId, err = parseConsoleId(ids[1], 8); err != nil {
+			return err
+		}
+		span.Links = append(span.Links, link)
+	}
+	scope := &otlpcommon.InstrumentationScope{Name: b.fields["Activity.ActivitySourceName"], Version: b.fields["Activity.ActivitySourceVersion"]}
+	c.addSpan(b.resource(), scope, span)
+	return nil
+}
+
+func (c *ConsoleTelemetry) addDotnetLogRecord(b *dotnetBlock) error {
+	record := &otlplogs.LogRecord{
+		TimeUnixNano:   dotnetTimestamp(b.fields["LogRecord.Timestamp"]),
+		SeverityNumber: dotnetSeverity(b.fields["LogRecord.Severity"]),
+		SeverityText:   b.fields["LogRecord.SeverityText"],
+	}
+	// the OTLP exporter exports the formatted message as the body, when included
+	body := b.fields["LogRecord.FormattedMessage"]
+	if body == "" {
+		body = b.fields["LogRecord.Body"]
+	}
+	if body != "" {
+		record.Body = &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: body}}
+	}
+	for name := range b.sections {
+		if strings.HasPrefix(name, "LogRecord.Attributes") {
+			record.Attributes = b.attributes(name)
+		}
+	}
+	var err error
+	if record.TraceId, err = parseConsoleId(b.fields["LogRecord.TraceId"], 16); err != nil {
+		return err
+	}
+	if record.SpanId, err = parseConsoleId(b.fields["LogRecord.SpanId"], 8); err != nil {
+		return err
+	}
+	scope := &otlpcommon.InstrumentationScope{Name: b.fields["LogRecord.CategoryName"]}
+	c.addLog(b.resource(), scope, record)
+	return nil
+}
+
+func dotnetTimestamp(s string) uint64 {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func dotnetEventTime(s string) uint64 {
+	for _, layout := range dotnetEventTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return uint64(t.UnixNano())
+		}
+	}
+	return 0
+}
+
+// Parses a TimeSpan, e.g. 00:00:00.0012345, or 1.02:03:04.5000000 for more than a day
+func dotnetDuration(s string) time.Duration {
+	var days int64
+	if d, rest, found := strings.Cut(s, "."); found && strings.Contains(rest, ":") {
+		days, _ = strconv.ParseInt(d, 10, 64)
+		s = rest
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	hours, _ := strconv.ParseInt(parts[0], 10, 64)
+	minutes, _ := strconv.ParseInt(parts[1], 10, 64)
+	seconds, _ := strconv.ParseFloat(parts[2], 64)
+	return time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds*float64(time.Second))
+}
+
+func dotnetSeverity(s string) otlplogs.SeverityNumber {
+	name := strings.TrimRight(s, "234")
+	sn, found := dotnetSeverities[name]
+	if !found {
+		return otlplogs.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+	}
+	if n, err := strconv.Atoi(strings.TrimPrefix(s, name)); err == nil {
+		sn += otlplogs.SeverityNumber(n - 1)
+	}
+	return sn
+}
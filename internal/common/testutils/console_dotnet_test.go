@@ -0,0 +1,219 @@
+package testutils
+
+import (
+	"testing"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestConsoleDotnetSpans(t *testing.T) {
+	roll := &otlptrace.Span{
+		Name:              "roll",
+		TraceId:           mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+		SpanId:            mustHexId(t, "051581bf3cb55c13"),
+		ParentSpanId:      mustHexId(t, "5fb397be34d26b51"),
+		Kind:              otlptrace.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: mustTimestamp(t, "2024-05-02T10:01:02.114304Z"),
+		EndTimeUnixNano:   mustTimestamp(t, "2024-05-02T10:01:02.1145613Z"),
+	}
+	get := &otlptrace.Span{
+		Name:              "GET /roll",
+		TraceId:           mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+		SpanId:            mustHexId(t, "5fb397be34d26b51"),
+		Kind:              otlptrace.Span_SPAN_KIND_SERVER,
+		StartTimeUnixNano: mustTimestamp(t, "2024-05-02T10:01:02.1Z"),
+		EndTimeUnixNano:   mustTimestamp(t, "2024-05-02T10:01:02.2Z"),
+		Status:            &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR, Message: "7 is not a dice value"},
+	}
+	tests := []struct {
+		name     string
+		testdata string
+		want     []*otlptrace.Span
+		scopes   []*otlpcommon.InstrumentationScope
+		resource *otlpresource.Resource
+	}{
+		{
+			name:     "StatusCode",
+			testdata: "dotnet",
+			want: []*otlptrace.Span{
+				{
+					Name:              roll.Name,
+					TraceId:           roll.TraceId,
+					SpanId:            roll.SpanId,
+					ParentSpanId:      roll.ParentSpanId,
+					Kind:              roll.Kind,
+					StartTimeUnixNano: roll.StartTimeUnixNano,
+					EndTimeUnixNano:   roll.EndTimeUnixNano,
+					Attributes: []*otlpcommon.KeyValue{
+						IntAttribute("roll.value", 4),
+						BoolAttribute("roll.fair", true),
+						{Key: "roll.weight", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: 0.5}}},
+						StringAttribute("roll.label", "a four: lucky"),
+					},
+					Events: []*otlptrace.Span_Event{
+						{
+							Name:         "rolled",
+							TimeUnixNano: mustTimestamp(t, "2024-05-02T10:01:02Z"),
+							Attributes:   []*otlpcommon.KeyValue{IntAttribute("attempt", 1)},
+						},
+						{Name: "retried", TimeUnixNano: mustTimestamp(t, "2024-05-02T10:01:02.11445Z")},
+					},
+					Links: []*otlptrace.Span_Link{{
+						TraceId:    mustHexId(t, "829fb7ceb787403c96eac634767ef10a"),
+						SpanId:     mustHexId(t, "efe159833c5bf9d1"),
+						Attributes: []*otlpcommon.KeyValue{StringAttribute("reason", "retry")},
+					}},
+				},
+				get,
+			},
+			scopes: []*otlpcommon.InstrumentationScope{{Name: "otel-recipes", Version: "1.0.0"}, {Name: "Microsoft.AspNetCore"}},
+			resource: &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{
+				StringAttribute("service.name", "dotnet.console.traces"),
+				StringAttribute("telemetry.sdk.language", "dotnet"),
+			}},
+		},
+		{
+			// printed before v1.5.0 of the exporter, the blocks not separated by empty lines
+			name:     "Activity.StatusCode",
+			testdata: "dotnet-legacy",
+			want: []*otlptrace.Span{
+				{
+					Name:              get.Name,
+					TraceId:           get.TraceId,
+					SpanId:            get.SpanId,
+					Kind:              get.Kind,
+					StartTimeUnixNano: get.StartTimeUnixNano,
+					EndTimeUnixNano:   get.EndTimeUnixNano,
+					Attributes:        []*otlpcommon.KeyValue{StringAttribute("http.method", "GET")},
+					Status:            get.Status,
+				},
+				{
+					Name:              roll.Name,
+					TraceId:           roll.TraceId,
+					SpanId:            roll.SpanId,
+					ParentSpanId:      roll.ParentSpanId,
+					Kind:              roll.Kind,
+					StartTimeUnixNano: roll.StartTimeUnixNano,
+					EndTimeUnixNano:   roll.EndTimeUnixNano,
+					Status:            &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_OK},
+				},
+			},
+			scopes:   []*otlpcommon.InstrumentationScope{{Name: "otel-recipes"}, {Name: "otel-recipes"}},
+			resource: &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{StringAttribute("service.name", "dotnet.console.traces")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := parseConsoleTestdata(t, tt.testdata)
+			rss := c.Traces.GetResourceSpans()
+			if len(rss) != len(tt.want) {
+				t.Fatalf("Expected %d spans, got %d", len(tt.want), len(rss))
+			}
+			for i, want := range tt.want {
+				ss := rss[i].GetScopeSpans()[0]
+				assertProtoEqual(t, want, ss.GetSpans()[0])
+				assertProtoEqual(t, tt.scopes[i], ss.GetScope())
+				assertProtoEqual(t, tt.resource, rss[i].GetResource())
+			}
+		})
+	}
+}
+
+func TestConsoleDotnetLogs(t *testing.T) {
+	c := parseConsoleTestdata(t, "dotnet")
+	logs, resources := consoleLogs(c)
+	tests := []struct {
+		name string
+		want *otlplogs.LogRecord
+	}{
+		{
+			// the formatted message is the body
+			name: "in a span",
+			want: &otlplogs.LogRecord{
+				TimeUnixNano:   mustTimestamp(t, "2024-05-02T10:01:02.1144Z"),
+				SeverityNumber: otlplogs.SeverityNumber_SEVERITY_NUMBER_WARN,
+				SeverityText:   "Warning",
+				Body:           stringValue("Rolled a 4"),
+				Attributes: []*otlpcommon.KeyValue{
+					IntAttribute("roll", 4),
+					StringAttribute("OriginalFormat (a.k.a Body)", "Rolled a {roll}"),
+				},
+				TraceId: mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+				SpanId:  mustHexId(t, "051581bf3cb55c13"),
+			},
+		},
+		{
+			name: "outside of a span",
+			want: &otlplogs.LogRecord{
+				TimeUnixNano:   mustTimestamp(t, "2024-05-02T10:01:03Z"),
+				SeverityNumber: otlplogs.SeverityNumber_SEVERITY_NUMBER_INFO2,
+				SeverityText:   "Information",
+				Body:           stringValue("Done"),
+			},
+		},
+	}
+	if len(logs) != len(tests) {
+		t.Fatalf("Expected %d log records, got %d", len(tests), len(logs))
+	}
+	// the attributes of the resource are printed without indentation
+	resource := &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{
+		StringAttribute("service.name", "dotnet.console.logs"),
+		StringAttribute("telemetry.sdk.language", "dotnet"),
+	}}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertProtoEqual(t, tt.want, logs[i])
+			assertProtoEqual(t, resource, resources[i])
+			assertProtoEqual(t, &otlpcommon.InstrumentationScope{Name: "Program"}, c.Logs.GetResourceLogs()[i].GetScopeLogs()[0].GetScope())
+		})
+	}
+}
+
+func TestDotnetDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"00:00:00.0002573", 257300 * time.Nanosecond},
+		{"00:00:01", time.Second},
+		{"01:02:03.5000000", time.Hour + 2*time.Minute + 3500*time.Millisecond},
+		{"1.02:03:04.5000000", 26*time.Hour + 3*time.Minute + 4500*time.Millisecond},
+		{"", 0},
+		{"1.5", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := dotnetDuration(tt.value); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDotnetSeverity(t *testing.T) {
+	tests := []struct {
+		value string
+		want  otlplogs.SeverityNumber
+	}{
+		{"Trace", otlplogs.SeverityNumber_SEVERITY_NUMBER_TRACE},
+		{"Debug", otlplogs.SeverityNumber_SEVERITY_NUMBER_DEBUG},
+		{"Info", otlplogs.SeverityNumber_SEVERITY_NUMBER_INFO},
+		{"Info2", otlplogs.SeverityNumber_SEVERITY_NUMBER_INFO2},
+		{"Warn4", otlplogs.SeverityNumber_SEVERITY_NUMBER_WARN4},
+		{"Error", otlplogs.SeverityNumber_SEVERITY_NUMBER_ERROR},
+		{"Fatal3", otlplogs.SeverityNumber_SEVERITY_NUMBER_FATAL3},
+		{"Information", otlplogs.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED},
+		{"", otlplogs.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := dotnetSeverity(tt.value); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
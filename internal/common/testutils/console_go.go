@@ -0,0 +1,436 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// The JSON printed by the Go stdouttrace, stdoutmetric and stdoutlog exporters, the fields of the SDK types
+type goKeyValue struct {
+	Key   string
+	Value goValue
+}
+
+type goValue struct {
+	Type  string
+	Value json.RawMessage
+}
+
+type goScope struct {
+	Name      string
+	Version   string
+	SchemaURL string
+}
+
+type goSpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+type goSpan struct {
+	Name        string
+	SpanContext goSpanContext
+	Parent      goSpanContext
+	// Same values as the OTLP kinds
+	SpanKind   int32
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes []goKeyValue
+	Events     []struct {
+		Name                  string
+		Attributes            []goKeyValue
+		DroppedAttributeCount uint32
+		Time                  time.Time
+	}
+	Links []struct {
+		SpanContext           goSpanContext
+		Attributes            []goKeyValue
+		DroppedAttributeCount uint32
+	}
+	Status struct {
+		Code        string
+		Description string
+	}
+	DroppedAttributes uint32
+	DroppedEvents     uint32
+	DroppedLinks      uint32
+	Resource          []goKeyValue
+	// InstrumentationLibrary before v1.23.0 of the SDK
+	InstrumentationScope   *goScope
+	InstrumentationLibrary *goScope
+}
+
+type goLogRecord struct {
+	Timestamp         time.Time
+	ObservedTimestamp time.Time
+	Severity          int32
+	SeverityText      string
+	Body              goValue
+	Attributes        []goKeyValue
+	TraceID           string
+	SpanID            string
+	Resource          []goKeyValue
+	Scope             goScope
+	DroppedAttributes uint32
+}
+
+type goResourceMetrics struct {
+	Resource     []goKeyValue
+	ScopeMetrics []struct {
+		Scope   goScope
+		Metrics []struct {
+			Name        string
+			Description string
+			Unit        string
+			Data        struct {
+				DataPoints []map[string]any
+				// Set for the sums and histograms, e.g. CumulativeTemporality
+				Temporality string
+				IsMonotonic *bool
+			}
+		}
+	}
+}
+
+func (c *ConsoleTelemetry) addGo(data []byte, obj map[string]any) error {
+	switch {
+	case obj["SpanContext"] != nil:
+		var s goSpan
+		if err := decodeJSON(data, &s); err != nil {
+			return fmt.Errorf("invalid span of stdouttrace in the console output: %w", err)
+		}
+		return c.addGoSpan(&s)
+	case obj["ScopeMetrics"] != nil:
+		var rm goResourceMetrics
+		if err := decodeJSON(data, &rm); err != nil {
+			return fmt.Errorf("invalid metrics of stdoutmetric in the console output: %w", err)
+		}
+		return c.addGoMetrics(&rm)
+	default:
+		var l goLogRecord
+		if err := decodeJSON(data, &l); err != nil {
+			return fmt.Errorf("invalid log record of stdoutlog in the console output: %w", err)
+		}
+		return c.addGoLog(&l)
+	}
+}
+
+func (c *ConsoleTelemetry) addGoSpan(s *goSpan) error {
+	span := &otlptrace.Span{
+		Name:                   s.Name,
+		Kind:                   otlptrace.Span_SpanKind(s.SpanKind),
+		StartTimeUnixNano:      goTimestamp(s.StartTime),
+		EndTimeUnixNano:        goTimestamp(s.EndTime),
+		Status:                 consoleStatus(s.Status.Code, s.Status.Description),
+		DroppedAttributesCount: s.DroppedAttributes,
+		DroppedEventsCount:     s.DroppedEvents,
+		DroppedLinksCount:      s.DroppedLinks,
+	}
+	var err error
+	if span.TraceId, span.SpanId, err = goSpanIds(s.SpanContext); err != nil {
+		return err
+	}
+	if _, span.ParentSpanId, err = goSpanIds(s.Parent); err != nil {
+		return err
+	}
+	if span.Attributes, err = goAttributes(s.Attributes); err != nil {
+		return err
+	}
+	for _, e := range s.Events {
+		event := &otlptrace.Span_Event{Name: e.Name, TimeUnixNano: goTimestamp(e.Time), DroppedAttributesCount: e.DroppedAttributeCount}
+		if event.Attributes, err = goAttributes(e.Attributes); err != nil {
+			return err
+		}
+		span.Events = append(span.Events, event)
+	}
+	for _, l := range s.Links {
+		link := &otlptrace.Span_Link{DroppedAttributesCount: l.DroppedAttributeCount}
+		if link.TraceId, link.SpanId, err = goSpanIds(l.SpanContext); err != nil {
+			return err
+		}
+		if link.Attributes, err = goAttributes(l.Attributes); err != nil {
+			return err
+		}
+		span.Links = append(span.Links, link)
+	}
+	r, err := goResource(s.Resource)
+	if err != nil {
+		return err
+	}
+	scope := s.InstrumentationScope
+	if scope == nil {
+		scope = s.InstrumentationLibrary
+	}
+	c.addSpan(r, goInstrumentationScope(scope), span)
+	return nil
+}
+
+func (c *ConsoleTelemetry) addGoLog(l *goLogRecord) error {
+	record := &otlplogs.LogRecord{
+		TimeUnixNano:           goTimestamp(l.Timestamp),
+		ObservedTimeUnixNano:   goTimestamp(l.ObservedTimestamp),
+		SeverityNumber:         otlplogs.SeverityNumber(l.Severity),
+		SeverityText:           l.SeverityText,
+		DroppedAttributesCount: l.DroppedAttributes,
+	}
+	var err error
+	if record.TraceId, record.SpanId, err = goSpanIds(goSpanContext{TraceID: l.TraceID, SpanID: l.SpanID}); err != nil {
+		return err
+	}
+	if record.Body, err = goAnyValue(l.Body); err != nil {
+		return err
+	}
+	if record.Attributes, err = goAttributes(l.Attributes); err != nil {
+		return err
+	}
+	r, err := goResource(l.Resource)
+	if err != nil {
+		return err
+	}
+	c.addLog(r, goInstrumentationScope(&l.Scope), record)
+	return nil
+}
+
+func (c *ConsoleTelemetry) addGoMetrics(rm *goResourceMetrics) error {
+	r, err := goResource(rm.Resource)
+	if err != nil {
+		return err
+	}
+	for _, sm := range rm.ScopeMetrics {
+		var metrics []*otlpmetrics.Metric
+		for _, m := range sm.Metrics {
+			metric := &otlpmetrics.Metric{Name: m.Name, Description: m.Description, Unit: m.Unit}
+			dps := m.Data.DataPoints
+			temporality := otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+			if m.Data.Temporality == "DeltaTemporality" {
+				temporality = otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+			}
+			switch {
+			case len(dps) > 0 && dps[0]["Scale"] != nil:
+				// the exponential histograms are not supported
+				continue
+			case len(dps) > 0 && dps[0]["Bounds"] != nil:
+				h := &otlpmetrics.Histogram{AggregationTemporality: temporality}
+				for _, dp := range dps {
+					hdp, err := goHistogramDataPoint(dp)
+					if err != nil {
+						return err
+					}
+					h.DataPoints = append(h.DataPoints, hdp)
+				}
+				metric.Data = &otlpmetrics.Metric_Histogram{Histogram: h}
+			case m.Data.IsMonotonic != nil:
+				sum := &otlpmetrics.Sum{AggregationTemporality: temporality, IsMonotonic: *m.Data.IsMonotonic}
+				if sum.DataPoints, err = goNumberDataPoints(dps); err != nil {
+					return err
+				}
+				metric.Data = &otlpmetrics.Metric_Sum{Sum: sum}
+			default:
+				gauge := &otlpmetrics.Gauge{}
+				if gauge.DataPoints, err = goNumberDataPoints(dps); err != nil {
+					return err
+				}
+				metric.Data = &otlpmetrics.Metric_Gauge{Gauge: gauge}
+			}
+			metrics = append(metrics, metric)
+		}
+		c.addMetrics(r, goInstrumentationScope(&sm.Scope), metrics...)
+	}
+	return nil
+}
+
+func goNumberDataPoints(dps []map[string]any) ([]*otlpmetrics.NumberDataPoint, error) {
+	var res []*otlpmetrics.NumberDataPoint
+	for _, dp := range dps {
+		ndp := &otlpmetrics.NumberDataPoint{}
+		if err := goDataPointCommon(dp, &ndp.Attributes, &ndp.StartTimeUnixNano, &ndp.TimeUnixNano); err != nil {
+			return nil, err
+		}
+		v, _ := dp["Value"].(json.Number)
+		if i, err := v.Int64(); err == nil {
+			ndp.Value = &otlpmetrics.NumberDataPoint_AsInt{AsInt: i}
+		} else {
+			f, _ := v.Float64()
+			ndp.Value = &otlpmetrics.NumberDataPoint_AsDouble{AsDouble: f}
+		}
+		res = append(res, ndp)
+	}
+	return res, nil
+}
+
+func goHistogramDataPoint(dp map[string]any) (*otlpmetrics.HistogramDataPoint, error) {
+	hdp := &otlpmetrics.HistogramDataPoint{Count: uint64(jsonInt(dp, "Count"))}
+	if err := goDataPointCommon(dp, &hdp.Attributes, &hdp.StartTimeUnixNano, &hdp.TimeUnixNano); err != nil {
+		return nil, err
+	}
+	sum := jsonFloat(dp, "Sum")
+	hdp.Sum = &sum
+	for _, b := range jsonArray(dp, "Bounds") {
+		f, _ := b.(json.Number).Float64()
+		hdp.ExplicitBounds = append(hdp.ExplicitBounds, f)
+	}
+	for _, c := range jsonArray(dp, "BucketCounts") {
+		i, _ := c.(json.Number).Int64()
+		hdp.BucketCounts = append(hdp.BucketCounts, uint64(i))
+	}
+	hdp.Min, hdp.Max = goExtrema(dp["Min"]), goExtrema(dp["Max"])
+	return hdp, nil
+}
+
+// The min and max of the histograms are printed as text, empty when not recorded
+func goExtrema(v any) *float64 {
+	var s string
+	switch e := v.(type) {
+	case string:
+		s = e
+	case json.Number:
+		s = e.String()
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+func goDataPointCommon(dp map[string]any, attributes *[]*otlpcommon.KeyValue, start, end *uint64) error {
+	data, err := json.Marshal(struct {
+		Attributes []any
+		StartTime  any
+		Time       any
+	}{jsonArray(dp, "Attributes"), dp["StartTime"], dp["Time"]})
+	if err != nil {
+		return err
+	}
+	var common struct {
+		Attributes []goKeyValue
+		StartTime  time.Time
+		Time       time.Time
+	}
+	if err := json.Unmarshal(data, &common); err != nil {
+		return fmt.Errorf("invalid data point of stdoutmetric in the console output: %w", err)
+	}
+	*start, *end = goTimestamp(common.StartTime), goTimestamp(common.Time)
+	*attributes, err = goAttributes(common.Attributes)
+	return err
+}
+
+func goSpanIds(sc goSpanContext) ([]byte, []byte, error) {
+	traceId, err := parseConsoleId(sc.TraceID, 16)
+	if err != nil {
+		return nil, nil, err
+	}
+	spanId, err := parseConsoleId(sc.SpanID, 8)
+	return traceId, spanId, err
+}
+
+// The zero time is printed for unset timestamps, e.g. the ones of logs emitted without a timestamp
+func goTimestamp(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func goResource(attrs []goKeyValue) (*otlpresource.Resource, error) {
+	kvs, err := goAttributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return &otlpresource.Resource{Attributes: kvs}, nil
+}
+
+func goInstrumentationScope(s *goScope) *otlpcommon.InstrumentationScope {
+	if s == nil {
+		return nil
+	}
+	return &otlpcommon.InstrumentationScope{Name: s.Name, Version: s.Version}
+}
+
+func goAttributes(attrs []goKeyValue) ([]*otlpcommon.KeyValue, error) {
+	var res []*otlpcommon.KeyValue
+	for _, a := range attrs {
+		v, err := goAnyValue(a.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute %s in the console output: %w", a.Key, err)
+		}
+		res = append(res, &otlpcommon.KeyValue{Key: a.Key, Value: v})
+	}
+	return res, nil
+}
+
+// Converts a value of the attribute package, e.g. of type STRINGSLICE, or of the log package, e.g. of type
+// Slice, whose elements are values too
+func goAnyValue(v goValue) (*otlpcommon.AnyValue, error) {
+	var err error
+	res := &otlpcommon.AnyValue{}
+	switch v.Type {
+	case "", "Empty", "INVALID":
+	case "STRING", "String":
+		var s string
+		err = json.Unmarshal(v.Value, &s)
+		res.Value = &otlpcommon.AnyValue_StringValue{StringValue: s}
+	case "BOOL", "Bool":
+		var b bool
+		err = json.Unmarshal(v.Value, &b)
+		res.Value = &otlpcommon.AnyValue_BoolValue{BoolValue: b}
+	case "INT64", "Int64":
+		var i int64
+		err = json.Unmarshal(v.Value, &i)
+		res.Value = &otlpcommon.AnyValue_IntValue{IntValue: i}
+	case "FLOAT64", "Float64":
+		var f float64
+		err = json.Unmarshal(v.Value, &f)
+		res.Value = &otlpcommon.AnyValue_DoubleValue{DoubleValue: f}
+	case "Bytes":
+		var s string
+		if err = json.Unmarshal(v.Value, &s); err == nil {
+			var b []byte
+			b, err = base64.StdEncoding.DecodeString(s)
+			res.Value = &otlpcommon.AnyValue_BytesValue{BytesValue: b}
+		}
+	case "STRINGSLICE", "BOOLSLICE", "INT64SLICE", "FLOAT64SLICE":
+		var values []json.RawMessage
+		err = json.Unmarshal(v.Value, &values)
+		arr := &otlpcommon.ArrayValue{}
+		for _, e := range values {
+			ev, evErr := goAnyValue(goValue{Type: v.Type[:len(v.Type)-len("SLICE")], Value: e})
+			if evErr != nil {
+				return nil, evErr
+			}
+			arr.Values = append(arr.Values, ev)
+		}
+		res.Value = &otlpcommon.AnyValue_ArrayValue{ArrayValue: arr}
+	case "Slice":
+		var values []goValue
+		err = json.Unmarshal(v.Value, &values)
+		arr := &otlpcommon.ArrayValue{}
+		for _, e := range values {
+			ev, evErr := goAnyValue(e)
+			if evErr != nil {
+				return nil, evErr
+			}
+			arr.Values = append(arr.Values, ev)
+		}
+		res.Value = &otlpcommon.AnyValue_ArrayValue{ArrayValue: arr}
+	case "Map":
+		var kvs []goKeyValue
+		if err = json.Unmarshal(v.Value, &kvs); err == nil {
+			var values []*otlpcommon.KeyValue
+			values, err = goAttributes(kvs)
+			res.Value = &otlpcommon.AnyValue_KvlistValue{KvlistValue: &otlpcommon.KeyValueList{Values: values}}
+		}
+	default:
+		return nil, fmt.Errorf("unknown value type %s", v.Type)
+	}
+	return res, err
+}
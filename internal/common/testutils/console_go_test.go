@@ -0,0 +1,207 @@
+package testutils
+
+import (
+	"testing"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestConsoleGoSpans(t *testing.T) {
+	c := parseConsoleTestdata(t, "go")
+	resource := &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{
+		StringAttribute("service.name", "go.console.traces"),
+		StringAttribute("telemetry.sdk.language", "go"),
+	}}
+	tests := []struct {
+		name  string
+		want  *otlptrace.Span
+		scope *otlpcommon.InstrumentationScope
+	}{
+		{
+			name: "HelloWorldSpan",
+			want: &otlptrace.Span{
+				Name:              "HelloWorldSpan",
+				TraceId:           mustHexId(t, "829fb7ceb787403c96eac634767ef10a"),
+				SpanId:            mustHexId(t, "efe159833c5bf9d1"),
+				ParentSpanId:      mustHexId(t, "0a3bb75e2b3b1d6b"),
+				Kind:              otlptrace.Span_SPAN_KIND_INTERNAL,
+				StartTimeUnixNano: mustTimestamp(t, "2024-05-02T12:01:02.177119576+02:00"),
+				EndTimeUnixNano:   mustTimestamp(t, "2024-05-02T12:01:02.177136776+02:00"),
+				Attributes: []*otlpcommon.KeyValue{
+					StringAttribute("foo", "bar"),
+					IntAttribute("roll.value", 6),
+					{Key: "tags", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: &otlpcommon.ArrayValue{
+						Values: []*otlpcommon.AnyValue{stringValue("a"), stringValue("b")},
+					}}}},
+				},
+				Events: []*otlptrace.Span_Event{{
+					Name:         "Feeding",
+					TimeUnixNano: mustTimestamp(t, "2024-05-02T12:01:02.17713+02:00"),
+					Attributes:   []*otlpcommon.KeyValue{StringAttribute("food", "pizza")},
+				}},
+				Links: []*otlptrace.Span_Link{{
+					TraceId: mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+					SpanId:  mustHexId(t, "051581bf3cb55c13"),
+				}},
+				Status: &otlptrace.Status{},
+			},
+			scope: &otlpcommon.InstrumentationScope{Name: "otel-recipes/go-console", Version: "1.0.0"},
+		},
+		{
+			// printed with the InstrumentationLibrary of the SDKs before v1.23.0, the parent being all zeros
+			name: "main",
+			want: &otlptrace.Span{
+				Name:                   "main",
+				TraceId:                mustHexId(t, "829fb7ceb787403c96eac634767ef10a"),
+				SpanId:                 mustHexId(t, "0a3bb75e2b3b1d6b"),
+				Kind:                   otlptrace.Span_SPAN_KIND_SERVER,
+				StartTimeUnixNano:      mustTimestamp(t, "2024-05-02T12:01:02.177100001+02:00"),
+				EndTimeUnixNano:        mustTimestamp(t, "2024-05-02T12:01:02.177200002+02:00"),
+				Status:                 &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR, Message: "it failed"},
+				DroppedAttributesCount: 2,
+			},
+			scope: &otlpcommon.InstrumentationScope{Name: "otel-recipes/go-console"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, r, scope := findConsoleSpan(c, tt.name)
+			if span == nil {
+				t.Fatalf("Span %s not parsed", tt.name)
+			}
+			assertProtoEqual(t, tt.want, span)
+			assertProtoEqual(t, resource, r)
+			assertProtoEqual(t, tt.scope, scope)
+		})
+	}
+}
+
+func TestConsoleGoMetrics(t *testing.T) {
+	c := parseConsoleTestdata(t, "go")
+	start, end := mustTimestamp(t, "2024-05-02T10:01:02.1Z"), mustTimestamp(t, "2024-05-02T10:01:03.2Z")
+	sum, min, max := 12.0, 1.5, 7.0
+	tests := []struct {
+		name string
+		want *otlpmetrics.Metric
+	}{
+		{
+			name: "dice.rolls",
+			want: &otlpmetrics.Metric{
+				Name: "dice.rolls", Description: "The number of rolls by roll value", Unit: "{roll}",
+				Data: &otlpmetrics.Metric_Sum{Sum: &otlpmetrics.Sum{
+					AggregationTemporality: otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+					DataPoints: []*otlpmetrics.NumberDataPoint{{
+						Attributes:        []*otlpcommon.KeyValue{IntAttribute("roll.value", 1)},
+						StartTimeUnixNano: start, TimeUnixNano: end,
+						Value: &otlpmetrics.NumberDataPoint_AsInt{AsInt: 4},
+					}},
+				}},
+			},
+		},
+		{
+			// without temporality nor monotonicity
+			name: "queue.size",
+			want: &otlpmetrics.Metric{
+				Name: "queue.size",
+				Data: &otlpmetrics.Metric_Gauge{Gauge: &otlpmetrics.Gauge{
+					DataPoints: []*otlpmetrics.NumberDataPoint{{
+						StartTimeUnixNano: start, TimeUnixNano: end,
+						Value: &otlpmetrics.NumberDataPoint_AsDouble{AsDouble: 2.5},
+					}},
+				}},
+			},
+		},
+		{
+			name: "request.duration",
+			want: &otlpmetrics.Metric{
+				Name: "request.duration", Unit: "ms",
+				Data: &otlpmetrics.Metric_Histogram{Histogram: &otlpmetrics.Histogram{
+					AggregationTemporality: otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					DataPoints: []*otlpmetrics.HistogramDataPoint{{
+						StartTimeUnixNano: start, TimeUnixNano: end,
+						Count: 3, Sum: &sum, Min: &min, Max: &max,
+						ExplicitBounds: []float64{0, 5, 10},
+						BucketCounts:   []uint64{0, 2, 1, 0},
+					}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, r := findConsoleMetric(c, tt.name)
+			if m == nil {
+				t.Fatalf("Metric %s not parsed", tt.name)
+			}
+			assertProtoEqual(t, tt.want, m)
+			if sn := getServiceName(r); sn != "go.console.metrics" {
+				t.Errorf("Unexpected service.name %q", sn)
+			}
+		})
+	}
+}
+
+func TestConsoleGoLogs(t *testing.T) {
+	c := parseConsoleTestdata(t, "go")
+	logs, resources := consoleLogs(c)
+	if len(logs) != 1 {
+		t.Fatalf("Expected 1 log record, got %d", len(logs))
+	}
+	want := &otlplogs.LogRecord{
+		TimeUnixNano:         mustTimestamp(t, "2024-05-02T10:01:02.5Z"),
+		ObservedTimeUnixNano: mustTimestamp(t, "2024-05-02T10:01:02.6Z"),
+		SeverityNumber:       otlplogs.SeverityNumber_SEVERITY_NUMBER_INFO,
+		SeverityText:         "INFO",
+		Body:                 stringValue("Hello from the logs"),
+		Attributes: []*otlpcommon.KeyValue{{Key: "user", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_KvlistValue{
+			KvlistValue: &otlpcommon.KeyValueList{Values: []*otlpcommon.KeyValue{BoolAttribute("admin", true)}},
+		}}}},
+		TraceId: mustHexId(t, "829fb7ceb787403c96eac634767ef10a"),
+		SpanId:  mustHexId(t, "efe159833c5bf9d1"),
+	}
+	assertProtoEqual(t, want, logs[0])
+	if sn := getServiceName(resources[0]); sn != "go.console.logs" {
+		t.Errorf("Unexpected service.name %q", sn)
+	}
+}
+
+func TestGoAnyValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   goValue
+		want    *otlpcommon.AnyValue
+		wantErr bool
+	}{
+		{"string", goValue{Type: "STRING", Value: []byte(`"bar"`)}, stringValue("bar"), false},
+		{"log string", goValue{Type: "String", Value: []byte(`"bar"`)}, stringValue("bar"), false},
+		{"bool", goValue{Type: "BOOL", Value: []byte(`true`)}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: true}}, false},
+		{"int", goValue{Type: "INT64", Value: []byte(`42`)}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: 42}}, false},
+		{"float", goValue{Type: "FLOAT64", Value: []byte(`0.5`)}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: 0.5}}, false},
+		{"bytes", goValue{Type: "Bytes", Value: []byte(`"aGk="`)}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BytesValue{BytesValue: []byte("hi")}}, false},
+		{"int slice", goValue{Type: "INT64SLICE", Value: []byte(`[1,2]`)}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: &otlpcommon.ArrayValue{
+			Values: []*otlpcommon.AnyValue{{Value: &otlpcommon.AnyValue_IntValue{IntValue: 1}}, {Value: &otlpcommon.AnyValue_IntValue{IntValue: 2}}},
+		}}}, false},
+		{"log slice", goValue{Type: "Slice", Value: []byte(`[{"Type":"String","Value":"a"}]`)}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: &otlpcommon.ArrayValue{
+			Values: []*otlpcommon.AnyValue{stringValue("a")},
+		}}}, false},
+		{"empty", goValue{Type: "Empty"}, &otlpcommon.AnyValue{}, false},
+		{"unknown type", goValue{Type: "COMPLEX128", Value: []byte(`1`)}, nil, true},
+		{"mismatching value", goValue{Type: "INT64", Value: []byte(`"1"`)}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := goAnyValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !tt.wantErr {
+				assertProtoEqual(t, tt.want, got)
+			}
+		})
+	}
+}
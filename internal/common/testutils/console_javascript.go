@@ -0,0 +1,351 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// The values util.inspect prints instead of the objects deeper than its depth, e.g. [Object] or [Array]
+var jsPlaceholder = regexp.MustCompile(`^\[(Object|Array|Function|Getter|Setter|Getter/Setter|Circular|class)\b[^\]\n]*\]`)
+
+// The placeholder of the truncated arrays, e.g. ... 10 more items
+var jsMoreItems = regexp.MustCompile(`^\.\.\. \d+ more items?`)
+
+// The references of the circular objects, e.g. <ref *1>
+var jsRef = regexp.MustCompile(`^<ref \*\d+>`)
+
+// The data point types of the JavaScript SDK
+const (
+	jsHistogram = iota
+	jsExponentialHistogram
+	jsGauge
+	jsSum
+)
+
+// Adds the telemetry printed by the console exporters of the JavaScript SDK, objects printed by console.dir
+func (c *ConsoleTelemetry) addJs(obj map[string]any) error {
+	switch {
+	case hasKeys(obj, "traceId", "id", "name"):
+		return c.addJsSpan(obj)
+	case hasKeys(obj, "descriptor", "dataPoints"):
+		c.addJsMetric(obj)
+		return nil
+	case hasKeys(obj, "body", "severityNumber"), hasKeys(obj, "body", "severityText"):
+		return c.addJsLog(obj)
+	}
+	return nil
+}
+
+func (c *ConsoleTelemetry) addJsSpan(obj map[string]any) error {
+	start := uint64(jsonFloat(obj, "timestamp") * 1e3)
+	span := &otlptrace.Span{
+		Name:              jsonString(obj, "name"),
+		Kind:              otlptrace.Span_SpanKind(jsonInt(obj, "kind") + 1),
+		StartTimeUnixNano: start,
+		EndTimeUnixNano:   start + uint64(jsonFloat(obj, "duration")*1e3),
+		Attributes:        jsonAttributes(jsonObject(obj, "attributes")),
+	}
+	if status := jsonObject(obj, "status"); status != nil {
+		span.Status = &otlptrace.Status{Code: otlptrace.Status_StatusCode(jsonInt(status, "code")), Message: jsonString(status, "message")}
+	}
+	var err error
+	if span.TraceId, err = parseConsoleId(jsonString(obj, "traceId"), 16); err != nil {
+		return err
+	}
+	if span.SpanId, err = parseConsoleId(jsonString(obj, "id"), 8); err != nil {
+		return err
+	}
+	// parentId before v2.0.0 of the SDK
+	parent := jsonString(obj, "parentId")
+	if p := jsonString(jsonObject(obj, "parentSpanContext"), "spanId"); p != "" {
+		parent = p
+	}
+	if span.ParentSpanId, err = parseConsoleId(parent, 8); err != nil {
+		return err
+	}
+	for _, e := range jsonArray(obj, "events") {
+		e, _ := e.(map[string]any)
+		span.Events = append(span.Events, &otlptrace.Span_Event{
+			Name:                   jsonString(e, "name"),
+			TimeUnixNano:           jsHrTime(e["time"]),
+			Attributes:             jsonAttributes(jsonObject(e, "attributes")),
+			DroppedAttributesCount: uint32(jsonInt(e, "droppedAttributesCount")),
+		})
+	}
+	for _, l := range jsonArray(obj, "links") {
+		l, _ := l.(map[string]any)
+		ctx := jsonObject(l, "context")
+		link := &otlptrace.Span_Link{Attributes: jsonAttributes(jsonObject(l, "attributes"))}
+		if link.TraceId, err = parseConsoleId(jsonString(ctx, "traceId"), 16); err != nil {
+			return err
+		}
+		if link.SpanId, err = parseConsoleId(jsonString(ctx, "spanId"), 8); err != nil {
+			return err
+		}
+		span.Links = append(span.Links, link)
+	}
+	c.addSpan(jsResource(obj), jsScope(obj), span)
+	return nil
+}
+
+func (c *ConsoleTelemetry) addJsLog(obj map[string]any) error {
+	record := &otlplogs.LogRecord{
+		TimeUnixNano:   uint64(jsonFloat(obj, "timestamp") * 1e3),
+		SeverityNumber: otlplogs.SeverityNumber(jsonInt(obj, "severityNumber")),
+		SeverityText:   jsonString(obj, "severityText"),
+		Attributes:     jsonAttributes(jsonObject(obj, "attributes")),
+	}
+	if body := obj["body"]; body != nil {
+		record.Body = jsonAnyValue(body)
+	}
+	var err error
+	if record.TraceId, err = parseConsoleId(jsonString(obj, "traceId"), 16); err != nil {
+		return err
+	}
+	if record.SpanId, err = parseConsoleId(jsonString(obj, "spanId"), 8); err != nil {
+		return err
+	}
+	c.addLog(jsResource(obj), jsScope(obj), record)
+	return nil
+}
+
+// The metrics are printed without their resource nor scope, and without their temporality, cumulative by default
+func (c *ConsoleTelemetry) addJsMetric(obj map[string]any) {
+	desc := jsonObject(obj, "descriptor")
+	metric := &otlpmetrics.Metric{Name: jsonString(desc, "name"), Description: jsonString(desc, "description"), Unit: jsonString(desc, "unit")}
+	temporality := otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	dps := jsonArray(obj, "dataPoints")
+	switch jsonInt(obj, "dataPointType") {
+	case jsHistogram:
+		h := &otlpmetrics.Histogram{AggregationTemporality: temporality}
+		for _, dp := range dps {
+			dp, _ := dp.(map[string]any)
+			h.DataPoints = append(h.DataPoints, jsHistogramDataPoint(dp))
+		}
+		metric.Data = &otlpmetrics.Metric_Histogram{Histogram: h}
+	case jsSum:
+		kind := jsonString(desc, "type")
+		metric.Data = &otlpmetrics.Metric_Sum{Sum: &otlpmetrics.Sum{
+			AggregationTemporality: temporality,
+			IsMonotonic:            kind == "COUNTER" || kind == "OBSERVABLE_COUNTER",
+			DataPoints:             jsNumberDataPoints(dps, jsonInt(desc, "valueType")),
+		}}
+	case jsGauge:
+		metric.Data = &otlpmetrics.Metric_Gauge{Gauge: &otlpmetrics.Gauge{DataPoints: jsNumberDataPoints(dps, jsonInt(desc, "valueType"))}}
+	default:
+		// the exponential histograms are not supported
+		return
+	}
+	c.addMetrics(&otlpresource.Resource{}, nil, metric)
+}
+
+// The value type of the instrument tells the integers, 0, from the doubles, 1
+func jsNumberDataPoints(dps []any, valueType int64) []*otlpmetrics.NumberDataPoint {
+	var res []*otlpmetrics.NumberDataPoint
+	for _, dp := range dps {
+		dp, _ := dp.(map[string]any)
+		ndp := &otlpmetrics.NumberDataPoint{
+			Attributes:        jsonAttributes(jsonObject(dp, "attributes")),
+			StartTimeUnixNano: jsHrTime(dp["startTime"]),
+			TimeUnixNano:      jsHrTime(dp["endTime"]),
+		}
+		if valueType == 0 {
+			ndp.Value = &otlpmetrics.NumberDataPoint_AsInt{AsInt: jsonInt(dp, "value")}
+		} else {
+			ndp.Value = &otlpmetrics.NumberDataPoint_AsDouble{AsDouble: jsonFloat(dp, "value")}
+		}
+		res = append(res, ndp)
+	}
+	return res
+}
+
+func jsHistogramDataPoint(dp map[string]any) *otlpmetrics.HistogramDataPoint {
+	value := jsonObject(dp, "value")
+	sum := jsonFloat(value, "sum")
+	hdp := &otlpmetrics.HistogramDataPoint{
+		Attributes:        jsonAttributes(jsonObject(dp, "attributes")),
+		StartTimeUnixNano: jsHrTime(dp["startTime"]),
+		TimeUnixNano:      jsHrTime(dp["endTime"]),
+		Count:             uint64(jsonInt(value, "count")),
+		Sum:               &sum,
+	}
+	buckets := jsonObject(value, "buckets")
+	for _, b := range jsonArray(buckets, "boundaries") {
+		f, _ := b.(json.Number).Float64()
+		hdp.ExplicitBounds = append(hdp.ExplicitBounds, f)
+	}
+	for _, c := range jsonArray(buckets, "counts") {
+		i, _ := c.(json.Number).Int64()
+		hdp.BucketCounts = append(hdp.BucketCounts, uint64(i))
+	}
+	if _, found := value["min"].(json.Number); found {
+		v := jsonFloat(value, "min")
+		hdp.Min = &v
+	}
+	if _, found := value["max"].(json.Number); found {
+		v := jsonFloat(value, "max")
+		hdp.Max = &v
+	}
+	return hdp
+}
+
+// Converts a time printed as a [seconds, nanoseconds] tuple
+func jsHrTime(v any) uint64 {
+	t, _ := v.([]any)
+	if len(t) != 2 {
+		return 0
+	}
+	sec, _ := t[0].(json.Number).Int64()
+	nanos, _ := t[1].(json.Number).Int64()
+	return uint64(sec)*1e9 + uint64(nanos)
+}
+
+func jsResource(obj map[string]any) *otlpresource.Resource {
+	return &otlpresource.Resource{Attributes: jsonAttributes(jsonObject(jsonObject(obj, "resource"), "attributes"))}
+}
+
+// instrumentationLibrary before v1.10.0 of the SDK
+func jsScope(obj map[string]any) *otlpcommon.InstrumentationScope {
+	s := jsonObject(obj, "instrumentationScope")
+	if s == nil {
+		s = jsonObject(obj, "instrumentationLibrary")
+	}
+	if s == nil {
+		return nil
+	}
+	return &otlpcommon.InstrumentationScope{Name: jsonString(s, "name"), Version: jsonString(s, "version")}
+}
+
+// Converts an object printed by util.inspect to JSON: the keys are quoted, the strings double quoted, the
+// undefined values and the placeholders of the nested objects are null, the class names before the objects
+// are removed, e.g. Resource { ... }, and so are the trailing commas
+func jsObjectToJSON(text string) ([]byte, error) {
+	var out []byte
+	closeValue := func(r byte) {
+		out = []byte(strings.TrimRightFunc(string(out), unicode.IsSpace))
+		out = []byte(strings.TrimSuffix(string(out), ","))
+		out = append(out, r)
+	}
+	for i := 0; i < len(text); {
+		ch := text[i]
+		rest := text[i:]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			s, n, err := jsString(rest)
+			if err != nil {
+				return nil, err
+			}
+			quoted, _ := json.Marshal(s)
+			out = append(out, quoted...)
+			i += n
+		case ch == '}' || ch == ']':
+			closeValue(ch)
+			i++
+		case ch == '[' && jsPlaceholder.MatchString(rest):
+			out = append(out, "null"...)
+			i += len(jsPlaceholder.FindString(rest))
+		case ch == '<' && jsRef.MatchString(rest):
+			i += len(jsRef.FindString(rest))
+		case ch == '.' && jsMoreItems.MatchString(rest):
+			i += len(jsMoreItems.FindString(rest))
+		case ch == '-' || (ch >= '0' && ch <= '9'):
+			n := 1
+			for n < len(rest) && strings.IndexByte("0123456789.eE+-", rest[n]) >= 0 {
+				n++
+			}
+			if rest[:n] == "-" {
+				// -Infinity
+				i++
+				continue
+			}
+			out = append(out, rest[:n]...)
+			i += n
+			// BigInt
+			if i < len(text) && text[i] == 'n' {
+				i++
+			}
+		case ch == '_' || ch == '$' || unicode.IsLetter(rune(ch)):
+			n := 1
+			for n < len(rest) && (rest[n] == '_' || rest[n] == '$' || rest[n] == '.' || unicode.IsLetter(rune(rest[n])) || unicode.IsDigit(rune(rest[n]))) {
+				n++
+			}
+			word := rest[:n]
+			i += n
+			next := strings.TrimLeftFunc(text[i:], unicode.IsSpace)
+			switch {
+			case strings.HasPrefix(next, ":"):
+				quoted, _ := json.Marshal(word)
+				out = append(out, quoted...)
+			case word == "true" || word == "false" || word == "null":
+				out = append(out, word...)
+			case word == "undefined" || word == "NaN" || word == "Infinity":
+				out = append(out, "null"...)
+			case strings.HasPrefix(next, "(") || strings.HasPrefix(next, "{") || strings.HasPrefix(next, "["):
+				// a class name, e.g. Map(1) { ... } or Array(2) [ ... ]
+				i = len(text) - len(next)
+				if strings.HasPrefix(next, "(") {
+					if end := strings.IndexByte(next, ')'); end >= 0 {
+						i += end + 1
+					}
+				}
+			default:
+				return nil, fmt.Errorf("unexpected %q in the JavaScript object", word)
+			}
+		default:
+			out = append(out, ch)
+			i++
+		}
+	}
+	return out, nil
+}
+
+// Decodes the string at the start of the text, returning its length in the text
+func jsString(text string) (string, int, error) {
+	quote := text[0]
+	var b strings.Builder
+	for i := 1; i < len(text); i++ {
+		ch := text[i]
+		switch {
+		case ch == quote:
+			return b.String(), i + 1, nil
+		case ch == '\\' && i+1 < len(text):
+			i++
+			switch text[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u', 'x':
+				size := 4
+				if text[i] == 'x' {
+					size = 2
+				}
+				if i+size < len(text) {
+					if r, err := strconv.ParseUint(text[i+1:i+1+size], 16, 32); err == nil {
+						b.WriteRune(rune(r))
+						i += size
+						continue
+					}
+				}
+				b.WriteByte(text[i])
+			default:
+				b.WriteByte(text[i])
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string in the JavaScript object")
+}
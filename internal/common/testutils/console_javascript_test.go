@@ -0,0 +1,238 @@
+package testutils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestConsoleJsSpans(t *testing.T) {
+	c := parseConsoleTestdata(t, "javascript")
+	tests := []struct {
+		name    string
+		want    *otlptrace.Span
+		version string
+		scope   *otlpcommon.InstrumentationScope
+	}{
+		{
+			// printed by the SDKs before v2.0.0, with the parentId and without scope
+			name: "roll",
+			want: &otlptrace.Span{
+				Name:              "roll",
+				TraceId:           mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+				SpanId:            mustHexId(t, "051581bf3cb55c13"),
+				ParentSpanId:      mustHexId(t, "5fb397be34d26b51"),
+				Kind:              otlptrace.Span_SPAN_KIND_INTERNAL,
+				StartTimeUnixNano: 1714644062114304000,
+				EndTimeUnixNano:   1714644062114304000 + 257291,
+				Attributes: []*otlpcommon.KeyValue{
+					IntAttribute("roll.big", 9007199254740993),
+					StringAttribute("roll.label", "it's a 'four'"),
+					{Key: "roll.tags", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: &otlpcommon.ArrayValue{
+						Values: []*otlpcommon.AnyValue{stringValue("six"), stringValue("sided")},
+					}}}},
+					IntAttribute("roll.value", 4),
+				},
+				Events: []*otlptrace.Span_Event{{
+					Name:         "rolled",
+					TimeUnixNano: 1714644062114500000,
+					Attributes:   []*otlpcommon.KeyValue{IntAttribute("attempt", 1)},
+				}},
+				Links: []*otlptrace.Span_Link{{
+					TraceId:    mustHexId(t, "829fb7ceb787403c96eac634767ef10a"),
+					SpanId:     mustHexId(t, "efe159833c5bf9d1"),
+					Attributes: []*otlpcommon.KeyValue{StringAttribute("reason", "retry")},
+				}},
+				Status: &otlptrace.Status{},
+			},
+			version: "1.24.0",
+		},
+		{
+			// printed by the SDKs from v2.0.0, with the parentSpanContext and the scope
+			name: "GET /roll",
+			want: &otlptrace.Span{
+				Name:              "GET /roll",
+				TraceId:           mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+				SpanId:            mustHexId(t, "5fb397be34d26b51"),
+				ParentSpanId:      mustHexId(t, "7a2190356bc8ec5f"),
+				Kind:              otlptrace.Span_SPAN_KIND_SERVER,
+				StartTimeUnixNano: 1714644062100000000,
+				EndTimeUnixNano:   1714644062200000000,
+				Status:            &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR, Message: "Error: 7 is not a dice value"},
+			},
+			version: "2.0.0",
+			scope:   &otlpcommon.InstrumentationScope{Name: "otel-recipes", Version: "1.0.0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, r, scope := findConsoleSpan(c, tt.name)
+			if span == nil {
+				t.Fatalf("Span %s not parsed", tt.name)
+			}
+			assertProtoEqual(t, tt.want, span)
+			assertProtoEqual(t, &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{
+				StringAttribute("service.name", "js.console.traces"),
+				StringAttribute("telemetry.sdk.language", "nodejs"),
+				StringAttribute("telemetry.sdk.version", tt.version),
+			}}, r)
+			assertProtoEqual(t, tt.scope, scope)
+		})
+	}
+}
+
+func TestConsoleJsMetrics(t *testing.T) {
+	c := parseConsoleTestdata(t, "javascript")
+	start, end := uint64(1714644062100000000), uint64(1714644063200000000)
+	sum, min, max := 12.5, 1.5, 7.5
+	cumulative := otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	tests := []struct {
+		name string
+		want *otlpmetrics.Metric
+	}{
+		{
+			name: "dice.rolls",
+			want: &otlpmetrics.Metric{
+				Name: "dice.rolls", Description: "The number of rolls by roll value", Unit: "{roll}",
+				Data: &otlpmetrics.Metric_Sum{Sum: &otlpmetrics.Sum{
+					AggregationTemporality: cumulative,
+					IsMonotonic:            true,
+					DataPoints: []*otlpmetrics.NumberDataPoint{{
+						Attributes:        []*otlpcommon.KeyValue{IntAttribute("roll.value", 4)},
+						StartTimeUnixNano: start, TimeUnixNano: end,
+						Value: &otlpmetrics.NumberDataPoint_AsInt{AsInt: 2},
+					}},
+				}},
+			},
+		},
+		{
+			// a double told by the value type of the instrument, the value being printed as 2
+			name: "queue.size",
+			want: &otlpmetrics.Metric{
+				Name: "queue.size",
+				Data: &otlpmetrics.Metric_Gauge{Gauge: &otlpmetrics.Gauge{
+					DataPoints: []*otlpmetrics.NumberDataPoint{{
+						StartTimeUnixNano: start, TimeUnixNano: end,
+						Value: &otlpmetrics.NumberDataPoint_AsDouble{AsDouble: 2},
+					}},
+				}},
+			},
+		},
+		{
+			name: "queue.changes",
+			want: &otlpmetrics.Metric{
+				Name: "queue.changes",
+				Data: &otlpmetrics.Metric_Sum{Sum: &otlpmetrics.Sum{
+					AggregationTemporality: cumulative,
+					DataPoints: []*otlpmetrics.NumberDataPoint{{
+						StartTimeUnixNano: start, TimeUnixNano: end,
+						Value: &otlpmetrics.NumberDataPoint_AsInt{AsInt: -3},
+					}},
+				}},
+			},
+		},
+		{
+			name: "request.duration",
+			want: &otlpmetrics.Metric{
+				Name: "request.duration", Unit: "ms",
+				Data: &otlpmetrics.Metric_Histogram{Histogram: &otlpmetrics.Histogram{
+					AggregationTemporality: cumulative,
+					DataPoints: []*otlpmetrics.HistogramDataPoint{{
+						StartTimeUnixNano: start, TimeUnixNano: end,
+						Count: 3, Sum: &sum, Min: &min, Max: &max,
+						ExplicitBounds: []float64{0, 5, 10},
+						BucketCounts:   []uint64{0, 2, 1, 0},
+					}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, r := findConsoleMetric(c, tt.name)
+			if m == nil {
+				t.Fatalf("Metric %s not parsed", tt.name)
+			}
+			assertProtoEqual(t, tt.want, m)
+			// the resource is not printed
+			assertProtoEqual(t, &otlpresource.Resource{}, r)
+		})
+	}
+}
+
+func TestConsoleJsLogs(t *testing.T) {
+	c := parseConsoleTestdata(t, "javascript")
+	logs, resources := consoleLogs(c)
+	if len(logs) != 1 {
+		t.Fatalf("Expected 1 log record, got %d", len(logs))
+	}
+	want := &otlplogs.LogRecord{
+		TimeUnixNano:   1714644062114400000,
+		SeverityNumber: otlplogs.SeverityNumber_SEVERITY_NUMBER_WARN,
+		SeverityText:   "warn",
+		Body:           stringValue("Rolled a 4"),
+		Attributes: []*otlpcommon.KeyValue{
+			IntAttribute("code.lineno", 12),
+			// the nested array is printed as [Array]
+			{Key: "user", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_KvlistValue{KvlistValue: &otlpcommon.KeyValueList{
+				Values: []*otlpcommon.KeyValue{StringAttribute("name", "alice"), {Key: "roles", Value: &otlpcommon.AnyValue{}}},
+			}}}},
+		},
+		TraceId: mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+		SpanId:  mustHexId(t, "051581bf3cb55c13"),
+	}
+	assertProtoEqual(t, want, logs[0])
+	if sn := getServiceName(resources[0]); sn != "js.console.logs" {
+		t.Errorf("Unexpected service.name %q", sn)
+	}
+}
+
+func TestJsObjectToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{"unquoted keys", `{ name: 'roll', kind: 0 }`, `{ "name": "roll", "kind": 0 }`, false},
+		{"quoted keys", `{ 'service.name': 'a' }`, `{ "service.name": "a" }`, false},
+		{"double quoted string", `{ a: "it's" }`, `{ "a": "it's" }`, false},
+		{"escapes", `{ a: 'it\'s\né' }`, `{ "a": "it's\né" }`, false},
+		{"undefined", `{ a: undefined, b: null }`, `{ "a": null, "b": null }`, false},
+		{"bigint", `{ a: 2n, b: -3n }`, `{ "a": 2, "b": -3 }`, false},
+		{"placeholders", `{ a: [Object], b: [Array], c: [Function: f] }`, `{ "a": null, "b": null, "c": null }`, false},
+		{"class names", `{ a: Map(1) { b: 1 }, c: Resource { d: true } }`, `{ "a": { "b": 1 }, "c": { "d": true } }`, false},
+		{"more items", "{ a: [ 1, 2,\n ... 98 more items\n] }", `{ "a": [ 1, 2 ] }`, false},
+		{"circular", `<ref *1> { a: [Circular *1] }`, `{ "a": null }`, false},
+		{"unterminated string", `{ a: 'b }`, "", true},
+		{"unknown word", `{ a: Symbol }`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jsObjectToJSON(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			// the whitespaces are kept as printed, the values are compared
+			var want, value any
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(got, &value); err != nil {
+				t.Fatalf("Invalid JSON %s: %v", got, err)
+			}
+			if !reflect.DeepEqual(want, value) {
+				t.Errorf("Unexpected JSON\nwant: %s\ngot:  %s", tt.want, got)
+			}
+		})
+	}
+}
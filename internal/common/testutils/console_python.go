@@ -0,0 +1,236 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// The severity number printed as the repr of the enum by the older SDKs, e.g. <SeverityNumber.INFO: 9>
+var pythonSeverityRepr = regexp.MustCompile(`^<SeverityNumber\.\w+: (\d+)>$`)
+
+// Adds the telemetry printed by the to_json of the Python ReadableSpan, LogRecord and MetricsData
+func (c *ConsoleTelemetry) addPython(obj map[string]any) error {
+	switch {
+	case obj["context"] != nil:
+		return c.addPythonSpan(obj)
+	case obj["resource_metrics"] != nil:
+		c.addPythonMetrics(obj)
+		return nil
+	default:
+		return c.addPythonLog(obj)
+	}
+}
+
+func (c *ConsoleTelemetry) addPythonSpan(obj map[string]any) error {
+	span := &otlptrace.Span{
+		Name:              jsonString(obj, "name"),
+		Kind:              consoleSpanKind(strings.TrimPrefix(jsonString(obj, "kind"), "SpanKind.")),
+		StartTimeUnixNano: pythonTimestamp(jsonString(obj, "start_time")),
+		EndTimeUnixNano:   pythonTimestamp(jsonString(obj, "end_time")),
+		Attributes:        jsonAttributes(jsonObject(obj, "attributes")),
+	}
+	if status := jsonObject(obj, "status"); status != nil {
+		span.Status = consoleStatus(jsonString(status, "status_code"), jsonString(status, "description"))
+	}
+	var err error
+	if span.TraceId, span.SpanId, err = pythonSpanIds(jsonObject(obj, "context")); err != nil {
+		return err
+	}
+	if span.ParentSpanId, err = parseConsoleId(jsonString(obj, "parent_id"), 8); err != nil {
+		return err
+	}
+	for _, e := range jsonArray(obj, "events") {
+		e, _ := e.(map[string]any)
+		span.Events = append(span.Events, &otlptrace.Span_Event{
+			Name:         jsonString(e, "name"),
+			TimeUnixNano: pythonTimestamp(jsonString(e, "timestamp")),
+			Attributes:   jsonAttributes(jsonObject(e, "attributes")),
+		})
+	}
+	for _, l := range jsonArray(obj, "links") {
+		l, _ := l.(map[string]any)
+		link := &otlptrace.Span_Link{Attributes: jsonAttributes(jsonObject(l, "attributes"))}
+		if link.TraceId, link.SpanId, err = pythonSpanIds(jsonObject(l, "context")); err != nil {
+			return err
+		}
+		span.Links = append(span.Links, link)
+	}
+	c.addSpan(pythonResource(obj["resource"]), nil, span)
+	return nil
+}
+
+func (c *ConsoleTelemetry) addPythonLog(obj map[string]any) error {
+	record := &otlplogs.LogRecord{
+		TimeUnixNano:           pythonTimestamp(jsonString(obj, "timestamp")),
+		ObservedTimeUnixNano:   pythonTimestamp(jsonString(obj, "observed_timestamp")),
+		SeverityText:           jsonString(obj, "severity_text"),
+		Attributes:             jsonAttributes(jsonObject(obj, "attributes")),
+		DroppedAttributesCount: uint32(jsonInt(obj, "dropped_attributes")),
+	}
+	switch sn := obj["severity_number"].(type) {
+	case json.Number:
+		i, _ := sn.Int64()
+		record.SeverityNumber = otlplogs.SeverityNumber(i)
+	case string:
+		if m := pythonSeverityRepr.FindStringSubmatch(sn); m != nil {
+			i, _ := strconv.Atoi(m[1])
+			record.SeverityNumber = otlplogs.SeverityNumber(i)
+		}
+	}
+	if body, found := obj["body"]; found && body != nil {
+		record.Body = jsonAnyValue(body)
+	}
+	var err error
+	if record.TraceId, err = parseConsoleId(jsonString(obj, "trace_id"), 16); err != nil {
+		return err
+	}
+	if record.SpanId, err = parseConsoleId(jsonString(obj, "span_id"), 8); err != nil {
+		return err
+	}
+	c.addLog(pythonResource(obj["resource"]), nil, record)
+	return nil
+}
+
+func (c *ConsoleTelemetry) addPythonMetrics(obj map[string]any) {
+	for _, rm := range jsonArray(obj, "resource_metrics") {
+		rm, _ := rm.(map[string]any)
+		r := pythonResource(rm["resource"])
+		for _, sm := range jsonArray(rm, "scope_metrics") {
+			sm, _ := sm.(map[string]any)
+			var metrics []*otlpmetrics.Metric
+			for _, m := range jsonArray(sm, "metrics") {
+				m, _ := m.(map[string]any)
+				if metric := pythonMetric(m); metric != nil {
+					metrics = append(metrics, metric)
+				}
+			}
+			c.addMetrics(r, pythonScope(jsonObject(sm, "scope")), metrics...)
+		}
+	}
+}
+
+// The type of the metric is not printed, it is told by the fields of its data
+func pythonMetric(m map[string]any) *otlpmetrics.Metric {
+	metric := &otlpmetrics.Metric{Name: jsonString(m, "name"), Description: jsonString(m, "description"), Unit: jsonString(m, "unit")}
+	data := jsonObject(m, "data")
+	dps := jsonArray(data, "data_points")
+	temporality := otlpmetrics.AggregationTemporality(jsonInt(data, "aggregation_temporality"))
+	var first map[string]any
+	if len(dps) > 0 {
+		first, _ = dps[0].(map[string]any)
+	}
+	switch {
+	case first["scale"] != nil:
+		// the exponential histograms are not supported
+		return nil
+	case first["explicit_bounds"] != nil:
+		h := &otlpmetrics.Histogram{AggregationTemporality: temporality}
+		for _, dp := range dps {
+			dp, _ := dp.(map[string]any)
+			h.DataPoints = append(h.DataPoints, pythonHistogramDataPoint(dp))
+		}
+		metric.Data = &otlpmetrics.Metric_Histogram{Histogram: h}
+	case data["is_monotonic"] != nil:
+		metric.Data = &otlpmetrics.Metric_Sum{Sum: &otlpmetrics.Sum{
+			AggregationTemporality: temporality,
+			IsMonotonic:            jsonBool(data, "is_monotonic"),
+			DataPoints:             pythonNumberDataPoints(dps),
+		}}
+	default:
+		metric.Data = &otlpmetrics.Metric_Gauge{Gauge: &otlpmetrics.Gauge{DataPoints: pythonNumberDataPoints(dps)}}
+	}
+	return metric
+}
+
+func pythonNumberDataPoints(dps []any) []*otlpmetrics.NumberDataPoint {
+	var res []*otlpmetrics.NumberDataPoint
+	for _, dp := range dps {
+		dp, _ := dp.(map[string]any)
+		ndp := &otlpmetrics.NumberDataPoint{
+			Attributes:        jsonAttributes(jsonObject(dp, "attributes")),
+			StartTimeUnixNano: uint64(jsonInt(dp, "start_time_unix_nano")),
+			TimeUnixNano:      uint64(jsonInt(dp, "time_unix_nano")),
+		}
+		// the doubles are printed with a decimal point, e.g. 1.0
+		v, _ := dp["value"].(json.Number)
+		if i, err := v.Int64(); err == nil {
+			ndp.Value = &otlpmetrics.NumberDataPoint_AsInt{AsInt: i}
+		} else {
+			f, _ := v.Float64()
+			ndp.Value = &otlpmetrics.NumberDataPoint_AsDouble{AsDouble: f}
+		}
+		res = append(res, ndp)
+	}
+	return res
+}
+
+func pythonHistogramDataPoint(dp map[string]any) *otlpmetrics.HistogramDataPoint {
+	sum := jsonFloat(dp, "sum")
+	hdp := &otlpmetrics.HistogramDataPoint{
+		Attributes:        jsonAttributes(jsonObject(dp, "attributes")),
+		StartTimeUnixNano: uint64(jsonInt(dp, "start_time_unix_nano")),
+		TimeUnixNano:      uint64(jsonInt(dp, "time_unix_nano")),
+		Count:             uint64(jsonInt(dp, "count")),
+		Sum:               &sum,
+	}
+	for _, b := range jsonArray(dp, "explicit_bounds") {
+		f, _ := b.(json.Number).Float64()
+		hdp.ExplicitBounds = append(hdp.ExplicitBounds, f)
+	}
+	for _, c := range jsonArray(dp, "bucket_counts") {
+		i, _ := c.(json.Number).Int64()
+		hdp.BucketCounts = append(hdp.BucketCounts, uint64(i))
+	}
+	if _, found := dp["min"].(json.Number); found {
+		v := jsonFloat(dp, "min")
+		hdp.Min = &v
+	}
+	if _, found := dp["max"].(json.Number); found {
+		v := jsonFloat(dp, "max")
+		hdp.Max = &v
+	}
+	return hdp
+}
+
+func pythonSpanIds(ctx map[string]any) ([]byte, []byte, error) {
+	traceId, err := parseConsoleId(jsonString(ctx, "trace_id"), 16)
+	if err != nil {
+		return nil, nil, err
+	}
+	spanId, err := parseConsoleId(jsonString(ctx, "span_id"), 8)
+	return traceId, spanId, err
+}
+
+// The times are printed in ISO 8601, e.g. 2024-05-02T10:01:02.123456Z
+func pythonTimestamp(s string) uint64 {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// The resource of the log records is printed as a JSON string by some versions of the SDK
+func pythonResource(v any) *otlpresource.Resource {
+	r, _ := v.(map[string]any)
+	if s, ok := v.(string); ok {
+		_ = decodeJSON([]byte(s), &r)
+	}
+	return &otlpresource.Resource{Attributes: jsonAttributes(jsonObject(r, "attributes"))}
+}
+
+func pythonScope(s map[string]any) *otlpcommon.InstrumentationScope {
+	if s == nil {
+		return nil
+	}
+	return &otlpcommon.InstrumentationScope{Name: jsonString(s, "name"), Version: jsonString(s, "version")}
+}
@@ -0,0 +1,206 @@
+package testutils
+
+import (
+	"testing"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func TestConsolePythonSpans(t *testing.T) {
+	c := parseConsoleTestdata(t, "python")
+	resource := &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{
+		StringAttribute("service.name", "python.console.traces"),
+		StringAttribute("telemetry.sdk.language", "python"),
+	}}
+	tests := []struct {
+		name string
+		want *otlptrace.Span
+	}{
+		{
+			// the span id printed without its leading zero
+			name: "roll",
+			want: &otlptrace.Span{
+				Name:              "roll",
+				TraceId:           mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+				SpanId:            mustHexId(t, "051581bf3cb55c13"),
+				ParentSpanId:      mustHexId(t, "5fb397be34d26b51"),
+				Kind:              otlptrace.Span_SPAN_KIND_INTERNAL,
+				StartTimeUnixNano: mustTimestamp(t, "2024-05-02T10:01:02.114304Z"),
+				EndTimeUnixNano:   mustTimestamp(t, "2024-05-02T10:01:02.114561Z"),
+				Attributes: []*otlpcommon.KeyValue{
+					BoolAttribute("roll.fair", true),
+					{Key: "roll.tags", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: &otlpcommon.ArrayValue{
+						Values: []*otlpcommon.AnyValue{stringValue("six"), stringValue("sided")},
+					}}}},
+					IntAttribute("roll.value", 4),
+					{Key: "roll.weight", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: 0.5}}},
+				},
+				Events: []*otlptrace.Span_Event{{
+					Name:         "rolled",
+					TimeUnixNano: mustTimestamp(t, "2024-05-02T10:01:02.1145Z"),
+					Attributes:   []*otlpcommon.KeyValue{IntAttribute("attempt", 1)},
+				}},
+				Links: []*otlptrace.Span_Link{{
+					TraceId:    mustHexId(t, "829fb7ceb787403c96eac634767ef10a"),
+					SpanId:     mustHexId(t, "efe159833c5bf9d1"),
+					Attributes: []*otlpcommon.KeyValue{StringAttribute("reason", "retry")},
+				}},
+				Status: &otlptrace.Status{},
+			},
+		},
+		{
+			// the root span, with a null parent_id
+			name: "GET /roll",
+			want: &otlptrace.Span{
+				Name:              "GET /roll",
+				TraceId:           mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+				SpanId:            mustHexId(t, "5fb397be34d26b51"),
+				Kind:              otlptrace.Span_SPAN_KIND_SERVER,
+				StartTimeUnixNano: mustTimestamp(t, "2024-05-02T10:01:02.1Z"),
+				EndTimeUnixNano:   mustTimestamp(t, "2024-05-02T10:01:02.2Z"),
+				Status:            &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR, Message: "ValueError: 7 is not a dice value"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span, r, _ := findConsoleSpan(c, tt.name)
+			if span == nil {
+				t.Fatalf("Span %s not parsed", tt.name)
+			}
+			assertProtoEqual(t, tt.want, span)
+			assertProtoEqual(t, resource, r)
+		})
+	}
+}
+
+func TestConsolePythonMetrics(t *testing.T) {
+	c := parseConsoleTestdata(t, "python")
+	start, end := uint64(1714644062100000000), uint64(1714644063200000000)
+	sum, min, max := 12.5, 1.5, 7.5
+	tests := []struct {
+		name string
+		want *otlpmetrics.Metric
+	}{
+		{
+			name: "dice.rolls",
+			want: &otlpmetrics.Metric{
+				Name: "dice.rolls", Description: "The number of rolls by roll value", Unit: "{roll}",
+				Data: &otlpmetrics.Metric_Sum{Sum: &otlpmetrics.Sum{
+					AggregationTemporality: otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+					DataPoints: []*otlpmetrics.NumberDataPoint{{
+						Attributes:        []*otlpcommon.KeyValue{IntAttribute("roll.value", 4)},
+						StartTimeUnixNano: start, TimeUnixNano: end,
+						Value: &otlpmetrics.NumberDataPoint_AsInt{AsInt: 2},
+					}},
+				}},
+			},
+		},
+		{
+			// the double printed with a decimal point
+			name: "queue.size",
+			want: &otlpmetrics.Metric{
+				Name: "queue.size",
+				Data: &otlpmetrics.Metric_Gauge{Gauge: &otlpmetrics.Gauge{
+					DataPoints: []*otlpmetrics.NumberDataPoint{{
+						TimeUnixNano: end,
+						Value:        &otlpmetrics.NumberDataPoint_AsDouble{AsDouble: 2},
+					}},
+				}},
+			},
+		},
+		{
+			name: "request.duration",
+			want: &otlpmetrics.Metric{
+				Name: "request.duration", Unit: "ms",
+				Data: &otlpmetrics.Metric_Histogram{Histogram: &otlpmetrics.Histogram{
+					AggregationTemporality: otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+					DataPoints: []*otlpmetrics.HistogramDataPoint{{
+						StartTimeUnixNano: start, TimeUnixNano: end,
+						Count: 3, Sum: &sum, Min: &min, Max: &max,
+						ExplicitBounds: []float64{0, 5, 10},
+						BucketCounts:   []uint64{0, 2, 1, 0},
+					}},
+				}},
+			},
+		},
+		{
+			// the exponential histograms are skipped
+			name: "request.size",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, r := findConsoleMetric(c, tt.name)
+			if tt.want == nil {
+				if m != nil {
+					t.Fatalf("Unexpected metric %s", tt.name)
+				}
+				return
+			}
+			if m == nil {
+				t.Fatalf("Metric %s not parsed", tt.name)
+			}
+			assertProtoEqual(t, tt.want, m)
+			if sn := getServiceName(r); sn != "python.console.metrics" {
+				t.Errorf("Unexpected service.name %q", sn)
+			}
+		})
+	}
+	scope := c.Metrics.GetResourceMetrics()[0].GetScopeMetrics()[0].GetScope()
+	assertProtoEqual(t, &otlpcommon.InstrumentationScope{Name: "otel-recipes.dice", Version: "1.0.0"}, scope)
+}
+
+func TestConsolePythonLogs(t *testing.T) {
+	c := parseConsoleTestdata(t, "python")
+	logs, resources := consoleLogs(c)
+	tests := []struct {
+		name string
+		want *otlplogs.LogRecord
+	}{
+		{
+			// the severity number printed as the repr of the enum, the resource as a JSON string
+			name: "older SDK",
+			want: &otlplogs.LogRecord{
+				TimeUnixNano:           mustTimestamp(t, "2024-05-02T10:01:02.1144Z"),
+				ObservedTimeUnixNano:   mustTimestamp(t, "2024-05-02T10:01:02.11445Z"),
+				SeverityNumber:         otlplogs.SeverityNumber_SEVERITY_NUMBER_WARN,
+				SeverityText:           "WARNING",
+				Body:                   stringValue("Rolled a 4"),
+				Attributes:             []*otlpcommon.KeyValue{IntAttribute("code.lineno", 12)},
+				DroppedAttributesCount: 1,
+				TraceId:                mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+				SpanId:                 mustHexId(t, "051581bf3cb55c13"),
+			},
+		},
+		{
+			// outside of a span, with a map body
+			name: "newer SDK",
+			want: &otlplogs.LogRecord{
+				TimeUnixNano:         mustTimestamp(t, "2024-05-02T10:01:03Z"),
+				ObservedTimeUnixNano: mustTimestamp(t, "2024-05-02T10:01:03.000001Z"),
+				SeverityNumber:       otlplogs.SeverityNumber_SEVERITY_NUMBER_INFO,
+				SeverityText:         "INFO",
+				Body: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_KvlistValue{KvlistValue: &otlpcommon.KeyValueList{
+					Values: []*otlpcommon.KeyValue{StringAttribute("user", "alice")},
+				}}},
+			},
+		},
+	}
+	if len(logs) != len(tests) {
+		t.Fatalf("Expected %d log records, got %d", len(tests), len(logs))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertProtoEqual(t, tt.want, logs[i])
+			if sn := getServiceName(resources[i]); sn != "python.console.logs" {
+				t.Errorf("Unexpected service.name %q", sn)
+			}
+		})
+	}
+}
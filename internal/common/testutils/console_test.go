@@ -0,0 +1,220 @@
+package testutils
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Parses the console output of testdata/console/<name>.txt
+func parseConsoleTestdata(t *testing.T, name string) *ConsoleTelemetry {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "console", name+".txt"))
+	if err != nil {
+		t.Fatalf("Failed reading the console output: %v", err)
+	}
+	c, err := ParseConsoleOutput(string(data))
+	if err != nil {
+		t.Fatalf("Failed parsing the console output: %v", err)
+	}
+	return c
+}
+
+func assertProtoEqual(t *testing.T, want, got proto.Message) {
+	t.Helper()
+	if !proto.Equal(want, got) {
+		t.Errorf("Unexpected telemetry\nwant: %s\ngot:  %s", protojson.Format(want), protojson.Format(got))
+	}
+}
+
+func mustTimestamp(t *testing.T, s string) uint64 {
+	t.Helper()
+	ts, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uint64(ts.UnixNano())
+}
+
+func mustHexId(t *testing.T, s string) []byte {
+	t.Helper()
+	id, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func stringValue(s string) *otlpcommon.AnyValue {
+	return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: s}}
+}
+
+// The printed span of the name, with its resource and scope
+func findConsoleSpan(c *ConsoleTelemetry, name string) (*otlptrace.Span, *otlpresource.Resource, *otlpcommon.InstrumentationScope) {
+	for _, rs := range c.Traces.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			for _, s := range ss.GetSpans() {
+				if s.GetName() == name {
+					return s, rs.GetResource(), ss.GetScope()
+				}
+			}
+		}
+	}
+	return nil, nil, nil
+}
+
+func findConsoleMetric(c *ConsoleTelemetry, name string) (*otlpmetrics.Metric, *otlpresource.Resource) {
+	for _, rm := range c.Metrics.GetResourceMetrics() {
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				if m.GetName() == name {
+					return m, rm.GetResource()
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// The printed log records, in the order of the output
+func consoleLogs(c *ConsoleTelemetry) ([]*otlplogs.LogRecord, []*otlpresource.Resource) {
+	var logs []*otlplogs.LogRecord
+	var resources []*otlpresource.Resource
+	for _, rl := range c.Logs.GetResourceLogs() {
+		for _, sl := range rl.GetScopeLogs() {
+			for _, l := range sl.GetLogRecords() {
+				logs = append(logs, l)
+				resources = append(resources, rl.GetResource())
+			}
+		}
+	}
+	return logs, resources
+}
+
+func TestParseConsoleOutputSkipsOtherLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"empty", ""},
+		{"plain lines", "Starting the sample\nListening on :8080\n"},
+		{"unbalanced object", "{\n\t\"Name\": \"HelloWorldSpan\",\n"},
+		{"other JSON", `{"level":"info","msg":"started"}`},
+		{"array", "[1, 2, 3]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConsoleOutput(tt.output)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if n := len(c.Traces.GetResourceSpans()) + len(c.Metrics.GetResourceMetrics()) + len(c.Logs.GetResourceLogs()); n != 0 {
+				t.Errorf("Expected no telemetry, got %d resources", n)
+			}
+		})
+	}
+}
+
+func TestParseConsoleId(t *testing.T) {
+	tests := []struct {
+		id      string
+		size    int
+		want    string
+		wantErr bool
+	}{
+		{"5b8aa5a2d2c872e8321cf37308d69df2", 16, "5b8aa5a2d2c872e8321cf37308d69df2", false},
+		{"0x5b8aa5a2d2c872e8321cf37308d69df2", 16, "5b8aa5a2d2c872e8321cf37308d69df2", false},
+		// Python prints the ids as ints, without the leading zeros
+		{"0x51581bf3cb55c13", 8, "051581bf3cb55c13", false},
+		{"0x0000000000000000", 8, "", false},
+		{"", 16, "", false},
+		{"not-an-id", 8, "", true},
+		{"5b8aa5a2d2c872e8321cf37308d69df2", 8, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			got, err := parseConsoleId(tt.id, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("Expected id %q, got %x", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConsoleBackendAddsServiceName(t *testing.T) {
+	// e.g. the JavaScript metrics exporter doesn't print the resource
+	out := "Activity.TraceId:            d8cd3b6a5bbd1d0e0b1d3c33c8a8bd5f\n" +
+		"Activity.SpanId:             2b4a9a3b5dd3c1f8\n" +
+		"Activity.DisplayName:        SayHello\n"
+	b := NewConsoleBackend(func() (string, error) { return out, nil })
+	rs, err := b.GetTraces("dotnet.console.traces", TraceQueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs == nil {
+		t.Fatal("Expected the spans without a service.name to be returned for the service")
+	}
+	if sn := getServiceName(rs.GetResource()); sn != "dotnet.console.traces" {
+		t.Errorf("Expected the service.name to be set, got %q", sn)
+	}
+}
+
+func TestParseConsoleOutputOtlpJson(t *testing.T) {
+	// logged by the Java logging-otlp exporters, one message per line
+	output := `May 02, 2024 10:01:02 AM io.opentelemetry.exporter.logging.otlp.OtlpJsonLoggingSpanExporter export
+INFO: {"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"java.console.traces"}}]},"scopeSpans":[{"scope":{"name":"otel-recipes"},"spans":[{"traceId":"5b8aa5a2d2c872e8321cf37308d69df2","spanId":"051581bf3cb55c13","parentSpanId":"5fb397be34d26b51","name":"roll","kind":1,"startTimeUnixNano":"1714644062114304000","endTimeUnixNano":"1714644062114561000","links":[{"traceId":"829fb7ceb787403c96eac634767ef10a","spanId":"efe159833c5bf9d1"}],"status":{}}]}]}]}
+May 02, 2024 10:01:02 AM io.opentelemetry.exporter.logging.otlp.OtlpJsonLoggingLogRecordExporter export
+INFO: {"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"java.console.logs"}}]},"scopeLogs":[{"scope":{"name":"otel-recipes"},"logRecords":[{"timeUnixNano":"1714644062114400000","severityNumber":13,"body":{"stringValue":"Rolled a 4"},"traceId":"5b8aa5a2d2c872e8321cf37308d69df2","spanId":"051581bf3cb55c13"}]}]}]}
+`
+	c, err := ParseConsoleOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	span, r, scope := findConsoleSpan(c, "roll")
+	if span == nil {
+		t.Fatal("Span roll not parsed")
+	}
+	assertProtoEqual(t, &otlptrace.Span{
+		Name:              "roll",
+		TraceId:           mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+		SpanId:            mustHexId(t, "051581bf3cb55c13"),
+		ParentSpanId:      mustHexId(t, "5fb397be34d26b51"),
+		Kind:              otlptrace.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: 1714644062114304000,
+		EndTimeUnixNano:   1714644062114561000,
+		Links: []*otlptrace.Span_Link{{
+			TraceId: mustHexId(t, "829fb7ceb787403c96eac634767ef10a"),
+			SpanId:  mustHexId(t, "efe159833c5bf9d1"),
+		}},
+		Status: &otlptrace.Status{},
+	}, span)
+	assertProtoEqual(t, &otlpcommon.InstrumentationScope{Name: "otel-recipes"}, scope)
+	if sn := getServiceName(r); sn != "java.console.traces" {
+		t.Errorf("Unexpected service.name %q", sn)
+	}
+
+	logs, _ := consoleLogs(c)
+	if len(logs) != 1 {
+		t.Fatalf("Expected 1 log record, got %d", len(logs))
+	}
+	assertProtoEqual(t, &otlplogs.LogRecord{
+		TimeUnixNano:   1714644062114400000,
+		SeverityNumber: otlplogs.SeverityNumber_SEVERITY_NUMBER_WARN,
+		Body:           stringValue("Rolled a 4"),
+		TraceId:        mustHexId(t, "5b8aa5a2d2c872e8321cf37308d69df2"),
+		SpanId:         mustHexId(t, "051581bf3cb55c13"),
+	}, logs[0])
+}
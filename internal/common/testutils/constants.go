@@ -3,6 +3,27 @@ package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common
 // Address of the OTLP back-end running inside compose
 const OtlpBackendUri string = "http://localhost:4319"
 
+// Address of the collector Prometheus exporter running inside compose
+const PrometheusExporterUri string = "http://localhost:8889/metrics"
+
+// Address of the Prometheus HTTP API running inside compose
+const PrometheusUri string = "http://localhost:9090"
+
+// Address of the Grafana Tempo HTTP API running inside compose
+const TempoUri string = "http://localhost:3200"
+
+// Address of the Zipkin HTTP API running inside compose
+const ZipkinUri string = "http://localhost:9411"
+
+// Address of the Jaeger query HTTP API running inside compose
+const JaegerUri string = "http://localhost:16686"
+
+// Address of the Jaeger query gRPC API running inside compose
+const JaegerGrpcUri string = "localhost:16685"
+
+// Address of the OTLP/HTTP receiver of the collector running inside compose
+const CollectorUri string = "http://localhost:4318"
+
 // Constants for signals
 const TraceSignal string = "trace"
 const MetricsSignal string = "metrics"
@@ -0,0 +1,123 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// A call between two services aggregated by Jaeger, with the number of spans of the child service whose
+// parent is a span of the parent service
+type JaegerDependency struct {
+	Parent    string `json:"parent"`
+	Child     string `json:"child"`
+	CallCount uint64 `json:"callCount"`
+}
+
+type jaegerDependenciesResponse struct {
+	Data []JaegerDependency `json:"data"`
+}
+
+// Fetches the dependencies recorded in the window via the /api/dependencies endpoint of jaeger-query.
+// The in-memory and Badger storages compute them on the fly, others need the spark-dependencies job
+func (b *JaegerBackend) GetDependencies(start, end time.Time) ([]JaegerDependency, error) {
+	q := url.Values{}
+	q.Set("endTs", fmt.Sprint(end.UnixMilli()))
+	q.Set("lookback", fmt.Sprint(end.Sub(start).Milliseconds()))
+
+	body, err := httpGet(fmt.Sprintf("%s/api/dependencies?%s", b.uri, q.Encode()), "application/json")
+	if err != nil {
+		var se *httpStatusError
+		if errors.As(err, &se) && se.statusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed calling Jaeger: %w", err)
+	}
+
+	var res jaegerDependenciesResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("error reading payload from Jaeger: %w", err)
+	}
+	return res.Data, nil
+}
+
+// The calls between services Jaeger must have recorded, e.g. for recipes of several services. Complements
+// AssertServiceGraph, which asserts a single trace, with the calls of all the traces of the window
+type DependenciesTestCase struct {
+	dependencies []JaegerDependency
+}
+
+func NewDependenciesTestCase() *DependenciesTestCase {
+	return &DependenciesTestCase{}
+}
+
+// Expects parent to have called child at least minCalls times
+func (tc *DependenciesTestCase) WithDependency(parent, child string, minCalls uint64) *DependenciesTestCase {
+	tc.dependencies = append(tc.dependencies, JaegerDependency{Parent: parent, Child: child, CallCount: minCalls})
+	return tc
+}
+
+// Asserts the dependencies of Jaeger at -jaeger-url have each expected call, with at least the expected count.
+// The dependencies are queried in the window of the trace queries, see TraceQueryOptions
+func AssertDependencies(t TestingT, tc *DependenciesTestCase) {
+	if len(tc.dependencies) == 0 {
+		t.Fatal("No dependencies expected")
+	}
+	b := NewJaegerBackend(getConfig(t).JaegerUrl)
+
+	d := &diff{}
+	found := Eventually(t, "Jaeger dependencies", func() bool {
+		start, end := traceQuery(t, TraceQueryOptions{}).window(time.Now())
+		Logger(t).Debug("Going to call Jaeger to fetch the dependencies", "backend", "jaeger")
+		deps, err := b.GetDependencies(start, end)
+		if err != nil {
+			checkBackendError(t, "jaeger", err)
+			return false
+		}
+		d = dependenciesDiff(tc.dependencies, deps)
+		return d.empty()
+	})
+	if !found {
+		t.Fatalf("Could not find the expected dependencies in Jaeger:\n%s", d)
+	}
+}
+
+func dependenciesDiff(expected, actual []JaegerDependency) *diff {
+	counts := make(map[[2]string]uint64)
+	for _, dep := range actual {
+		counts[[2]string{dep.Parent, dep.Child}] += dep.CallCount
+	}
+
+	d := &diff{}
+	expectedCalls := make(map[[2]string]bool)
+	for _, exp := range expected {
+		key := [2]string{exp.Parent, exp.Child}
+		expectedCalls[key] = true
+		count, found := counts[key]
+		switch {
+		case !found:
+			d.missing("%s -> %s: at least %d calls", exp.Parent, exp.Child, exp.CallCount)
+		case count < exp.CallCount:
+			d.mismatch("%s -> %s: %d calls, expected at least %d", exp.Parent, exp.Child, count, exp.CallCount)
+		default:
+			d.same("%s -> %s: %d calls", exp.Parent, exp.Child, count)
+		}
+	}
+
+	// the other calls are listed for context only
+	var others []string
+	for key, count := range counts {
+		if !expectedCalls[key] {
+			others = append(others, fmt.Sprintf("%s -> %s: %d calls", key[0], key[1], count))
+		}
+	}
+	sort.Strings(others)
+	for _, o := range others {
+		d.same("%s", o)
+	}
+	return d
+}
@@ -0,0 +1,91 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"os"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// The resource detectors whose attributes can be asserted
+const (
+	HostDetector      string = "host"
+	ContainerDetector string = "container"
+	K8sDetector       string = "k8s"
+)
+
+// The attributes each detector is required to populate
+var detectorAttributes = map[string][]string{
+	HostDetector:      {"host.name"},
+	ContainerDetector: {"container.id"},
+	K8sDetector:       {"k8s.namespace.name", "k8s.pod.name", "k8s.node.name"},
+}
+
+// The values the resource detectors of the sample are expected to find, as seen by the harness in the
+// environment the sample runs in. Empty values are only checked to be populated
+type DetectedResource struct {
+	HostName     string
+	ContainerID  string
+	K8sNamespace string
+	K8sPodName   string
+	K8sNodeName  string
+}
+
+// Reads the expected values from the environment of the tests: SAMPLE_HOST_NAME, SAMPLE_CONTAINER_ID and the
+// K8S_NAMESPACE_NAME, K8S_POD_NAME and K8S_NODE_NAME of the downward API, e.g. when the tests run as a sidecar of
+// the sample. Without SAMPLE_HOST_NAME, the host name is derived from the container id (docker uses the short
+// id by default) or the pod name. SAMPLE_HOST_NAME=$(hostname) suits samples running on the host of the tests
+func DetectedResourceFromEnv() *DetectedResource {
+	d := &DetectedResource{
+		HostName:     os.Getenv("SAMPLE_HOST_NAME"),
+		ContainerID:  os.Getenv("SAMPLE_CONTAINER_ID"),
+		K8sNamespace: os.Getenv("K8S_NAMESPACE_NAME"),
+		K8sPodName:   os.Getenv("K8S_POD_NAME"),
+		K8sNodeName:  os.Getenv("K8S_NODE_NAME"),
+	}
+	if d.HostName == "" {
+		switch {
+		case len(d.ContainerID) >= 12:
+			d.HostName = d.ContainerID[:12]
+		case d.K8sPodName != "":
+			d.HostName = d.K8sPodName
+		}
+	}
+	return d
+}
+
+// Asserts the resource has the attributes of each detector populated and, when the expected
+// value is known, equal to it. container.id may also be expected as its short form
+func AssertDetectedResource(t TestingT, r *otlpresource.Resource, expected *DetectedResource, detectors ...string) {
+	if expected == nil {
+		expected = &DetectedResource{}
+	}
+	values := map[string]string{
+		"host.name":          expected.HostName,
+		"container.id":       expected.ContainerID,
+		"k8s.namespace.name": expected.K8sNamespace,
+		"k8s.pod.name":       expected.K8sPodName,
+		"k8s.node.name":      expected.K8sNodeName,
+	}
+
+	for _, d := range detectors {
+		keys, found := detectorAttributes[d]
+		if !found {
+			t.Fatalf("Unknown resource detector %q", d)
+		}
+		for _, key := range keys {
+			actual := getStringAttribute(r.GetAttributes(), key)
+			if !assert.NotEmpty(t, actual, "Missing %s resource attribute populated by the %s detector", key, d) {
+				continue
+			}
+			if exp := values[key]; exp != "" {
+				if key == "container.id" {
+					assert.True(t, strings.HasPrefix(actual, exp), "Unexpected container.id resource attribute: expected %s, actual %s", exp, actual)
+				} else {
+					assert.Equal(t, exp, actual, "Unexpected %s resource attribute", key)
+				}
+			}
+		}
+	}
+}
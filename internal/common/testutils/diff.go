@@ -0,0 +1,177 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// The differences between the expected and the actual telemetry, printed by the failing assertions.
+// Each line is marked as missing (-), unexpected (+), mismatching (~) or matching ( )
+type diff struct {
+	lines []string
+}
+
+func (d *diff) missing(format string, args ...any) {
+	d.lines = append(d.lines, "- "+fmt.Sprintf(format, args...))
+}
+
+func (d *diff) unexpected(format string, args ...any) {
+	d.lines = append(d.lines, "+ "+fmt.Sprintf(format, args...))
+}
+
+func (d *diff) mismatch(format string, args ...any) {
+	d.lines = append(d.lines, "~ "+fmt.Sprintf(format, args...))
+}
+
+func (d *diff) same(format string, args ...any) {
+	d.lines = append(d.lines, "  "+fmt.Sprintf(format, args...))
+}
+
+// Whether there is any difference, matching lines aside
+func (d *diff) empty() bool {
+	for _, l := range d.lines {
+		if !strings.HasPrefix(l, "  ") {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *diff) String() string {
+	return "(- missing, + unexpected, ~ mismatch)\n" + strings.Join(d.lines, "\n")
+}
+
+// Asserts all the expected attributes are found with their value and type. On failure it prints
+// a single diff of all the attributes of e.g. the span, instead of a failure per attribute
+func AssertAttributes(t TestingT, what string, attributes []*otlpcommon.KeyValue, expected ...*otlpcommon.KeyValue) bool {
+	d := attributesDiff(attributes, expected)
+	if d.empty() {
+		return true
+	}
+	return assert.Fail(t, "Unexpected attributes of "+what, "Attributes of %s:\n%s", what, d)
+}
+
+// Lists the expected attributes missing or with a different value, followed by the other actual attributes
+func attributesDiff(actual, expected []*otlpcommon.KeyValue) *diff {
+	d := &diff{}
+	keys := make(map[string]bool, len(expected))
+	for _, exp := range expected {
+		keys[exp.GetKey()] = true
+		a := findAttribute(actual, exp.GetKey())
+		switch {
+		case a == nil:
+			d.missing("%s: %s", exp.GetKey(), formatExpectedValue(exp.GetValue()))
+		case !matchAttributeValue(exp.GetValue(), a.GetValue()):
+			d.mismatch("%s: expected %s, actual %s %v", exp.GetKey(), formatExpectedValue(exp.GetValue()),
+				AttributeTypeOf(a.GetValue()), formatAnyValue(a.GetValue()))
+		default:
+			d.same("%s: %s %v", exp.GetKey(), AttributeTypeOf(a.GetValue()), formatAnyValue(a.GetValue()))
+		}
+	}
+
+	var others []string
+	for _, a := range actual {
+		if !keys[a.GetKey()] {
+			others = append(others, fmt.Sprintf("%s: %s %v", a.GetKey(), AttributeTypeOf(a.GetValue()), formatAnyValue(a.GetValue())))
+		}
+	}
+	sort.Strings(others)
+	for _, o := range others {
+		d.same("%s", o)
+	}
+	return d
+}
+
+// Compares the expected spans with the actual ones. Each expected span is matched to a different span,
+// preferring one with the expected attributes and kind. Spans found with others are listed with their diff
+func spansDiff(expected []*TraceTestCase, actual []*otlptrace.Span) *diff {
+	d := &diff{}
+	used := make(map[*otlptrace.Span]bool, len(actual))
+	for _, exp := range expected {
+		var match *otlptrace.Span
+		for _, s := range actual {
+			if used[s] || !matchSpanName(exp.spanName, s.GetName()) {
+				continue
+			}
+			if match == nil || exp.matches(s) && !exp.matches(match) {
+				match = s
+			}
+		}
+		if match == nil {
+			d.missing("span %s", exp.spanName)
+			continue
+		}
+		used[match] = true
+
+		ad := &diff{}
+		if exp.kind != otlptrace.Span_SPAN_KIND_UNSPECIFIED && match.GetKind() != exp.kind {
+			ad.mismatch("kind: expected %s, actual %s", formatSpanKind(exp.kind), formatSpanKind(match.GetKind()))
+		}
+		ad.lines = append(ad.lines, attributesDiff(match.GetAttributes(), exp.attributes).lines...)
+		if ad.empty() {
+			d.same("span %s", match.GetName())
+			continue
+		}
+		d.mismatch("span %s", match.GetName())
+		for _, l := range ad.lines {
+			d.lines = append(d.lines, "    "+l)
+		}
+	}
+	for _, s := range actual {
+		if !used[s] {
+			d.unexpected("span %s", s.GetName())
+		}
+	}
+	return d
+}
+
+// The trace most similar to the expected spans, i.e. with the fewest differences
+func closestTrace(expected []*TraceTestCase, traces [][]*otlptrace.Span) []*otlptrace.Span {
+	var res []*otlptrace.Span
+	best := -1
+	for _, trace := range traces {
+		differences := 0
+		for _, l := range spansDiff(expected, trace).lines {
+			if !strings.HasPrefix(l, "  ") {
+				differences++
+			}
+		}
+		if best < 0 || differences < best {
+			best, res = differences, trace
+		}
+	}
+	return res
+}
+
+func allSpans(rs *otlptrace.ResourceSpans) []*otlptrace.Span {
+	var res []*otlptrace.Span
+	for _, ss := range rs.GetScopeSpans() {
+		res = append(res, ss.GetSpans()...)
+	}
+	return res
+}
+
+// Lists the bodies of the logs found, marking the expected one as missing
+func logBodiesDiff(expected *otlpcommon.AnyValue, rl *otlplogs.ResourceLogs) *diff {
+	d := &diff{}
+	d.missing("log %v", formatAnyValue(expected))
+	for _, sl := range rl.GetScopeLogs() {
+		for _, l := range sl.GetLogRecords() {
+			// for structured bodies, the field that differs
+			if AttributeTypeOf(expected) == MapAttributeType {
+				if reason := logBodyMismatch(expected, l.GetBody(), ""); reason != "" {
+					d.unexpected("log %v: %s", formatAnyValue(l.GetBody()), reason)
+					continue
+				}
+			}
+			d.unexpected("log %v", formatAnyValue(l.GetBody()))
+		}
+	}
+	return d
+}
@@ -0,0 +1,27 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Returns the host the ports published by docker are reached at: the one of a remote daemon set via DOCKER_HOST,
+// e.g. tcp://192.168.64.2:2376 for a VM, else localhost. Docker Desktop on macOS and Windows, colima and WSL forward
+// the published ports to localhost, so they use local sockets and need nothing set
+func DockerHost() string {
+	u, err := url.Parse(os.Getenv("DOCKER_HOST"))
+	if err != nil || u.Scheme != "tcp" && u.Scheme != "ssh" || u.Hostname() == "" {
+		return "localhost"
+	}
+	return u.Hostname()
+}
+
+// Points a default address of the compose setup, e.g. http://localhost:4319, to the docker host
+func onDockerHost(addr string) string {
+	host := DockerHost()
+	if host == "localhost" {
+		return addr
+	}
+	return strings.Replace(addr, "localhost", host, 1)
+}
@@ -0,0 +1,72 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"flag"
+	"fmt"
+
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+var allowDropped = flag.Bool("allow-dropped", false, "Only log the attributes, events and links dropped by the SDK limits instead of failing the test")
+
+// Asserts the SDK dropped none of the attributes, events and links of the span, nor of its events and links, e.g.
+// as the sample exceeds the default limit of 128 attributes. Only the OTLP back-end and files keep the dropped
+// counts, the Jaeger and Zipkin ones always report 0
+func AssertSpanNotTruncated(t TestingT, span *otlptrace.Span) {
+	t.Helper()
+	what := "span " + span.GetName()
+	reportDropped(t, what, "attributes", span.GetDroppedAttributesCount())
+	reportDropped(t, what, "events", span.GetDroppedEventsCount())
+	reportDropped(t, what, "links", span.GetDroppedLinksCount())
+	for _, e := range span.GetEvents() {
+		reportDropped(t, fmt.Sprintf("event %s of %s", e.GetName(), what), "attributes", e.GetDroppedAttributesCount())
+	}
+	for _, l := range span.GetLinks() {
+		reportDropped(t, "link of "+what, "attributes", l.GetDroppedAttributesCount())
+	}
+}
+
+// Asserts the SDK dropped none of the attributes of the log record, see AssertSpanNotTruncated
+func AssertLogNotTruncated(t TestingT, l *otlplogs.LogRecord) {
+	t.Helper()
+	reportDropped(t, fmt.Sprintf("log %q", l.GetBody().GetStringValue()), "attributes", l.GetDroppedAttributesCount())
+}
+
+// Asserts the SDK dropped none of the resource attributes, see AssertSpanNotTruncated
+func AssertResourceNotTruncated(t TestingT, r *otlpresource.Resource) {
+	t.Helper()
+	reportDropped(t, "resource", "attributes", r.GetDroppedAttributesCount())
+}
+
+// Asserts the SDK dropped nothing of the spans of the trace nor of their resource, see AssertSpanNotTruncated
+func AssertTraceNotTruncated(t TestingT, rs *otlptrace.ResourceSpans) {
+	t.Helper()
+	AssertResourceNotTruncated(t, rs.GetResource())
+	for _, s := range allSpans(rs) {
+		AssertSpanNotTruncated(t, s)
+	}
+}
+
+// Asserts the SDK dropped nothing of the log records nor of their resource, see AssertSpanNotTruncated
+func AssertLogsNotTruncated(t TestingT, rl *otlplogs.ResourceLogs) {
+	t.Helper()
+	AssertResourceNotTruncated(t, rl.GetResource())
+	for _, sl := range rl.GetScopeLogs() {
+		for _, l := range sl.GetLogRecords() {
+			AssertLogNotTruncated(t, l)
+		}
+	}
+}
+
+func reportDropped(t TestingT, what, dropped string, count uint32) {
+	t.Helper()
+	switch {
+	case count == 0:
+	case *allowDropped:
+		Logger(t).Warn("The SDK limits dropped telemetry", "of", what, "dropped", dropped, "count", count)
+	default:
+		t.Errorf("The %s has %d %s dropped by the SDK limits", what, count, dropped)
+	}
+}
@@ -0,0 +1,199 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+// The variables all the OTel SDKs read the resource from, see
+// https://opentelemetry.io/docs/specs/otel/configuration/sdk-environment-variables/#general-sdk-configuration
+const (
+	ServiceNameEnv        string = "OTEL_SERVICE_NAME"
+	ResourceAttributesEnv string = "OTEL_RESOURCE_ATTRIBUTES"
+)
+
+// The variables all the OTel SDKs configure their OTLP exporters from, for all the signals, see
+// https://opentelemetry.io/docs/specs/otel/protocol/exporter/#configuration-options
+const (
+	ExporterEndpointEnv    string = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	ExporterProtocolEnv    string = "OTEL_EXPORTER_OTLP_PROTOCOL"
+	ExporterHeadersEnv     string = "OTEL_EXPORTER_OTLP_HEADERS"
+	ExporterCompressionEnv string = "OTEL_EXPORTER_OTLP_COMPRESSION"
+)
+
+// The values of OTEL_EXPORTER_OTLP_PROTOCOL and OTEL_EXPORTER_OTLP_COMPRESSION
+var (
+	exporterProtocols    = []string{"grpc", "http/protobuf", "http/json"}
+	exporterCompressions = []string{"gzip", "none"}
+)
+
+// How an OTLP exporter is configured via the environment. The fields not set are neither set on the sample
+// nor asserted, e.g. as the defaults of the protocol differ between the SDKs
+type ExporterConfig struct {
+	// grpc, http/protobuf or http/json
+	Protocol string `yaml:"protocol"`
+	// Sent with each export, e.g. api-key: secret
+	Headers map[string]string `yaml:"headers"`
+	// gzip or none
+	Compression string `yaml:"compression"`
+}
+
+// An export received by a capture endpoint, e.g. the otlpsink, with the properties of its connection
+type ExportRequest struct {
+	// traces, metrics or logs
+	Signal string
+	// grpc, http/protobuf or http/json
+	Protocol string
+	// The gRPC metadata or the HTTP headers, with lower-cased keys
+	Headers map[string][]string
+	// The compression of the request body, e.g. gzip. Empty if not compressed
+	Compression string
+	// The service.name of the resources of the export
+	ServiceNames []string
+}
+
+// ExportRecorder keeps the exports received by a capture endpoint, see UseExporterCapture
+type ExportRecorder interface {
+	ExportRequests() []ExportRequest
+}
+
+// Returns the OTEL_EXPORTER_OTLP_* variables pointing the exporters of a sample to the endpoint, e.g.
+// http://host.docker.internal:4320, with the protocol, headers and compression of the config. The values of
+// the headers are percent-encoded, as the SDKs decode them
+func ExporterEnv(endpoint string, c ExporterConfig) []string {
+	env := []string{ExporterEndpointEnv + "=" + endpoint}
+	if c.Protocol != "" {
+		env = append(env, ExporterProtocolEnv+"="+c.Protocol)
+	}
+	if len(c.Headers) > 0 {
+		keys := make([]string, 0, len(c.Headers))
+		for k := range c.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			pairs[i] = k + "=" + percentEncode(c.Headers[k])
+		}
+		env = append(env, ExporterHeadersEnv+"="+strings.Join(pairs, ","))
+	}
+	if c.Compression != "" {
+		env = append(env, ExporterCompressionEnv+"="+c.Compression)
+	}
+	return env
+}
+
+// Asserts the exports of the service received by the recorder honored the config set via ExporterEnv: they
+// were sent with the protocol, the headers and the compression, e.g. as the sample reads its exporter
+// configuration from the environment and doesn't override it in code
+func AssertExporterConfig(t TestingT, r ExportRecorder, serviceName string, c ExporterConfig) {
+	var exports []ExportRequest
+	found := Eventually(t, "Exports of "+serviceName, func() bool {
+		exports = exports[:0]
+		for _, e := range r.ExportRequests() {
+			if slices.Contains(e.ServiceNames, serviceName) {
+				exports = append(exports, e)
+			}
+		}
+		return len(exports) > 0
+	})
+	if !found {
+		t.Fatalf("No export of %s was received. Are the exporters of the sample configured via %s?", serviceName, ExporterEndpointEnv)
+	}
+
+	for _, e := range exports {
+		if c.Protocol != "" && e.Protocol != c.Protocol {
+			t.Errorf("The %s were exported via %s, expected %s. Is %s read by the sample?", e.Signal, e.Protocol, c.Protocol, ExporterProtocolEnv)
+		}
+		for k, v := range c.Headers {
+			if values := e.Headers[strings.ToLower(k)]; !slices.Contains(values, v) {
+				t.Errorf("The %s were exported with the header %s=%v, expected %q. Is %s read by the sample?", e.Signal, k, values, v, ExporterHeadersEnv)
+			}
+		}
+		compression := e.Compression
+		if compression == "" {
+			compression = "none"
+		}
+		if c.Compression != "" && compression != c.Compression {
+			t.Errorf("The %s were exported with the compression %s, expected %s. Is %s read by the sample?", e.Signal, compression, c.Compression, ExporterCompressionEnv)
+		}
+		if t.Failed() {
+			// the other exports are most likely sent the same way
+			return
+		}
+	}
+}
+
+// Fails for the protocols and compressions the SDKs don't support, and the header names they can't parse
+func (c ExporterConfig) validate() error {
+	if c.Protocol != "" && !slices.Contains(exporterProtocols, c.Protocol) {
+		return fmt.Errorf("unknown protocol %q, expected one of %v", c.Protocol, exporterProtocols)
+	}
+	if c.Compression != "" && !slices.Contains(exporterCompressions, c.Compression) {
+		return fmt.Errorf("unknown compression %q, expected one of %v", c.Compression, exporterCompressions)
+	}
+	for k := range c.Headers {
+		if k == "" || strings.ContainsAny(k, "=, ") {
+			return fmt.Errorf("invalid header name %q", k)
+		}
+	}
+	return nil
+}
+
+// Returns the OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES variables configuring the resource of a sample to
+// the service and the attributes, e.g. to set them on a sample configured only via the environment. The values
+// of the attributes are percent-encoded, as the SDKs decode them
+func ResourceEnv(serviceName string, attributes map[string]string) []string {
+	env := []string{ServiceNameEnv + "=" + serviceName}
+	if len(attributes) == 0 {
+		return env
+	}
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + percentEncode(attributes[k])
+	}
+	return append(env, ResourceAttributesEnv+"="+strings.Join(pairs, ","))
+}
+
+// Encodes all the characters besides the unreserved ones of RFC 3986, e.g. the , and = separating the attributes
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// Asserts the resource has the service.name and the attributes set via ResourceEnv, with their exact values
+// and as strings, e.g. as the sample reads its resource from the environment and doesn't override it in code
+func AssertResourceFromEnv(t TestingT, r *otlpresource.Resource, serviceName string, attributes map[string]string) {
+	assert.Equal(t, serviceName, getServiceName(r), "Unexpected service.name resource attribute, is %s read by the sample?", ServiceNameEnv)
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var expected []*otlpcommon.KeyValue
+	for _, k := range keys {
+		expected = append(expected, StringAttribute(k, attributes[k]))
+	}
+	if !AssertAttributes(t, "the resource", r.GetAttributes(), expected...) {
+		t.Logf("The resource attributes are set via %s, is it read by the sample?", ResourceAttributesEnv)
+	}
+}
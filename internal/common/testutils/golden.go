@@ -0,0 +1,387 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+var updateGolden = flag.Bool("update", false, "Write the telemetry found in the back-ends to the golden files instead of comparing with them")
+
+// Attributes differing on each run of a sample, left out of the golden files. Keys ending with
+// a dot are prefixes, e.g. process. for process.pid and process.runtime.version
+var volatileAttributes = []string{
+	"host.", "os.", "process.", "container.", "k8s.",
+	"service.instance.id", "telemetry.sdk.version", "telemetry.distro.version", "telemetry.auto.version",
+	"client.address", "client.port", "network.peer.address", "network.peer.port",
+	"net.peer.ip", "net.peer.port", "net.sock.peer.addr", "net.sock.peer.port", "net.sock.host.addr", "net.sock.host.port",
+	"thread.id", "thread.name", "user_agent.original", "http.user_agent",
+}
+
+// The telemetry of a sample without the values differing on each run: ids, timestamps, metric values and
+// the attributes in volatileAttributes. Spans are grouped by trace and identical traces, metric data points
+// and logs are only kept once, so the number of times the sample was invoked does not matter
+type goldenTelemetry struct {
+	Resource map[string]string `json:"resource,omitempty"`
+	Traces   [][]goldenSpan    `json:"traces,omitempty"`
+	Metrics  []goldenMetric    `json:"metrics,omitempty"`
+	Logs     []goldenLog       `json:"logs,omitempty"`
+}
+
+type goldenSpan struct {
+	Name       string            `json:"name"`
+	Kind       string            `json:"kind"`
+	Scope      string            `json:"scope,omitempty"`
+	Parent     string            `json:"parent,omitempty"`
+	Status     string            `json:"status,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Events     []goldenEvent     `json:"events,omitempty"`
+	Links      int               `json:"links,omitempty"`
+}
+
+type goldenEvent struct {
+	Name       string            `json:"name"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type goldenMetric struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Scope       string `json:"scope,omitempty"`
+	// e.g. sum, gauge, histogram, and the temporality for sums and histograms
+	Type string `json:"type"`
+	// The attribute sets of the data points
+	DataPoints []map[string]string `json:"dataPoints,omitempty"`
+}
+
+type goldenLog struct {
+	Severity   string            `json:"severity,omitempty"`
+	Body       string            `json:"body"`
+	Scope      string            `json:"scope,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Whether the log was emitted in a span
+	InSpan bool `json:"inSpan,omitempty"`
+}
+
+// Compares the telemetry exported by the service with the golden file, e.g. testdata/telemetry.golden.json,
+// failing with a diff of both on any difference. With the -update flag the golden file is written instead:
+//
+//	go test -v -update
+//
+// Meant to be called after the other assertions, as the telemetry is compared once it no longer changes
+func AssertGolden(t TestingT, serviceName, path string) {
+	var got []byte
+	if *updateGolden {
+		Eventually(t, "Telemetry", func() bool {
+			got = captureGolden(t, serviceName)
+			return got != nil
+		})
+		if got == nil {
+			t.Fatalf("Could not find any telemetry of %s to write to %s", serviceName, path)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed creating the folder of the golden file: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("Failed writing the golden file: %v", err)
+		}
+		Logger(t).Info("Updated the golden file", "path", path)
+		return
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed reading the golden file (run with -update to create it): %v", err)
+	}
+	// the expected telemetry goes through the same normalization, so hand edits in any order still match
+	want, err := canonicalGolden(raw)
+	if err != nil {
+		t.Fatalf("Invalid golden file %s: %v", path, err)
+	}
+	matched := Eventually(t, "Telemetry matching "+path, func() bool {
+		got = captureGolden(t, serviceName)
+		return string(got) == string(want)
+	})
+	if !matched {
+		assert.Equal(t, string(want), string(got), "The telemetry of %s does not match the golden file %s (run with -update to accept it)", serviceName, path)
+	}
+}
+
+// Fetches and normalizes all the telemetry of the service. Returns nil if there is none yet
+func captureGolden(t TestingT, serviceName string) []byte {
+	g := &goldenTelemetry{}
+	if rs, err := queryTraces(t, serviceName, TraceQueryOptions{}); err == nil && len(rs.GetScopeSpans()) > 0 {
+		rs = goldenNormalization.Traces(rs)
+		g.Resource = goldenAttributes(rs.GetResource().GetAttributes())
+		g.Traces = goldenTraces(rs)
+	}
+	if rm, err := getMetricsBackend(t).GetMetrics(serviceName); err == nil && len(rm.GetScopeMetrics()) > 0 {
+		rm = goldenNormalization.Metrics(rm)
+		g.Resource = goldenAttributes(rm.GetResource().GetAttributes())
+		g.Metrics = goldenMetrics(rm)
+	}
+	if rl, err := getLogsBackend(t).GetLogs(serviceName); err == nil && len(rl.GetScopeLogs()) > 0 {
+		rl = goldenNormalization.Logs(rl)
+		g.Resource = goldenAttributes(rl.GetResource().GetAttributes())
+		g.Logs = goldenLogs(rl)
+	}
+	if g.Traces == nil && g.Metrics == nil && g.Logs == nil {
+		return nil
+	}
+
+	data, err := marshalGolden(g)
+	if err != nil {
+		t.Fatalf("Failed serializing the telemetry: %v", err)
+	}
+	return data
+}
+
+// The golden file in the form captureGolden writes it: the spans, traces, data points and logs sorted and
+// without duplicates, and without the volatile attributes
+func canonicalGolden(data []byte) ([]byte, error) {
+	g := &goldenTelemetry{}
+	if err := json.Unmarshal(data, g); err != nil {
+		return nil, err
+	}
+	g.Resource = goldenStable(g.Resource)
+	for _, tr := range g.Traces {
+		for i := range tr {
+			tr[i].Attributes = goldenStable(tr[i].Attributes)
+			for j := range tr[i].Events {
+				tr[i].Events[j].Attributes = goldenStable(tr[i].Events[j].Attributes)
+			}
+		}
+		sort.SliceStable(tr, func(i, j int) bool { return goldenKey(tr[i]) < goldenKey(tr[j]) })
+	}
+	if g.Traces != nil {
+		g.Traces = goldenUnique(g.Traces)
+	}
+	for i := range g.Metrics {
+		for j := range g.Metrics[i].DataPoints {
+			g.Metrics[i].DataPoints[j] = goldenStable(g.Metrics[i].DataPoints[j])
+		}
+		g.Metrics[i].DataPoints = goldenUnique(g.Metrics[i].DataPoints)
+	}
+	sort.SliceStable(g.Metrics, func(i, j int) bool { return g.Metrics[i].Name < g.Metrics[j].Name })
+	for i := range g.Logs {
+		g.Logs[i].Attributes = goldenStable(g.Logs[i].Attributes)
+	}
+	if g.Logs != nil {
+		g.Logs = goldenUnique(g.Logs)
+	}
+	return marshalGolden(g)
+}
+
+func marshalGolden(g *goldenTelemetry) ([]byte, error) {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func goldenTraces(rs *otlptrace.ResourceSpans) [][]goldenSpan {
+	seen := make(map[string]bool)
+	var traces [][]goldenSpan
+	for _, trace := range groupSpansByTrace(rs) {
+		spans := make([]goldenSpan, 0, len(trace))
+		for _, s := range trace {
+			gs := goldenSpan{
+				Name:       s.GetName(),
+				Kind:       strings.TrimPrefix(s.GetKind().String(), "SPAN_KIND_"),
+				Scope:      findSpanScope(rs, s).GetName(),
+				Attributes: goldenAttributes(s.GetAttributes()),
+				Links:      len(s.GetLinks()),
+			}
+			if parent := findSpanByID(rs, s.GetTraceId(), s.GetParentSpanId()); parent != nil {
+				gs.Parent = parent.GetName()
+			}
+			if code := s.GetStatus().GetCode(); code != otlptrace.Status_STATUS_CODE_UNSET {
+				gs.Status = strings.TrimPrefix(code.String(), "STATUS_CODE_")
+			}
+			for _, e := range s.GetEvents() {
+				gs.Events = append(gs.Events, goldenEvent{Name: e.GetName(), Attributes: goldenAttributes(e.GetAttributes())})
+			}
+			spans = append(spans, gs)
+		}
+		sort.SliceStable(spans, func(i, j int) bool { return goldenKey(spans[i]) < goldenKey(spans[j]) })
+
+		if key := goldenKey(spans); !seen[key] {
+			seen[key] = true
+			traces = append(traces, spans)
+		}
+	}
+	sort.Slice(traces, func(i, j int) bool { return goldenKey(traces[i]) < goldenKey(traces[j]) })
+	return traces
+}
+
+func goldenMetrics(rm *otlpmetrics.ResourceMetrics) []goldenMetric {
+	byName := make(map[string]*goldenMetric)
+	for _, sm := range rm.GetScopeMetrics() {
+		for _, m := range sm.GetMetrics() {
+			gm, found := byName[m.GetName()]
+			if !found {
+				gm = &goldenMetric{
+					Name:        m.GetName(),
+					Description: m.GetDescription(),
+					Unit:        m.GetUnit(),
+					Scope:       sm.GetScope().GetName(),
+				}
+				byName[m.GetName()] = gm
+			}
+
+			var attrs [][]*otlpcommon.KeyValue
+			switch d := m.GetData().(type) {
+			case *otlpmetrics.Metric_Sum:
+				gm.Type = "sum/" + goldenTemporality(d.Sum.GetAggregationTemporality())
+				for _, dp := range d.Sum.GetDataPoints() {
+					attrs = append(attrs, dp.GetAttributes())
+				}
+			case *otlpmetrics.Metric_Gauge:
+				gm.Type = "gauge"
+				for _, dp := range d.Gauge.GetDataPoints() {
+					attrs = append(attrs, dp.GetAttributes())
+				}
+			case *otlpmetrics.Metric_Histogram:
+				gm.Type = "histogram/" + goldenTemporality(d.Histogram.GetAggregationTemporality())
+				for _, dp := range d.Histogram.GetDataPoints() {
+					attrs = append(attrs, dp.GetAttributes())
+				}
+			case *otlpmetrics.Metric_ExponentialHistogram:
+				gm.Type = "exponential_histogram/" + goldenTemporality(d.ExponentialHistogram.GetAggregationTemporality())
+				for _, dp := range d.ExponentialHistogram.GetDataPoints() {
+					attrs = append(attrs, dp.GetAttributes())
+				}
+			case *otlpmetrics.Metric_Summary:
+				gm.Type = "summary"
+				for _, dp := range d.Summary.GetDataPoints() {
+					attrs = append(attrs, dp.GetAttributes())
+				}
+			}
+			for _, a := range attrs {
+				gm.DataPoints = append(gm.DataPoints, goldenAttributes(a))
+			}
+		}
+	}
+
+	metrics := make([]goldenMetric, 0, len(byName))
+	for _, gm := range byName {
+		gm.DataPoints = goldenUnique(gm.DataPoints)
+		metrics = append(metrics, *gm)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics
+}
+
+func goldenLogs(rl *otlplogs.ResourceLogs) []goldenLog {
+	var logs []goldenLog
+	for _, sl := range rl.GetScopeLogs() {
+		for _, l := range sl.GetLogRecords() {
+			gl := goldenLog{
+				Severity:   l.GetSeverityText(),
+				Body:       goldenValue(l.GetBody()),
+				Scope:      sl.GetScope().GetName(),
+				Attributes: goldenAttributes(l.GetAttributes()),
+				InSpan:     len(l.GetSpanId()) > 0,
+			}
+			logs = append(logs, gl)
+		}
+	}
+	return goldenUnique(logs)
+}
+
+// Sorts the values by their JSON form and removes the duplicates
+func goldenUnique[T any](values []T) []T {
+	seen := make(map[string]bool)
+	var res []T
+	for _, v := range values {
+		if key := goldenKey(v); !seen[key] {
+			seen[key] = true
+			res = append(res, v)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return goldenKey(res[i]) < goldenKey(res[j]) })
+	return res
+}
+
+func goldenKey(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func goldenTemporality(t otlpmetrics.AggregationTemporality) string {
+	return strings.ToLower(strings.TrimPrefix(t.String(), "AGGREGATION_TEMPORALITY_"))
+}
+
+// The attributes are already normalized, i.e. without the volatile ones
+func goldenAttributes(attributes []*otlpcommon.KeyValue) map[string]string {
+	var res map[string]string
+	for _, kv := range attributes {
+		if res == nil {
+			res = make(map[string]string)
+		}
+		res[kv.GetKey()] = goldenValue(kv.GetValue())
+	}
+	return res
+}
+
+// Removes the volatile attributes, e.g. left in a golden file edited by hand
+func goldenStable(attributes map[string]string) map[string]string {
+	for k := range attributes {
+		if matchAttributeKey(volatileAttributes, k) {
+			delete(attributes, k)
+		}
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+	return attributes
+}
+
+// Formats the value keeping its type visible, e.g. "bar", 5, 5.0, true, ["a", "b"]
+func goldenValue(v *otlpcommon.AnyValue) string {
+	switch val := v.GetValue().(type) {
+	case *otlpcommon.AnyValue_StringValue:
+		return strconv.Quote(val.StringValue)
+	case *otlpcommon.AnyValue_BoolValue:
+		return strconv.FormatBool(val.BoolValue)
+	case *otlpcommon.AnyValue_IntValue:
+		return strconv.FormatInt(val.IntValue, 10)
+	case *otlpcommon.AnyValue_DoubleValue:
+		s := strconv.FormatFloat(val.DoubleValue, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEIN") {
+			s += ".0"
+		}
+		return s
+	case *otlpcommon.AnyValue_BytesValue:
+		return "0x" + hex.EncodeToString(val.BytesValue)
+	case *otlpcommon.AnyValue_ArrayValue:
+		values := make([]string, 0, len(val.ArrayValue.GetValues()))
+		for _, e := range val.ArrayValue.GetValues() {
+			values = append(values, goldenValue(e))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case *otlpcommon.AnyValue_KvlistValue:
+		values := make([]string, 0, len(val.KvlistValue.GetValues()))
+		for _, kv := range val.KvlistValue.GetValues() {
+			values = append(values, fmt.Sprintf("%q: %s", kv.GetKey(), goldenValue(kv.GetValue())))
+		}
+		sort.Strings(values)
+		return "{" + strings.Join(values, ", ") + "}"
+	default:
+		return "null"
+	}
+}
@@ -0,0 +1,183 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const grpcInvokeTimeout time.Duration = 10 * time.Second
+
+// Calls a unary method of the gRPC sample API, e.g. helloworld.Greeter/SayHello. The request and
+// the returned response are the JSON representation of the messages, e.g. {"name": "world"}.
+// The sample must enable server reflection, which is used to discover the method's messages,
+// so no generated code is needed in the tests.
+func InvokeSampleGrpcApi(t TestingT, method, request string) string {
+	target := getConfig(t).SampleGrpcUrl
+	waitForSampleGrpcApi(t, target)
+	Logger(t).Info("Going to call the gRPC sample API", "target", target, "method", method)
+
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed connecting to the gRPC sample API: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), grpcInvokeTimeout)
+	defer cancel()
+
+	md, err := resolveGrpcMethod(ctx, conn, method)
+	if err != nil {
+		t.Fatalf("Failed resolving gRPC method %s via server reflection: %v", method, err)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		t.Fatalf("gRPC method %s is streaming, only unary methods are supported", method)
+	}
+
+	req := dynamicpb.NewMessage(md.Input())
+	if err := protojson.Unmarshal([]byte(request), req); err != nil {
+		t.Fatalf("Invalid request for gRPC method %s: %v", method, err)
+	}
+
+	res := dynamicpb.NewMessage(md.Output())
+	if err := conn.Invoke(ctx, "/"+strings.TrimPrefix(method, "/"), req, res); err != nil {
+		t.Fatalf("Failed calling the gRPC sample API: %v", err)
+	}
+
+	Logger(t).Info("Received OK response from the gRPC sample API", "target", target, "method", method)
+
+	body, err := protojson.Marshal(res)
+	if err != nil {
+		t.Fatalf("Failed marshaling the response of the gRPC sample API: %v", err)
+	}
+	return string(body)
+}
+
+// Looks up the descriptor of a method, e.g. helloworld.Greeter/SayHello, via server reflection
+func resolveGrpcMethod(ctx context.Context, conn *grpc.ClientConn, method string) (protoreflect.MethodDescriptor, error) {
+	service, name, found := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	if !found {
+		return nil, fmt.Errorf("method must be in the format package.Service/Method")
+	}
+
+	// v1alpha is the version supported by the reflection services of all the SDK languages
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	fds, err := reflectFiles(stream, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the server may only return the file of the service, so the missing dependencies are requested by name
+	known := make(map[string]*descriptorpb.FileDescriptorProto)
+	for len(fds) > 0 {
+		fd := fds[0]
+		fds = fds[1:]
+		if _, found := known[fd.GetName()]; found {
+			continue
+		}
+		known[fd.GetName()] = fd
+
+		for _, dep := range fd.GetDependency() {
+			if _, found := known[dep]; found {
+				continue
+			}
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				continue
+			}
+			deps, err := reflectFiles(stream, &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			})
+			if err != nil {
+				return nil, err
+			}
+			fds = append(fds, deps...)
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range known {
+		set.File = append(set.File, fd)
+	}
+	files, err := protodesc.NewFiles(withGlobalDependencies(set))
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, err
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(name))
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", service, name)
+	}
+	return md, nil
+}
+
+func reflectFiles(stream rpb.ServerReflection_ServerReflectionInfoClient, req *rpb.ServerReflectionRequest) ([]*descriptorpb.FileDescriptorProto, error) {
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if e := res.GetErrorResponse(); e != nil {
+		return nil, fmt.Errorf("server reflection error: %s", e.GetErrorMessage())
+	}
+
+	var fds []*descriptorpb.FileDescriptorProto
+	for _, b := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fd := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(b, fd); err != nil {
+			return nil, err
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
+// Adds the dependencies not returned by the server, e.g. google/protobuf/empty.proto,
+// from the files linked into the tests
+func withGlobalDependencies(set *descriptorpb.FileDescriptorSet) *descriptorpb.FileDescriptorSet {
+	included := make(map[string]bool, len(set.File))
+	for _, fd := range set.File {
+		included[fd.GetName()] = true
+	}
+
+	for i := 0; i < len(set.File); i++ {
+		for _, dep := range set.File[i].GetDependency() {
+			if included[dep] {
+				continue
+			}
+			if d, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+				set.File = append(set.File, protodesc.ToFileDescriptorProto(d))
+				included[dep] = true
+			}
+		}
+	}
+	return set
+}
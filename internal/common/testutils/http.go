@@ -0,0 +1,74 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+var httpTimeout = flag.Duration("http-timeout", 10*time.Second, "Max time of each HTTP request to the back-ends and the sample API, including reading the response")
+
+// Shared by all the requests, so the connections to the back-ends are reused across the retries
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// Sends the request and reads the whole response body, bounded by the -http-timeout flag and
+// the context of the request. A back-end accepting the connection but never answering
+// then fails the attempt instead of hanging the test until the go test timeout
+func doHttp(req *http.Request) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), *httpTimeout)
+	defer cancel()
+
+	res, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res, nil, fmt.Errorf("failed reading the response of %s: %w", req.URL, err)
+	}
+	return res, body, nil
+}
+
+// Sends a GET request, failing on any status other than 200
+func httpGet(uri, accept string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	res, body, err := doHttp(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, newHttpStatusError(uri, res.StatusCode)
+	}
+	return body, nil
+}
+
+// The context of the requests sent by a test, cancelled at the test deadline (go test -timeout)
+func testContext(t TestingT) (context.Context, context.CancelFunc) {
+	if deadline, ok := t.Deadline(); ok {
+		return context.WithDeadline(context.Background(), deadline)
+	}
+	return context.WithCancel(context.Background())
+}
@@ -0,0 +1,143 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	traceIdSize int = 16
+	spanIdSize  int = 8
+)
+
+// Asserts the ids of all the spans, their parents and links are valid W3C ids: 16 bytes trace ids and
+// 8 bytes span ids, none of them all zeros. Catches samples with a misconfigured id generator, or one
+// generating 64-bit trace ids, e.g. of the legacy Jaeger or Zipkin formats
+func AssertTraceIDs(t TestingT, rs *otlptrace.ResourceSpans) {
+	t.Helper()
+	for _, ss := range rs.GetScopeSpans() {
+		for _, s := range ss.GetSpans() {
+			assertSpanIDs(t, s)
+		}
+	}
+}
+
+// Asserts the trace and span ids of the exemplars are valid, when set. See AssertTraceIDs
+func AssertMetricsIDs(t TestingT, rm *otlpmetrics.ResourceMetrics) {
+	t.Helper()
+	for _, sm := range rm.GetScopeMetrics() {
+		for _, m := range sm.GetMetrics() {
+			for _, e := range metricExemplars(m) {
+				what := "exemplar of metric " + m.GetName()
+				reportIdViolation(t, what, traceIdViolation(e.GetTraceId(), true))
+				reportIdViolation(t, what, spanIdViolation(e.GetSpanId(), true))
+			}
+		}
+	}
+}
+
+// Asserts the trace and span ids of the logs are valid, when set. A log with a span id must have a
+// trace id too. See AssertTraceIDs
+func AssertLogsIDs(t TestingT, rl *otlplogs.ResourceLogs) {
+	t.Helper()
+	for _, sl := range rl.GetScopeLogs() {
+		for _, l := range sl.GetLogRecords() {
+			assertLogIDs(t, l)
+		}
+	}
+}
+
+func assertSpanIDs(t TestingT, s *otlptrace.Span) {
+	t.Helper()
+	what := "span " + s.GetName()
+	reportIdViolation(t, what, traceIdViolation(s.GetTraceId(), false))
+	reportIdViolation(t, what, spanIdViolation(s.GetSpanId(), false))
+	if v := spanIdViolation(s.GetParentSpanId(), true); v != "" {
+		reportIdViolation(t, what, "parent "+v)
+	}
+	for _, l := range s.GetLinks() {
+		reportIdViolation(t, "link of "+what, traceIdViolation(l.GetTraceId(), false))
+		reportIdViolation(t, "link of "+what, spanIdViolation(l.GetSpanId(), false))
+	}
+}
+
+func assertLogIDs(t TestingT, l *otlplogs.LogRecord) {
+	t.Helper()
+	what := fmt.Sprintf("log %q", l.GetBody().GetStringValue())
+	reportIdViolation(t, what, traceIdViolation(l.GetTraceId(), true))
+	reportIdViolation(t, what, spanIdViolation(l.GetSpanId(), true))
+	if len(l.GetSpanId()) > 0 && len(l.GetTraceId()) == 0 {
+		t.Errorf("The %s has a span id but no trace id", what)
+	}
+}
+
+func reportIdViolation(t TestingT, what, violation string) {
+	t.Helper()
+	if violation != "" {
+		t.Errorf("The %s has an invalid %s", what, violation)
+	}
+}
+
+// Describes why the trace id is invalid, or returns an empty string. Optional ids may be empty
+func traceIdViolation(id []byte, optional bool) string {
+	switch {
+	case len(id) == 0 && optional:
+		return ""
+	case len(id) != traceIdSize:
+		return fmt.Sprintf("trace id %s: %d bytes instead of %d", hex.EncodeToString(id), len(id), traceIdSize)
+	case isZeroId(id):
+		return "trace id: all zeros"
+	case isZeroId(id[:spanIdSize]):
+		// how the 64-bit ids of the legacy formats are padded when converted to W3C ids
+		return fmt.Sprintf("trace id %s: only 64 bits, the upper half is zero", hex.EncodeToString(id))
+	}
+	return ""
+}
+
+func spanIdViolation(id []byte, optional bool) string {
+	switch {
+	case len(id) == 0 && optional:
+		return ""
+	case len(id) != spanIdSize:
+		return fmt.Sprintf("span id %s: %d bytes instead of %d", hex.EncodeToString(id), len(id), spanIdSize)
+	case isZeroId(id):
+		return "span id: all zeros"
+	}
+	return ""
+}
+
+func isZeroId(id []byte) bool {
+	for _, b := range id {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func metricExemplars(m *otlpmetrics.Metric) []*otlpmetrics.Exemplar {
+	var res []*otlpmetrics.Exemplar
+	switch d := m.GetData().(type) {
+	case *otlpmetrics.Metric_Sum:
+		for _, dp := range d.Sum.GetDataPoints() {
+			res = append(res, dp.GetExemplars()...)
+		}
+	case *otlpmetrics.Metric_Gauge:
+		for _, dp := range d.Gauge.GetDataPoints() {
+			res = append(res, dp.GetExemplars()...)
+		}
+	case *otlpmetrics.Metric_Histogram:
+		for _, dp := range d.Histogram.GetDataPoints() {
+			res = append(res, dp.GetExemplars()...)
+		}
+	case *otlpmetrics.Metric_ExponentialHistogram:
+		for _, dp := range d.ExponentialHistogram.GetDataPoints() {
+			res = append(res, dp.GetExemplars()...)
+		}
+	}
+	return res
+}
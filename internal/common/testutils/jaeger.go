@@ -0,0 +1,288 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	// Max number of traces returned by the Jaeger query
+	jaegerQueryLimit int = 20
+)
+
+func init() {
+	RegisterTraceBackend("jaeger", func(c *Config) TraceBackend { return NewJaegerBackend(c.JaegerUrl) })
+}
+
+// TraceBackend for Jaeger. Traces are queried via the /api/traces endpoint of jaeger-query, filtered by
+// the service, the operation and the tags of the queried span, and the Jaeger spans are mapped back into
+// OTLP spans. The spans of all the traces found are returned, not only of the first one
+type JaegerBackend struct {
+	uri string
+}
+
+func NewJaegerBackend(uri string) *JaegerBackend {
+	return &JaegerBackend{uri: uri}
+}
+
+type jaegerResponse struct {
+	Data []jaegerTrace `json:"data"`
+}
+
+type jaegerTrace struct {
+	TraceID   string                   `json:"traceID"`
+	Spans     []jaegerSpan             `json:"spans"`
+	Processes map[string]jaegerProcess `json:"processes"`
+}
+
+type jaegerProcess struct {
+	ServiceName string           `json:"serviceName"`
+	Tags        []jaegerKeyValue `json:"tags"`
+}
+
+type jaegerReference struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+type jaegerLog struct {
+	Timestamp uint64           `json:"timestamp"`
+	Fields    []jaegerKeyValue `json:"fields"`
+}
+
+type jaegerKeyValue struct {
+	Key string `json:"key"`
+	// One of: string, bool, int64, float64, binary
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+// See https://github.com/jaegertracing/jaeger/blob/main/model/json/model.go
+type jaegerSpan struct {
+	TraceID       string            `json:"traceID"`
+	SpanID        string            `json:"spanID"`
+	OperationName string            `json:"operationName"`
+	References    []jaegerReference `json:"references"`
+	StartTime     uint64            `json:"startTime"`
+	Duration      uint64            `json:"duration"`
+	Tags          []jaegerKeyValue  `json:"tags"`
+	Logs          []jaegerLog       `json:"logs"`
+	ProcessID     string            `json:"processID"`
+}
+
+func (b *JaegerBackend) GetTraces(serviceName string, opts TraceQueryOptions) (*otlptrace.ResourceSpans, error) {
+	q := url.Values{}
+	q.Set("service", serviceName)
+	start, end := opts.window(time.Now())
+	q.Set("limit", fmt.Sprint(opts.limit(jaegerQueryLimit)))
+	q.Set("start", fmt.Sprint(start.UnixMicro()))
+	q.Set("end", fmt.Sprint(end.UnixMicro()))
+	if opts.SpanName != "" {
+		q.Set("operation", opts.SpanName)
+	}
+	if len(opts.Tags) > 0 {
+		tags, err := json.Marshal(opts.Tags)
+		if err != nil {
+			return nil, err
+		}
+		q.Set("tags", string(tags))
+	}
+
+	body, err := httpGet(fmt.Sprintf("%s/api/traces?%s", b.uri, q.Encode()), "application/json")
+	if err != nil {
+		// jaeger-query answers 404 until it has seen a span of the service
+		var se *httpStatusError
+		if errors.As(err, &se) && se.statusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed calling Jaeger: %w", err)
+	}
+
+	// the numbers are kept as json.Number, so int64 tags don't lose precision
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var res jaegerResponse
+	if err := dec.Decode(&res); err != nil {
+		return nil, fmt.Errorf("error reading payload from Jaeger: %w", err)
+	}
+	return toOtlpResourceSpansFromJaeger(serviceName, res.Data)
+}
+
+func toOtlpResourceSpansFromJaeger(serviceName string, traces []jaegerTrace) (*otlptrace.ResourceSpans, error) {
+	var resource *otlpresource.Resource
+	scopes := make(map[string]*otlptrace.ScopeSpans)
+	for _, tr := range traces {
+		for _, js := range tr.Spans {
+			p := tr.Processes[js.ProcessID]
+			if p.ServiceName != serviceName {
+				continue
+			}
+			if resource == nil {
+				resource = &otlpresource.Resource{Attributes: append([]*otlpcommon.KeyValue{StringAttribute("service.name", serviceName)},
+					toOtlpAttributesFromJaeger(p.Tags, nil)...)}
+			}
+
+			s, err := toOtlpSpanFromJaeger(js)
+			if err != nil {
+				return nil, err
+			}
+			scope := &otlpcommon.InstrumentationScope{Name: jaegerTag(js.Tags, "otel.scope.name"), Version: jaegerTag(js.Tags, "otel.scope.version")}
+			if scope.Name == "" {
+				scope.Name, scope.Version = jaegerTag(js.Tags, "otel.library.name"), jaegerTag(js.Tags, "otel.library.version")
+			}
+			key := scope.Name + "@" + scope.Version
+			ss, found := scopes[key]
+			if !found {
+				ss = &otlptrace.ScopeSpans{Scope: scope}
+				scopes[key] = ss
+			}
+			ss.Spans = append(ss.Spans, s)
+		}
+	}
+	if resource == nil {
+		return nil, nil
+	}
+
+	rs := &otlptrace.ResourceSpans{Resource: resource}
+	keys := make([]string, 0, len(scopes))
+	for k := range scopes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rs.ScopeSpans = append(rs.ScopeSpans, scopes[k])
+	}
+	return rs, nil
+}
+
+// Tags added by the OTel -> Jaeger translation that are mapped back into span fields
+var jaegerReservedTags = map[string]bool{
+	"span.kind":               true,
+	"otel.scope.name":         true,
+	"otel.scope.version":      true,
+	"otel.library.name":       true,
+	"otel.library.version":    true,
+	"otel.status_code":        true,
+	"otel.status_description": true,
+	"error":                   true,
+	"internal.span.format":    true,
+}
+
+func toOtlpSpanFromJaeger(js jaegerSpan) (*otlptrace.Span, error) {
+	traceID, err := decodeZipkinID(js.TraceID, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Jaeger trace id %s: %w", js.TraceID, err)
+	}
+	spanID, err := decodeZipkinID(js.SpanID, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Jaeger span id %s: %w", js.SpanID, err)
+	}
+
+	s := &otlptrace.Span{
+		TraceId:           traceID,
+		SpanId:            spanID,
+		Name:              js.OperationName,
+		Kind:              toOtlpSpanKind(strings.ToUpper(jaegerTag(js.Tags, "span.kind"))),
+		StartTimeUnixNano: js.StartTime * 1000,
+		EndTimeUnixNano:   (js.StartTime + js.Duration) * 1000,
+		Attributes:        toOtlpAttributesFromJaeger(js.Tags, jaegerReservedTags),
+	}
+	tags := map[string]string{
+		"otel.status_code":        jaegerTag(js.Tags, "otel.status_code"),
+		"otel.status_description": jaegerTag(js.Tags, "otel.status_description"),
+	}
+	// unlike Zipkin, the error tag is a bool, not the message
+	if tags["otel.status_code"] == "" && jaegerTag(js.Tags, "error") == "true" {
+		tags["otel.status_code"] = "ERROR"
+	}
+	s.Status = toOtlpStatus(tags)
+
+	// the parent is the first CHILD_OF reference of the same trace, the other references are links
+	for _, ref := range js.References {
+		refTrace, err := decodeZipkinID(ref.TraceID, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Jaeger reference trace id %s: %w", ref.TraceID, err)
+		}
+		refSpan, err := decodeZipkinID(ref.SpanID, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Jaeger reference span id %s: %w", ref.SpanID, err)
+		}
+		if ref.RefType == "CHILD_OF" && s.ParentSpanId == nil && bytes.Equal(refTrace, traceID) {
+			s.ParentSpanId = refSpan
+			continue
+		}
+		s.Links = append(s.Links, &otlptrace.Span_Link{TraceId: refTrace, SpanId: refSpan})
+	}
+
+	for _, l := range js.Logs {
+		s.Events = append(s.Events, &otlptrace.Span_Event{
+			Name:         jaegerTag(l.Fields, "event"),
+			TimeUnixNano: l.Timestamp * 1000,
+			Attributes:   toOtlpAttributesFromJaeger(l.Fields, map[string]bool{"event": true}),
+		})
+	}
+	return s, nil
+}
+
+// Maps the Jaeger tags to attributes of the same types, leaving out the reserved keys
+func toOtlpAttributesFromJaeger(tags []jaegerKeyValue, reserved map[string]bool) []*otlpcommon.KeyValue {
+	var res []*otlpcommon.KeyValue
+	for _, kv := range tags {
+		if reserved[kv.Key] {
+			continue
+		}
+		res = append(res, &otlpcommon.KeyValue{Key: kv.Key, Value: toOtlpValueFromJaeger(kv)})
+	}
+	return res
+}
+
+func toOtlpValueFromJaeger(kv jaegerKeyValue) *otlpcommon.AnyValue {
+	switch kv.Type {
+	case "bool":
+		if b, ok := kv.Value.(bool); ok {
+			return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: b}}
+		}
+	case "int64":
+		if n, ok := kv.Value.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: i}}
+			}
+		}
+	case "float64":
+		if n, ok := kv.Value.(json.Number); ok {
+			if f, err := n.Float64(); err == nil {
+				return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: f}}
+			}
+		}
+	case "binary":
+		if s, ok := kv.Value.(string); ok {
+			if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+				return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BytesValue{BytesValue: b}}
+			}
+		}
+	}
+	return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: fmt.Sprint(kv.Value)}}
+}
+
+// The value of the tag as a string, empty if not found
+func jaegerTag(tags []jaegerKeyValue, key string) string {
+	for _, kv := range tags {
+		if kv.Key == key {
+			return fmt.Sprint(kv.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,339 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const jaegerFindTracesMethod string = "/jaeger.api_v2.QueryService/FindTraces"
+
+func init() {
+	RegisterTraceBackend("jaeger-grpc", func(c *Config) TraceBackend { return NewJaegerGrpcBackend(c.JaegerGrpcUrl) })
+}
+
+// TraceBackend for the gRPC query API of Jaeger (jaeger.api_v2.QueryService), e.g. at localhost:16685.
+// Unlike the JSON API it returns the full span model: the references with their types, the logs and the
+// process of each span, and the tags with their types, which are mapped into OTLP spans without loss.
+// The protobuf messages are encoded by hand, so the harness doesn't depend on the Jaeger modules
+type JaegerGrpcBackend struct {
+	target string
+}
+
+func NewJaegerGrpcBackend(target string) *JaegerGrpcBackend {
+	return &JaegerGrpcBackend{target: target}
+}
+
+func (b *JaegerGrpcBackend) GetTraces(serviceName string, opts TraceQueryOptions) (*otlptrace.ResourceSpans, error) {
+	conn, err := grpc.NewClient(b.target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), grpcInvokeTimeout)
+	defer cancel()
+
+	req := jaegerFindTracesRequest(serviceName, opts, time.Now())
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, jaegerFindTracesMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return nil, fmt.Errorf("failed calling Jaeger: %w", err)
+	}
+	if err := stream.SendMsg(&req); err != nil {
+		return nil, fmt.Errorf("failed calling Jaeger: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("failed calling Jaeger: %w", err)
+	}
+
+	// the spans are streamed in chunks, each span with its process
+	tr := jaegerTrace{Processes: make(map[string]jaegerProcess)}
+	for {
+		var chunk []byte
+		err := stream.RecvMsg(&chunk)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if status.Code(err) == codes.NotFound {
+			// no traces of the service yet
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed calling Jaeger: %w", err)
+		}
+		if err := decodeJaegerChunk(chunk, &tr); err != nil {
+			return nil, fmt.Errorf("error reading payload from Jaeger: %w", err)
+		}
+	}
+	return toOtlpResourceSpansFromJaeger(serviceName, []jaegerTrace{tr})
+}
+
+// A FindTracesRequest with the TraceQueryParameters of the service, operation, tags, window and limit
+func jaegerFindTracesRequest(serviceName string, opts TraceQueryOptions, now time.Time) []byte {
+	var q []byte
+	q = protowire.AppendTag(q, 1, protowire.BytesType)
+	q = protowire.AppendString(q, serviceName)
+	if opts.SpanName != "" {
+		q = protowire.AppendTag(q, 2, protowire.BytesType)
+		q = protowire.AppendString(q, opts.SpanName)
+	}
+	for k, v := range opts.Tags {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, v)
+		q = protowire.AppendTag(q, 3, protowire.BytesType)
+		q = protowire.AppendBytes(q, entry)
+	}
+	start, end := opts.window(now)
+	q = protowire.AppendTag(q, 4, protowire.BytesType)
+	q = protowire.AppendBytes(q, protoTimestamp(start))
+	q = protowire.AppendTag(q, 5, protowire.BytesType)
+	q = protowire.AppendBytes(q, protoTimestamp(end))
+	q = protowire.AppendTag(q, 8, protowire.VarintType)
+	q = protowire.AppendVarint(q, uint64(opts.limit(jaegerQueryLimit)))
+
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	return protowire.AppendBytes(req, q)
+}
+
+func protoTimestamp(t time.Time) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(t.Unix()))
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(t.Nanosecond()))
+}
+
+// Decodes a SpansResponseChunk into the JSON model of the spans, shared with the JaegerBackend
+func decodeJaegerChunk(b []byte, tr *jaegerTrace) error {
+	return decodeProtoFields(b, func(num protowire.Number, typ protowire.Type, v []byte, _ uint64) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		s, p, err := decodeJaegerSpan(v)
+		if err != nil {
+			return err
+		}
+		s.ProcessID = fmt.Sprintf("p%d", len(tr.Processes)+1)
+		tr.Processes[s.ProcessID] = p
+		tr.Spans = append(tr.Spans, s)
+		return nil
+	})
+}
+
+func decodeJaegerSpan(b []byte) (jaegerSpan, jaegerProcess, error) {
+	var s jaegerSpan
+	var p jaegerProcess
+	err := decodeProtoFields(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		var err error
+		switch num {
+		case 1:
+			s.TraceID = hex.EncodeToString(v)
+		case 2:
+			s.SpanID = hex.EncodeToString(v)
+		case 3:
+			s.OperationName = string(v)
+		case 4:
+			var ref jaegerReference
+			ref, err = decodeJaegerRef(v)
+			s.References = append(s.References, ref)
+		case 6:
+			s.StartTime, err = decodeProtoMicros(v)
+		case 7:
+			s.Duration, err = decodeProtoMicros(v)
+		case 8:
+			var kv jaegerKeyValue
+			kv, err = decodeJaegerKeyValue(v)
+			s.Tags = append(s.Tags, kv)
+		case 9:
+			var l jaegerLog
+			l, err = decodeJaegerLog(v)
+			s.Logs = append(s.Logs, l)
+		case 10:
+			err = decodeProtoFields(v, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+				switch num {
+				case 1:
+					p.ServiceName = string(v)
+				case 2:
+					kv, err := decodeJaegerKeyValue(v)
+					if err != nil {
+						return err
+					}
+					p.Tags = append(p.Tags, kv)
+				}
+				return nil
+			})
+		}
+		return err
+	})
+	return s, p, err
+}
+
+var jaegerRefTypes = map[uint64]string{0: "CHILD_OF", 1: "FOLLOWS_FROM"}
+
+func decodeJaegerRef(b []byte) (jaegerReference, error) {
+	ref := jaegerReference{RefType: jaegerRefTypes[0]}
+	err := decodeProtoFields(b, func(num protowire.Number, _ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			ref.TraceID = hex.EncodeToString(v)
+		case 2:
+			ref.SpanID = hex.EncodeToString(v)
+		case 3:
+			ref.RefType = jaegerRefTypes[n]
+		}
+		return nil
+	})
+	return ref, err
+}
+
+func decodeJaegerLog(b []byte) (jaegerLog, error) {
+	var l jaegerLog
+	err := decodeProtoFields(b, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+		var err error
+		switch num {
+		case 1:
+			l.Timestamp, err = decodeProtoMicros(v)
+		case 2:
+			var kv jaegerKeyValue
+			kv, err = decodeJaegerKeyValue(v)
+			l.Fields = append(l.Fields, kv)
+		}
+		return err
+	})
+	return l, err
+}
+
+// The value types of the KeyValue, in the order of the enum
+var jaegerValueTypes = []string{"string", "bool", "int64", "float64", "binary"}
+
+func decodeJaegerKeyValue(b []byte) (jaegerKeyValue, error) {
+	kv := jaegerKeyValue{Type: jaegerValueTypes[0], Value: ""}
+	values := make(map[string]any)
+	err := decodeProtoFields(b, func(num protowire.Number, _ protowire.Type, v []byte, n uint64) error {
+		switch num {
+		case 1:
+			kv.Key = string(v)
+		case 2:
+			if n < uint64(len(jaegerValueTypes)) {
+				kv.Type = jaegerValueTypes[n]
+			}
+		case 3:
+			values["string"] = string(v)
+		case 4:
+			values["bool"] = n != 0
+		case 5:
+			values["int64"] = json.Number(strconv.FormatInt(int64(n), 10))
+		case 6:
+			values["float64"] = json.Number(strconv.FormatFloat(math.Float64frombits(n), 'g', -1, 64))
+		case 7:
+			values["binary"] = base64.StdEncoding.EncodeToString(v)
+		}
+		return nil
+	})
+	if v, found := values[kv.Type]; found {
+		kv.Value = v
+		return kv, err
+	}
+	// the fields of the default values are not encoded
+	switch kv.Type {
+	case "bool":
+		kv.Value = false
+	case "int64", "float64":
+		kv.Value = json.Number("0")
+	}
+	return kv, err
+}
+
+// A google.protobuf.Timestamp or Duration in microseconds, the unit of the JSON model
+func decodeProtoMicros(b []byte) (uint64, error) {
+	var seconds, nanos uint64
+	err := decodeProtoFields(b, func(num protowire.Number, _ protowire.Type, _ []byte, n uint64) error {
+		switch num {
+		case 1:
+			seconds = n
+		case 2:
+			nanos = n
+		}
+		return nil
+	})
+	return seconds*1_000_000 + nanos/1000, err
+}
+
+// Calls f with each field of the message, with the bytes of the length-delimited ones and the value of
+// the varint and fixed ones
+func decodeProtoFields(b []byte, f func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		b = b[l:]
+
+		var v []byte
+		var n uint64
+		switch typ {
+		case protowire.VarintType:
+			n, l = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			n, l = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var n32 uint32
+			n32, l = protowire.ConsumeFixed32(b)
+			n = uint64(n32)
+		case protowire.BytesType:
+			v, l = protowire.ConsumeBytes(b)
+		default:
+			l = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		b = b[l:]
+		if err := f(num, typ, v, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sends and receives the messages as they are encoded, i.e. as *[]byte
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// The content subtype is proto, as the messages are
+func (rawCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,312 @@
+package testutils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Encodes the spans of the recorded JSON response as the SpansResponseChunks of the gRPC API, one chunk
+// per trace, see https://github.com/jaegertracing/jaeger-idl/blob/main/proto/api_v2/model.proto
+func jaegerTestdataChunks(t *testing.T) [][]byte {
+	dec := json.NewDecoder(bytes.NewReader(readJaegerTestdata(t)))
+	dec.UseNumber()
+	var res jaegerResponse
+	if err := dec.Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	var chunks [][]byte
+	for _, tr := range res.Data {
+		var chunk []byte
+		for _, s := range tr.Spans {
+			chunk = protowire.AppendTag(chunk, 1, protowire.BytesType)
+			chunk = protowire.AppendBytes(chunk, encodeJaegerTestSpan(t, s, tr.Processes[s.ProcessID]))
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func encodeJaegerTestSpan(t *testing.T, s jaegerSpan, p jaegerProcess) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, mustHexId(t, s.TraceID))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, mustHexId(t, s.SpanID))
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, s.OperationName)
+	for _, ref := range s.References {
+		var r []byte
+		r = protowire.AppendTag(r, 1, protowire.BytesType)
+		r = protowire.AppendBytes(r, mustHexId(t, ref.TraceID))
+		r = protowire.AppendTag(r, 2, protowire.BytesType)
+		r = protowire.AppendBytes(r, mustHexId(t, ref.SpanID))
+		// CHILD_OF is the default value, not encoded
+		if ref.RefType == "FOLLOWS_FROM" {
+			r = protowire.AppendTag(r, 3, protowire.VarintType)
+			r = protowire.AppendVarint(r, 1)
+		}
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, r)
+	}
+	b = protowire.AppendTag(b, 6, protowire.BytesType)
+	b = protowire.AppendBytes(b, protoTimestamp(time.UnixMicro(int64(s.StartTime))))
+	b = protowire.AppendTag(b, 7, protowire.BytesType)
+	b = protowire.AppendBytes(b, encodeJaegerTestDuration(time.Duration(s.Duration)*time.Microsecond))
+	for _, kv := range s.Tags {
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeJaegerTestKeyValue(t, kv))
+	}
+	for _, l := range s.Logs {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendBytes(lb, protoTimestamp(time.UnixMicro(int64(l.Timestamp))))
+		for _, kv := range l.Fields {
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendBytes(lb, encodeJaegerTestKeyValue(t, kv))
+		}
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, lb)
+	}
+	var pb []byte
+	pb = protowire.AppendTag(pb, 1, protowire.BytesType)
+	pb = protowire.AppendString(pb, p.ServiceName)
+	for _, kv := range p.Tags {
+		pb = protowire.AppendTag(pb, 2, protowire.BytesType)
+		pb = protowire.AppendBytes(pb, encodeJaegerTestKeyValue(t, kv))
+	}
+	b = protowire.AppendTag(b, 10, protowire.BytesType)
+	return protowire.AppendBytes(b, pb)
+}
+
+func encodeJaegerTestDuration(d time.Duration) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(d/time.Second))
+	b = protowire.AppendTag(b, 2, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(d%time.Second))
+}
+
+func encodeJaegerTestKeyValue(t *testing.T, kv jaegerKeyValue) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, kv.Key)
+	switch kv.Type {
+	case "string":
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, kv.Value.(string))
+	case "bool":
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+		b = protowire.AppendTag(b, 4, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(kv.Value.(bool)))
+	case "int64":
+		i, err := kv.Value.(json.Number).Int64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, 2)
+		b = protowire.AppendTag(b, 5, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(i))
+	case "float64":
+		f, err := kv.Value.(json.Number).Float64()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, 3)
+		b = protowire.AppendTag(b, 6, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(f))
+	case "binary":
+		v, err := base64.StdEncoding.DecodeString(kv.Value.(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, 4)
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, v)
+	}
+	return b
+}
+
+// Serves FindTraces with the chunks, or the error, recording the request
+func startJaegerGrpcTestServer(t *testing.T, chunks [][]byte, failure error) (string, *[]byte) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req []byte
+	srv := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		if method, _ := grpc.MethodFromServerStream(stream); method != jaegerFindTracesMethod {
+			return status.Errorf(codes.Unimplemented, "unexpected method %s", method)
+		}
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		if failure != nil {
+			return failure
+		}
+		for _, c := range chunks {
+			if err := stream.SendMsg(&c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String(), &req
+}
+
+func TestJaegerGrpcBackendGetTraces(t *testing.T) {
+	target, req := startJaegerGrpcTestServer(t, jaegerTestdataChunks(t), nil)
+	rs, err := NewJaegerGrpcBackend(target).GetTraces("dice", TraceQueryOptions{SpanName: "roll"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same spans as the JSON API
+	assertProtoEqual(t, jaegerTestdataSpans(t), rs)
+
+	// the query parameters of the request
+	var service, operation string
+	_ = decodeProtoFields(*req, func(_ protowire.Number, _ protowire.Type, q []byte, _ uint64) error {
+		return decodeProtoFields(q, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) error {
+			switch num {
+			case 1:
+				service = string(v)
+			case 2:
+				operation = string(v)
+			}
+			return nil
+		})
+	})
+	if service != "dice" || operation != "roll" {
+		t.Errorf("Unexpected query of service %q and operation %q", service, operation)
+	}
+}
+
+func TestJaegerGrpcBackendGetTracesStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  [][]byte
+		err     error
+		wantErr bool
+	}{
+		// no traces of the service yet
+		{"not found", nil, status.Error(codes.NotFound, "trace not found"), false},
+		{"no chunks", nil, nil, false},
+		{"unavailable", nil, status.Error(codes.Unavailable, "storage unavailable"), true},
+		{"invalid chunk", [][]byte{{0x0a, 0x05, 0x01}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, _ := startJaegerGrpcTestServer(t, tt.chunks, tt.err)
+			rs, err := NewJaegerGrpcBackend(target).GetTraces("dice", TraceQueryOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rs != nil {
+				t.Errorf("Expected no spans, got %v", rs)
+			}
+		})
+	}
+}
+
+func TestDecodeJaegerKeyValue(t *testing.T) {
+	kv := func(fields ...func([]byte) []byte) []byte {
+		b := protowire.AppendTag(nil, 1, protowire.BytesType)
+		b = protowire.AppendString(b, "k")
+		for _, f := range fields {
+			b = f(b)
+		}
+		return b
+	}
+	varint := func(num protowire.Number, v uint64) func([]byte) []byte {
+		return func(b []byte) []byte {
+			return protowire.AppendVarint(protowire.AppendTag(b, num, protowire.VarintType), v)
+		}
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want *otlpcommon.AnyValue
+	}{
+		{"string", kv(func(b []byte) []byte {
+			return protowire.AppendString(protowire.AppendTag(b, 3, protowire.BytesType), "v")
+		}), stringValue("v")},
+		// the fields of the default values are not encoded
+		{"empty string", kv(), stringValue("")},
+		{"false", kv(varint(2, 1)), &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{}}},
+		{"zero", kv(varint(2, 2)), &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{}}},
+		{"negative int64", kv(varint(2, 2), varint(5, uint64(math.MaxUint64-1))), &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: -2}}},
+		{"float64", kv(varint(2, 3), func(b []byte) []byte {
+			return protowire.AppendFixed64(protowire.AppendTag(b, 6, protowire.Fixed64Type), math.Float64bits(0.25))
+		}), &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: 0.25}}},
+		{"binary", kv(varint(2, 4), func(b []byte) []byte {
+			return protowire.AppendBytes(protowire.AppendTag(b, 7, protowire.BytesType), []byte{0xca, 0xfe})
+		}), &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BytesValue{BytesValue: []byte{0xca, 0xfe}}}},
+		// a value of another type than the declared one is ignored
+		{"mismatching value", kv(varint(2, 1), varint(5, 3)), &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeJaegerKeyValue(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Key != "k" {
+				t.Errorf("Unexpected key %q", got.Key)
+			}
+			assertProtoEqual(t, tt.want, toOtlpValueFromJaeger(got))
+		})
+	}
+}
+
+func TestDecodeJaegerRef(t *testing.T) {
+	ref := func(refType uint64) []byte {
+		b := protowire.AppendTag(nil, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, bytes.Repeat([]byte{1}, 16))
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, bytes.Repeat([]byte{2}, 8))
+		if refType != 0 {
+			b = protowire.AppendTag(b, 3, protowire.VarintType)
+			b = protowire.AppendVarint(b, refType)
+		}
+		return b
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"CHILD_OF by default", ref(0), "CHILD_OF"},
+		{"FOLLOWS_FROM", ref(1), "FOLLOWS_FROM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeJaegerRef(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.RefType != tt.want {
+				t.Errorf("Expected the reference type %s, got %s", tt.want, got.RefType)
+			}
+			if got.TraceID != hex.EncodeToString(bytes.Repeat([]byte{1}, 16)) || got.SpanID != "0202020202020202" {
+				t.Errorf("Unexpected ids %s %s", got.TraceID, got.SpanID)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package testutils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func readJaegerTestdata(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "jaeger", "traces.json"))
+	if err != nil {
+		t.Fatalf("Failed reading the Jaeger response: %v", err)
+	}
+	return data
+}
+
+// The spans of the dice service in testdata/jaeger/traces.json, by scope
+func jaegerTestdataSpans(t *testing.T) *otlptrace.ResourceSpans {
+	const traceA, traceB = "5b8aa5a2d2c872e8321cf37308d69df2", "829fb7ceb787403c96eac634767ef10a"
+	return &otlptrace.ResourceSpans{
+		Resource: &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{
+			StringAttribute("service.name", "dice"),
+			StringAttribute("telemetry.sdk.language", "go"),
+		}},
+		ScopeSpans: []*otlptrace.ScopeSpans{
+			{
+				// without scope tags
+				Scope: &otlpcommon.InstrumentationScope{},
+				Spans: []*otlptrace.Span{{
+					TraceId:           mustHexId(t, traceB),
+					SpanId:            mustHexId(t, "efe159833c5bf9d1"),
+					ParentSpanId:      mustHexId(t, "0a3bb75e2b3b1d6b"),
+					Name:              "cache.get",
+					Kind:              otlptrace.Span_SPAN_KIND_CLIENT,
+					StartTimeUnixNano: 1714644063000000000,
+					EndTimeUnixNano:   1714644063001500000,
+					// the reference to another trace and the second parent are links
+					Links: []*otlptrace.Span_Link{
+						{TraceId: mustHexId(t, traceA), SpanId: mustHexId(t, "5fb397be34d26b51")},
+						{TraceId: mustHexId(t, traceB), SpanId: mustHexId(t, "1f2e3d4c5b6a7988")},
+					},
+					Status: &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR},
+				}},
+			},
+			{
+				// the otel.library tags of the older SDKs
+				Scope: &otlpcommon.InstrumentationScope{Name: "otel-recipes/legacy", Version: "0.1.0"},
+				Spans: []*otlptrace.Span{{
+					TraceId:           mustHexId(t, traceB),
+					SpanId:            mustHexId(t, "0a3bb75e2b3b1d6b"),
+					Name:              "publish",
+					Kind:              otlptrace.Span_SPAN_KIND_PRODUCER,
+					StartTimeUnixNano: 1714644062990000000,
+					EndTimeUnixNano:   1714644063010000000,
+					Status:            &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_OK},
+				}},
+			},
+			{
+				Scope: &otlpcommon.InstrumentationScope{Name: "otel-recipes", Version: "1.0.0"},
+				Spans: []*otlptrace.Span{
+					{
+						TraceId:           mustHexId(t, traceA),
+						SpanId:            mustHexId(t, "051581bf3cb55c13"),
+						ParentSpanId:      mustHexId(t, "5fb397be34d26b51"),
+						Name:              "roll",
+						Kind:              otlptrace.Span_SPAN_KIND_INTERNAL,
+						StartTimeUnixNano: 1714644062114304000,
+						EndTimeUnixNano:   1714644062114561000,
+						Attributes: []*otlpcommon.KeyValue{
+							IntAttribute("roll.value", 4),
+							BoolAttribute("roll.fair", true),
+							{Key: "roll.weight", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: 0.5}}},
+							{Key: "roll.seed", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BytesValue{BytesValue: []byte{1, 2}}}},
+						},
+						Events: []*otlptrace.Span_Event{{
+							Name:         "rolled",
+							TimeUnixNano: 1714644062114500000,
+							Attributes:   []*otlpcommon.KeyValue{IntAttribute("attempt", 1)},
+						}},
+						// FOLLOWS_FROM
+						Links:  []*otlptrace.Span_Link{{TraceId: mustHexId(t, traceB), SpanId: mustHexId(t, "efe159833c5bf9d1")}},
+						Status: &otlptrace.Status{},
+					},
+					{
+						TraceId:           mustHexId(t, traceA),
+						SpanId:            mustHexId(t, "5fb397be34d26b51"),
+						Name:              "GET /roll",
+						Kind:              otlptrace.Span_SPAN_KIND_SERVER,
+						StartTimeUnixNano: 1714644062100000000,
+						EndTimeUnixNano:   1714644062200000000,
+						// beyond the precision of a float64
+						Attributes: []*otlpcommon.KeyValue{IntAttribute("http.request.body.size", 9007199254740993)},
+						Status:     &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR, Message: "7 is not a dice value"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestJaegerBackendGetTraces(t *testing.T) {
+	data := readJaegerTestdata(t)
+	var query map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	end := time.Date(2024, 5, 2, 10, 5, 0, 0, time.UTC)
+	opts := TraceQueryOptions{SpanName: "roll", Tags: map[string]string{"roll.value": "4"}, End: end, Lookback: 10 * time.Minute}
+	rs, err := NewJaegerBackend(srv.URL).GetTraces("dice", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertProtoEqual(t, jaegerTestdataSpans(t), rs)
+
+	for key, want := range map[string]string{
+		"service":   "dice",
+		"operation": "roll",
+		"tags":      `{"roll.value":"4"}`,
+		"limit":     "20",
+		"start":     "1714643700000000",
+		"end":       "1714644300000000",
+	} {
+		if got := query[key]; len(got) != 1 || got[0] != want {
+			t.Errorf("Expected the %s %s in the query, got %v", key, want, got)
+		}
+	}
+}
+
+func TestJaegerBackendGetTracesStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		// jaeger-query answers 404 until it has seen a span of the service
+		{"not found", http.StatusNotFound, `{"data":null,"errors":[{"code":404,"msg":"trace not found"}]}`, false},
+		{"no traces", http.StatusOK, `{"data":[],"total":0,"limit":0,"offset":0,"errors":null}`, false},
+		{"other service", http.StatusOK, `{"data":[{"traceID":"01","spans":[{"traceID":"01","spanID":"02","processID":"p1"}],"processes":{"p1":{"serviceName":"frontend"}}}]}`, false},
+		{"server error", http.StatusInternalServerError, `{"errors":[{"code":500,"msg":"boom"}]}`, true},
+		{"invalid payload", http.StatusOK, `{"data":`, true},
+		{"invalid id", http.StatusOK, `{"data":[{"traceID":"zz","spans":[{"traceID":"zz","spanID":"02","processID":"p1"}],"processes":{"p1":{"serviceName":"dice"}}}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			rs, err := NewJaegerBackend(srv.URL).GetTraces("dice", TraceQueryOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if rs != nil {
+				t.Errorf("Expected no spans, got %v", rs)
+			}
+		})
+	}
+}
+
+func TestToOtlpSpanFromJaegerStatusAndKind(t *testing.T) {
+	tag := func(key, typ string, value any) jaegerKeyValue {
+		return jaegerKeyValue{Key: key, Type: typ, Value: value}
+	}
+	tests := []struct {
+		name       string
+		tags       []jaegerKeyValue
+		wantKind   otlptrace.Span_SpanKind
+		wantStatus *otlptrace.Status
+	}{
+		{"no tags", nil, otlptrace.Span_SPAN_KIND_INTERNAL, &otlptrace.Status{}},
+		{"server", []jaegerKeyValue{tag("span.kind", "string", "server")}, otlptrace.Span_SPAN_KIND_SERVER, &otlptrace.Status{}},
+		{"consumer", []jaegerKeyValue{tag("span.kind", "string", "consumer")}, otlptrace.Span_SPAN_KIND_CONSUMER, &otlptrace.Status{}},
+		{"ok", []jaegerKeyValue{tag("otel.status_code", "string", "OK")}, otlptrace.Span_SPAN_KIND_INTERNAL, &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_OK}},
+		{
+			"error with description",
+			[]jaegerKeyValue{tag("otel.status_code", "string", "ERROR"), tag("otel.status_description", "string", "boom")},
+			otlptrace.Span_SPAN_KIND_INTERNAL, &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR, Message: "boom"},
+		},
+		// the error tag is a bool, not the message
+		{"error tag", []jaegerKeyValue{tag("error", "bool", true)}, otlptrace.Span_SPAN_KIND_INTERNAL, &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR}},
+		{"error tag false", []jaegerKeyValue{tag("error", "bool", false)}, otlptrace.Span_SPAN_KIND_INTERNAL, &otlptrace.Status{}},
+		{
+			"status code over the error tag",
+			[]jaegerKeyValue{tag("error", "bool", true), tag("otel.status_code", "string", "OK")},
+			otlptrace.Span_SPAN_KIND_INTERNAL, &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_OK},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := toOtlpSpanFromJaeger(jaegerSpan{TraceID: "01", SpanID: "02", Tags: tt.tags})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Kind != tt.wantKind {
+				t.Errorf("Expected the kind %v, got %v", tt.wantKind, s.Kind)
+			}
+			assertProtoEqual(t, tt.wantStatus, s.Status)
+			// the reserved tags are not attributes
+			if len(s.Attributes) != 0 {
+				t.Errorf("Unexpected attributes %v", s.Attributes)
+			}
+		})
+	}
+}
+
+func TestToOtlpValueFromJaeger(t *testing.T) {
+	tests := []struct {
+		name string
+		kv   jaegerKeyValue
+		want *otlpcommon.AnyValue
+	}{
+		{"string", jaegerKeyValue{Type: "string", Value: "a"}, stringValue("a")},
+		{"bool", jaegerKeyValue{Type: "bool", Value: true}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: true}}},
+		{"int64", jaegerKeyValue{Type: "int64", Value: json.Number("-3")}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: -3}}},
+		{"float64", jaegerKeyValue{Type: "float64", Value: json.Number("1e-3")}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: 0.001}}},
+		{"binary", jaegerKeyValue{Type: "binary", Value: "aGk="}, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BytesValue{BytesValue: []byte("hi")}}},
+		// the values not matching their types are kept as strings
+		{"int64 not a number", jaegerKeyValue{Type: "int64", Value: "4"}, stringValue("4")},
+		{"int64 a double", jaegerKeyValue{Type: "int64", Value: json.Number("4.5")}, stringValue("4.5")},
+		{"bool not a bool", jaegerKeyValue{Type: "bool", Value: "true"}, stringValue("true")},
+		{"binary not base64", jaegerKeyValue{Type: "binary", Value: "!"}, stringValue("!")},
+		{"unknown type", jaegerKeyValue{Type: "uint64", Value: json.Number("7")}, stringValue("7")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertProtoEqual(t, tt.want, toOtlpValueFromJaeger(tt.kv))
+		})
+	}
+}
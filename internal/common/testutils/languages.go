@@ -0,0 +1,110 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The languageId values of the recipefile.json
+var languageIds = []string{"csharp", "js", "go", "java", "python"}
+
+func LanguageIds() []string {
+	return slices.Clone(languageIds)
+}
+
+// Applies the overrides of the language, declared under languages, to the spec document. Mappings
+// are merged key by key, while any other value, including lists such as spans, is replaced as a whole
+func applyLanguageOverrides(doc *yaml.Node, language string) error {
+	return applyOverrides(doc, "languages", "language", language, func(lang string) error {
+		if !slices.Contains(languageIds, lang) {
+			return fmt.Errorf("unknown language %q, expected one of %v", lang, languageIds)
+		}
+		return nil
+	})
+}
+
+// Merges the overrides declared under key for selected into the spec document, after checking each of the
+// declared values, e.g. the languageIds
+func applyOverrides(doc *yaml.Node, key, what, selected string, check func(string) error) error {
+	root := specRoot(doc)
+	all := mappingValue(root, key)
+	if all == nil {
+		return nil
+	}
+	if all.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s must map a %s to its overrides", key, what)
+	}
+	for i := 0; i < len(all.Content); i += 2 {
+		value, overrides := all.Content[i].Value, all.Content[i+1]
+		if err := check(value); err != nil {
+			return err
+		}
+		if overrides.Kind != yaml.MappingNode {
+			return fmt.Errorf("the overrides of %s %s must be a mapping", what, value)
+		}
+		if value == selected {
+			mergeNodes(root, overrides)
+		}
+	}
+	return nil
+}
+
+func specRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return doc
+}
+
+func mergeNodes(base, override *yaml.Node) {
+	for i := 0; i < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		if b := mappingValue(base, key.Value); b != nil && b.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			mergeNodes(b, value)
+			continue
+		}
+		replaced := false
+		for j := 0; j < len(base.Content); j += 2 {
+			if base.Content[j].Value == key.Value {
+				base.Content[j+1] = value
+				replaced = true
+			}
+		}
+		if !replaced {
+			base.Content = append(base.Content, key, value)
+		}
+	}
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; n.Kind == yaml.MappingNode && i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// The languageId of the recipe the expected telemetry file belongs to, read from the recipefile.json
+// in the folder of the file or its parent, i.e. the recipe folder of the test module. Empty if not found
+func recipeLanguage(specPath string) string {
+	dir := filepath.Dir(specPath)
+	for _, d := range []string{dir, filepath.Dir(dir)} {
+		data, err := os.ReadFile(filepath.Join(d, "recipefile.json"))
+		if err != nil {
+			continue
+		}
+		var recipe struct {
+			LanguageID string `json:"languageId"`
+		}
+		if json.Unmarshal(data, &recipe) == nil {
+			return recipe.LanguageID
+		}
+	}
+	return ""
+}
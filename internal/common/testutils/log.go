@@ -0,0 +1,72 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"flag"
+	"log/slog"
+	"strings"
+)
+
+var logLevel = flag.String("log-level", "info", "The minimum level of the harness logs. One of: debug, info, warn, error")
+var logFormat = flag.String("log-format", "text", "The format of the harness logs. One of: text, json, e.g. to parse them in CI")
+
+// Writes each record with t.Log, so the logs stay attached to the test in the go test output
+type testLogWriter struct {
+	t TestingT
+}
+
+func (w testLogWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// Returns the logger of the harness for t, configured by the -log-level and -log-format flags. The records
+// carry the name of the test and the attributes set with UseLogAttrs for t and its parent tests, e.g. the sample being validated
+func Logger(t TestingT) *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	if *logFormat == "json" {
+		h = slog.NewJSONHandler(testLogWriter{t}, opts)
+	} else {
+		// go test already tells the records apart by test, the time only adds noise
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		}
+		h = slog.NewTextHandler(testLogWriter{t}, opts)
+	}
+	return slog.New(h).With("test", t.Name()).With(logAttrs(t)...)
+}
+
+// Adds key/value attributes to the logs of t and its subtests, e.g. UseLogAttrs(t, "sample", path)
+func UseLogAttrs(t TestingT, args ...any) {
+	s := getOrCreateScope(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logAttrs = append(s.logAttrs, args...)
+}
+
+// The attributes of the scopes of t and its parent tests, the ones of the parents first
+func logAttrs(t TestingT) []any {
+	var res []any
+	name := t.Name()
+	for {
+		if s, found := scopes.Load(name); found {
+			sc := s.(*testScope)
+			sc.mu.Lock()
+			res = append(append([]any{}, sc.logAttrs...), res...)
+			sc.mu.Unlock()
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			return res
+		}
+		name = name[:i]
+	}
+}
@@ -0,0 +1,91 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"github.com/joaopgrassi/otel-recipes/internal/common/semconv"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// The attribute naming the event of a log record, see https://opentelemetry.io/docs/specs/semconv/general/events/
+const eventNameAttribute string = "event.name"
+
+// An event emitted via the Events API, or as a log record with an event.name attribute
+type LogEventTestCase struct {
+	serviceName string
+	name        string
+	attributes  []*otlpcommon.KeyValue
+	required    []string
+}
+
+func NewLogEventTestCase(serviceName, name string, attributes ...*otlpcommon.KeyValue) *LogEventTestCase {
+	return &LogEventTestCase{serviceName: serviceName, name: name, attributes: attributes}
+}
+
+// Expects the event to have the attributes, whatever their value, e.g. for custom events not in the
+// semantic conventions
+func (tc *LogEventTestCase) WithRequiredAttributes(keys ...string) *LogEventTestCase {
+	tc.required = append(tc.required, keys...)
+	return tc
+}
+
+// Asserts the service emitted a log record with the event.name of the test case and its attributes. The
+// attributes required for the event by the semantic conventions must be present, unless -semconv=off, while
+// the other violations are reported as for the spans. Returns the log record of the event
+func AssertLogEvent(t TestingT, tc *LogEventTestCase) *otlplogs.LogRecord {
+	var actual *otlplogs.LogRecord
+	var rl *otlplogs.ResourceLogs
+	found := Eventually(t, "Event "+tc.name, func() bool {
+		rl = GetLog(t, tc.serviceName)
+		actual = findEvent(rl, tc.name)
+		return actual != nil
+	})
+	if !found {
+		t.Fatalf("Could not find a log record with %s=%s. Events of %s: %v", eventNameAttribute, tc.name, tc.serviceName, eventNames(rl))
+	}
+
+	AssertAttributes(t, "event "+tc.name, actual.GetAttributes(), tc.attributes...)
+	for _, key := range tc.required {
+		if findAttribute(actual.GetAttributes(), key) == nil {
+			t.Errorf("Event %s has no attribute %s", tc.name, key)
+		}
+	}
+	validateEventConventions(t, tc.name, actual)
+	return actual
+}
+
+func validateEventConventions(t TestingT, name string, log *otlplogs.LogRecord) {
+	if *semconvMode == semconvOff {
+		return
+	}
+	for _, v := range getSemconvRegistry().ValidateEvent(name, log.GetAttributes()) {
+		if v.Severity == semconv.Error || *semconvMode == semconvStrict {
+			t.Errorf("Event %s does not follow the semantic conventions: %s", name, v)
+		} else {
+			Logger(t).Warn("Event does not follow the semantic conventions", "event", name, "violation", v)
+		}
+	}
+}
+
+func findEvent(rl *otlplogs.ResourceLogs, name string) *otlplogs.LogRecord {
+	for _, sl := range rl.GetScopeLogs() {
+		for _, l := range sl.GetLogRecords() {
+			if getStringAttribute(l.GetAttributes(), eventNameAttribute) == name {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// The names of the events among the log records, for the failure messages
+func eventNames(rl *otlplogs.ResourceLogs) []string {
+	var names []string
+	for _, sl := range rl.GetScopeLogs() {
+		for _, l := range sl.GetLogRecords() {
+			if name := getStringAttribute(l.GetAttributes(), eventNameAttribute); name != "" && !containsString(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
@@ -1,121 +1,194 @@
 package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
-	"io"
-	"net/http"
-	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
 	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
 	"google.golang.org/protobuf/proto"
 )
 
-func AssertLogWithAttributeExists(t *testing.T, tc *LogTestCase) {
-	backoffSchedule := []time.Duration{
-		1 * time.Second,
-		3 * time.Second,
-		10 * time.Second,
-		15 * time.Second,
-		20 * time.Second,
-		30 * time.Second,
+func AssertLogWithAttributeExists(t TestingT, tc *LogTestCase) {
+	var span *otlptrace.Span
+	if tc.span != nil {
+		span, _ = findSpanWithRetry(t, tc.span)
 	}
 
 	var actual *otlplogs.LogRecord
-	for _, backoff := range backoffSchedule {
-		logs := GetLogsWithRetry(t, tc.serviceName)
-		log := findLog(logs, tc.body)
-
-		if log != nil {
-			actual = log
-			break
-		}
-
-		t.Logf("Log not found yet, retrying in %v\n", backoff)
-		time.Sleep(backoff)
+	var rl *otlplogs.ResourceLogs
+	Eventually(t, "Log", func() bool {
+		rl = GetLog(t, tc.serviceName)
+		actual = findLog(rl, tc.body, span)
+		return actual != nil && (span == nil || isLogInSpan(actual, span))
+	})
+
+	if actual == nil {
+		t.Fatalf("Could not find log with body: %v. Logs of %s:\n%s", formatAnyValue(tc.body), tc.serviceName, logBodiesDiff(tc.body, rl))
 	}
 
 	// assert
 	assert.Equal(t, tc.severity, actual.GetSeverityText())
+	assertLogSeverity(t, actual)
+	if tc.severityNumber != "" {
+		AssertSeverityNumber(t, actual, tc.severityNumber)
+	}
 
 	if tc.withTrace {
 		assert.NotEmpty(t, actual.GetTraceId())
 		assert.NotEmpty(t, actual.GetSpanId())
 	}
 
-	for _, exp := range tc.attributes {
-		assert.Contains(t, actual.Attributes, exp)
+	AssertAttributes(t, fmt.Sprintf("log %v", formatAnyValue(tc.body)), actual.Attributes, tc.attributes...)
+
+	if span != nil {
+		AssertLogInSpan(t, actual, span)
+	}
+
+	assert.Equal(t, tc.serviceName, getServiceName(rl.GetResource()), "Unexpected service.name resource attribute of the logs")
+	AssertResourceAttributes(t, rl.GetResource(), tc.resourceAttributes...)
+	if tc.scopeName != "" {
+		AssertLogScope(t, rl, actual, tc.scopeName)
+	}
+}
+
+// Asserts the log record was produced by the instrumentation scope with the given name, see AssertSpanScope
+func AssertLogScope(t TestingT, rl *otlplogs.ResourceLogs, log *otlplogs.LogRecord, scopeName string) {
+	scope := findLogScope(rl, log)
+	if assert.NotNil(t, scope, "Could not find the instrumentation scope of log %v", formatAnyValue(log.GetBody())) {
+		assert.True(t, matchSpanName(scopeName, scope.GetName()),
+			"Unexpected instrumentation scope for log %v: expected %s, actual %s", formatAnyValue(log.GetBody()), scopeName, scope.GetName())
+	}
+}
+
+// Asserts the log records of the export have instrumentation scopes with a name, which the log bridges set
+// to the logger name or their own. A scope without a name hints at records emitted directly to the provider
+func AssertLogScopes(t TestingT, rl *otlplogs.ResourceLogs) {
+	for _, sl := range rl.GetScopeLogs() {
+		if sl.GetScope().GetName() == "" && len(sl.GetLogRecords()) > 0 {
+			assert.Fail(t, "Missing instrumentation scope", "%d log record(s) have an instrumentation scope without a name, e.g. %v",
+				len(sl.GetLogRecords()), formatAnyValue(sl.GetLogRecords()[0].GetBody()))
+		}
+	}
+}
+
+func findLogScope(rl *otlplogs.ResourceLogs, log *otlplogs.LogRecord) *otlpcommon.InstrumentationScope {
+	for _, sl := range rl.GetScopeLogs() {
+		for _, l := range sl.GetLogRecords() {
+			if l == log {
+				return sl.GetScope()
+			}
+		}
 	}
+	return nil
 }
 
-func findLog(logs *otlplogs.ResourceLogs, body string) *otlplogs.LogRecord {
-	for _, sl := range logs.ScopeLogs {
+// Asserts the log record was emitted within the span, i.e. the trace context was injected into the log
+func AssertLogInSpan(t TestingT, log *otlplogs.LogRecord, span *otlptrace.Span) {
+	assert.Equal(t, hex.EncodeToString(span.GetTraceId()), hex.EncodeToString(log.GetTraceId()), "trace id of log %q", log.GetBody().GetStringValue())
+	assert.Equal(t, hex.EncodeToString(span.GetSpanId()), hex.EncodeToString(log.GetSpanId()), "span id of log %q", log.GetBody().GetStringValue())
+}
+
+// Finds the log with the body, see logBodyMismatch. When a span is given, prefers the log emitted within it, so samples
+// logging the same message on each request are matched to the right one
+func findLog(logs *otlplogs.ResourceLogs, body *otlpcommon.AnyValue, span *otlptrace.Span) *otlplogs.LogRecord {
+	var res *otlplogs.LogRecord
+	for _, sl := range logs.GetScopeLogs() {
 		for _, l := range sl.LogRecords {
-			if l.Body.GetStringValue() == body {
+			if logBodyMismatch(body, l.GetBody(), "") != "" {
+				continue
+			}
+			if span == nil || isLogInSpan(l, span) {
 				return l
 			}
+			if res == nil {
+				res = l
+			}
 		}
 	}
-	return nil
+	return res
 }
 
-func GetLogsWithRetry(t *testing.T, serviceName string) *otlplogs.ResourceLogs {
-	backoffSchedule := []time.Duration{
-		1 * time.Second,
-		3 * time.Second,
-		10 * time.Second,
-		15 * time.Second,
-		20 * time.Second,
-		30 * time.Second,
+// Describes why the actual body does not match the expected one, or returns an empty string. The fields of
+// an expected map must be found in the actual one, with matching values, while the other fields are ignored
+func logBodyMismatch(exp, actual *otlpcommon.AnyValue, path string) string {
+	field := "body"
+	if path != "" {
+		field = "field " + path
+	}
+	if _, _, ok := valuePattern(exp); ok {
+		if !matchAttributeValue(exp, actual) {
+			return fmt.Sprintf("%s is %v, expected a value %s", field, formatAnyValue(actual), formatExpectedValue(exp))
+		}
+		return ""
 	}
+	if typ := AttributeTypeOf(exp); typ != AttributeTypeOf(actual) {
+		return fmt.Sprintf("%s is the %s %v, expected the %s %v", field, AttributeTypeOf(actual), formatAnyValue(actual), typ, formatAnyValue(exp))
+	}
+	switch val := exp.GetValue().(type) {
+	case *otlpcommon.AnyValue_KvlistValue:
+		fields := actual.GetKvlistValue().GetValues()
+		for _, kv := range val.KvlistValue.GetValues() {
+			key := kv.GetKey()
+			if path != "" {
+				key = path + "." + key
+			}
+			a := findAttribute(fields, kv.GetKey())
+			if a == nil {
+				return fmt.Sprintf("field %s not found", key)
+			}
+			if reason := logBodyMismatch(kv.GetValue(), a.GetValue(), key); reason != "" {
+				return reason
+			}
+		}
+		return ""
+	case *otlpcommon.AnyValue_ArrayValue:
+		values := actual.GetArrayValue().GetValues()
+		if len(values) != len(val.ArrayValue.GetValues()) {
+			return fmt.Sprintf("%s has %d elements, expected %d", field, len(values), len(val.ArrayValue.GetValues()))
+		}
+		for i, e := range val.ArrayValue.GetValues() {
+			if reason := logBodyMismatch(e, values[i], fmt.Sprintf("%s[%d]", path, i)); reason != "" {
+				return reason
+			}
+		}
+		return ""
+	}
+	if !proto.Equal(exp, actual) {
+		return fmt.Sprintf("%s is %v, expected %v", field, formatAnyValue(actual), formatAnyValue(exp))
+	}
+	return ""
+}
 
+func isLogInSpan(log *otlplogs.LogRecord, span *otlptrace.Span) bool {
+	return bytes.Equal(log.GetTraceId(), span.GetTraceId()) && bytes.Equal(log.GetSpanId(), span.GetSpanId())
+}
+
+func GetLogsWithRetry(t TestingT, serviceName string) *otlplogs.ResourceLogs {
 	var rl *otlplogs.ResourceLogs
 
 	// do some retries until we backend has it
-	for _, backoff := range backoffSchedule {
+	found := Eventually(t, "Log", func() bool {
 		rl = GetLog(t, serviceName)
+		return len(rl.GetScopeLogs()) > 0
+	})
 
-		if rl != nil {
-			break
-		}
-
-		t.Logf("Log not found yet, retrying in %v\n", backoff)
-		time.Sleep(backoff)
-	}
-
-	if len(rl.ScopeLogs) == 0 {
+	if !found {
 		t.Fatalf("Could not find logs for sample: %s", serviceName)
 	}
 
 	return rl
 }
 
-func GetLog(t *testing.T, serviceName string) *otlplogs.ResourceLogs {
-	t.Logf("Going to call OTLP backend to fetch logs for sample: %s", serviceName)
-	r, err := http.Get(fmt.Sprintf("%s/getotlp?signal=logs&servicename=%s", OtlpBackendUri, serviceName))
+func GetLog(t TestingT, serviceName string) *otlplogs.ResourceLogs {
+	Logger(t).Debug("Going to call the back-end to fetch logs", "backend", "logs", "service", serviceName)
+	rl, err := getLogsBackend(t).GetLogs(serviceName)
 	if err != nil {
-		t.Fatalf("Failed getting logs from OTLP backend: %v", err)
-	}
-
-	t.Log("Received 200 response from OTLP backend")
-
-	defer r.Body.Close()
-
-	body, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
-	if err != nil {
-		t.Fatalf("Error reading payload from OTLP backend: %v", err)
-	}
-
-	if len(body) == 0 {
+		checkBackendError(t, "logs", err)
 		return nil
 	}
-
-	rl := &otlplogs.ResourceLogs{}
-	err = proto.Unmarshal(body, rl)
-	if err != nil {
-		t.Fatalf("Error reading payload from OTLP backend: %v", err)
-	}
 	return rl
 }
@@ -0,0 +1,137 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// The attributes, or dimensions, of all the data points of a metric, e.g. for recipes configuring a View
+// that keeps only some attribute keys to bound the cardinality
+type MetricAttributesTestCase struct {
+	metricName    string
+	keys          []string
+	attributeSets [][]*otlpcommon.KeyValue
+	absent        []string
+	maxDataPoints int
+}
+
+func NewMetricAttributesTestCase(name string) *MetricAttributesTestCase {
+	return &MetricAttributesTestCase{metricName: name}
+}
+
+// Expects every data point to have exactly these attribute keys
+func (tc *MetricAttributesTestCase) WithKeys(keys ...string) *MetricAttributesTestCase {
+	tc.keys = keys
+	return tc
+}
+
+// Expects a data point with exactly these attributes, no more
+func (tc *MetricAttributesTestCase) WithAttributeSet(attributes ...*otlpcommon.KeyValue) *MetricAttributesTestCase {
+	tc.attributeSets = append(tc.attributeSets, attributes)
+	return tc
+}
+
+// Expects no data point to have these attribute keys, e.g. the high-cardinality ones dropped by a View
+func (tc *MetricAttributesTestCase) WithoutAttributes(keys ...string) *MetricAttributesTestCase {
+	tc.absent = append(tc.absent, keys...)
+	return tc
+}
+
+// Expects at most n data points, i.e. attribute sets, e.g. the cardinality limit of the SDK
+func (tc *MetricAttributesTestCase) WithMaxDataPoints(n int) *MetricAttributesTestCase {
+	tc.maxDataPoints = n
+	return tc
+}
+
+// Asserts the attributes of the data points of the metric. On failure it prints the attribute set of each
+// data point
+func AssertMetricAttributes(t TestingT, tc *MetricAttributesTestCase, actualMetrics []*otlpmetrics.Metric) {
+	m := findMetric(t, actualMetrics, tc.metricName)
+	sets := dataPointAttributes(m)
+	if len(sets) == 0 {
+		t.Fatalf("Metric %s has no data points", tc.metricName)
+	}
+
+	failed := false
+	fail := func(format string, args ...any) {
+		t.Helper()
+		failed = true
+		t.Errorf(format, args...)
+	}
+	if tc.keys != nil {
+		expected := slices.Clone(tc.keys)
+		sort.Strings(expected)
+		for _, attrs := range sets {
+			if keys := attributeKeys(attrs); !slices.Equal(keys, expected) {
+				fail("A data point of metric %s has the attribute keys [%s], expected [%s]", tc.metricName, strings.Join(keys, ", "), strings.Join(expected, ", "))
+			}
+		}
+	}
+	for _, key := range tc.absent {
+		for _, attrs := range sets {
+			if kv := findAttribute(attrs, key); kv != nil {
+				fail("A data point of metric %s has the attribute %s=%s, expected to be dropped", tc.metricName, key, formatAnyValue(kv.GetValue()))
+				break
+			}
+		}
+	}
+	for _, exp := range tc.attributeSets {
+		if !slices.ContainsFunc(sets, func(attrs []*otlpcommon.KeyValue) bool {
+			return len(attrs) == len(exp) && hasAttributes(attrs, exp)
+		}) {
+			fail("Metric %s has no data point with exactly the attributes {%s}", tc.metricName, attributesKey(exp))
+		}
+	}
+	if tc.maxDataPoints > 0 && len(sets) > tc.maxDataPoints {
+		fail("Metric %s has %d data points, expected at most %d", tc.metricName, len(sets), tc.maxDataPoints)
+	}
+
+	if failed {
+		lines := make([]string, 0, len(sets))
+		for _, attrs := range sets {
+			lines = append(lines, "{"+attributesKey(attrs)+"}")
+		}
+		t.Logf("Attributes of the data points of metric %s:\n%s", tc.metricName, strings.Join(lines, "\n"))
+	}
+}
+
+// The attributes of each data point of the metric, whatever its type
+func dataPointAttributes(m *otlpmetrics.Metric) [][]*otlpcommon.KeyValue {
+	var res [][]*otlpcommon.KeyValue
+	switch d := m.GetData().(type) {
+	case *otlpmetrics.Metric_Sum:
+		for _, dp := range d.Sum.GetDataPoints() {
+			res = append(res, dp.GetAttributes())
+		}
+	case *otlpmetrics.Metric_Gauge:
+		for _, dp := range d.Gauge.GetDataPoints() {
+			res = append(res, dp.GetAttributes())
+		}
+	case *otlpmetrics.Metric_Histogram:
+		for _, dp := range d.Histogram.GetDataPoints() {
+			res = append(res, dp.GetAttributes())
+		}
+	case *otlpmetrics.Metric_ExponentialHistogram:
+		for _, dp := range d.ExponentialHistogram.GetDataPoints() {
+			res = append(res, dp.GetAttributes())
+		}
+	case *otlpmetrics.Metric_Summary:
+		for _, dp := range d.Summary.GetDataPoints() {
+			res = append(res, dp.GetAttributes())
+		}
+	}
+	return res
+}
+
+func attributeKeys(attributes []*otlpcommon.KeyValue) []string {
+	keys := make([]string, 0, len(attributes))
+	for _, kv := range attributes {
+		keys = append(keys, kv.GetKey())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,24 +1,26 @@
 package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
 
 import (
-	"fmt"
-	"io"
-	"net/http"
-	"testing"
-	"time"
+	"slices"
 
 	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
 	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
-	"google.golang.org/protobuf/proto"
 )
 
-func AssertCounter[T Number](t *testing.T, tc *MetricTestCase[T], actualMetrics []*otlpmetrics.Metric) {
+// Tolerance used when comparing the floating point sums of the data points
+const sumDelta float64 = 1e-9
+
+// The explicit bucket boundaries of the SDKs when not configured via a View, see
+// https://opentelemetry.io/docs/specs/otel/metrics/sdk/#explicit-bucket-histogram-aggregation
+var DefaultHistogramBounds = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+func AssertCounter[T Number](t TestingT, tc *MetricTestCase[T], actualMetrics []*otlpmetrics.Metric) {
 	// find metric by name
 	m := findMetric(t, actualMetrics, tc.metricName)
 
 	// assert
-	assert.Equal(t, tc.description, m.GetDescription())
-	assert.Equal(t, tc.unit, m.GetUnit())
+	AssertMetricMetadata(t, m, tc.unit, tc.description)
 	s := m.GetData().(*otlpmetrics.Metric_Sum)
 	dp := s.Sum.DataPoints[0]
 
@@ -31,89 +33,336 @@ func AssertCounter[T Number](t *testing.T, tc *MetricTestCase[T], actualMetrics
 		t.Fatalf("invalid datapoint value type")
 	}
 
-	for _, exp := range tc.attributes {
-		assert.Contains(t, dp.Attributes, exp)
-	}
+	AssertAttributes(t, "the data point of metric "+tc.metricName, dp.Attributes, tc.attributes...)
 }
 
-func AssertGauge[T Number](t *testing.T, tc *MetricTestCase[T], actualMetrics []*otlpmetrics.Metric) {
+func AssertGauge[T Number](t TestingT, tc *MetricTestCase[T], actualMetrics []*otlpmetrics.Metric) {
 	// find metric by name
 	m := findMetric(t, actualMetrics, tc.metricName)
 
 	// assert
-	assert.Equal(t, tc.description, m.GetDescription())
-	assert.Equal(t, tc.unit, m.GetUnit())
+	AssertMetricMetadata(t, m, tc.unit, tc.description)
 	g := m.GetData().(*otlpmetrics.Metric_Gauge)
 	dp := g.Gauge.DataPoints[0]
 	assert.Equal(t, tc.value, dp.GetAsDouble())
 
-	for _, exp := range tc.attributes {
-		assert.Contains(t, dp.Attributes, exp)
+	AssertAttributes(t, "the data point of metric "+tc.metricName, dp.Attributes, tc.attributes...)
+}
+
+// Asserts the counter is monotonic and its value is at least the one of the test case. Useful for
+// counters incremented on each request, whose exact value depends on how often the sample was called
+func AssertCounterAtLeast[T Number](t TestingT, tc *MetricTestCase[T], actualMetrics []*otlpmetrics.Metric) {
+	m := findMetric(t, actualMetrics, tc.metricName)
+
+	AssertMetricMetadata(t, m, tc.unit, tc.description)
+	s, ok := m.GetData().(*otlpmetrics.Metric_Sum)
+	if !ok {
+		t.Fatalf("Metric %s is not a counter", tc.metricName)
+	}
+	assert.True(t, s.Sum.GetIsMonotonic(), "Counter %s is not monotonic", tc.metricName)
+
+	dp := findNumberDataPoint(t, tc.metricName, s.Sum.GetDataPoints(), tc.attributes)
+	switch v := any(tc.value).(type) {
+	case int:
+		assert.GreaterOrEqual(t, dp.GetAsInt(), int64(v))
+	case int64:
+		assert.GreaterOrEqual(t, dp.GetAsInt(), v)
+	case float64:
+		assert.GreaterOrEqual(t, dp.GetAsDouble(), v)
 	}
 }
 
-func findMetric(t *testing.T, metrics []*otlpmetrics.Metric, name string) *otlpmetrics.Metric {
-	for _, m := range metrics {
-		if m.GetName() == name {
-			return m
+// Asserts the value of the last-value gauge is within the range of the test case, e.g. for a gauge of the
+// memory in use. The gauge must have a single data point per attribute set
+func AssertGaugeInRange[T Number](t TestingT, tc *MetricRangeTestCase[T], actualMetrics []*otlpmetrics.Metric) {
+	m := findMetric(t, actualMetrics, tc.metricName)
+
+	AssertMetricMetadata(t, m, tc.unit, tc.description)
+	g, ok := m.GetData().(*otlpmetrics.Metric_Gauge)
+	if !ok {
+		t.Fatalf("Metric %s is not a gauge", tc.metricName)
+	}
+	assertSingleDataPoints(t, tc.metricName, g.Gauge.GetDataPoints())
+
+	dp := findNumberDataPoint(t, tc.metricName, g.Gauge.GetDataPoints(), tc.attributes)
+	assertNumberInRange(t, tc.metricName, dp, float64(tc.min), float64(tc.max))
+}
+
+// Asserts the value of the UpDownCounter, a non-monotonic sum, is the one of the test case
+func AssertUpDownCounter[T Number](t TestingT, tc *MetricTestCase[T], actualMetrics []*otlpmetrics.Metric) {
+	dp := findUpDownCounterDataPoint(t, tc.metricName, tc.description, tc.unit, tc.attributes, actualMetrics)
+	assertNumberInRange(t, tc.metricName, dp, float64(tc.value), float64(tc.value))
+}
+
+// Asserts the value of the UpDownCounter is within the range of the test case, e.g. for the number of
+// active requests, which goes up and down with the load
+func AssertUpDownCounterInRange[T Number](t TestingT, tc *MetricRangeTestCase[T], actualMetrics []*otlpmetrics.Metric) {
+	dp := findUpDownCounterDataPoint(t, tc.metricName, tc.description, tc.unit, tc.attributes, actualMetrics)
+	assertNumberInRange(t, tc.metricName, dp, float64(tc.min), float64(tc.max))
+}
+
+// Finds the data point of the non-monotonic sum, which must have a single data point per attribute set
+func findUpDownCounterDataPoint(t TestingT, name, description, unit string, attributes []*otlpcommon.KeyValue, actualMetrics []*otlpmetrics.Metric) *otlpmetrics.NumberDataPoint {
+	m := findMetric(t, actualMetrics, name)
+
+	AssertMetricMetadata(t, m, unit, description)
+	s, ok := m.GetData().(*otlpmetrics.Metric_Sum)
+	if !ok {
+		t.Fatalf("Metric %s is not an UpDownCounter", name)
+	}
+	assert.False(t, s.Sum.GetIsMonotonic(), "UpDownCounter %s is monotonic, is it a Counter?", name)
+	assertSingleDataPoints(t, name, s.Sum.GetDataPoints())
+	return findNumberDataPoint(t, name, s.Sum.GetDataPoints(), attributes)
+}
+
+// Asserts there is a single data point per attribute set, i.e. the values of an export were aggregated
+func assertSingleDataPoints(t TestingT, name string, dps []*otlpmetrics.NumberDataPoint) {
+	seen := make(map[string]bool)
+	for _, dp := range dps {
+		key := attributesKey(dp.GetAttributes())
+		if seen[key] {
+			t.Errorf("Metric %s has several data points with the attributes {%s}", name, key)
 		}
+		seen[key] = true
 	}
-	t.Fatalf("Could not find metric with name: %s", name)
-	return nil
 }
 
-func GetMetricsWithRetry(t *testing.T, serviceName string) *otlpmetrics.ResourceMetrics {
-	backoffSchedule := []time.Duration{
-		1 * time.Second,
-		3 * time.Second,
-		10 * time.Second,
-		15 * time.Second,
-		20 * time.Second,
-		30 * time.Second,
+func assertNumberInRange(t TestingT, name string, dp *otlpmetrics.NumberDataPoint, min, max float64) {
+	v := numberValue(dp)
+	switch {
+	case min == max && v != min:
+		t.Errorf("Metric %s has the value %v, expected %v", name, v, min)
+	case v < min || v > max:
+		t.Errorf("Metric %s has the value %v, expected between %v and %v", name, v, min, max)
 	}
+}
 
-	var rm *otlpmetrics.ResourceMetrics
+// Asserts the count, the sum and the bucket counts of the histogram data point with the
+// attributes of the test case
+func AssertHistogram(t TestingT, tc *HistogramTestCase, actualMetrics []*otlpmetrics.Metric) {
+	m := findMetric(t, actualMetrics, tc.metricName)
 
-	// do some retries until we backend has it
-	for _, backoff := range backoffSchedule {
-		rm = GetMetric(t, serviceName)
+	AssertMetricMetadata(t, m, tc.unit, tc.description)
+	h := getHistogram(t, m)
+
+	dp := findHistogramDataPoint(t, tc.metricName, h.GetDataPoints(), tc.attributes)
+
+	if tc.count != nil {
+		assert.Equal(t, *tc.count, dp.GetCount(), "count of histogram %s", tc.metricName)
+	}
+	if tc.sum != nil {
+		assert.InDelta(t, *tc.sum, dp.GetSum(), sumDelta, "sum of histogram %s", tc.metricName)
+	}
+	if tc.bounds != nil {
+		assertExplicitBounds(t, tc.metricName, tc.bounds, dp)
+	}
+	if tc.bucketCounts != nil {
+		assert.Equal(t, tc.bucketCounts, dp.GetBucketCounts(), "bucket counts of histogram %s", tc.metricName)
+	}
+}
 
-		if rm != nil {
+// Asserts the data point was aggregated with the bounds, and has a count per bucket they define
+func assertExplicitBounds(t TestingT, name string, bounds []float64, dp *otlpmetrics.HistogramDataPoint) {
+	actual := dp.GetExplicitBounds()
+	if !slices.Equal(bounds, actual) {
+		hint := ""
+		if slices.Equal(actual, DefaultHistogramBounds) && !slices.Equal(bounds, DefaultHistogramBounds) {
+			hint = ". These are the default boundaries of the SDK, is the View of the histogram registered?"
+		}
+		t.Errorf("Histogram %s has the bucket boundaries %v, expected %v%s", name, actual, bounds, hint)
+		return
+	}
+	if len(dp.GetBucketCounts()) != len(actual)+1 {
+		t.Errorf("Histogram %s has %d bucket counts for %d boundaries, expected %d", name, len(dp.GetBucketCounts()), len(actual), len(actual)+1)
+	}
+}
+
+// Asserts the scale, the zero count and the buckets of the exponential histogram data point with the
+// attributes of the test case, and that the count is the total of its buckets
+func AssertExponentialHistogram(t TestingT, tc *ExponentialHistogramTestCase, actualMetrics []*otlpmetrics.Metric) {
+	m := findMetric(t, actualMetrics, tc.metricName)
+
+	AssertMetricMetadata(t, m, tc.unit, tc.description)
+	h, ok := m.GetData().(*otlpmetrics.Metric_ExponentialHistogram)
+	if !ok {
+		t.Fatalf("Metric %s is not an exponential histogram", m.GetName())
+	}
+
+	var dp *otlpmetrics.ExponentialHistogramDataPoint
+	for _, d := range h.ExponentialHistogram.GetDataPoints() {
+		if hasAttributes(d.GetAttributes(), tc.attributes) {
+			dp = d
 			break
 		}
+	}
+	if dp == nil {
+		t.Fatalf("Could not find a data point of exponential histogram %s with attributes %v", tc.metricName, tc.attributes)
+	}
+
+	if tc.count != nil {
+		assert.Equal(t, *tc.count, dp.GetCount(), "count of exponential histogram %s", tc.metricName)
+	}
+	if tc.sum != nil {
+		assert.InDelta(t, *tc.sum, dp.GetSum(), sumDelta, "sum of exponential histogram %s", tc.metricName)
+	}
+	if tc.scale != nil {
+		assert.Equal(t, *tc.scale, dp.GetScale(), "scale of exponential histogram %s", tc.metricName)
+	}
+	if tc.maxScale != nil {
+		assert.LessOrEqual(t, dp.GetScale(), *tc.maxScale, "scale of exponential histogram %s", tc.metricName)
+	}
+	if tc.zeroCount != nil {
+		assert.Equal(t, *tc.zeroCount, dp.GetZeroCount(), "zero count of exponential histogram %s", tc.metricName)
+	}
+	if tc.positive != nil {
+		assertExponentialBuckets(t, tc.metricName, "positive", *tc.positive, dp.GetPositive())
+	}
+	if tc.negative != nil {
+		assertExponentialBuckets(t, tc.metricName, "negative", *tc.negative, dp.GetNegative())
+	}
+
+	total := dp.GetZeroCount()
+	for _, b := range []*otlpmetrics.ExponentialHistogramDataPoint_Buckets{dp.GetPositive(), dp.GetNegative()} {
+		for _, c := range b.GetBucketCounts() {
+			total += c
+		}
+	}
+	assert.Equal(t, dp.GetCount(), total, "count of exponential histogram %s, the total of the zero count and of the buckets", tc.metricName)
+}
 
-		t.Logf("Metrics not found yet, retrying in %v\n", backoff)
-		time.Sleep(backoff)
+// Compares the buckets without their empty leading and trailing buckets, which don't change the values they
+// hold but depend on the SDK
+func assertExponentialBuckets(t TestingT, name, side string, expected ExponentialBuckets, actual *otlpmetrics.ExponentialHistogramDataPoint_Buckets) {
+	exp := trimExponentialBuckets(expected)
+	act := trimExponentialBuckets(ExponentialBuckets{Offset: actual.GetOffset(), Counts: actual.GetBucketCounts()})
+	assert.Equal(t, exp, act, "%s buckets of exponential histogram %s", side, name)
+}
+
+func trimExponentialBuckets(b ExponentialBuckets) ExponentialBuckets {
+	counts := b.Counts
+	offset := b.Offset
+	for len(counts) > 0 && counts[0] == 0 {
+		counts = counts[1:]
+		offset++
+	}
+	for len(counts) > 0 && counts[len(counts)-1] == 0 {
+		counts = counts[:len(counts)-1]
+	}
+	if len(counts) == 0 {
+		return ExponentialBuckets{}
 	}
+	return ExponentialBuckets{Offset: offset, Counts: counts}
+}
 
-	return rm
+// Asserts the histogram data point with the attributes of the test case carries exemplars, and that
+// the spans they were recorded in are found in the traces of serviceName, i.e. the metric can be
+// correlated with the traces
+func AssertHistogramExemplars(t TestingT, serviceName string, tc *HistogramTestCase, actualMetrics []*otlpmetrics.Metric) {
+	h := getHistogram(t, findMetric(t, actualMetrics, tc.metricName))
+	dp := findHistogramDataPoint(t, tc.metricName, h.GetDataPoints(), tc.attributes)
+
+	var exemplars []*otlpmetrics.Exemplar
+	for _, e := range dp.GetExemplars() {
+		if len(e.GetSpanId()) > 0 {
+			exemplars = append(exemplars, e)
+		}
+	}
+	if len(exemplars) == 0 {
+		t.Fatalf("Histogram %s has no exemplars with a trace context", tc.metricName)
+	}
+
+	// the spans can reach the back-end after the metrics, e.g. when exported in batches
+	var missing []*otlpmetrics.Exemplar
+	found := Eventually(t, "Exemplar spans", func() bool {
+		rs := GetTrace(t, serviceName)
+		missing = missing[:0]
+		for _, e := range exemplars {
+			if findSpanByID(rs, e.GetTraceId(), e.GetSpanId()) == nil {
+				missing = append(missing, e)
+			}
+		}
+		return len(missing) == 0
+	})
+	if !found {
+		for _, e := range missing {
+			t.Errorf("Span %x of trace %x referenced by an exemplar of %s not found", e.GetSpanId(), e.GetTraceId(), tc.metricName)
+		}
+	}
 }
 
-func GetMetric(t *testing.T, serviceName string) *otlpmetrics.ResourceMetrics {
-	t.Logf("Going to call OTLP backend to fetch metrics for sample: %s", serviceName)
-	r, err := http.Get(fmt.Sprintf("%s/getotlp?signal=metrics&servicename=%s", OtlpBackendUri, serviceName))
-	if err != nil {
-		t.Fatalf("Failed getting trace from OTLP backend: %v", err)
+// Asserts the sum or histogram metric uses the expected aggregation temporality, e.g. for samples
+// configuring their exporter with a delta temporality preference
+func AssertTemporality(t TestingT, m *otlpmetrics.Metric, expected otlpmetrics.AggregationTemporality) {
+	var actual otlpmetrics.AggregationTemporality
+	switch d := m.GetData().(type) {
+	case *otlpmetrics.Metric_Sum:
+		actual = d.Sum.GetAggregationTemporality()
+	case *otlpmetrics.Metric_Histogram:
+		actual = d.Histogram.GetAggregationTemporality()
+	case *otlpmetrics.Metric_ExponentialHistogram:
+		actual = d.ExponentialHistogram.GetAggregationTemporality()
+	default:
+		t.Fatalf("Metric %s has no aggregation temporality", m.GetName())
 	}
+	assert.Equal(t, expected, actual, "aggregation temporality of metric %s", m.GetName())
+}
 
-	t.Log("Received 200 response from OTLP backend")
+func getHistogram(t TestingT, m *otlpmetrics.Metric) *otlpmetrics.Histogram {
+	h, ok := m.GetData().(*otlpmetrics.Metric_Histogram)
+	if !ok {
+		t.Fatalf("Metric %s is not a histogram", m.GetName())
+	}
+	return h.Histogram
+}
 
-	defer r.Body.Close()
+func findHistogramDataPoint(t TestingT, name string, dps []*otlpmetrics.HistogramDataPoint, attributes []*otlpcommon.KeyValue) *otlpmetrics.HistogramDataPoint {
+	for _, dp := range dps {
+		if hasAttributes(dp.GetAttributes(), attributes) {
+			return dp
+		}
+	}
+	t.Fatalf("Could not find a data point of histogram %s with attributes %v", name, attributes)
+	return nil
+}
 
-	body, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
-	if err != nil {
-		t.Fatalf("Error reading payload from OTLP backend: %v", err)
+func findNumberDataPoint(t TestingT, name string, dps []*otlpmetrics.NumberDataPoint, attributes []*otlpcommon.KeyValue) *otlpmetrics.NumberDataPoint {
+	for _, dp := range dps {
+		if hasAttributes(dp.GetAttributes(), attributes) {
+			return dp
+		}
 	}
+	t.Fatalf("Could not find a data point of metric %s with attributes %v", name, attributes)
+	return nil
+}
 
-	if len(body) == 0 {
-		return nil
+func findMetric(t TestingT, metrics []*otlpmetrics.Metric, name string) *otlpmetrics.Metric {
+	for _, m := range metrics {
+		if m.GetName() == name {
+			return m
+		}
 	}
+	t.Fatalf("Could not find metric with name: %s", name)
+	return nil
+}
 
-	rm := &otlpmetrics.ResourceMetrics{}
-	err = proto.Unmarshal(body, rm)
+func GetMetricsWithRetry(t TestingT, serviceName string) *otlpmetrics.ResourceMetrics {
+	var rm *otlpmetrics.ResourceMetrics
+
+	// do some retries until we backend has it
+	Eventually(t, "Metrics", func() bool {
+		rm = GetMetric(t, serviceName)
+		return rm != nil
+	})
+
+	return rm
+}
+
+func GetMetric(t TestingT, serviceName string) *otlpmetrics.ResourceMetrics {
+	Logger(t).Debug("Going to call the back-end to fetch metrics", "backend", "metrics", "service", serviceName)
+	rm, err := getMetricsBackend(t).GetMetrics(serviceName)
 	if err != nil {
-		t.Fatalf("Error reading metrics payload from OTLP backend: %v", err)
+		checkBackendError(t, "metrics", err)
+		return nil
 	}
 	return rm
 }
@@ -0,0 +1,367 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// How telemetry is normalized before it is compared, so two exports of the same telemetry compare equal
+// regardless of the order the back-end returned it in. The scopes, spans, metrics, data points, logs and
+// attributes are always sorted, by their names and attributes rather than their ids or timestamps
+type Normalization struct {
+	// Replaces the trace and span ids with ids following the sorted order of the spans, keeping the
+	// parents and links between the spans of the telemetry
+	StripIDs bool
+	// Clears the timestamps. The spans then start at 0 and end after their canonical duration
+	StripTimestamps bool
+	// The canonical duration of a span is its duration rounded to the resolution, e.g. 100ms. Zero drops
+	// the durations too. Only used with StripTimestamps
+	DurationResolution time.Duration
+	// Attributes removed from the resources, spans, events, links, data points and logs. Keys ending with a
+	// dot are prefixes, e.g. process. for process.pid
+	DropAttributes []string
+}
+
+// What the golden files are compared with
+var goldenNormalization = Normalization{StripIDs: true, StripTimestamps: true, DropAttributes: volatileAttributes}
+
+// Returns a normalized copy of the spans
+func (n Normalization) Traces(rs *otlptrace.ResourceSpans) *otlptrace.ResourceSpans {
+	if rs == nil {
+		return nil
+	}
+	rs = proto.Clone(rs).(*otlptrace.ResourceSpans)
+	n.normalizeResource(rs.GetResource())
+
+	keys := make(map[*otlptrace.Span]string)
+	var traceIds [][]byte
+	traceKeys := make(map[string][]string)
+	for _, ss := range rs.GetScopeSpans() {
+		for _, s := range ss.GetSpans() {
+			s.Attributes = n.attributes(s.GetAttributes())
+			for _, e := range s.GetEvents() {
+				e.Attributes = n.attributes(e.GetAttributes())
+				if n.StripTimestamps {
+					e.TimeUnixNano = 0
+				}
+			}
+			for _, l := range s.GetLinks() {
+				l.Attributes = n.attributes(l.GetAttributes())
+			}
+			if n.StripTimestamps {
+				s.StartTimeUnixNano, s.EndTimeUnixNano = 0, n.canonicalDuration(s)
+			}
+			keys[s] = spanKey(s)
+			if _, found := traceKeys[string(s.TraceId)]; !found {
+				traceIds = append(traceIds, s.TraceId)
+			}
+			traceKeys[string(s.TraceId)] = append(traceKeys[string(s.TraceId)], keys[s])
+		}
+	}
+
+	// the traces are ordered by their spans, so the same traces are in the same order on each run
+	sort.SliceStable(traceIds, func(i, j int) bool {
+		return traceKey(traceKeys[string(traceIds[i])]) < traceKey(traceKeys[string(traceIds[j])])
+	})
+	traceRank := make(map[string]int, len(traceIds))
+	for i, id := range traceIds {
+		traceRank[string(id)] = i
+	}
+
+	sort.SliceStable(rs.ScopeSpans, func(i, j int) bool {
+		return scopeKey(rs.ScopeSpans[i].GetScope()) < scopeKey(rs.ScopeSpans[j].GetScope())
+	})
+	for _, ss := range rs.GetScopeSpans() {
+		sort.SliceStable(ss.Spans, func(i, j int) bool {
+			a, b := ss.Spans[i], ss.Spans[j]
+			if ra, rb := traceRank[string(a.TraceId)], traceRank[string(b.TraceId)]; ra != rb {
+				return ra < rb
+			}
+			return keys[a] < keys[b]
+		})
+	}
+
+	if n.StripIDs {
+		n.replaceSpanIds(rs, traceRank)
+	}
+	return rs
+}
+
+// Assigns the ids in the order of the traces and of the spans of each trace. Ids of spans not in the
+// telemetry, e.g. remote parents, get ids after the ones of the spans
+func (n Normalization) replaceSpanIds(rs *otlptrace.ResourceSpans, traceRank map[string]int) {
+	var spans []*otlptrace.Span
+	for _, ss := range rs.GetScopeSpans() {
+		spans = append(spans, ss.GetSpans()...)
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return traceRank[string(spans[i].TraceId)] < traceRank[string(spans[j].TraceId)]
+	})
+
+	traces := newIdMap(16)
+	ids := newIdMap(8)
+	for _, s := range spans {
+		ids.get(s.SpanId)
+	}
+	for _, s := range spans {
+		for _, l := range s.GetLinks() {
+			l.TraceId, l.SpanId = traces.get(l.TraceId), ids.get(l.SpanId)
+		}
+		s.TraceId, s.SpanId, s.ParentSpanId = traces.get(s.TraceId), ids.get(s.SpanId), ids.get(s.ParentSpanId)
+	}
+}
+
+// Returns a normalized copy of the metrics. The values of the data points are kept
+func (n Normalization) Metrics(rm *otlpmetrics.ResourceMetrics) *otlpmetrics.ResourceMetrics {
+	if rm == nil {
+		return nil
+	}
+	rm = proto.Clone(rm).(*otlpmetrics.ResourceMetrics)
+	n.normalizeResource(rm.GetResource())
+
+	sort.SliceStable(rm.ScopeMetrics, func(i, j int) bool {
+		return scopeKey(rm.ScopeMetrics[i].GetScope()) < scopeKey(rm.ScopeMetrics[j].GetScope())
+	})
+	for _, sm := range rm.GetScopeMetrics() {
+		sort.SliceStable(sm.Metrics, func(i, j int) bool { return sm.Metrics[i].GetName() < sm.Metrics[j].GetName() })
+		for _, m := range sm.GetMetrics() {
+			n.normalizeDataPoints(m)
+		}
+	}
+	return rm
+}
+
+func (n Normalization) normalizeDataPoints(m *otlpmetrics.Metric) {
+	exemplars := func(es []*otlpmetrics.Exemplar) {
+		for _, e := range es {
+			e.FilteredAttributes = n.attributes(e.GetFilteredAttributes())
+			if n.StripTimestamps {
+				e.TimeUnixNano = 0
+			}
+			if n.StripIDs {
+				e.TraceId, e.SpanId = nil, nil
+			}
+		}
+	}
+	byAttributes := func(len int, attrs func(i int) []*otlpcommon.KeyValue, swap func(i, j int)) {
+		sort.Sort(dataPoints{len, func(i, j int) bool { return attributesKey(attrs(i)) < attributesKey(attrs(j)) }, swap})
+	}
+
+	switch d := m.GetData().(type) {
+	case *otlpmetrics.Metric_Sum:
+		for _, dp := range d.Sum.GetDataPoints() {
+			dp.Attributes = n.attributes(dp.GetAttributes())
+			n.stripTimes(&dp.StartTimeUnixNano, &dp.TimeUnixNano)
+			exemplars(dp.GetExemplars())
+		}
+		dps := d.Sum.DataPoints
+		byAttributes(len(dps), func(i int) []*otlpcommon.KeyValue { return dps[i].Attributes }, func(i, j int) { dps[i], dps[j] = dps[j], dps[i] })
+	case *otlpmetrics.Metric_Gauge:
+		for _, dp := range d.Gauge.GetDataPoints() {
+			dp.Attributes = n.attributes(dp.GetAttributes())
+			n.stripTimes(&dp.StartTimeUnixNano, &dp.TimeUnixNano)
+			exemplars(dp.GetExemplars())
+		}
+		dps := d.Gauge.DataPoints
+		byAttributes(len(dps), func(i int) []*otlpcommon.KeyValue { return dps[i].Attributes }, func(i, j int) { dps[i], dps[j] = dps[j], dps[i] })
+	case *otlpmetrics.Metric_Histogram:
+		for _, dp := range d.Histogram.GetDataPoints() {
+			dp.Attributes = n.attributes(dp.GetAttributes())
+			n.stripTimes(&dp.StartTimeUnixNano, &dp.TimeUnixNano)
+			exemplars(dp.GetExemplars())
+		}
+		dps := d.Histogram.DataPoints
+		byAttributes(len(dps), func(i int) []*otlpcommon.KeyValue { return dps[i].Attributes }, func(i, j int) { dps[i], dps[j] = dps[j], dps[i] })
+	case *otlpmetrics.Metric_ExponentialHistogram:
+		for _, dp := range d.ExponentialHistogram.GetDataPoints() {
+			dp.Attributes = n.attributes(dp.GetAttributes())
+			n.stripTimes(&dp.StartTimeUnixNano, &dp.TimeUnixNano)
+			exemplars(dp.GetExemplars())
+		}
+		dps := d.ExponentialHistogram.DataPoints
+		byAttributes(len(dps), func(i int) []*otlpcommon.KeyValue { return dps[i].Attributes }, func(i, j int) { dps[i], dps[j] = dps[j], dps[i] })
+	case *otlpmetrics.Metric_Summary:
+		for _, dp := range d.Summary.GetDataPoints() {
+			dp.Attributes = n.attributes(dp.GetAttributes())
+			n.stripTimes(&dp.StartTimeUnixNano, &dp.TimeUnixNano)
+		}
+		dps := d.Summary.DataPoints
+		byAttributes(len(dps), func(i int) []*otlpcommon.KeyValue { return dps[i].Attributes }, func(i, j int) { dps[i], dps[j] = dps[j], dps[i] })
+	}
+}
+
+// Returns a normalized copy of the logs. With StripIDs, the trace and span ids of the logs are replaced
+// in the sorted order of the logs, so logs of the same span still share their ids
+func (n Normalization) Logs(rl *otlplogs.ResourceLogs) *otlplogs.ResourceLogs {
+	if rl == nil {
+		return nil
+	}
+	rl = proto.Clone(rl).(*otlplogs.ResourceLogs)
+	n.normalizeResource(rl.GetResource())
+
+	sort.SliceStable(rl.ScopeLogs, func(i, j int) bool {
+		return scopeKey(rl.ScopeLogs[i].GetScope()) < scopeKey(rl.ScopeLogs[j].GetScope())
+	})
+	traces, ids := newIdMap(16), newIdMap(8)
+	for _, sl := range rl.GetScopeLogs() {
+		for _, l := range sl.GetLogRecords() {
+			l.Attributes = n.attributes(l.GetAttributes())
+			n.stripTimes(&l.TimeUnixNano, &l.ObservedTimeUnixNano)
+		}
+		sort.SliceStable(sl.LogRecords, func(i, j int) bool { return logKey(sl.LogRecords[i]) < logKey(sl.LogRecords[j]) })
+		if n.StripIDs {
+			for _, l := range sl.GetLogRecords() {
+				l.TraceId, l.SpanId = traces.get(l.TraceId), ids.get(l.SpanId)
+			}
+		}
+	}
+	return rl
+}
+
+func (n Normalization) normalizeResource(r *otlpresource.Resource) {
+	if r != nil {
+		r.Attributes = n.attributes(r.GetAttributes())
+	}
+}
+
+func (n Normalization) stripTimes(times ...*uint64) {
+	if !n.StripTimestamps {
+		return
+	}
+	for _, t := range times {
+		*t = 0
+	}
+}
+
+func (n Normalization) canonicalDuration(s *otlptrace.Span) uint64 {
+	if n.DurationResolution <= 0 || s.EndTimeUnixNano < s.StartTimeUnixNano {
+		return 0
+	}
+	d := time.Duration(s.EndTimeUnixNano - s.StartTimeUnixNano)
+	return uint64(d.Round(n.DurationResolution))
+}
+
+// The attributes without the dropped ones, sorted by key. Nested maps are sorted too
+func (n Normalization) attributes(attributes []*otlpcommon.KeyValue) []*otlpcommon.KeyValue {
+	res := attributes[:0]
+	for _, kv := range attributes {
+		if matchAttributeKey(n.DropAttributes, kv.GetKey()) {
+			continue
+		}
+		sortKvlists(kv.GetValue())
+		res = append(res, kv)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].GetKey() < res[j].GetKey() })
+	return res
+}
+
+func sortKvlists(v *otlpcommon.AnyValue) {
+	switch val := v.GetValue().(type) {
+	case *otlpcommon.AnyValue_KvlistValue:
+		values := val.KvlistValue.GetValues()
+		for _, kv := range values {
+			sortKvlists(kv.GetValue())
+		}
+		sort.SliceStable(values, func(i, j int) bool { return values[i].GetKey() < values[j].GetKey() })
+	case *otlpcommon.AnyValue_ArrayValue:
+		for _, e := range val.ArrayValue.GetValues() {
+			sortKvlists(e)
+		}
+	}
+}
+
+// Whether the key is one of the keys, or starts with one of them ending with a dot
+func matchAttributeKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if key == k || (strings.HasSuffix(k, ".") && strings.HasPrefix(key, k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the ids with sequential ones, in the order they are first seen. Empty ids stay empty
+type idMap struct {
+	size int
+	ids  map[string][]byte
+}
+
+func newIdMap(size int) *idMap {
+	return &idMap{size: size, ids: make(map[string][]byte)}
+}
+
+func (m *idMap) get(id []byte) []byte {
+	if len(id) == 0 {
+		return id
+	}
+	if res, found := m.ids[string(id)]; found {
+		return res
+	}
+	res := make([]byte, m.size)
+	binary.BigEndian.PutUint64(res[m.size-8:], uint64(len(m.ids)+1))
+	m.ids[string(id)] = res
+	return res
+}
+
+// Sorts data points of any type via their accessors
+type dataPoints struct {
+	n    int
+	less func(i, j int) bool
+	swap func(i, j int)
+}
+
+func (d dataPoints) Len() int           { return d.n }
+func (d dataPoints) Less(i, j int) bool { return d.less(i, j) }
+func (d dataPoints) Swap(i, j int)      { d.swap(i, j) }
+
+// Sort keys not depending on the ids, and on the timestamps only once they are stripped
+func spanKey(s *otlptrace.Span) string {
+	var b strings.Builder
+	b.WriteString(s.GetName())
+	b.WriteString("\x00" + s.GetKind().String())
+	b.WriteString("\x00" + attributesKey(s.GetAttributes()))
+	for _, e := range s.GetEvents() {
+		b.WriteString("\x00" + e.GetName() + attributesKey(e.GetAttributes()))
+	}
+	b.WriteString("\x00" + s.GetStatus().GetCode().String())
+	fmt.Fprintf(&b, "\x00%020d", s.StartTimeUnixNano)
+	return b.String()
+}
+
+func traceKey(spanKeys []string) string {
+	sorted := append([]string(nil), spanKeys...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, "\x01")
+}
+
+func scopeKey(s *otlpcommon.InstrumentationScope) string {
+	return s.GetName() + "\x00" + s.GetVersion()
+}
+
+func logKey(l *otlplogs.LogRecord) string {
+	var b strings.Builder
+	b.WriteString(l.GetSeverityText())
+	b.WriteString("\x00" + goldenValue(l.GetBody()))
+	b.WriteString("\x00" + attributesKey(l.GetAttributes()))
+	fmt.Fprintf(&b, "\x00%020d", l.TimeUnixNano)
+	return b.String()
+}
+
+func attributesKey(attributes []*otlpcommon.KeyValue) string {
+	parts := make([]string, 0, len(attributes))
+	for _, kv := range attributes {
+		parts = append(parts, kv.GetKey()+"="+goldenValue(kv.GetValue()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
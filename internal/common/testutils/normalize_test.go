@@ -0,0 +1,319 @@
+package testutils
+
+import (
+	"encoding/hex"
+	"slices"
+	"testing"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func normalizeTestSpan(t *testing.T, name, traceId, spanId, parentId string, start, end uint64) *otlptrace.Span {
+	s := &otlptrace.Span{
+		Name:              name,
+		TraceId:           mustHexId(t, traceId),
+		SpanId:            mustHexId(t, spanId),
+		StartTimeUnixNano: start,
+		EndTimeUnixNano:   end,
+	}
+	if parentId != "" {
+		s.ParentSpanId = mustHexId(t, parentId)
+	}
+	return s
+}
+
+// Two traces of two spans, one of them with a remote parent and a link to the other trace
+func normalizeTestTraces(t *testing.T) []*otlptrace.Span {
+	const traceA, traceB = "5b8aa5a2d2c872e8321cf37308d69df2", "829fb7ceb787403c96eac634767ef10a"
+	base := uint64(1714644062100000000)
+	roll := normalizeTestSpan(t, "roll", traceA, "051581bf3cb55c13", "5fb397be34d26b51", base+10, base+130_000_000)
+	roll.Links = []*otlptrace.Span_Link{{TraceId: mustHexId(t, traceB), SpanId: mustHexId(t, "efe159833c5bf9d1")}}
+	return []*otlptrace.Span{
+		normalizeTestSpan(t, "GET /roll", traceA, "5fb397be34d26b51", "", base, base+200_000_000),
+		roll,
+		normalizeTestSpan(t, "GET /health", traceB, "efe159833c5bf9d1", "7a2190356bc8ec5f", base+500, base+900),
+		normalizeTestSpan(t, "check", traceB, "0a3bb75e2b3b1d6b", "efe159833c5bf9d1", base+600, base+800),
+	}
+}
+
+func resourceSpansOf(spans ...*otlptrace.Span) *otlptrace.ResourceSpans {
+	return &otlptrace.ResourceSpans{
+		Resource:   &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{StringAttribute("service.name", "dice")}},
+		ScopeSpans: []*otlptrace.ScopeSpans{{Scope: &otlpcommon.InstrumentationScope{Name: "dice"}, Spans: spans}},
+	}
+}
+
+func TestNormalizationTracesOrder(t *testing.T) {
+	spans := normalizeTestTraces(t)
+	orders := []struct {
+		name  string
+		order []int
+	}{
+		{"reversed", []int{3, 2, 1, 0}},
+		{"by trace, reversed", []int{2, 3, 0, 1}},
+		{"interleaved", []int{1, 3, 0, 2}},
+	}
+	normalizations := []struct {
+		name string
+		n    Normalization
+	}{
+		{"sort only", Normalization{}},
+		{"strip ids", Normalization{StripIDs: true}},
+		{"golden", goldenNormalization},
+	}
+	for _, nt := range normalizations {
+		want := nt.n.Traces(resourceSpansOf(spans...))
+		for _, o := range orders {
+			t.Run(nt.name+"/"+o.name, func(t *testing.T) {
+				var shuffled []*otlptrace.Span
+				for _, i := range o.order {
+					shuffled = append(shuffled, spans[i])
+				}
+				assertProtoEqual(t, want, nt.n.Traces(resourceSpansOf(shuffled...)))
+			})
+		}
+	}
+}
+
+func TestNormalizationTracesScopes(t *testing.T) {
+	spans := normalizeTestTraces(t)
+	rs := &otlptrace.ResourceSpans{ScopeSpans: []*otlptrace.ScopeSpans{
+		{Scope: &otlpcommon.InstrumentationScope{Name: "b"}, Spans: spans[2:]},
+		{Scope: &otlpcommon.InstrumentationScope{Name: "a", Version: "2.0.0"}, Spans: spans[1:2]},
+		{Scope: &otlpcommon.InstrumentationScope{Name: "a", Version: "1.0.0"}, Spans: spans[:1]},
+	}}
+	got := Normalization{}.Traces(rs)
+	var scopes []string
+	for _, ss := range got.GetScopeSpans() {
+		scopes = append(scopes, ss.GetScope().GetName()+"@"+ss.GetScope().GetVersion())
+	}
+	if want := []string{"a@1.0.0", "a@2.0.0", "b@"}; !slices.Equal(want, scopes) {
+		t.Errorf("Expected the scopes %v, got %v", want, scopes)
+	}
+}
+
+func TestNormalizationStripIDs(t *testing.T) {
+	got := Normalization{StripIDs: true}.Traces(resourceSpansOf(normalizeTestTraces(t)...))
+	tests := []struct {
+		name    string
+		traceId string
+		spanId  string
+		parent  string
+	}{
+		// the traces are ordered by their sorted spans, GET /health before GET /roll. The remote parent
+		// gets an id after the ones of the spans
+		{"GET /health", "00000000000000000000000000000001", "0000000000000001", "0000000000000005"},
+		{"check", "00000000000000000000000000000001", "0000000000000002", "0000000000000001"},
+		{"GET /roll", "00000000000000000000000000000002", "0000000000000003", ""},
+		{"roll", "00000000000000000000000000000002", "0000000000000004", "0000000000000003"},
+	}
+	spans := got.GetScopeSpans()[0].GetSpans()
+	if len(spans) != len(tests) {
+		t.Fatalf("Expected %d spans, got %d", len(tests), len(spans))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := spans[i]
+			if s.GetName() != tt.name {
+				t.Fatalf("Expected span %s at %d, got %s", tt.name, i, s.GetName())
+			}
+			for _, id := range []struct{ name, want, got string }{
+				{"trace id", tt.traceId, hex.EncodeToString(s.TraceId)},
+				{"span id", tt.spanId, hex.EncodeToString(s.SpanId)},
+				{"parent span id", tt.parent, hex.EncodeToString(s.ParentSpanId)},
+			} {
+				if id.want != id.got {
+					t.Errorf("Expected the %s %s, got %s", id.name, id.want, id.got)
+				}
+			}
+		})
+	}
+	// the link keeps pointing at the span of the other trace
+	link := spans[3].GetLinks()[0]
+	if !proto.Equal(&otlptrace.Span{TraceId: link.TraceId, SpanId: link.SpanId}, &otlptrace.Span{TraceId: spans[0].TraceId, SpanId: spans[0].SpanId}) {
+		t.Errorf("Expected the link to GET /health, got %x %x", link.TraceId, link.SpanId)
+	}
+}
+
+func TestNormalizationTimestamps(t *testing.T) {
+	start := uint64(1714644062100000000)
+	tests := []struct {
+		name      string
+		n         Normalization
+		end       uint64
+		wantStart uint64
+		wantEnd   uint64
+	}{
+		{"kept", Normalization{}, start + 130_000_000, start, start + 130_000_000},
+		{"stripped", Normalization{StripTimestamps: true}, start + 130_000_000, 0, 0},
+		{"rounded down", Normalization{StripTimestamps: true, DurationResolution: 100 * time.Millisecond}, start + 130_000_000, 0, 100_000_000},
+		{"rounded up", Normalization{StripTimestamps: true, DurationResolution: 100 * time.Millisecond}, start + 150_000_000, 0, 200_000_000},
+		{"ended before its start", Normalization{StripTimestamps: true, DurationResolution: time.Millisecond}, start - 1, 0, 0},
+		{"resolution without stripping", Normalization{DurationResolution: time.Second}, start + 130_000_000, start, start + 130_000_000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &otlptrace.Span{
+				Name:              "roll",
+				StartTimeUnixNano: start,
+				EndTimeUnixNano:   tt.end,
+				Events:            []*otlptrace.Span_Event{{Name: "rolled", TimeUnixNano: start + 1}},
+			}
+			got := tt.n.Traces(resourceSpansOf(s)).GetScopeSpans()[0].GetSpans()[0]
+			if got.StartTimeUnixNano != tt.wantStart || got.EndTimeUnixNano != tt.wantEnd {
+				t.Errorf("Expected the times %d-%d, got %d-%d", tt.wantStart, tt.wantEnd, got.StartTimeUnixNano, got.EndTimeUnixNano)
+			}
+			if stripped := got.Events[0].TimeUnixNano == 0; stripped != tt.n.StripTimestamps {
+				t.Errorf("Unexpected time of the event %d", got.Events[0].TimeUnixNano)
+			}
+			// the input is not modified
+			if s.StartTimeUnixNano != start || s.EndTimeUnixNano != tt.end {
+				t.Error("Expected the spans to be copied")
+			}
+		})
+	}
+}
+
+func TestNormalizationDropAttributes(t *testing.T) {
+	attributes := func() []*otlpcommon.KeyValue {
+		return []*otlpcommon.KeyValue{
+			StringAttribute("process.pid", "42"),
+			StringAttribute("host.name", "a"),
+			StringAttribute("processor", "b"),
+			{Key: "user", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_KvlistValue{KvlistValue: &otlpcommon.KeyValueList{
+				Values: []*otlpcommon.KeyValue{StringAttribute("name", "alice"), BoolAttribute("admin", true)},
+			}}}},
+			StringAttribute("process.runtime.name", "go"),
+		}
+	}
+	sortedUser := &otlpcommon.KeyValue{Key: "user", Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_KvlistValue{KvlistValue: &otlpcommon.KeyValueList{
+		Values: []*otlpcommon.KeyValue{BoolAttribute("admin", true), StringAttribute("name", "alice")},
+	}}}}
+	tests := []struct {
+		name string
+		drop []string
+		want []string
+	}{
+		{"none", nil, []string{"host.name", "process.pid", "process.runtime.name", "processor", "user"}},
+		{"key", []string{"host.name"}, []string{"process.pid", "process.runtime.name", "processor", "user"}},
+		{"prefix", []string{"process."}, []string{"host.name", "processor", "user"}},
+		// without the dot, the key must match
+		{"not a prefix", []string{"process"}, []string{"host.name", "process.pid", "process.runtime.name", "processor", "user"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := Normalization{DropAttributes: tt.drop}
+			s := &otlptrace.Span{Name: "roll", Attributes: attributes()}
+			rs := resourceSpansOf(s)
+			rs.Resource.Attributes = attributes()
+			got := n.Traces(rs)
+			for name, attrs := range map[string][]*otlpcommon.KeyValue{
+				"resource": got.GetResource().GetAttributes(),
+				"span":     got.GetScopeSpans()[0].GetSpans()[0].GetAttributes(),
+			} {
+				var keys []string
+				for _, kv := range attrs {
+					keys = append(keys, kv.GetKey())
+				}
+				if !slices.Equal(tt.want, keys) {
+					t.Errorf("Expected the attributes %v of the %s, got %v", tt.want, name, keys)
+				}
+				// nested maps are sorted too
+				assertProtoEqual(t, sortedUser, attrs[len(attrs)-1])
+			}
+		})
+	}
+}
+
+func TestNormalizationMetrics(t *testing.T) {
+	point := func(value int64, start uint64) *otlpmetrics.NumberDataPoint {
+		return &otlpmetrics.NumberDataPoint{
+			Attributes:        []*otlpcommon.KeyValue{IntAttribute("roll.value", value)},
+			StartTimeUnixNano: start, TimeUnixNano: start + 1,
+			Value: &otlpmetrics.NumberDataPoint_AsInt{AsInt: value * 10},
+		}
+	}
+	metrics := func(order ...int64) *otlpmetrics.ResourceMetrics {
+		sum := &otlpmetrics.Sum{IsMonotonic: true}
+		for _, v := range order {
+			sum.DataPoints = append(sum.DataPoints, point(v, 100))
+		}
+		return &otlpmetrics.ResourceMetrics{ScopeMetrics: []*otlpmetrics.ScopeMetrics{{Metrics: []*otlpmetrics.Metric{
+			{Name: "queue.size", Data: &otlpmetrics.Metric_Gauge{Gauge: &otlpmetrics.Gauge{DataPoints: []*otlpmetrics.NumberDataPoint{point(1, 100)}}}},
+			{Name: "dice.rolls", Data: &otlpmetrics.Metric_Sum{Sum: sum}},
+		}}}}
+	}
+	tests := []struct {
+		name     string
+		n        Normalization
+		wantTime uint64
+	}{
+		{"sort only", Normalization{}, 101},
+		{"strip timestamps", Normalization{StripTimestamps: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.n.Metrics(metrics(1, 2, 3))
+			assertProtoEqual(t, want, tt.n.Metrics(metrics(3, 1, 2)))
+			ms := want.GetScopeMetrics()[0].GetMetrics()
+			if ms[0].GetName() != "dice.rolls" || ms[1].GetName() != "queue.size" {
+				t.Errorf("Expected the metrics sorted by name, got %s, %s", ms[0].GetName(), ms[1].GetName())
+			}
+			dp := ms[0].GetSum().GetDataPoints()[2]
+			if dp.GetAsInt() != 30 || dp.TimeUnixNano != tt.wantTime {
+				t.Errorf("Unexpected data point %v", dp)
+			}
+		})
+	}
+}
+
+func TestNormalizationLogs(t *testing.T) {
+	const traceId, spanA, spanB = "5b8aa5a2d2c872e8321cf37308d69df2", "051581bf3cb55c13", "5fb397be34d26b51"
+	record := func(body, spanId string) *otlplogs.LogRecord {
+		return &otlplogs.LogRecord{
+			TimeUnixNano: 1714644062100000000,
+			Body:         stringValue(body),
+			TraceId:      mustHexId(t, traceId),
+			SpanId:       mustHexId(t, spanId),
+		}
+	}
+	logs := func(records ...*otlplogs.LogRecord) *otlplogs.ResourceLogs {
+		return &otlplogs.ResourceLogs{ScopeLogs: []*otlplogs.ScopeLogs{{LogRecords: records}}}
+	}
+	n := Normalization{StripIDs: true, StripTimestamps: true}
+	want := n.Logs(logs(record("a", spanA), record("b", spanB), record("c", spanA)))
+	assertProtoEqual(t, want, n.Logs(logs(record("c", spanA), record("b", spanB), record("a", spanA))))
+
+	tests := []struct {
+		body   string
+		spanId string
+	}{
+		{"a", "0000000000000001"},
+		{"b", "0000000000000002"},
+		// the logs of the same span share their ids
+		{"c", "0000000000000001"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			l := want.GetScopeLogs()[0].GetLogRecords()[i]
+			if l.GetBody().GetStringValue() != tt.body {
+				t.Fatalf("Expected the log %s at %d, got %s", tt.body, i, l.GetBody().GetStringValue())
+			}
+			if got := hex.EncodeToString(l.SpanId); got != tt.spanId {
+				t.Errorf("Expected the span id %s, got %s", tt.spanId, got)
+			}
+			if got := hex.EncodeToString(l.TraceId); got != "00000000000000000000000000000001" {
+				t.Errorf("Unexpected trace id %s", got)
+			}
+			if l.TimeUnixNano != 0 {
+				t.Errorf("Expected the timestamp to be stripped, got %d", l.TimeUnixNano)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// The asynchronous instruments, whose values are reported by a callback on each collection
+type ObservableKind int
+
+const (
+	ObservableCounter ObservableKind = iota
+	ObservableUpDownCounter
+	ObservableGauge
+)
+
+func (k ObservableKind) String() string {
+	switch k {
+	case ObservableCounter:
+		return "ObservableCounter"
+	case ObservableUpDownCounter:
+		return "ObservableUpDownCounter"
+	default:
+		return "ObservableGauge"
+	}
+}
+
+// The number of collections observed by default, so a callback only called once, e.g. registered for a
+// single collection, fails the test
+const defaultObservableCycles int = 2
+
+type ObservableTestCase struct {
+	serviceName string
+	metricName  string
+	kind        ObservableKind
+	attributes  []*otlpcommon.KeyValue
+	cycles      int
+}
+
+// Creates a test case for the data point of the instrument with the attributes provided by its callback
+func NewObservableTestCase(serviceName, metricName string, kind ObservableKind, attributes ...*otlpcommon.KeyValue) *ObservableTestCase {
+	return &ObservableTestCase{
+		serviceName: serviceName,
+		metricName:  metricName,
+		kind:        kind,
+		attributes:  attributes,
+		cycles:      defaultObservableCycles,
+	}
+}
+
+// Sets the number of collections the data point must be reported in. Defaults to 2
+func (tc *ObservableTestCase) WithCycles(cycles int) *ObservableTestCase {
+	tc.cycles = cycles
+	return tc
+}
+
+// Asserts the callback of the instrument reported the data point with the attributes of the test case on
+// several collections, by fetching the metrics of the service until the data point was seen with as many
+// distinct timestamps. The cumulative values of an ObservableCounter must not decrease between collections.
+// Returns the data point of each collection, in order
+func AssertObservable(t TestingT, tc *ObservableTestCase) []*otlpmetrics.NumberDataPoint {
+	var collected []*otlpmetrics.NumberDataPoint
+	var lastErr string
+	found := Eventually(t, fmt.Sprintf("%d collections of %s", tc.cycles, tc.metricName), func() bool {
+		rm := GetMetric(t, tc.serviceName)
+		dp, err := findObservableDataPoint(rm, tc)
+		if err != "" {
+			lastErr = err
+			return false
+		}
+		if len(collected) == 0 || dp.GetTimeUnixNano() > collected[len(collected)-1].GetTimeUnixNano() {
+			collected = append(collected, dp)
+		}
+		return len(collected) >= tc.cycles
+	})
+	if !found {
+		if len(collected) == 0 {
+			t.Fatalf("Could not find the data point of %s %s: %s", tc.kind, tc.metricName, lastErr)
+		}
+		t.Fatalf("The data point of %s %s was only reported in %d collection(s), expected %d. Is the callback registered for every collection?",
+			tc.kind, tc.metricName, len(collected), tc.cycles)
+	}
+
+	if tc.kind == ObservableCounter {
+		for i := 1; i < len(collected); i++ {
+			if numberValue(collected[i]) < numberValue(collected[i-1]) && collected[i].GetStartTimeUnixNano() == collected[i-1].GetStartTimeUnixNano() {
+				t.Errorf("ObservableCounter %s decreased from %v to %v between two collections", tc.metricName, numberValue(collected[i-1]), numberValue(collected[i]))
+			}
+		}
+	}
+	return collected
+}
+
+// Finds the data point of the instrument in an export, or describes why it is not found
+func findObservableDataPoint(rm *otlpmetrics.ResourceMetrics, tc *ObservableTestCase) (*otlpmetrics.NumberDataPoint, string) {
+	var metric *otlpmetrics.Metric
+	for _, sm := range rm.GetScopeMetrics() {
+		for _, m := range sm.GetMetrics() {
+			if m.GetName() == tc.metricName {
+				metric = m
+			}
+		}
+	}
+	if metric == nil {
+		return nil, "no metric with this name"
+	}
+
+	var dps []*otlpmetrics.NumberDataPoint
+	switch d := metric.GetData().(type) {
+	case *otlpmetrics.Metric_Sum:
+		if tc.kind == ObservableGauge {
+			return nil, "the metric is a sum, not a gauge"
+		}
+		if d.Sum.GetIsMonotonic() != (tc.kind == ObservableCounter) {
+			return nil, fmt.Sprintf("the metric is a sum with monotonic %t", d.Sum.GetIsMonotonic())
+		}
+		dps = d.Sum.GetDataPoints()
+	case *otlpmetrics.Metric_Gauge:
+		if tc.kind != ObservableGauge {
+			return nil, "the metric is a gauge, not a sum"
+		}
+		dps = d.Gauge.GetDataPoints()
+	default:
+		return nil, fmt.Sprintf("the metric is a %T", metric.GetData())
+	}
+
+	for _, dp := range dps {
+		if hasAttributes(dp.GetAttributes(), tc.attributes) {
+			return dp, ""
+		}
+	}
+	return nil, fmt.Sprintf("no data point with the attributes %v among %d data points", tc.attributes, len(dps))
+}
+
+func numberValue(dp *otlpmetrics.NumberDataPoint) float64 {
+	if _, ok := dp.GetValue().(*otlpmetrics.NumberDataPoint_AsInt); ok {
+		return float64(dp.GetAsInt())
+	}
+	return dp.GetAsDouble()
+}
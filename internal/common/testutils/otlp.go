@@ -7,3 +7,53 @@ import (
 func StringAttribute(key, value string) *otlpcommon.KeyValue {
 	return &otlpcommon.KeyValue{Key: key, Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: value}}}
 }
+
+func BoolAttribute(key string, value bool) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{Key: key, Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: value}}}
+}
+
+func IntAttribute(key string, value int64) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{Key: key, Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: value}}}
+}
+
+func DoubleAttribute(key string, value float64) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{Key: key, Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: value}}}
+}
+
+func StringSliceAttribute(key string, values ...string) *otlpcommon.KeyValue {
+	arr := &otlpcommon.ArrayValue{}
+	for _, v := range values {
+		arr.Values = append(arr.Values, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: v}})
+	}
+	return &otlpcommon.KeyValue{Key: key, Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: arr}}}
+}
+
+func IntSliceAttribute(key string, values ...int64) *otlpcommon.KeyValue {
+	arr := &otlpcommon.ArrayValue{}
+	for _, v := range values {
+		arr.Values = append(arr.Values, &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: v}})
+	}
+	return &otlpcommon.KeyValue{Key: key, Value: &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: arr}}}
+}
+
+// A map value, e.g. the structured body of a log record or a nested attribute
+func MapValue(values ...*otlpcommon.KeyValue) *otlpcommon.AnyValue {
+	return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_KvlistValue{KvlistValue: &otlpcommon.KeyValueList{Values: values}}}
+}
+
+func MapAttribute(key string, values ...*otlpcommon.KeyValue) *otlpcommon.KeyValue {
+	return &otlpcommon.KeyValue{Key: key, Value: MapValue(values...)}
+}
+
+func ArrayValue(values ...*otlpcommon.AnyValue) *otlpcommon.AnyValue {
+	return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: &otlpcommon.ArrayValue{Values: values}}}
+}
+
+// Creates an attribute from a Go value: string, bool, int, int64, float64, []string or []any of those
+func Attribute(key string, value any) (*otlpcommon.KeyValue, error) {
+	v, err := toAnyValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return &otlpcommon.KeyValue{Key: key, Value: v}, nil
+}
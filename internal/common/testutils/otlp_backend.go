@@ -0,0 +1,74 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+	"net/http"
+
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// TraceBackend, MetricsBackend and LogsBackend for the OTLP back-end (internal/otlp_backend) running inside compose
+type OtlpBackend struct {
+	uri string
+}
+
+func NewOtlpBackend(uri string) *OtlpBackend {
+	return &OtlpBackend{uri: uri}
+}
+
+func (b *OtlpBackend) GetTraces(serviceName string, _ TraceQueryOptions) (*otlptrace.ResourceSpans, error) {
+	body, err := b.getOtlp(TraceSignal, serviceName)
+	if err != nil || len(body) == 0 {
+		return nil, err
+	}
+
+	rs := &otlptrace.ResourceSpans{}
+	if err := proto.Unmarshal(body, rs); err != nil {
+		return nil, fmt.Errorf("error reading payload from OTLP backend: %w", err)
+	}
+	return rs, nil
+}
+
+func (b *OtlpBackend) GetMetrics(serviceName string) (*otlpmetrics.ResourceMetrics, error) {
+	body, err := b.getOtlp(MetricsSignal, serviceName)
+	if err != nil || len(body) == 0 {
+		return nil, err
+	}
+
+	rm := &otlpmetrics.ResourceMetrics{}
+	if err := proto.Unmarshal(body, rm); err != nil {
+		return nil, fmt.Errorf("error reading metrics payload from OTLP backend: %w", err)
+	}
+	return rm, nil
+}
+
+func (b *OtlpBackend) GetLogs(serviceName string) (*otlplogs.ResourceLogs, error) {
+	body, err := b.getOtlp(LogsSignal, serviceName)
+	if err != nil || len(body) == 0 {
+		return nil, err
+	}
+
+	rl := &otlplogs.ResourceLogs{}
+	if err := proto.Unmarshal(body, rl); err != nil {
+		return nil, fmt.Errorf("error reading payload from OTLP backend: %w", err)
+	}
+	return rl, nil
+}
+
+func (b *OtlpBackend) getOtlp(signal, serviceName string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/getotlp?signal=%s&servicename=%s", b.uri, signal, serviceName), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, body, err := doHttp(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting %s from OTLP backend: %w", signal, err)
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		return nil, newHttpStatusError(req.URL.String(), res.StatusCode)
+	}
+	return body, nil
+}
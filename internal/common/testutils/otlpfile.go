@@ -0,0 +1,138 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Paths to files written by an OTLP file exporter (e.g. the collector `file` exporter).
+// When set, the signal is read from the file instead of the OTLP back-end
+var tracesFile = flag.String("traces-file", "", "Path to the OTLP JSON lines file containing the exported traces")
+var metricsFile = flag.String("metrics-file", "", "Path to the OTLP JSON lines file containing the exported metrics")
+var logsFile = flag.String("logs-file", "", "Path to the OTLP JSON lines file containing the exported logs")
+
+// The file exporters write one OTLP JSON message (e.g. LogsData) per line
+// and lines can get big depending on the export batch size
+const maxOtlpFileLineSize int = 16 * 1024 * 1024
+
+// Reads all lines of an OTLP JSON file, unmarshalling each into a new message created by newMsg.
+// A missing file is not an error, as the exporter may not have flushed yet.
+func readOtlpJsonLines(path string, newMsg func() proto.Message, onMsg func(proto.Message)) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxOtlpFileLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		msg := newMsg()
+		if err := protojson.Unmarshal(line, msg); err != nil {
+			return fmt.Errorf("invalid OTLP JSON line in %s: %w", path, err)
+		}
+		onMsg(msg)
+	}
+	return scanner.Err()
+}
+
+// TraceBackend, MetricsBackend and LogsBackend reading the telemetry from an OTLP JSON lines file
+type OtlpFileBackend struct {
+	path string
+}
+
+func NewOtlpFileBackend(path string) *OtlpFileBackend {
+	return &OtlpFileBackend{path: path}
+}
+
+func (b *OtlpFileBackend) GetTraces(serviceName string, _ TraceQueryOptions) (*otlptrace.ResourceSpans, error) {
+	return ReadTracesFromFile(b.path, serviceName)
+}
+
+func (b *OtlpFileBackend) GetMetrics(serviceName string) (*otlpmetrics.ResourceMetrics, error) {
+	return ReadMetricsFromFile(b.path, serviceName)
+}
+
+func (b *OtlpFileBackend) GetLogs(serviceName string) (*otlplogs.ResourceLogs, error) {
+	return ReadLogsFromFile(b.path, serviceName)
+}
+
+// Reads the spans of the given service from an OTLP JSON lines file. Spans from
+// all exports are merged into a single ResourceSpans. Returns nil if nothing is found.
+func ReadTracesFromFile(path, serviceName string) (*otlptrace.ResourceSpans, error) {
+	var all []*otlptrace.ResourceSpans
+
+	err := readOtlpJsonLines(path,
+		func() proto.Message { return &otlptrace.TracesData{} },
+		func(m proto.Message) {
+			for _, rs := range m.(*otlptrace.TracesData).GetResourceSpans() {
+				if getServiceName(rs.GetResource()) == serviceName {
+					all = append(all, rs)
+				}
+			}
+		})
+
+	return mergeResourceSpans(all), err
+}
+
+// Reads the metrics of the given service from an OTLP JSON lines file. Metrics from
+// all exports are merged into a single ResourceMetrics. Returns nil if nothing is found.
+func ReadMetricsFromFile(path, serviceName string) (*otlpmetrics.ResourceMetrics, error) {
+	var res *otlpmetrics.ResourceMetrics
+
+	err := readOtlpJsonLines(path,
+		func() proto.Message { return &otlpmetrics.MetricsData{} },
+		func(m proto.Message) {
+			for _, rm := range m.(*otlpmetrics.MetricsData).GetResourceMetrics() {
+				if getServiceName(rm.GetResource()) != serviceName {
+					continue
+				}
+				if res == nil {
+					res = &otlpmetrics.ResourceMetrics{Resource: rm.GetResource(), SchemaUrl: rm.GetSchemaUrl()}
+				}
+				res.ScopeMetrics = append(res.ScopeMetrics, rm.GetScopeMetrics()...)
+			}
+		})
+
+	return res, err
+}
+
+// Reads the logs of the given service from an OTLP JSON lines file. Records from
+// all exports are merged into a single ResourceLogs. Returns nil if nothing is found.
+func ReadLogsFromFile(path, serviceName string) (*otlplogs.ResourceLogs, error) {
+	var res *otlplogs.ResourceLogs
+
+	err := readOtlpJsonLines(path,
+		func() proto.Message { return &otlplogs.LogsData{} },
+		func(m proto.Message) {
+			for _, rl := range m.(*otlplogs.LogsData).GetResourceLogs() {
+				if getServiceName(rl.GetResource()) != serviceName {
+					continue
+				}
+				if res == nil {
+					res = &otlplogs.ResourceLogs{Resource: rl.GetResource(), SchemaUrl: rl.GetSchemaUrl()}
+				}
+				res.ScopeLogs = append(res.ScopeLogs, rl.GetScopeLogs()...)
+			}
+		})
+
+	return res, err
+}
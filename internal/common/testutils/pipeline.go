@@ -0,0 +1,254 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// Compares the spans a sample emitted, captured before the collector processes them, with the spans
+// landing in the trace back-end, e.g. for recipes demonstrating the processors of a collector pipeline
+type PipelineTestCase struct {
+	serviceName        string
+	emitted            TraceBackend
+	droppedSpans       []string
+	addedAttributes    []*otlpcommon.KeyValue
+	removedAttributes  []string
+	resourceAttributes []*otlpcommon.KeyValue
+	attributeActions   []AttributeAction
+}
+
+// The actions of the collector attributes processor
+const (
+	InsertAction string = "insert"
+	UpdateAction string = "update"
+	UpsertAction string = "upsert"
+	DeleteAction string = "delete"
+	HashAction   string = "hash"
+)
+
+var attributeActions = []string{InsertAction, UpdateAction, UpsertAction, DeleteAction, HashAction}
+
+// An action of a collector attributes processor, with the same fields as in its configuration:
+//
+//	actions:
+//	  - key: deployment.environment
+//	    value: recipes
+//	    action: insert
+type AttributeAction struct {
+	Key    string `yaml:"key"`
+	Action string `yaml:"action"`
+	Value  any    `yaml:"value"`
+	// Used instead of Value by insert, update and upsert if set
+	FromAttribute string `yaml:"from_attribute"`
+}
+
+// Creates a test case for the spans of the service. The emitted back-end receives the spans as sent by the
+// sample, e.g. the OTLP back-end or an otlpsink fed by a collector pipeline without processors, while the
+// spans after the pipeline are fetched from the trace back-end of the tests (-trace-backend)
+func NewPipelineTestCase(serviceName string, emitted TraceBackend) *PipelineTestCase {
+	return &PipelineTestCase{serviceName: serviceName, emitted: emitted}
+}
+
+// Expects the emitted spans with the names, which can be patterns, to be dropped, e.g. by a filter processor
+func (tc *PipelineTestCase) WithDroppedSpans(spanNames ...string) *PipelineTestCase {
+	tc.droppedSpans = append(tc.droppedSpans, spanNames...)
+	return tc
+}
+
+// Expects the attributes to be added to all the spans, e.g. by an attributes processor
+func (tc *PipelineTestCase) WithAddedAttributes(attributes ...*otlpcommon.KeyValue) *PipelineTestCase {
+	tc.addedAttributes = append(tc.addedAttributes, attributes...)
+	return tc
+}
+
+// Expects the attributes to be removed from all the spans, e.g. by an attributes or redaction processor
+func (tc *PipelineTestCase) WithRemovedAttributes(keys ...string) *PipelineTestCase {
+	tc.removedAttributes = append(tc.removedAttributes, keys...)
+	return tc
+}
+
+// Expects the attributes to be added to the resource, e.g. by a resource or resourcedetection processor
+func (tc *PipelineTestCase) WithResourceAttributes(attributes ...*otlpcommon.KeyValue) *PipelineTestCase {
+	tc.resourceAttributes = append(tc.resourceAttributes, attributes...)
+	return tc
+}
+
+// Expects the spans to be changed by an attributes processor with the actions. The actions are applied
+// to the emitted attributes, in order, to know the attributes the exported spans must have. The include
+// and exclude filters of the processor are not supported, so the actions must apply to all the spans
+func (tc *PipelineTestCase) WithAttributeActions(actions ...AttributeAction) *PipelineTestCase {
+	tc.attributeActions = append(tc.attributeActions, actions...)
+	return tc
+}
+
+// Reads the actions of the attributes processor with the name, e.g. attributes/redact, from a collector configuration
+func LoadAttributeActions(configPath, processorName string) ([]AttributeAction, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Processors map[string]struct {
+			Actions []AttributeAction `yaml:"actions"`
+		} `yaml:"processors"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid collector configuration %s: %w", configPath, err)
+	}
+	p, found := config.Processors[processorName]
+	if !found {
+		return nil, fmt.Errorf("processor %s not found in %s", processorName, configPath)
+	}
+	for _, a := range p.Actions {
+		if !slices.Contains(attributeActions, a.Action) {
+			return nil, fmt.Errorf("action %q of attribute %s in processor %s is not supported", a.Action, a.Key, processorName)
+		}
+	}
+	return p.Actions, nil
+}
+
+// Asserts each emitted span reached the trace back-end, matched by its trace and span id, with the same name
+// and attributes, except for the changes the test case expects from the pipeline. Dropped spans must not reach it
+func AssertPipeline(t TestingT, tc *PipelineTestCase) {
+	var emitted *otlptrace.ResourceSpans
+	found := Eventually(t, "Emitted spans", func() bool {
+		var err error
+		emitted, err = tc.emitted.GetTraces(tc.serviceName, TraceQueryOptions{})
+		if err != nil {
+			checkBackendError(t, "emitted spans", err)
+		}
+		return len(emitted.GetScopeSpans()) > 0
+	})
+	if !found {
+		t.Fatalf("Could not find the spans emitted by %s", tc.serviceName)
+	}
+
+	var expected []*otlptrace.Span
+	var dropped []*otlptrace.Span
+	for _, s := range allSpans(emitted) {
+		if tc.isDropped(s.GetName()) {
+			dropped = append(dropped, s)
+		} else {
+			expected = append(expected, s)
+		}
+	}
+
+	// wait until all the spans made it through the pipeline, which may batch them
+	var exported *otlptrace.ResourceSpans
+	var missing []*otlptrace.Span
+	Eventually(t, "Exported spans", func() bool {
+		exported = getTrace(t, tc.serviceName, TraceQueryOptions{})
+		missing = missing[:0]
+		for _, s := range expected {
+			if findSpanByID(exported, s.GetTraceId(), s.GetSpanId()) == nil {
+				missing = append(missing, s)
+			}
+		}
+		return len(missing) == 0
+	})
+	for _, s := range missing {
+		assert.Fail(t, "Span not exported", "Span %s (%s) emitted by %s did not reach the trace back-end",
+			s.GetName(), hex.EncodeToString(s.GetSpanId()), tc.serviceName)
+	}
+
+	for _, s := range dropped {
+		assert.Nil(t, findSpanByID(exported, s.GetTraceId(), s.GetSpanId()),
+			"Span %s was expected to be dropped by the pipeline", s.GetName())
+	}
+
+	for _, s := range expected {
+		actual := findSpanByID(exported, s.GetTraceId(), s.GetSpanId())
+		if actual == nil {
+			continue
+		}
+		assert.Equal(t, s.GetName(), actual.GetName(), "Span %s was renamed by the pipeline", s.GetName())
+
+		attrs, absent := tc.expectedAttributes(t, s.GetAttributes())
+		AssertAttributes(t, "exported span "+s.GetName(), actual.GetAttributes(), attrs...)
+		for _, key := range absent {
+			AssertNoAttribute(t, actual.GetAttributes(), key)
+		}
+	}
+
+	AssertResourceAttributes(t, exported.GetResource(), tc.keptAttributes(emitted.GetResource().GetAttributes(), tc.resourceAttributes)...)
+	AssertResourceAttributes(t, exported.GetResource(), tc.resourceAttributes...)
+}
+
+func (tc *PipelineTestCase) isDropped(spanName string) bool {
+	for _, pattern := range tc.droppedSpans {
+		if matchSpanName(pattern, spanName) {
+			return true
+		}
+	}
+	return false
+}
+
+// The attributes an exported span is expected to have given the emitted ones, and the ones it must not have
+func (tc *PipelineTestCase) expectedAttributes(t TestingT, emitted []*otlpcommon.KeyValue) ([]*otlpcommon.KeyValue, []string) {
+	attrs := append(tc.keptAttributes(emitted, tc.addedAttributes), tc.addedAttributes...)
+	absent := slices.Clone(tc.removedAttributes)
+
+	set := func(kv *otlpcommon.KeyValue) {
+		attrs = slices.DeleteFunc(attrs, func(a *otlpcommon.KeyValue) bool { return a.GetKey() == kv.GetKey() })
+		attrs = append(attrs, kv)
+		absent = slices.DeleteFunc(absent, func(k string) bool { return k == kv.GetKey() })
+	}
+	for _, a := range tc.attributeActions {
+		current := findAttribute(attrs, a.Key)
+		switch a.Action {
+		case InsertAction, UpdateAction, UpsertAction:
+			if a.Action == InsertAction && current != nil || a.Action == UpdateAction && current == nil {
+				continue
+			}
+			if a.FromAttribute != "" {
+				from := findAttribute(attrs, a.FromAttribute)
+				if from == nil {
+					continue
+				}
+				set(&otlpcommon.KeyValue{Key: a.Key, Value: from.GetValue()})
+				continue
+			}
+			v, err := toAnyValue(a.Value)
+			if err != nil {
+				t.Fatalf("Invalid value of the %s action of attribute %s: %v", a.Action, a.Key, err)
+			}
+			set(&otlpcommon.KeyValue{Key: a.Key, Value: v})
+		case DeleteAction:
+			attrs = slices.DeleteFunc(attrs, func(kv *otlpcommon.KeyValue) bool { return kv.GetKey() == a.Key })
+			absent = append(absent, a.Key)
+		case HashAction:
+			if current == nil {
+				continue
+			}
+			// the processor hashes the string values with SHA1, other types are only expected as strings
+			if sv, ok := current.GetValue().GetValue().(*otlpcommon.AnyValue_StringValue); ok {
+				sum := sha1.Sum([]byte(sv.StringValue))
+				set(StringAttribute(a.Key, hex.EncodeToString(sum[:])))
+			} else {
+				attrs = slices.DeleteFunc(attrs, func(kv *otlpcommon.KeyValue) bool { return kv.GetKey() == a.Key })
+			}
+		default:
+			t.Fatalf("Unsupported action %q of attribute %s", a.Action, a.Key)
+		}
+	}
+	return attrs, absent
+}
+
+// The emitted attributes expected to be exported unchanged, i.e. neither removed nor overridden by the pipeline
+func (tc *PipelineTestCase) keptAttributes(attributes, overridden []*otlpcommon.KeyValue) []*otlpcommon.KeyValue {
+	var res []*otlpcommon.KeyValue
+	for _, kv := range attributes {
+		if !slices.Contains(tc.removedAttributes, kv.GetKey()) && findAttribute(overridden, kv.GetKey()) == nil {
+			res = append(res, kv)
+		}
+	}
+	return res
+}
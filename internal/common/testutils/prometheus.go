@@ -0,0 +1,134 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"bytes"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+)
+
+// The collector's Prometheus exporter sets the job label from service.name,
+// so it is used to keep only the metrics of the sample being tested
+const prometheusJobLabel string = "job"
+
+func AssertPrometheusCounter[T Number](t TestingT, tc *MetricTestCase[T], families map[string]*dto.MetricFamily) {
+	mf := findMetricFamily(t, families, tc.metricName, dto.MetricType_COUNTER)
+	m := findPrometheusMetric(t, mf, tc.attributes)
+
+	assert.Equal(t, tc.description, mf.GetHelp())
+	assert.Equal(t, float64(tc.value), m.GetCounter().GetValue())
+}
+
+func AssertPrometheusGauge[T Number](t TestingT, tc *MetricTestCase[T], families map[string]*dto.MetricFamily) {
+	mf := findMetricFamily(t, families, tc.metricName, dto.MetricType_GAUGE)
+	m := findPrometheusMetric(t, mf, tc.attributes)
+
+	assert.Equal(t, tc.description, mf.GetHelp())
+	assert.Equal(t, float64(tc.value), m.GetGauge().GetValue())
+}
+
+func AssertPrometheusHistogramExists(t TestingT, name, description string, families map[string]*dto.MetricFamily, attributes ...*otlpcommon.KeyValue) {
+	mf := findMetricFamily(t, families, name, dto.MetricType_HISTOGRAM)
+	m := findPrometheusMetric(t, mf, attributes)
+
+	assert.Equal(t, description, mf.GetHelp())
+	assert.NotZero(t, m.GetHistogram().GetSampleCount())
+}
+
+func findMetricFamily(t TestingT, families map[string]*dto.MetricFamily, name string, mt dto.MetricType) *dto.MetricFamily {
+	mf, found := families[name]
+	if !found {
+		t.Fatalf("Could not find Prometheus metric with name: %s", name)
+	}
+	if mf.GetType() != mt {
+		t.Fatalf("Prometheus metric %s has type %s, expected %s", name, mf.GetType(), mt)
+	}
+	return mf
+}
+
+func findPrometheusMetric(t TestingT, mf *dto.MetricFamily, attributes []*otlpcommon.KeyValue) *dto.Metric {
+	for _, m := range mf.GetMetric() {
+		if hasLabels(m, attributes) {
+			return m
+		}
+	}
+	t.Fatalf("Could not find Prometheus metric %s with labels: %v", mf.GetName(), attributes)
+	return nil
+}
+
+func hasLabels(m *dto.Metric, attributes []*otlpcommon.KeyValue) bool {
+	for _, exp := range attributes {
+		if getLabelValue(m, prometheusLabelName(exp.GetKey())) != exp.GetValue().GetStringValue() {
+			return false
+		}
+	}
+	return true
+}
+
+func getLabelValue(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// Attribute keys are sanitized by the Prometheus exporter, e.g. http.method -> http_method
+func prometheusLabelName(key string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+func GetPrometheusMetricsWithRetry(t TestingT, serviceName string) map[string]*dto.MetricFamily {
+	var families map[string]*dto.MetricFamily
+
+	// do some retries until the exporter has it
+	found := Eventually(t, "Prometheus metrics", func() bool {
+		families = GetPrometheusMetrics(t, serviceName)
+		return len(families) > 0
+	})
+
+	if !found {
+		t.Fatalf("Could not find Prometheus metrics for sample: %s", serviceName)
+	}
+
+	return families
+}
+
+func GetPrometheusMetrics(t TestingT, serviceName string) map[string]*dto.MetricFamily {
+	Logger(t).Debug("Going to scrape the Prometheus exporter to fetch metrics", "backend", "prometheus", "service", serviceName)
+	body, err := httpGet(getConfig(t).PrometheusExporterUrl, "")
+	if err != nil {
+		t.Fatalf("Failed scraping the Prometheus exporter: %v", err)
+	}
+
+	var parser expfmt.TextParser
+	all, err := parser.TextToMetricFamilies(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Error parsing payload from the Prometheus exporter: %v", err)
+	}
+
+	// keep only the series exported by the sample
+	families := make(map[string]*dto.MetricFamily)
+	for name, mf := range all {
+		var metrics []*dto.Metric
+		for _, m := range mf.GetMetric() {
+			if getLabelValue(m, prometheusJobLabel) == serviceName {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) > 0 {
+			mf.Metric = metrics
+			families[name] = mf
+		}
+	}
+	return families
+}
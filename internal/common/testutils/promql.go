@@ -0,0 +1,275 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A value of a PromQL result at a time
+type PromPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// A series of a PromQL result, with a single point for the instant queries
+type PromSeries struct {
+	Labels map[string]string
+	Points []PromPoint
+}
+
+func (s PromSeries) String() string {
+	labels := make([]string, 0, len(s.Labels))
+	for k, v := range s.Labels {
+		labels = append(labels, fmt.Sprintf("%s=%q", k, v))
+	}
+	sort.Strings(labels)
+	return "{" + strings.Join(labels, ", ") + "}"
+}
+
+// Client of the HTTP API of a Prometheus server, e.g. scraping the Prometheus exporter of the collector or
+// receiving the metrics via remote write
+type PromClient struct {
+	uri string
+}
+
+func NewPromClient(uri string) *PromClient {
+	return &PromClient{uri: strings.TrimSuffix(uri, "/")}
+}
+
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#expression-query-result-formats
+type promResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type promResult struct {
+	Metric map[string]string `json:"metric"`
+	Value  []any             `json:"value"`
+	Values [][]any           `json:"values"`
+}
+
+// Evaluates the query at the time, via /api/v1/query
+func (c *PromClient) Query(query string, at time.Time) ([]PromSeries, error) {
+	q := url.Values{}
+	q.Set("query", query)
+	q.Set("time", formatPromTime(at))
+	return c.get("/api/v1/query", q)
+}
+
+// Evaluates the query at each step between start and end, via /api/v1/query_range
+func (c *PromClient) QueryRange(query string, start, end time.Time, step time.Duration) ([]PromSeries, error) {
+	q := url.Values{}
+	q.Set("query", query)
+	q.Set("start", formatPromTime(start))
+	q.Set("end", formatPromTime(end))
+	q.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	return c.get("/api/v1/query_range", q)
+}
+
+func (c *PromClient) get(path string, q url.Values) ([]PromSeries, error) {
+	uri := c.uri + path + "?" + q.Encode()
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, body, err := doHttp(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed calling Prometheus: %w", err)
+	}
+
+	// invalid queries are answered with a 400 or 422 and the error in the body
+	var pr promResponse
+	if err := json.Unmarshal(body, &pr); err != nil {
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed calling Prometheus: %w", newHttpStatusError(uri, res.StatusCode))
+		}
+		return nil, fmt.Errorf("error reading payload from Prometheus: %w", err)
+	}
+	if pr.Status != "success" {
+		if pr.ErrorType == "" && res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed calling Prometheus: %w", newHttpStatusError(uri, res.StatusCode))
+		}
+		return nil, fmt.Errorf("%w: %s: %s", errInvalidPromQuery, pr.ErrorType, pr.Error)
+	}
+	return decodePromResult(pr.Data.ResultType, pr.Data.Result)
+}
+
+var errInvalidPromQuery = errors.New("query rejected by Prometheus")
+
+func decodePromResult(resultType string, data json.RawMessage) ([]PromSeries, error) {
+	switch resultType {
+	case "scalar":
+		var v []any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("error reading payload from Prometheus: %w", err)
+		}
+		p, err := decodePromPoint(v)
+		if err != nil {
+			return nil, err
+		}
+		return []PromSeries{{Points: []PromPoint{p}}}, nil
+	case "vector", "matrix":
+		var results []promResult
+		if err := json.Unmarshal(data, &results); err != nil {
+			return nil, fmt.Errorf("error reading payload from Prometheus: %w", err)
+		}
+		series := make([]PromSeries, 0, len(results))
+		for _, r := range results {
+			s := PromSeries{Labels: r.Metric}
+			values := r.Values
+			if resultType == "vector" {
+				values = [][]any{r.Value}
+			}
+			for _, v := range values {
+				p, err := decodePromPoint(v)
+				if err != nil {
+					return nil, err
+				}
+				s.Points = append(s.Points, p)
+			}
+			series = append(series, s)
+		}
+		return series, nil
+	}
+	return nil, fmt.Errorf("unsupported Prometheus result type %q", resultType)
+}
+
+// A [<unix time>, "<value>"] pair. The values are strings, as they may be NaN or +Inf
+func decodePromPoint(v []any) (PromPoint, error) {
+	if len(v) != 2 {
+		return PromPoint{}, fmt.Errorf("invalid Prometheus sample %v", v)
+	}
+	ts, ok := v[0].(float64)
+	s, ok2 := v[1].(string)
+	if !ok || !ok2 {
+		return PromPoint{}, fmt.Errorf("invalid Prometheus sample %v", v)
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return PromPoint{}, fmt.Errorf("invalid Prometheus sample value %q: %w", s, err)
+	}
+	sec, frac := math.Modf(ts)
+	return PromPoint{Time: time.Unix(int64(sec), int64(frac*1e9)), Value: value}, nil
+}
+
+// The default scrape interval of Prometheus
+const defaultPromStep time.Duration = 15 * time.Second
+
+func formatPromTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+// A PromQL query whose values must be within thresholds, e.g. the request rate or the p95 latency:
+//
+//	histogram_quantile(0.95, sum by (le) (rate(http_server_duration_milliseconds_bucket[1m])))
+type PromQLTestCase struct {
+	query string
+	min   *float64
+	max   *float64
+	// Zero for an instant query
+	lookback time.Duration
+	step     time.Duration
+}
+
+func NewPromQLTestCase(query string) *PromQLTestCase {
+	return &PromQLTestCase{query: query}
+}
+
+// Expects every value to be at least min
+func (tc *PromQLTestCase) WithMin(min float64) *PromQLTestCase {
+	tc.min = &min
+	return tc
+}
+
+// Expects every value to be at most max
+func (tc *PromQLTestCase) WithMax(max float64) *PromQLTestCase {
+	tc.max = &max
+	return tc
+}
+
+// Evaluates the query over the last lookback at each step, instead of at the current time.
+// The step defaults to the scrape interval of Prometheus
+func (tc *PromQLTestCase) WithRange(lookback, step time.Duration) *PromQLTestCase {
+	if step <= 0 {
+		step = defaultPromStep
+	}
+	tc.lookback, tc.step = lookback, step
+	return tc
+}
+
+// Asserts the query of the Prometheus server at -prometheus-url returns at least one value, and that all the
+// values of all the series are within the thresholds. The query is retried until then, as Prometheus only
+// has the values after scraping the exporter, and the rates after scraping it twice
+func AssertPromQL(t TestingT, tc *PromQLTestCase) {
+	c := NewPromClient(getConfig(t).PrometheusUrl)
+
+	var d *diff
+	found := Eventually(t, "PromQL "+tc.query, func() bool {
+		Logger(t).Debug("Going to query Prometheus", "backend", "prometheus", "query", tc.query)
+		now := time.Now()
+		var series []PromSeries
+		var err error
+		if tc.lookback > 0 {
+			series, err = c.QueryRange(tc.query, now.Add(-tc.lookback), now, tc.step)
+		} else {
+			series, err = c.Query(tc.query, now)
+		}
+		if err != nil {
+			if errors.Is(err, errInvalidPromQuery) {
+				t.Fatalf("Invalid PromQL query %s: %v", tc.query, err)
+			}
+			checkBackendError(t, "prometheus", err)
+			return false
+		}
+		d = promDiff(tc, series)
+		return d.empty()
+	})
+	if !found {
+		if d == nil {
+			t.Fatalf("Could not query Prometheus for %s", tc.query)
+		}
+		t.Fatalf("Unexpected values of %s:\n%s", tc.query, d)
+	}
+}
+
+func promDiff(tc *PromQLTestCase, series []PromSeries) *diff {
+	d := &diff{}
+	if len(series) == 0 {
+		d.missing("no series returned")
+		return d
+	}
+	for _, s := range series {
+		for _, p := range s.Points {
+			if tc.min != nil && !(p.Value >= *tc.min) || tc.max != nil && !(p.Value <= *tc.max) {
+				d.mismatch("%s %g at %s, expected %s", s, p.Value, p.Time.Format(time.RFC3339), formatPromBounds(tc))
+			} else {
+				d.same("%s %g at %s", s, p.Value, p.Time.Format(time.RFC3339))
+			}
+		}
+	}
+	return d
+}
+
+func formatPromBounds(tc *PromQLTestCase) string {
+	switch {
+	case tc.min != nil && tc.max != nil:
+		return fmt.Sprintf("between %g and %g", *tc.min, *tc.max)
+	case tc.min != nil:
+		return fmt.Sprintf("at least %g", *tc.min)
+	default:
+		return fmt.Sprintf("at most %g", *tc.max)
+	}
+}
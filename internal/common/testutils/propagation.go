@@ -0,0 +1,61 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Asserts the context was propagated from one service to the other: the span of the to service is
+// found in the trace of the span of the from service, with the baggage entries as attributes
+func AssertPropagation(t TestingT, tc *PropagationTestCase) {
+	from, _ := findSpanWithRetry(t, tc.from)
+
+	to, rs := findSpanInTraceWithRetry(t, tc.to, from.GetTraceId())
+	if to == nil {
+		t.Fatalf("Could not find span %s of %s in the trace %x of span %s of %s",
+			tc.to.spanName, tc.to.serviceName, from.GetTraceId(), tc.from.spanName, tc.from.serviceName)
+	}
+
+	for _, exp := range tc.baggage {
+		assert.True(t, hasAttributes(to.GetAttributes(), []*otlpcommon.KeyValue{exp}),
+			"Baggage entry %s=%s not found in the attributes of span %s of %s",
+			exp.GetKey(), exp.GetValue().GetStringValue(), tc.to.spanName, tc.to.serviceName)
+	}
+	if tc.clientServer {
+		AssertClientServerSpans(t, from, to)
+	}
+	assertSpan(t, tc.to, to, rs)
+}
+
+// Asserts the server span handled the call of the client span, i.e. the traceparent sent by the
+// client was used as the parent of the server span
+func AssertClientServerSpans(t TestingT, client, server *otlptrace.Span) {
+	assert.Equal(t, otlptrace.Span_SPAN_KIND_CLIENT, client.GetKind(), "kind of client span %s", client.GetName())
+	assert.Equal(t, otlptrace.Span_SPAN_KIND_SERVER, server.GetKind(), "kind of server span %s", server.GetName())
+	assert.Equal(t, hex.EncodeToString(client.GetTraceId()), hex.EncodeToString(server.GetTraceId()),
+		"Spans %s and %s are in different traces", client.GetName(), server.GetName())
+	assert.Equal(t, hex.EncodeToString(client.GetSpanId()), hex.EncodeToString(server.GetParentSpanId()),
+		"Span %s is not the parent of span %s", client.GetName(), server.GetName())
+}
+
+// Finds the span of the test case in the given trace, retrying as the services may export at different times
+func findSpanInTraceWithRetry(t TestingT, tc *TraceTestCase, traceID []byte) (*otlptrace.Span, *otlptrace.ResourceSpans) {
+	var span *otlptrace.Span
+	var rs *otlptrace.ResourceSpans
+	Eventually(t, "Propagated span", func() bool {
+		rs = getTrace(t, tc.serviceName, spanQuery(tc.spanName))
+		span = nil
+		for _, s := range findSpans(rs, tc.spanName) {
+			if bytes.Equal(s.GetTraceId(), traceID) {
+				span = s
+				break
+			}
+		}
+		return span != nil
+	})
+	return span, rs
+}
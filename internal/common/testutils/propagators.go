@@ -0,0 +1,134 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The header formats a span context can be propagated with, named as in OTEL_PROPAGATORS
+const (
+	TraceContextFormat string = "tracecontext"
+	B3SingleFormat     string = "b3"
+	B3MultiFormat      string = "b3multi"
+	JaegerFormat       string = "jaeger"
+)
+
+var propagationFormats = []string{TraceContextFormat, B3SingleFormat, B3MultiFormat, JaegerFormat}
+
+// The context of a span, propagated to or from the sample API
+type SpanContext struct {
+	TraceID []byte
+	SpanID  []byte
+	Sampled bool
+}
+
+// Creates a sampled span context with random ids, e.g. to send it to the sample API
+// and assert the sample continues the trace
+func NewSpanContext() *SpanContext {
+	c := &SpanContext{TraceID: make([]byte, 16), SpanID: make([]byte, 8), Sampled: true}
+	_, _ = rand.Read(c.TraceID)
+	_, _ = rand.Read(c.SpanID)
+	return c
+}
+
+// Writes the span context in the headers of the given format
+func (c *SpanContext) Inject(format string, h http.Header) error {
+	traceID, spanID := hex.EncodeToString(c.TraceID), hex.EncodeToString(c.SpanID)
+	sampled := "0"
+	if c.Sampled {
+		sampled = "1"
+	}
+
+	switch format {
+	case TraceContextFormat:
+		h.Set("traceparent", fmt.Sprintf("00-%s-%s-0%s", traceID, spanID, sampled))
+	case B3SingleFormat:
+		h.Set("b3", fmt.Sprintf("%s-%s-%s", traceID, spanID, sampled))
+	case B3MultiFormat:
+		h.Set("X-B3-TraceId", traceID)
+		h.Set("X-B3-SpanId", spanID)
+		h.Set("X-B3-Sampled", sampled)
+	case JaegerFormat:
+		// the parent span id is deprecated and always 0
+		h.Set("uber-trace-id", fmt.Sprintf("%s:%s:0:%s", traceID, spanID, sampled))
+	default:
+		return fmt.Errorf("unknown propagation format %q. One of: %s", format, strings.Join(propagationFormats, ", "))
+	}
+	return nil
+}
+
+// Reads the span context from the headers of the given format, e.g. the headers a sample
+// sent to a downstream service, or echoed in its response
+func ExtractSpanContext(format string, h http.Header) (*SpanContext, error) {
+	var traceID, spanID, sampled string
+	switch format {
+	case TraceContextFormat:
+		parts := strings.Split(h.Get("traceparent"), "-")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid traceparent header %q", h.Get("traceparent"))
+		}
+		traceID, spanID = parts[1], parts[2]
+		if flags, err := hex.DecodeString(parts[3]); err == nil && len(flags) == 1 && flags[0]&1 == 1 {
+			sampled = "1"
+		}
+	case B3SingleFormat:
+		parts := strings.Split(h.Get("b3"), "-")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid b3 header %q", h.Get("b3"))
+		}
+		traceID, spanID = parts[0], parts[1]
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+	case B3MultiFormat:
+		traceID, spanID, sampled = h.Get("X-B3-TraceId"), h.Get("X-B3-SpanId"), h.Get("X-B3-Sampled")
+	case JaegerFormat:
+		parts := strings.Split(h.Get("uber-trace-id"), ":")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid uber-trace-id header %q", h.Get("uber-trace-id"))
+		}
+		traceID, spanID = parts[0], parts[1]
+		if flags, err := hex.DecodeString(fmt.Sprintf("%02s", parts[3])); err == nil && len(flags) == 1 && flags[0]&1 == 1 {
+			sampled = "1"
+		}
+	default:
+		return nil, fmt.Errorf("unknown propagation format %q. One of: %s", format, strings.Join(propagationFormats, ", "))
+	}
+
+	c := &SpanContext{Sampled: sampled == "1" || sampled == "d" || strings.EqualFold(sampled, "true")}
+	var err error
+	// 64 bit trace ids of B3 and Jaeger are left padded to 128 bit, as done by the OTel propagators
+	if c.TraceID, err = hex.DecodeString(fmt.Sprintf("%032s", traceID)); err != nil || len(c.TraceID) != 16 {
+		return nil, fmt.Errorf("invalid trace id %q in the %s headers", traceID, format)
+	}
+	if c.SpanID, err = hex.DecodeString(fmt.Sprintf("%016s", spanID)); err != nil || len(c.SpanID) != 8 {
+		return nil, fmt.Errorf("invalid span id %q in the %s headers", spanID, format)
+	}
+	return c, nil
+}
+
+// Sends the span context in the headers of the given format, so the sample continues its trace
+func (r *SampleRequest) WithSpanContext(format string, c *SpanContext) *SampleRequest {
+	if err := c.Inject(format, r.headers); err != nil {
+		r.err = err
+	}
+	return r
+}
+
+// Asserts the span of the test case continues the span context, i.e. it is in the same trace and its
+// parent is the span of the context. Used with contexts sent to the sample API via WithSpanContext
+func AssertSpanContinuesContext(t TestingT, tc *TraceTestCase, c *SpanContext) {
+	span, rs := findSpanInTraceWithRetry(t, tc, c.TraceID)
+	if span == nil {
+		t.Fatalf("Could not find span %s of %s in the propagated trace %x", tc.spanName, tc.serviceName, c.TraceID)
+	}
+	assert.True(t, bytes.Equal(c.SpanID, span.GetParentSpanId()),
+		"Span %s has parent %x, expected the propagated span %x", span.GetName(), span.GetParentSpanId(), c.SpanID)
+	assertSpan(t, tc, span, rs)
+}
@@ -0,0 +1,132 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	// How far back the traces are queried when neither a lookback nor a start is set
+	defaultTraceLookback time.Duration = time.Hour
+	// How much the clock of the containers may be behind the one of the tests, e.g. in the Docker VM on macOS
+	traceClockSkew time.Duration = 10 * time.Second
+)
+
+// A Config.TraceStart for a run starting now, so only the traces of the run are queried, e.g. in long
+// running CI environments where the back-ends keep the traces of the previous runs
+func TraceStartNow() string {
+	return time.Now().Add(-traceClockSkew).UTC().Format(time.RFC3339Nano)
+}
+
+// The window the traces are queried in: from Start, or Lookback ago if not set, until End or now
+func (o TraceQueryOptions) window(now time.Time) (time.Time, time.Time) {
+	end := o.End
+	if end.IsZero() {
+		end = now
+	}
+	start := o.Start
+	if start.IsZero() {
+		lookback := o.Lookback
+		if lookback <= 0 {
+			lookback = defaultTraceLookback
+		}
+		start = end.Add(-lookback)
+	}
+	return start, end
+}
+
+// The limit of the query, or the limit of the back-end if not set
+func (o TraceQueryOptions) limit(def int) int {
+	if o.Limit > 0 {
+		return o.Limit
+	}
+	return def
+}
+
+// Sets the limit and the window of the query configured for the test, unless set by the caller
+func traceQuery(t TestingT, opts TraceQueryOptions) TraceQueryOptions {
+	c := getConfig(t)
+	if opts.Limit == 0 && c.TraceLimit != "" {
+		limit, err := strconv.Atoi(c.TraceLimit)
+		if err != nil || limit <= 0 {
+			t.Fatalf("Invalid trace limit %q, expected a positive number", c.TraceLimit)
+		}
+		opts.Limit = limit
+	}
+	if opts.Lookback == 0 && c.TraceLookback != "" {
+		lookback, err := time.ParseDuration(c.TraceLookback)
+		if err != nil || lookback <= 0 {
+			t.Fatalf("Invalid trace lookback %q, expected a duration, e.g. 10m", c.TraceLookback)
+		}
+		opts.Lookback = lookback
+	}
+	if opts.Start.IsZero() && c.TraceStart != "" {
+		start, err := time.Parse(time.RFC3339Nano, c.TraceStart)
+		if err != nil {
+			t.Fatalf("Invalid trace start %q, expected an RFC 3339 time, e.g. 2024-06-01T10:00:00Z", c.TraceStart)
+		}
+		opts.Start = start
+	}
+	return opts
+}
+
+// Leaves out the spans started outside the window of the query and, with a limit, the spans of the older
+// traces. For the back-ends not filtering the traces themselves, e.g. the OTLP back-end
+func filterTraceWindow(rs *otlptrace.ResourceSpans, opts TraceQueryOptions) *otlptrace.ResourceSpans {
+	if rs == nil || opts.Start.IsZero() && opts.End.IsZero() && opts.Lookback == 0 && opts.Limit == 0 {
+		return rs
+	}
+	start, end := opts.window(time.Now())
+	from, to := uint64(start.UnixNano()), uint64(end.UnixNano())
+
+	// the latest start of each trace, to only keep the most recent ones
+	latest := make(map[string]uint64)
+	for _, ss := range rs.GetScopeSpans() {
+		for _, s := range ss.GetSpans() {
+			if inWindow(s, from, to) && s.StartTimeUnixNano > latest[string(s.TraceId)] {
+				latest[string(s.TraceId)] = s.StartTimeUnixNano
+			}
+		}
+	}
+	if opts.Limit > 0 && len(latest) > opts.Limit {
+		ids := make([]string, 0, len(latest))
+		for id := range latest {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return latest[ids[i]] > latest[ids[j]] })
+		for _, id := range ids[opts.Limit:] {
+			delete(latest, id)
+		}
+	}
+
+	res := &otlptrace.ResourceSpans{Resource: rs.GetResource(), SchemaUrl: rs.GetSchemaUrl()}
+	for _, ss := range rs.GetScopeSpans() {
+		var spans []*otlptrace.Span
+		for _, s := range ss.GetSpans() {
+			if _, found := latest[string(s.TraceId)]; found && inWindow(s, from, to) {
+				spans = append(spans, s)
+			}
+		}
+		if len(spans) > 0 {
+			res.ScopeSpans = append(res.ScopeSpans, &otlptrace.ScopeSpans{Scope: ss.GetScope(), SchemaUrl: ss.GetSchemaUrl(), Spans: spans})
+		}
+	}
+	return res
+}
+
+// Fetches the traces of the service with the query configured for the test, see traceQuery
+func queryTraces(t TestingT, serviceName string, opts TraceQueryOptions) (*otlptrace.ResourceSpans, error) {
+	opts = traceQuery(t, opts)
+	rs, err := getTraceBackend(t).GetTraces(serviceName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return filterTraceWindow(rs, opts), nil
+}
+
+func inWindow(s *otlptrace.Span, from, to uint64) bool {
+	return s.StartTimeUnixNano >= from && s.StartTimeUnixNano <= to
+}
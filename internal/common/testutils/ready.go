@@ -0,0 +1,48 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"context"
+	"flag"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/waitfor"
+)
+
+var sampleStartupTimeout = flag.Duration("sample-startup-timeout", time.Minute, "Max time to wait for the sample API to be ready before invoking it. 0 disables the wait")
+
+// The sample addresses already known to be ready, so the wait only happens on the first call
+var readySamples sync.Map
+
+// Waits until the sample API at the address of rawUrl answers, e.g. while the app is still starting inside compose
+func waitForSampleApi(t TestingT, rawUrl string) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return
+	}
+	base := u.Scheme + "://" + u.Host + "/"
+	waitForSample(t, base, func(ctx context.Context) error { return waitfor.WaitForHTTP(ctx, base) })
+}
+
+func waitForSampleGrpcApi(t TestingT, target string) {
+	waitForSample(t, target, func(ctx context.Context) error { return waitfor.WaitForPort(ctx, target) })
+}
+
+func waitForSample(t TestingT, addr string, wait func(ctx context.Context) error) {
+	if *sampleStartupTimeout <= 0 {
+		return
+	}
+	if _, ready := readySamples.Load(addr); ready {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *sampleStartupTimeout)
+	defer cancel()
+
+	Logger(t).Info("Waiting for the sample API to be ready", "addr", addr)
+	if err := wait(ctx); err != nil {
+		t.Fatalf("The sample API is not ready: %v", err)
+	}
+	readySamples.Store(addr, true)
+}
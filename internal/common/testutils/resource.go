@@ -0,0 +1,66 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"github.com/stretchr/testify/assert"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Asserts the resource has the attributes every OTel SDK is required to set:
+// service.name and telemetry.sdk.name/language/version. sdkLanguage is one of the
+// telemetry.sdk.language values, e.g. go, dotnet, java, nodejs, python. Empty skips the check.
+func AssertSdkResource(t TestingT, r *otlpresource.Resource, serviceName, sdkLanguage string) {
+	assert.Equal(t, serviceName, getServiceName(r), "Unexpected service.name resource attribute")
+	assert.Equal(t, "opentelemetry", getStringAttribute(r.GetAttributes(), "telemetry.sdk.name"), "Unexpected telemetry.sdk.name resource attribute")
+	assert.NotEmpty(t, getStringAttribute(r.GetAttributes(), "telemetry.sdk.version"), "Missing telemetry.sdk.version resource attribute")
+	if sdkLanguage != "" {
+		assert.Equal(t, sdkLanguage, getStringAttribute(r.GetAttributes(), "telemetry.sdk.language"), "Unexpected telemetry.sdk.language resource attribute")
+	}
+}
+
+func AssertResourceAttributes(t TestingT, r *otlpresource.Resource, attributes ...*otlpcommon.KeyValue) {
+	AssertAttributes(t, "the resource", r.GetAttributes(), attributes...)
+}
+
+// The resource attributes identifying the service and its SDK, which are the same for all the signals
+var serviceResourceKeys = []string{
+	"service.name", "service.namespace", "service.version", "service.instance.id",
+	"telemetry.sdk.name", "telemetry.sdk.language", "telemetry.sdk.version",
+}
+
+// Asserts the resources of the signals identify the same service, e.g. the logger provider was configured with
+// the resource of the tracer provider. The attributes identifying the service or its SDK must have the same
+// value in all the resources having them, as some trace back-ends only keep a few resource attributes
+func AssertSameService(t TestingT, resources ...*otlpresource.Resource) {
+	for _, key := range serviceResourceKeys {
+		var first *otlpcommon.KeyValue
+		for _, r := range resources {
+			kv := findAttribute(r.GetAttributes(), key)
+			if kv == nil {
+				continue
+			}
+			if first == nil {
+				first = kv
+				continue
+			}
+			if !proto.Equal(first.GetValue(), kv.GetValue()) {
+				assert.Fail(t, "Unexpected resource attribute", "Resource attribute %s is %v for a signal and %v for another, is the same resource set for all the providers?",
+					key, formatAnyValue(first.GetValue()), formatAnyValue(kv.GetValue()))
+			}
+		}
+	}
+}
+
+func getStringAttribute(attributes []*otlpcommon.KeyValue, key string) string {
+	for _, attr := range attributes {
+		if attr.GetKey() == key {
+			return attr.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
+
+func getServiceName(r *otlpresource.Resource) string {
+	return getStringAttribute(r.GetAttributes(), "service.name")
+}
@@ -0,0 +1,72 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"context"
+	"flag"
+	"sync"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/retry"
+)
+
+var retryInitialInterval = flag.Duration("retry-initial-interval", 0, "Wait before retrying to fetch the telemetry for the first time")
+var retryMaxInterval = flag.Duration("retry-max-interval", 0, "Max wait between two attempts to fetch the telemetry")
+var retryMaxElapsedTime = flag.Duration("retry-max-elapsed", 0, "Time after which the tests give up fetching the telemetry")
+
+var (
+	retryPolicyMu sync.Mutex
+	// The policy set via SetRetryPolicy. Takes precedence over the flags,
+	// but not over the policy of an expected telemetry file
+	retryPolicy *retry.Policy
+)
+
+// Sets the policy used to retry fetching the telemetry from the back-ends,
+// e.g. for recipes with slow exporters
+func SetRetryPolicy(p retry.Policy) {
+	retryPolicyMu.Lock()
+	defer retryPolicyMu.Unlock()
+	retryPolicy = &p
+}
+
+func getRetryPolicy(t TestingT) retry.Policy {
+	if s := findScope(t, func(s *testScope) bool { return s.retry != nil }); s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return *s.retry
+	}
+	retryPolicyMu.Lock()
+	defer retryPolicyMu.Unlock()
+	if retryPolicy != nil {
+		return *retryPolicy
+	}
+
+	p := retry.DefaultPolicy()
+	if *retryInitialInterval > 0 {
+		p.InitialInterval = *retryInitialInterval
+	}
+	if *retryMaxInterval > 0 {
+		p.MaxInterval = *retryMaxInterval
+	}
+	if *retryMaxElapsedTime > 0 {
+		p.MaxElapsedTime = *retryMaxElapsedTime
+	}
+	return p
+}
+
+// Calls found until it returns true, following the retry policy and bounded by the
+// test deadline (go test -timeout). Returns false if the telemetry was never found.
+func Eventually(t TestingT, what string, found func() bool) bool {
+	ctx := context.Background()
+	if deadline, ok := t.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	err := retry.DoNotify(ctx, getRetryPolicy(t),
+		func() (bool, error) { return found(), nil },
+		func(attempt int, wait time.Duration) {
+			Logger(t).Info("Not found yet, retrying", "what", what, "attempt", attempt, "wait", wait)
+		})
+	return err == nil
+}
@@ -0,0 +1,41 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import "math"
+
+// Default number of standard deviations the sampled span count may deviate from the expected count.
+// With 4, a correctly configured sampler fails the assertion about once in 15000 runs
+const defaultSamplingStdDevs float64 = 4
+
+// Asserts the number of spans sampled out of the total is within the range expected for the sampling ratio,
+// e.g. for samples configured with a TraceIdRatioBased sampler. The sampled count follows a binomial
+// distribution, so the range is the expected count plus or minus a number of standard deviations
+func AssertSamplingRatio(t TestingT, tc *SamplingTestCase) {
+	// when sending the requests, the spans of earlier requests are not counted
+	baseline := 0
+	if tc.request != nil {
+		baseline = len(findSpans(getTrace(t, tc.serviceName, spanQuery(tc.spanName)), tc.spanName))
+		for i := 0; i < tc.total; i++ {
+			InvokeSampleRequest(t, tc.request)
+		}
+	}
+
+	expected := float64(tc.total) * tc.ratio
+	delta := tc.stdDevs * math.Sqrt(expected*(1-tc.ratio))
+	min := int(math.Max(0, math.Ceil(expected-delta)))
+	max := int(math.Floor(expected + delta))
+
+	// the spans are usually exported in batches, so wait until the count settles
+	count, previous := 0, -1
+	Eventually(t, "Sampled spans", func() bool {
+		count = len(findSpans(getTrace(t, tc.serviceName, spanQuery(tc.spanName)), tc.spanName)) - baseline
+		settled := count == previous && count >= min && (count > 0 || expected < 1)
+		previous = count
+		return settled
+	})
+
+	Logger(t).Info("Sampled the spans", "span", tc.spanName, "sampled", count, "total", tc.total, "min", min, "max", max, "ratio", tc.ratio)
+	if count < min || count > max {
+		t.Errorf("Sampled %d of %d spans %s, expected between %d and %d for the ratio %v",
+			count, tc.total, tc.spanName, min, max, tc.ratio)
+	}
+}
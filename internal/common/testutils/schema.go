@@ -0,0 +1,52 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"github.com/stretchr/testify/assert"
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const schemaUrlPrefix string = "https://opentelemetry.io/schemas/"
+
+// Returns the schema URL of a version of the semantic conventions, e.g. https://opentelemetry.io/schemas/1.26.0
+func SchemaUrl(semconvVersion string) string {
+	return schemaUrlPrefix + semconvVersion
+}
+
+// Asserts the resource of the spans reports the schema URL of the semantic conventions version, e.g. 1.26.0,
+// and so do the scopes reporting one. The schema URLs are only kept by the back-ends receiving OTLP
+func AssertTraceSchemaUrl(t TestingT, rs *otlptrace.ResourceSpans, semconvVersion string) {
+	scopes := make(map[string]string)
+	for _, ss := range rs.GetScopeSpans() {
+		scopes[ss.GetScope().GetName()] = ss.GetSchemaUrl()
+	}
+	assertSchemaUrls(t, rs.GetSchemaUrl(), scopes, semconvVersion)
+}
+
+func AssertMetricsSchemaUrl(t TestingT, rm *otlpmetrics.ResourceMetrics, semconvVersion string) {
+	scopes := make(map[string]string)
+	for _, sm := range rm.GetScopeMetrics() {
+		scopes[sm.GetScope().GetName()] = sm.GetSchemaUrl()
+	}
+	assertSchemaUrls(t, rm.GetSchemaUrl(), scopes, semconvVersion)
+}
+
+func AssertLogsSchemaUrl(t TestingT, rl *otlplogs.ResourceLogs, semconvVersion string) {
+	scopes := make(map[string]string)
+	for _, sl := range rl.GetScopeLogs() {
+		scopes[sl.GetScope().GetName()] = sl.GetSchemaUrl()
+	}
+	assertSchemaUrls(t, rl.GetSchemaUrl(), scopes, semconvVersion)
+}
+
+func assertSchemaUrls(t TestingT, resource string, scopes map[string]string, semconvVersion string) {
+	expected := SchemaUrl(semconvVersion)
+	assert.Equal(t, expected, resource, "Unexpected schema URL of the resource")
+	for name, url := range scopes {
+		// the instrumentation libraries not following a version of the conventions report none
+		if url != "" {
+			assert.Equal(t, expected, url, "Unexpected schema URL of the instrumentation scope %s", name)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/retry"
+)
+
+// Settings of a test and its subtests. They allow validating several samples in
+// parallel within one go test invocation, each with its own addresses and back-ends.
+type testScope struct {
+	// guards all the fields, read by the parallel subtests
+	mu             sync.Mutex
+	config         *Config
+	retry          *retry.Policy
+	logAttrs       []any
+	traceBackend   TraceBackend
+	metricsBackend MetricsBackend
+	logsBackend    LogsBackend
+	exports        ExportRecorder
+}
+
+// Scopes keyed by the name of the test they were set for
+var scopes sync.Map
+
+// Sets the configuration used by t and its subtests, instead of the one returned by GetConfig.
+// The back-ends are created from it, so each parallel test can query its own back-ends:
+//
+//	t.Run(sample, func(t *testing.T) {
+//		t.Parallel()
+//		tu.UseConfig(t, cfg)
+//		tu.AssertSpecFile(t, specPath)
+//	})
+func UseConfig(t TestingT, c *Config) {
+	s := getOrCreateScope(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = c
+}
+
+// A capture endpoint the exporters of a sample are pointed to, e.g. the otlpsink, serving as its back-end
+type ExporterCapture interface {
+	TraceBackend
+	MetricsBackend
+	LogsBackend
+	ExportRecorder
+}
+
+// Sets the capture endpoint the sample tested by t exports to, e.g. via the variables of ExporterEnv. It is
+// the back-end of all the signals of t and its subtests, and its exports are asserted by AssertSpec. The
+// back-ends set via SetTraceBackend, SetMetricsBackend and SetLogsBackend still take precedence
+func UseExporterCapture(t TestingT, c ExporterCapture) {
+	s := getOrCreateScope(t)
+	parent := getConfig(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config == nil {
+		s.config = parent
+	}
+	s.traceBackend, s.metricsBackend, s.logsBackend, s.exports = c, c, c, c
+}
+
+// Returns the recorder set via UseExporterCapture for t, or nil
+func exportRecorder(t TestingT) ExportRecorder {
+	s := findScope(t, func(s *testScope) bool { return s.exports != nil })
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exports
+}
+
+// Sets the retry policy used by t and its subtests
+func useRetryPolicy(t TestingT, p retry.Policy) {
+	s := getOrCreateScope(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retry = &p
+}
+
+func getOrCreateScope(t TestingT) *testScope {
+	s, loaded := scopes.LoadOrStore(t.Name(), &testScope{})
+	if !loaded {
+		t.Cleanup(func() { scopes.Delete(t.Name()) })
+	}
+	return s.(*testScope)
+}
+
+// Finds the closest scope setting the given field, walking up from t to its parent tests.
+// has is called with the lock of the scope held
+func findScope(t TestingT, has func(*testScope) bool) *testScope {
+	name := t.Name()
+	for {
+		if v, found := scopes.Load(name); found {
+			s := v.(*testScope)
+			s.mu.Lock()
+			ok := has(s)
+			s.mu.Unlock()
+			if ok {
+				return s
+			}
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			return nil
+		}
+		name = name[:i]
+	}
+}
+
+func findConfigScope(t TestingT) *testScope {
+	return findScope(t, func(s *testScope) bool { return s.config != nil })
+}
+
+// Returns the configuration used by t, e.g. to change one of its addresses before passing a copy to UseConfig
+func ConfigOf(t TestingT) *Config {
+	return getConfig(t)
+}
+
+// Returns the configuration set for the test via UseConfig, or the global one
+func getConfig(t TestingT) *Config {
+	if s := findConfigScope(t); s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.config
+	}
+	return GetConfig()
+}
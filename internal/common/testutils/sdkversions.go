@@ -0,0 +1,37 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The SDK version building the sample with the versions of its dependency files, e.g. its go.mod
+const LatestSdkVersion string = "latest"
+
+// Applies the overrides of the SDK version, declared under sdkOverrides, to the spec document. The
+// overridden versions must be listed in sdkVersions
+func applySdkOverrides(doc *yaml.Node, sdkVersion string) error {
+	var versions []string
+	if n := mappingValue(specRoot(doc), "sdkVersions"); n != nil {
+		if err := n.Decode(&versions); err != nil {
+			return fmt.Errorf("sdkVersions must be a list of versions: %w", err)
+		}
+	}
+	return applyOverrides(doc, "sdkOverrides", "SDK version", sdkVersion, func(v string) error {
+		if !slices.Contains(versions, v) {
+			return fmt.Errorf("overrides of SDK version %s, which is not in sdkVersions %v", v, versions)
+		}
+		return nil
+	})
+}
+
+// The value of the SDK_VERSION build argument of the sample for the SDK version. Empty for LatestSdkVersion,
+// so the Dockerfile builds the sample as it is
+func SdkBuildArg(sdkVersion string) string {
+	if sdkVersion == LatestSdkVersion {
+		return ""
+	}
+	return sdkVersion
+}
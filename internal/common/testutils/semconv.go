@@ -0,0 +1,50 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"flag"
+	"sync"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/semconv"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	semconvOff    string = "off"
+	semconvWarn   string = "warn"
+	semconvStrict string = "strict"
+)
+
+// How the asserted spans are validated against the semantic conventions:
+// off disables it, warn logs the violations and strict fails the test on any violation
+var semconvMode = flag.String("semconv", semconvWarn, "Semantic conventions validation mode. One of: off, warn, strict")
+
+// Loaded once, on the first validation
+var semconvRegistry = sync.OnceValue(semconv.Default)
+
+// Validates the span attributes against the bundled semantic conventions registry.
+// When strict is false the violations are only logged.
+func AssertSemanticConventions(t TestingT, span *otlptrace.Span, strict bool) {
+	for _, v := range getSemconvRegistry().ValidateSpan(span) {
+		if strict {
+			t.Errorf("Span %s does not follow the semantic conventions: %s", span.Name, v)
+		} else {
+			Logger(t).Warn("Span does not follow the semantic conventions", "span", span.Name, "violation", v)
+		}
+	}
+}
+
+func getSemconvRegistry() *semconv.Registry {
+	return semconvRegistry()
+}
+
+func validateSemanticConventions(t TestingT, span *otlptrace.Span) {
+	switch *semconvMode {
+	case semconvOff:
+	case semconvWarn:
+		AssertSemanticConventions(t, span, false)
+	case semconvStrict:
+		AssertSemanticConventions(t, span, true)
+	default:
+		t.Fatalf("Unknown semantic conventions validation mode: %s", *semconvMode)
+	}
+}
@@ -0,0 +1,223 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// A call from a service to another in a trace: a span of the To service whose parent is a span of the From
+// service. The kinds default to a client span calling a server span
+type ServiceEdge struct {
+	From     string
+	To       string
+	FromKind otlptrace.Span_SpanKind
+	ToKind   otlptrace.Span_SpanKind
+}
+
+func (e ServiceEdge) String() string {
+	return fmt.Sprintf("%s (%s) -> %s (%s)", e.From, formatSpanKind(e.FromKind), e.To, formatSpanKind(e.ToKind))
+}
+
+// The services of a trace and the calls between them, e.g. for recipes of several services calling each other
+type ServiceGraphTestCase struct {
+	services []string
+	edges    []ServiceEdge
+	exact    bool
+}
+
+// Creates a test case for a trace spanning the services. The first one is queried for the traces, so it
+// should be the entry point of the requests, e.g. a frontend
+func NewServiceGraphTestCase(services ...string) *ServiceGraphTestCase {
+	return &ServiceGraphTestCase{services: services}
+}
+
+// Expects a client span of from calling a server span of to
+func (tc *ServiceGraphTestCase) WithEdge(from, to string) *ServiceGraphTestCase {
+	return tc.WithEdgeKinds(from, to, otlptrace.Span_SPAN_KIND_CLIENT, otlptrace.Span_SPAN_KIND_SERVER)
+}
+
+// Expects a span of from with the kind being the parent of a span of to with the kind, e.g. a producer
+// span and the consumer span processing its message
+func (tc *ServiceGraphTestCase) WithEdgeKinds(from, to string, fromKind, toKind otlptrace.Span_SpanKind) *ServiceGraphTestCase {
+	tc.edges = append(tc.edges, ServiceEdge{From: from, To: to, FromKind: fromKind, ToKind: toKind})
+	return tc
+}
+
+// Expects a chain of client/server calls, e.g. WithPath("frontend", "cart", "redis") for frontend -> cart -> redis
+func (tc *ServiceGraphTestCase) WithPath(services ...string) *ServiceGraphTestCase {
+	for i := 1; i < len(services); i++ {
+		tc.WithEdge(services[i-1], services[i])
+	}
+	return tc
+}
+
+// Expects the trace to have no other services nor calls than the expected ones
+func (tc *ServiceGraphTestCase) Exactly() *ServiceGraphTestCase {
+	tc.exact = true
+	return tc
+}
+
+// The services and calls found in a trace
+type serviceGraph struct {
+	traceID  []byte
+	services map[string]bool
+	edges    map[ServiceEdge]bool
+}
+
+// Asserts a trace of the first service spans all the services, with the expected calls between them.
+// The spans of each service are fetched from the trace back-end, as the services may export at different times
+func AssertServiceGraph(t TestingT, tc *ServiceGraphTestCase) {
+	if len(tc.services) == 0 {
+		t.Fatal("No services expected in the service graph")
+	}
+	services := append([]string(nil), tc.services...)
+	for _, e := range tc.edges {
+		for _, s := range []string{e.From, e.To} {
+			if !containsString(services, s) {
+				services = append(services, s)
+			}
+		}
+	}
+
+	var closest *serviceGraph
+	found := Eventually(t, "Trace spanning "+strings.Join(services, ", "), func() bool {
+		closest = nil
+		graphs := findServiceGraphs(t, services)
+		for _, g := range graphs {
+			if closest == nil || g.score(tc) > closest.score(tc) {
+				closest = g
+			}
+			if g.missing(tc, services) == "" {
+				return true
+			}
+		}
+		return false
+	})
+	if found {
+		return
+	}
+	if closest == nil {
+		t.Fatalf("Could not find any trace of %s", tc.services[0])
+	}
+	t.Fatalf("Could not find a trace of %s with the expected service graph. Closest trace %x:\n%s",
+		tc.services[0], closest.traceID, closest.missing(tc, services))
+}
+
+// Builds the graph of each trace of the first service, with the spans of all the services
+func findServiceGraphs(t TestingT, services []string) []*serviceGraph {
+	type serviceSpan struct {
+		service string
+		span    *otlptrace.Span
+	}
+	byTrace := make(map[string]map[string]serviceSpan)
+	var traceIds []string
+	for i, svc := range services {
+		for _, s := range allSpans(getTrace(t, svc, TraceQueryOptions{})) {
+			id := string(s.GetTraceId())
+			spans, found := byTrace[id]
+			if !found {
+				// only the traces of the first service are candidates
+				if i > 0 {
+					continue
+				}
+				spans = make(map[string]serviceSpan)
+				byTrace[id] = spans
+				traceIds = append(traceIds, id)
+			}
+			spans[string(s.GetSpanId())] = serviceSpan{service: svc, span: s}
+		}
+	}
+
+	graphs := make([]*serviceGraph, 0, len(traceIds))
+	for _, id := range traceIds {
+		g := &serviceGraph{traceID: []byte(id), services: make(map[string]bool), edges: make(map[ServiceEdge]bool)}
+		for _, s := range byTrace[id] {
+			g.services[s.service] = true
+			parent, found := byTrace[id][string(s.span.GetParentSpanId())]
+			if found && parent.service != s.service {
+				g.edges[ServiceEdge{From: parent.service, To: s.service, FromKind: parent.span.GetKind(), ToKind: s.span.GetKind()}] = true
+			}
+		}
+		graphs = append(graphs, g)
+	}
+	return graphs
+}
+
+// The number of expected services and calls found, to report the closest trace
+func (g *serviceGraph) score(tc *ServiceGraphTestCase) int {
+	n := 0
+	for _, s := range tc.services {
+		if g.services[s] {
+			n++
+		}
+	}
+	for _, e := range tc.edges {
+		if g.edges[e] {
+			n++
+		}
+	}
+	return n
+}
+
+// Lists the services and calls missing from the trace, and the unexpected ones with Exactly. Empty if it matches
+func (g *serviceGraph) missing(tc *ServiceGraphTestCase, services []string) string {
+	d := &diff{}
+	for _, s := range services {
+		if g.services[s] {
+			d.same("service %s", s)
+		} else {
+			d.missing("service %s", s)
+		}
+	}
+	for _, e := range tc.edges {
+		if g.edges[e] {
+			d.same("call %s", e)
+		} else {
+			d.missing("call %s", e)
+		}
+	}
+
+	var others []string
+	for e := range g.edges {
+		if !containsEdge(tc.edges, e) {
+			others = append(others, e.String())
+		}
+	}
+	sort.Strings(others)
+	for _, e := range others {
+		if tc.exact {
+			d.unexpected("call %s", e)
+		} else {
+			d.same("call %s", e)
+		}
+	}
+	if d.empty() {
+		return ""
+	}
+	return d.String()
+}
+
+func containsEdge(edges []ServiceEdge, e ServiceEdge) bool {
+	for _, exp := range edges {
+		if exp == e {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func formatSpanKind(k otlptrace.Span_SpanKind) string {
+	return strings.ToLower(strings.TrimPrefix(k.String(), "SPAN_KIND_"))
+}
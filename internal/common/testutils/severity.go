@@ -0,0 +1,117 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+	"strings"
+
+	otlplogs "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// The range of severity numbers of a level, e.g. WARN to WARN4 for warnings
+type SeverityRange struct {
+	Min, Max otlplogs.SeverityNumber
+}
+
+func (r SeverityRange) String() string {
+	if r.Min == r.Max {
+		return severityName(r.Min)
+	}
+	return fmt.Sprintf("%s-%s", severityName(r.Min), severityName(r.Max))
+}
+
+func (r SeverityRange) contains(n otlplogs.SeverityNumber) bool {
+	return n >= r.Min && n <= r.Max
+}
+
+var (
+	traceSeverities = SeverityRange{otlplogs.SeverityNumber_SEVERITY_NUMBER_TRACE, otlplogs.SeverityNumber_SEVERITY_NUMBER_TRACE4}
+	debugSeverities = SeverityRange{otlplogs.SeverityNumber_SEVERITY_NUMBER_DEBUG, otlplogs.SeverityNumber_SEVERITY_NUMBER_DEBUG4}
+	infoSeverities  = SeverityRange{otlplogs.SeverityNumber_SEVERITY_NUMBER_INFO, otlplogs.SeverityNumber_SEVERITY_NUMBER_INFO4}
+	warnSeverities  = SeverityRange{otlplogs.SeverityNumber_SEVERITY_NUMBER_WARN, otlplogs.SeverityNumber_SEVERITY_NUMBER_WARN4}
+	errorSeverities = SeverityRange{otlplogs.SeverityNumber_SEVERITY_NUMBER_ERROR, otlplogs.SeverityNumber_SEVERITY_NUMBER_ERROR4}
+	fatalSeverities = SeverityRange{otlplogs.SeverityNumber_SEVERITY_NUMBER_FATAL, otlplogs.SeverityNumber_SEVERITY_NUMBER_FATAL4}
+)
+
+// The native levels of the logging libraries used by the recipes, lower cased, and the severity numbers
+// their bridges map them to, see https://opentelemetry.io/docs/specs/otel/logs/data-model-appendix/#appendix-b-severitynumber-example-mappings
+var levelSeverities = map[string]SeverityRange{
+	"trace":       traceSeverities,
+	"verbose":     traceSeverities,
+	"finest":      traceSeverities,
+	"debug":       debugSeverities,
+	"finer":       debugSeverities,
+	"fine":        debugSeverities,
+	"config":      debugSeverities,
+	"info":        infoSeverities,
+	"information": infoSeverities,
+	"notice":      infoSeverities,
+	"warn":        warnSeverities,
+	"warning":     warnSeverities,
+	"error":       errorSeverities,
+	"err":         errorSeverities,
+	"severe":      errorSeverities,
+	"fatal":       fatalSeverities,
+	"critical":    fatalSeverities,
+	"crit":        fatalSeverities,
+	"panic":       fatalSeverities,
+	"alert":       fatalSeverities,
+	"emergency":   fatalSeverities,
+	"emerg":       fatalSeverities,
+}
+
+// The severity numbers a native level is mapped to, e.g. WARN-WARN4 for the Warn level of logrus.
+// Also accepts the short names of the severity numbers, e.g. INFO2
+func SeverityRangeOf(level string) (SeverityRange, bool) {
+	if r, found := levelSeverities[strings.ToLower(level)]; found {
+		return r, true
+	}
+	if n, found := otlplogs.SeverityNumber_value["SEVERITY_NUMBER_"+strings.ToUpper(level)]; found && n != 0 {
+		return SeverityRange{otlplogs.SeverityNumber(n), otlplogs.SeverityNumber(n)}, true
+	}
+	return SeverityRange{}, false
+}
+
+// The short name of the severity number, e.g. WARN for SEVERITY_NUMBER_WARN
+func severityName(n otlplogs.SeverityNumber) string {
+	return strings.TrimPrefix(n.String(), "SEVERITY_NUMBER_")
+}
+
+// Asserts the severity number of each log record agrees with its severity text, e.g. a Warning log has a
+// number between WARN and WARN4. Catches log appenders mapping the levels of the logging library wrongly
+func AssertLogSeverities(t TestingT, rl *otlplogs.ResourceLogs) {
+	t.Helper()
+	for _, sl := range rl.GetScopeLogs() {
+		for _, l := range sl.GetLogRecords() {
+			assertLogSeverity(t, l)
+		}
+	}
+}
+
+// Asserts the severity number agrees with the severity text, when both are set and the text is a known level
+func assertLogSeverity(t TestingT, l *otlplogs.LogRecord) {
+	t.Helper()
+	r, found := SeverityRangeOf(l.GetSeverityText())
+	if !found || l.GetSeverityNumber() == otlplogs.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+		return
+	}
+	if !r.contains(l.GetSeverityNumber()) {
+		t.Errorf("The log %v has the severity text %s but the severity number %s, expected %s. Is the log appender mapping the levels?",
+			formatAnyValue(l.GetBody()), l.GetSeverityText(), severityName(l.GetSeverityNumber()), r)
+	}
+}
+
+// Asserts the severity number of the log record is within the range of the level, e.g. WARN-WARN4 for warn,
+// or is the severity number itself, e.g. for WARN2
+func AssertSeverityNumber(t TestingT, l *otlplogs.LogRecord, level string) {
+	t.Helper()
+	r, found := SeverityRangeOf(level)
+	if !found {
+		t.Fatalf("Unknown log level %s", level)
+	}
+	switch {
+	case l.GetSeverityNumber() == otlplogs.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED:
+		t.Errorf("The log %v has no severity number, expected %s. Is the log appender setting it?", formatAnyValue(l.GetBody()), r)
+	case !r.contains(l.GetSeverityNumber()):
+		t.Errorf("The log %v has the severity number %s, expected %s", formatAnyValue(l.GetBody()), severityName(l.GetSeverityNumber()), r)
+	}
+}
@@ -0,0 +1,53 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/hex"
+	"strings"
+
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// How many trace ids are printed when spans are missing or duplicated
+const maxReportedTraces int = 10
+
+// Asserts each of the traces, e.g. the span contexts sent with concurrent requests to the sample API, has exactly
+// one span matching the test case by name and, if set, kind. Missing spans, e.g. still in a batch, are waited for
+// until the retries are exhausted, then reported as dropped together with the spans exported more than once
+func AssertSpanPerTrace(t TestingT, tc *TraceTestCase, traces []*SpanContext) {
+	counts := make(map[string]int, len(traces))
+	Eventually(t, "Spans of the traces", func() bool {
+		rs := getTrace(t, tc.serviceName, spanQuery(tc.spanName))
+		clear(counts)
+		for _, s := range allSpans(rs) {
+			if matchSpanName(tc.spanName, s.GetName()) && (tc.kind == otlptrace.Span_SPAN_KIND_UNSPECIFIED || s.GetKind() == tc.kind) {
+				counts[string(s.GetTraceId())]++
+			}
+		}
+		found := 0
+		for _, c := range traces {
+			if counts[string(c.TraceID)] > 0 {
+				found++
+			}
+		}
+		Logger(t).Info("Found the span in the traces", "span", tc.spanName, "found", found, "traces", len(traces))
+		return found == len(traces)
+	})
+
+	var missing, duplicated []string
+	for _, c := range traces {
+		switch n := counts[string(c.TraceID)]; {
+		case n == 0:
+			missing = append(missing, hex.EncodeToString(c.TraceID))
+		case n > 1:
+			duplicated = append(duplicated, hex.EncodeToString(c.TraceID))
+		}
+	}
+	if len(missing) > 0 {
+		t.Errorf("Span %s of %s is missing in %d of %d traces, e.g. %s", tc.spanName, tc.serviceName,
+			len(missing), len(traces), strings.Join(missing[:min(len(missing), maxReportedTraces)], ", "))
+	}
+	if len(duplicated) > 0 {
+		t.Errorf("Span %s of %s is exported more than once in %d of %d traces, e.g. %s", tc.spanName, tc.serviceName,
+			len(duplicated), len(traces), strings.Join(duplicated[:min(len(duplicated), maxReportedTraces)], ", "))
+	}
+}
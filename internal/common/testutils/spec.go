@@ -0,0 +1,1521 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// Default name of the expected telemetry file, relative to the recipe test module
+const DefaultSpecFile string = "expected.yaml"
+
+// Spec describes the telemetry a recipe is expected to export.
+// It is loaded from the recipe's expected telemetry file (see DefaultSpecFile).
+type Spec struct {
+	// The service.name of the recipe, which is the id in the recipefile.json
+	ServiceName string `yaml:"serviceName"`
+	// Requests sent to the sample API, in order, before asserting the telemetry
+	Requests []RequestSpec `yaml:"requests"`
+	Resource *ResourceSpec `yaml:"resource"`
+	Spans    []SpanSpec    `yaml:"spans"`
+	Traces   []TraceSpec   `yaml:"traces"`
+	// Spans of zero-code instrumentations, e.g. of the Java agent, whose names vary with their versions
+	SpanSets []SpanSetSpec `yaml:"spanSets"`
+	Metrics  []MetricSpec  `yaml:"metrics"`
+	// The effects of the Views of the recipe on its metrics
+	Views *ViewsSpec `yaml:"views"`
+	// Asserts all the metrics of the recipe service have UCUM units, e.g. ms and not milliseconds
+	MetricUnits bool `yaml:"metricUnits"`
+	// PromQL queries of the Prometheus server at -prometheus-url, e.g. of the request rate
+	PromQL []PromQLSpec `yaml:"promql"`
+	Logs   []LogSpec    `yaml:"logs"`
+	// Events recorded as log records with an event.name attribute, e.g. via the Events API
+	LogEvents []LogEventSpec `yaml:"logEvents"`
+	// Names or patterns of spans the recipe service must not export, e.g. as they are filtered out
+	AbsentSpans []string `yaml:"absentSpans"`
+	// Asserts each span of the traces of the recipe service is a root or has its parent in the trace, with the
+	// spans of the services of the serviceGraph. See AssertCompleteTraces
+	CompleteTraces bool `yaml:"completeTraces"`
+	// Asserts the timestamps of all the spans of the recipe service and that each span is within its parent.
+	// See AssertTraceTimestamps
+	Timestamps bool `yaml:"timestamps"`
+	// Asserts the trace and span ids of the spans, exemplars and logs of the signals declared. See AssertTraceIDs
+	IDs bool `yaml:"ids"`
+	// Asserts the SDK limits dropped none of the attributes, events and links of the spans and logs of the
+	// signals declared, nor of their resources. See AssertTraceNotTruncated
+	Truncation bool `yaml:"truncation"`
+	// Spans expected to be sampled at a ratio, e.g. by a TraceIdRatioBased sampler
+	Sampling []SamplingSpec `yaml:"sampling"`
+	// Traces sent to the collector, of which only the ones matching its tail sampling policy must be exported
+	TailSampling []ScenarioTraceSpec `yaml:"tailSampling"`
+	// Requests flowing from the recipe service to another one, e.g. in recipes with two services
+	Propagation []PropagationSpec `yaml:"propagation"`
+	// Compares the spans sent by the sample with the ones exported by the collector pipeline
+	Pipeline *PipelineSpec `yaml:"pipeline"`
+	// The tiers of collectors the spans must traverse, e.g. an agent and a gateway
+	Topology *TopologySpec `yaml:"topology"`
+	// The services of the traces of the recipe service and the calls between them, e.g. in microservice demos
+	ServiceGraph *ServiceGraphSpec `yaml:"serviceGraph"`
+	// The calls between services Jaeger must have recorded, from its /api/dependencies endpoint
+	Dependencies []DependencySpec `yaml:"dependencies"`
+	// The scheme of the credentials the OTLP back-end requires, bearer or basic, which the exporter of the
+	// recipe must send. See AssertExporterAuthenticated
+	Auth string `yaml:"auth"`
+	// Sets OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES on the sample when the samples runner starts its compose
+	// stack, and asserts the resource of each signal has exactly these. For the recipes configured via the environment
+	ResourceEnv *ResourceEnvSpec `yaml:"resourceEnv"`
+	// Points the exporters of the sample to a capture endpoint via OTEL_EXPORTER_OTLP_*, when the samples runner
+	// starts its compose stack, and asserts the exports honored the protocol, headers and compression
+	ExporterEnv *ExporterEnvSpec `yaml:"exporterEnv"`
+	// Overrides the default retry policy used to fetch the telemetry
+	Retry *RetrySpec `yaml:"retry"`
+	// Warms up the sample before the requests and the assertions, e.g. for the JIT-heavy Java and .NET samples
+	WarmUp *WarmUpSpec `yaml:"warmUp"`
+	// Overrides of the other fields per languageId of the recipe, e.g. java, applied when loading the spec.
+	// Lets one logical recipe declare e.g. the span names of each SDK
+	Languages map[string]any `yaml:"languages"`
+	// The SDK versions the samples runner builds and validates the recipe with, e.g. [latest, 1.24.0]
+	SdkVersions []string `yaml:"sdkVersions"`
+	// Overrides of the other fields per SDK version, applied after the ones of the language, e.g. for
+	// span names that changed between the releases of an instrumentation
+	SdkOverrides map[string]any `yaml:"sdkOverrides"`
+	// A golden file, relative to the recipe test module, all the telemetry of the recipe is compared with
+	// once the other assertions ran, e.g. testdata/telemetry.golden.json. Written when run with -update
+	Golden string `yaml:"golden"`
+}
+
+type RequestSpec struct {
+	// The HTTP method. Defaults to GET
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"`
+	Headers map[string]string `yaml:"headers"`
+	Query   map[string]string `yaml:"query"`
+	// A raw body, sent with the Content-Type header if set
+	Body string `yaml:"body"`
+	// A body sent as JSON, e.g. json: {name: world}
+	Json any `yaml:"json"`
+	// The expected status code. Defaults to any 2xx status
+	Status int `yaml:"status"`
+	// Sends a span context with the request and asserts the span continues its trace
+	Propagation *RequestPropagationSpec `yaml:"propagation"`
+}
+
+type RequestPropagationSpec struct {
+	// One of: tracecontext, b3, b3multi, jaeger
+	Format string `yaml:"format"`
+	// The span of the recipe service expected to continue the trace, e.g. the server span of the request
+	Span string `yaml:"span"`
+}
+
+// See WarmUpOptions. The delay is in the Go format, e.g. 5s
+type WarmUpSpec struct {
+	Requests int `yaml:"requests"`
+	// Defaults to the first of the requests, or GET /
+	Request   *RequestSpec  `yaml:"request"`
+	FirstSpan bool          `yaml:"firstSpan"`
+	Delay     time.Duration `yaml:"delay"`
+}
+
+// Durations in the Go format, e.g. 500ms, 10s, 2m
+type RetrySpec struct {
+	InitialInterval time.Duration `yaml:"initialInterval"`
+	MaxInterval     time.Duration `yaml:"maxInterval"`
+	MaxElapsedTime  time.Duration `yaml:"maxElapsedTime"`
+}
+
+// The resource all the telemetry of the recipe is expected to be exported with
+type ResourceSpec struct {
+	// The expected telemetry.sdk.language, e.g. go, dotnet, java, nodejs, python
+	SdkLanguage string         `yaml:"sdkLanguage"`
+	Attributes  map[string]any `yaml:"attributes"`
+	// The semantic conventions version the sample is built against, e.g. 1.26.0. The schema URL of the
+	// resources and the instrumentation scopes must match it
+	SemconvVersion string `yaml:"semconvVersion"`
+	// The resource detectors of the sample, i.e. host, container or k8s. The expected values are read from
+	// the environment of the tests, see DetectedResourceFromEnv
+	Detectors []string `yaml:"detectors"`
+}
+
+// The resource a sample configured only via the environment is started with, see ResourceEnv
+type ResourceEnvSpec struct {
+	// The compose service of the sample the variables are set on. Defaults to app
+	Service string `yaml:"service"`
+	// Set in OTEL_RESOURCE_ATTRIBUTES, OTEL_SERVICE_NAME being the serviceName of the spec
+	Attributes map[string]string `yaml:"attributes"`
+}
+
+// The compose service of the sample, app in the docker-compose.yml of the recipes
+func (s *ResourceEnvSpec) SampleService() string {
+	if s.Service == "" {
+		return "app"
+	}
+	return s.Service
+}
+
+// The variables to set on the sample of the recipe service
+func (s *ResourceEnvSpec) Env(serviceName string) []string {
+	return ResourceEnv(serviceName, s.Attributes)
+}
+
+// The exporter configuration a sample configured only via the environment is started with, see ExporterEnv
+type ExporterEnvSpec struct {
+	// The compose service of the sample the variables are set on. Defaults to app
+	Service        string `yaml:"service"`
+	ExporterConfig `yaml:",inline"`
+}
+
+// The compose service of the sample, app in the docker-compose.yml of the recipes
+func (s *ExporterEnvSpec) SampleService() string {
+	if s.Service == "" {
+		return "app"
+	}
+	return s.Service
+}
+
+// The variables to set on the sample to export to the capture endpoint
+func (s *ExporterEnvSpec) Env(endpoint string) []string {
+	return ExporterEnv(endpoint, s.ExporterConfig)
+}
+
+// A trace expected to contain all the listed spans
+type TraceSpec struct {
+	// The exact number of spans of the trace. 0 skips the check
+	SpanCount int        `yaml:"spanCount"`
+	Spans     []SpanSpec `yaml:"spans"`
+}
+
+// The spans of a zero-code instrumentation expected in a trace, see SpanSetTestCase
+type SpanSetSpec struct {
+	// One of: java-agent, python, go-ebpf. The spans without a scope must come from its instrumentation scopes
+	Instrumentation string     `yaml:"instrumentation"`
+	Spans           []SpanSpec `yaml:"spans"`
+	// Alternatives to spans, e.g. the spans of other versions of the instrumentation
+	OneOf [][]SpanSpec `yaml:"oneOf"`
+}
+
+type SpanSpec struct {
+	// The span name, or a glob pattern such as "GET /api/*"
+	Name       string         `yaml:"name"`
+	Attributes map[string]any `yaml:"attributes"`
+	// Name of the span expected to be the direct parent
+	Parent string      `yaml:"parent"`
+	Events []EventSpec `yaml:"events"`
+	Links  []LinkSpec  `yaml:"links"`
+	Status *StatusSpec `yaml:"status"`
+	// One of: internal, server, client, producer, consumer
+	Kind string `yaml:"kind"`
+	// Name of the instrumentation scope expected to have produced the span
+	Scope    string        `yaml:"scope"`
+	Duration *DurationSpec `yaml:"duration"`
+	// The types of attributes whose value is not known in advance, e.g. http.response.status_code: int64.
+	// One of: string, bool, int64, float64, array
+	AttributeTypes map[string]string `yaml:"attributeTypes"`
+	// Attributes the span must not have, e.g. as they are redacted
+	AbsentAttributes []string `yaml:"absentAttributes"`
+}
+
+// Bounds of the span duration, e.g. min: 100ms. A max of 0 means no upper bound
+type DurationSpec struct {
+	Min time.Duration `yaml:"min"`
+	Max time.Duration `yaml:"max"`
+}
+
+type StatusSpec struct {
+	// One of: unset, ok, error
+	Code        string `yaml:"code"`
+	Description string `yaml:"description"`
+}
+
+var statusCodes = map[string]otlptrace.Status_StatusCode{
+	"unset": otlptrace.Status_STATUS_CODE_UNSET,
+	"ok":    otlptrace.Status_STATUS_CODE_OK,
+	"error": otlptrace.Status_STATUS_CODE_ERROR,
+}
+
+var spanKinds = map[string]otlptrace.Span_SpanKind{
+	"internal": otlptrace.Span_SPAN_KIND_INTERNAL,
+	"server":   otlptrace.Span_SPAN_KIND_SERVER,
+	"client":   otlptrace.Span_SPAN_KIND_CLIENT,
+	"producer": otlptrace.Span_SPAN_KIND_PRODUCER,
+	"consumer": otlptrace.Span_SPAN_KIND_CONSUMER,
+}
+
+type LinkSpec struct {
+	// Name of the linked span
+	Span string `yaml:"span"`
+	// The service.name of the linked span. Defaults to the recipe service
+	ServiceName string         `yaml:"serviceName"`
+	Attributes  map[string]any `yaml:"attributes"`
+}
+
+type SamplingSpec struct {
+	Span  string  `yaml:"span"`
+	Ratio float64 `yaml:"ratio"`
+	// The number of spans created, of which ratio are expected to be sampled
+	Total int `yaml:"total"`
+	// Sent total times to the sample API, each creating one span. Without it, the sample is expected
+	// to create the spans itself
+	Request *RequestSpec `yaml:"request"`
+	// How many standard deviations the sampled count may deviate from the expected one. Defaults to 4
+	StdDevs float64 `yaml:"stdDevs"`
+}
+
+// A kind of trace generated for the tail sampling scenario, see ScenarioTrace
+type ScenarioTraceSpec struct {
+	Span       string         `yaml:"span"`
+	Error      bool           `yaml:"error"`
+	Duration   time.Duration  `yaml:"duration"`
+	Attributes map[string]any `yaml:"attributes"`
+	Sampled    bool           `yaml:"sampled"`
+	Count      int            `yaml:"count"`
+}
+
+type PropagationSpec struct {
+	From SpanRefSpec `yaml:"from"`
+	To   SpanRefSpec `yaml:"to"`
+	// Baggage entries set by the from service, expected as attributes of the span of the to service
+	Baggage map[string]string `yaml:"baggage"`
+	// Expects from to be the client span of the call and to the server span handling it
+	ClientServer bool `yaml:"clientServer"`
+}
+
+// The changes a collector pipeline is expected to make to the spans of the sample. The spans as sent
+// by the sample are read from an OTLP back-end, while the exported ones come from the trace back-end
+type PipelineSpec struct {
+	// Address of the OTLP back-end receiving the spans before they are processed. Defaults to -otlp-backend-url
+	EmittedUrl         string         `yaml:"emittedUrl"`
+	DroppedSpans       []string       `yaml:"droppedSpans"`
+	AddedAttributes    map[string]any `yaml:"addedAttributes"`
+	RemovedAttributes  []string       `yaml:"removedAttributes"`
+	ResourceAttributes map[string]any `yaml:"resourceAttributes"`
+	// The actions of an attributes processor, as in its configuration
+	AttributeActions []AttributeAction `yaml:"attributeActions"`
+	// Reads the actions of the attributes processor with the name, e.g. attributes/redact, from CollectorConfig
+	AttributesProcessor string `yaml:"attributesProcessor"`
+	// Relative to the recipe test module. Defaults to ../collector-config.yaml
+	CollectorConfig string `yaml:"collectorConfig"`
+}
+
+type TopologySpec struct {
+	// The name or pattern of the spans. Defaults to all the spans of the recipe service
+	Span  string     `yaml:"span"`
+	Tiers []TierSpec `yaml:"tiers"`
+}
+
+type ServiceGraphSpec struct {
+	// The services a trace of the recipe service must span, other than the recipe service
+	Services []string `yaml:"services"`
+	// Calls between services, e.g. [frontend, cart, redis] for frontend -> cart -> redis
+	Paths [][]string        `yaml:"paths"`
+	Edges []ServiceEdgeSpec `yaml:"edges"`
+	// Fails on calls of the trace that are not expected
+	Exact bool `yaml:"exact"`
+}
+
+// A span of the from service, with the kind, being the parent of a span of the to service
+type ServiceEdgeSpec struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Default to client and server
+	FromKind string `yaml:"fromKind"`
+	ToKind   string `yaml:"toKind"`
+}
+
+type DependencySpec struct {
+	// Default to the recipe service
+	Parent string `yaml:"parent"`
+	Child  string `yaml:"child"`
+	// The minimum number of calls recorded. Defaults to 1
+	MinCalls uint64 `yaml:"minCalls"`
+}
+
+// A tier of collectors, with the attributes it adds to the spans it processes
+type TierSpec struct {
+	Name               string         `yaml:"name"`
+	Attributes         map[string]any `yaml:"attributes"`
+	ResourceAttributes map[string]any `yaml:"resourceAttributes"`
+}
+
+// A span of a service, e.g. the client span of a frontend calling a backend
+type SpanRefSpec struct {
+	Span string `yaml:"span"`
+	// Defaults to the recipe service
+	ServiceName string `yaml:"serviceName"`
+}
+
+type EventSpec struct {
+	Name       string         `yaml:"name"`
+	Attributes map[string]any `yaml:"attributes"`
+}
+
+type MetricSpec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Unit        string `yaml:"unit"`
+	// One of: counter, upDownCounter, gauge, histogram, exponentialHistogram
+	Type  string `yaml:"type"`
+	Value any    `yaml:"value"`
+	// For counters, asserts the value is at least min instead of equal to value. For UpDownCounters and
+	// gauges, asserts the value is within min and max, the one not set being unbounded
+	Min        any            `yaml:"min"`
+	Max        any            `yaml:"max"`
+	Attributes map[string]any `yaml:"attributes"`
+	// The attributes of all the data points, e.g. as kept by a View. The ones not set are not asserted
+	AttributeKeys    []string         `yaml:"attributeKeys"`
+	AttributeSets    []map[string]any `yaml:"attributeSets"`
+	AbsentAttributes []string         `yaml:"absentAttributes"`
+	MaxDataPoints    int              `yaml:"maxDataPoints"`
+	// For counters and histograms. One of: delta, cumulative
+	Temporality string `yaml:"temporality"`
+	// For counters, UpDownCounters and gauges of asynchronous instruments, expects the data point to be
+	// reported on several collections, cycles defaulting to 2
+	Observable bool `yaml:"observable"`
+	Cycles     int  `yaml:"cycles"`
+
+	// For histograms, the fields of the data point to assert. The ones not set are not asserted
+	Count   *uint64      `yaml:"count"`
+	Sum     *float64     `yaml:"sum"`
+	Buckets *BucketsSpec `yaml:"buckets"`
+	// The explicit bucket boundaries, e.g. of a View, when the bucket counts are not asserted
+	Bounds []float64 `yaml:"bounds"`
+
+	// For exponential histograms, the fields of the data point to assert besides count and sum
+	Scale     *int32                  `yaml:"scale"`
+	MaxScale  *int32                  `yaml:"maxScale"`
+	ZeroCount *uint64                 `yaml:"zeroCount"`
+	Positive  *ExponentialBucketsSpec `yaml:"positive"`
+	Negative  *ExponentialBucketsSpec `yaml:"negative"`
+	// Asserts the data point has exemplars referencing spans found in the traces of the service
+	Exemplars bool `yaml:"exemplars"`
+}
+
+type BucketsSpec struct {
+	Bounds []float64 `yaml:"bounds"`
+	// One more than the bounds, the last one counting the values above the last bound
+	Counts []uint64 `yaml:"counts"`
+}
+
+type ViewsSpec struct {
+	Renamed []RenamedMetricSpec `yaml:"renamed"`
+	// Names of the instruments dropped, e.g. by a View with the drop aggregation
+	Dropped []string `yaml:"dropped"`
+	// The aggregation of the metrics by name. One of: sum, lastValue, histogram, exponentialHistogram
+	Aggregations map[string]string `yaml:"aggregations"`
+}
+
+type RenamedMetricSpec struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+var metricAggregations = map[string]MetricAggregation{
+	"sum":                  AggregationSum,
+	"lastValue":            AggregationLastValue,
+	"histogram":            AggregationExplicitBucketHistogram,
+	"exponentialHistogram": AggregationExponentialHistogram,
+}
+
+type PromQLSpec struct {
+	Query string `yaml:"query"`
+	// Bounds of all the values of the result. The ones not set are not asserted
+	Min *float64 `yaml:"min"`
+	Max *float64 `yaml:"max"`
+	// Evaluates the query over the last range, e.g. 1m, instead of at the current time
+	Range time.Duration `yaml:"range"`
+	// Defaults to 15s
+	Step time.Duration `yaml:"step"`
+}
+
+type ExponentialBucketsSpec struct {
+	Offset int32    `yaml:"offset"`
+	Counts []uint64 `yaml:"counts"`
+}
+
+type LogSpec struct {
+	Severity string `yaml:"severity"`
+	// The native level or the short name of the severity number, e.g. warn or WARN2
+	SeverityNumber string `yaml:"severityNumber"`
+	// Either a string, or a map for the structured bodies, whose fields are matched as a subset
+	Body       any            `yaml:"body"`
+	WithTrace  bool           `yaml:"withTrace"`
+	Attributes map[string]any `yaml:"attributes"`
+	// The name of the span of the service the log is expected to be emitted in
+	Span string `yaml:"span"`
+	// Name of the instrumentation scope expected to have produced the log, e.g. the logger name
+	Scope string `yaml:"scope"`
+}
+
+type LogEventSpec struct {
+	Name       string         `yaml:"name"`
+	Attributes map[string]any `yaml:"attributes"`
+	// Attributes the event must have, whatever their value
+	Required []string `yaml:"required"`
+}
+
+const (
+	counterMetricType       string = "counter"
+	upDownCounterMetricType string = "upDownCounter"
+	gaugeMetricType         string = "gauge"
+	histogramMetricType     string = "histogram"
+	// An exponential (base-2) histogram
+	exponentialHistogramMetricType string = "exponentialHistogram"
+)
+
+var metricTypes = []string{counterMetricType, upDownCounterMetricType, gaugeMetricType, histogramMetricType, exponentialHistogramMetricType}
+
+var temporalities = map[string]otlpmetrics.AggregationTemporality{
+	"delta":      otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+	"cumulative": otlpmetrics.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+}
+
+// Loads the expected telemetry file with the overrides of the language of its recipe applied, the languageId of
+// the recipefile.json next to the test module. See LoadSpecForLanguage
+func LoadSpec(path string) (*Spec, error) {
+	return LoadSpecForLanguage(path, recipeLanguage(path))
+}
+
+// Loads the expected telemetry file with the overrides declared under languages for the language, e.g. java.
+// Empty applies none
+func LoadSpecForLanguage(path, language string) (*Spec, error) {
+	return LoadSpecForSdk(path, language, "")
+}
+
+// Same as LoadSpecForLanguage, also applying the overrides declared under sdkOverrides for the SDK version
+// the sample was built with, e.g. 1.24.0. Empty applies none
+func LoadSpecForSdk(path, language, sdkVersion string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid expected telemetry file %s: %w", path, err)
+	}
+	if err := applyLanguageOverrides(&doc, language); err != nil {
+		return nil, fmt.Errorf("invalid expected telemetry file %s: %w", path, err)
+	}
+	if err := applySdkOverrides(&doc, sdkVersion); err != nil {
+		return nil, fmt.Errorf("invalid expected telemetry file %s: %w", path, err)
+	}
+	spec := &Spec{}
+	if err := doc.Decode(spec); err != nil {
+		return nil, fmt.Errorf("invalid expected telemetry file %s: %w", path, err)
+	}
+
+	if spec.ServiceName == "" {
+		return nil, fmt.Errorf("invalid expected telemetry file %s: missing serviceName", path)
+	}
+	if spec.Topology != nil {
+		if len(spec.Topology.Tiers) == 0 {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: topology without tiers", path)
+		}
+		for _, tier := range spec.Topology.Tiers {
+			if tier.Name == "" || len(tier.Attributes)+len(tier.ResourceAttributes) == 0 {
+				return nil, fmt.Errorf("invalid expected telemetry file %s: each tier of the topology needs a name and the attributes it adds", path)
+			}
+		}
+	}
+	if spec.Auth != "" && !validAuthScheme(spec.Auth) {
+		return nil, fmt.Errorf("invalid expected telemetry file %s: unknown auth scheme %q, expected one of %v", path, spec.Auth, authSchemes)
+	}
+	spans := spec.Spans
+	for _, tr := range spec.Traces {
+		spans = append(spans, tr.Spans...)
+	}
+	for _, ss := range spec.SpanSets {
+		if _, found := autoInstrumentationScopes[ss.Instrumentation]; !found && ss.Instrumentation != "" {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: unknown instrumentation %q", path, ss.Instrumentation)
+		}
+		spans = append(spans, ss.Spans...)
+		for _, alt := range ss.OneOf {
+			spans = append(spans, alt...)
+		}
+	}
+	for _, s := range spans {
+		for k, typ := range s.AttributeTypes {
+			if !slices.Contains(attributeTypes, AttributeType(typ)) {
+				return nil, fmt.Errorf("invalid expected telemetry file %s: attribute %s of span %s has unknown type %q", path, k, s.Name, typ)
+			}
+		}
+		if _, found := spanKinds[s.Kind]; s.Kind != "" && !found {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: span %s has unknown kind %q", path, s.Name, s.Kind)
+		}
+		if s.Status == nil {
+			continue
+		}
+		if _, found := statusCodes[s.Status.Code]; !found {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: span %s has unknown status code %q", path, s.Name, s.Status.Code)
+		}
+	}
+	if spec.ResourceEnv != nil {
+		if len(spec.ResourceEnv.Attributes) == 0 {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: resourceEnv without attributes", path)
+		}
+		if _, found := spec.ResourceEnv.Attributes["service.name"]; found {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: resourceEnv sets service.name, which is set from the serviceName", path)
+		}
+	}
+	if spec.ExporterEnv != nil {
+		// the capture endpoint receiving the exports depends on it
+		if spec.ExporterEnv.Protocol == "" {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: exporterEnv without protocol", path)
+		}
+		if err := spec.ExporterEnv.validate(); err != nil {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: exporterEnv: %w", path, err)
+		}
+	}
+	if spec.Resource != nil {
+		for _, d := range spec.Resource.Detectors {
+			if _, found := detectorAttributes[d]; !found {
+				return nil, fmt.Errorf("invalid expected telemetry file %s: unknown resource detector %q", path, d)
+			}
+		}
+	}
+	for _, s := range spec.Sampling {
+		if s.Ratio < 0 || s.Ratio > 1 || s.Total <= 0 {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: sampling of %s needs a ratio between 0 and 1 and a positive total", path, s.Span)
+		}
+	}
+	if w := spec.WarmUp; w != nil && (w.Requests < 0 || w.Delay < 0) {
+		return nil, fmt.Errorf("invalid expected telemetry file %s: the warm-up requests and delay can't be negative", path)
+	}
+	for _, r := range spec.Requests {
+		if r.Propagation != nil && !slices.Contains(propagationFormats, r.Propagation.Format) {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: request %s has unknown propagation format %q", path, r.Path, r.Propagation.Format)
+		}
+	}
+	if spec.Pipeline != nil {
+		for _, a := range spec.Pipeline.AttributeActions {
+			if !slices.Contains(attributeActions, a.Action) {
+				return nil, fmt.Errorf("invalid expected telemetry file %s: attribute %s has unsupported action %q", path, a.Key, a.Action)
+			}
+		}
+	}
+	if g := spec.ServiceGraph; g != nil {
+		for _, e := range g.Edges {
+			for _, k := range []string{e.FromKind, e.ToKind} {
+				if _, found := spanKinds[k]; k != "" && !found {
+					return nil, fmt.Errorf("invalid expected telemetry file %s: call %s -> %s has unknown span kind %q", path, e.From, e.To, k)
+				}
+			}
+		}
+		for _, p := range g.Paths {
+			if len(p) < 2 {
+				return nil, fmt.Errorf("invalid expected telemetry file %s: service graph path %v needs at least two services", path, p)
+			}
+		}
+	}
+	for _, d := range spec.Dependencies {
+		if d.Parent == d.Child || d.Parent == "" && d.Child == spec.ServiceName || d.Child == "" && d.Parent == spec.ServiceName {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: dependency %s -> %s needs two different services", path, d.Parent, d.Child)
+		}
+	}
+	if v := spec.Views; v != nil {
+		for name, a := range v.Aggregations {
+			if _, found := metricAggregations[a]; !found {
+				return nil, fmt.Errorf("invalid expected telemetry file %s: view of metric %s has unknown aggregation %q", path, name, a)
+			}
+		}
+		for _, r := range v.Renamed {
+			if r.From == "" || r.To == "" || r.From == r.To {
+				return nil, fmt.Errorf("invalid expected telemetry file %s: renamed metric %q -> %q needs two different names", path, r.From, r.To)
+			}
+		}
+	}
+	for _, q := range spec.PromQL {
+		if q.Query == "" {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: promql needs a query", path)
+		}
+		if q.Min != nil && q.Max != nil && *q.Min > *q.Max {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: promql %s has a min above its max", path, q.Query)
+		}
+	}
+	for _, l := range spec.Logs {
+		switch l.Body.(type) {
+		case string, map[string]any:
+		default:
+			return nil, fmt.Errorf("invalid expected telemetry file %s: log body must be a string or a map, got %v", path, l.Body)
+		}
+		if _, found := SeverityRangeOf(l.SeverityNumber); l.SeverityNumber != "" && !found {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: log %v has unknown severity number %q", path, l.Body, l.SeverityNumber)
+		}
+	}
+	for _, e := range spec.LogEvents {
+		if e.Name == "" {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: log event without a name", path)
+		}
+	}
+	for _, m := range spec.Metrics {
+		if !slices.Contains(metricTypes, m.Type) {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: metric %s has unknown type %q", path, m.Name, m.Type)
+		}
+		if _, found := temporalities[m.Temporality]; m.Temporality != "" && !found {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: metric %s has unknown temporality %q", path, m.Name, m.Temporality)
+		}
+		if m.Max != nil && m.Type != upDownCounterMetricType && m.Type != gaugeMetricType {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: max is only asserted for UpDownCounters and gauges, not %s", path, m.Name)
+		}
+		if _, found := observableKinds[m.Type]; m.Observable && !found {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: only counters, UpDownCounters and gauges are observable, not %s", path, m.Name)
+		}
+		if m.Cycles < 0 || m.Cycles > 0 && !m.Observable {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: cycles of %s must be positive and only set for observable metrics", path, m.Name)
+		}
+		if m.Exemplars && m.Type != histogramMetricType {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: exemplars are only asserted for histograms, not %s", path, m.Name)
+		}
+		if (m.Scale != nil || m.MaxScale != nil || m.ZeroCount != nil || m.Positive != nil || m.Negative != nil) && m.Type != exponentialHistogramMetricType {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: scale, zero count and positive and negative buckets are only asserted for exponential histograms, not %s", path, m.Name)
+		}
+		if (m.Buckets != nil || m.Bounds != nil) && m.Type == exponentialHistogramMetricType {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: exponential histogram %s has no explicit buckets, set positive and negative instead", path, m.Name)
+		}
+		if m.Buckets != nil && len(m.Buckets.Counts) != len(m.Buckets.Bounds)+1 {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: histogram %s must have one more bucket count than bounds", path, m.Name)
+		}
+		if m.Bounds != nil && m.Type != histogramMetricType {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: bounds are only asserted for histograms, not %s", path, m.Name)
+		}
+		if m.Bounds != nil && m.Buckets != nil {
+			return nil, fmt.Errorf("invalid expected telemetry file %s: histogram %s has both bounds and buckets, the bounds of buckets are asserted", path, m.Name)
+		}
+		bounds := m.Bounds
+		if m.Buckets != nil {
+			bounds = m.Buckets.Bounds
+		}
+		for i := 1; i < len(bounds); i++ {
+			if bounds[i] <= bounds[i-1] {
+				return nil, fmt.Errorf("invalid expected telemetry file %s: the bucket boundaries of histogram %s must be increasing", path, m.Name)
+			}
+		}
+	}
+	return spec, nil
+}
+
+// The outcome of one of the assertions generated from a spec, e.g. span/HelloWorldSpan
+type AssertionResult struct {
+	Name   string
+	Passed bool
+}
+
+// Loads the expected telemetry file and asserts all the telemetry declared in it
+func AssertSpecFile(t TestingT, path string) []AssertionResult {
+	spec, err := LoadSpecForSdk(path, recipeLanguage(path), getConfig(t).SdkVersion)
+	if err != nil {
+		t.Fatalf("Failed loading the expected telemetry: %v", err)
+	}
+	return AssertSpec(t, spec)
+}
+
+// Asserts the telemetry declared in the spec, each in its own subtest. Only the assertions of the given
+// signals run, e.g. TraceSignal, or all of them if none is given. Returns the outcome of each subtest,
+// e.g. to build a report
+func AssertSpec(t TestingT, spec *Spec, signals ...string) []AssertionResult {
+	selected := func(signal string) bool {
+		return len(signals) == 0 || slices.Contains(signals, signal)
+	}
+	// the signals of the telemetry checked by the assertions covering all of them, e.g. the resource
+	asserted := func(signal string) bool {
+		return selected(signal) && spec.declaresSignal(signal)
+	}
+	var results []AssertionResult
+	// signal is the one of the asserted telemetry, empty for the assertions covering all the signals
+	run := func(signal, name string, f func(t TestingT)) {
+		if signal != "" && !selected(signal) {
+			return
+		}
+		results = append(results, AssertionResult{Name: name, Passed: runSubtest(t, name, f)})
+	}
+
+	AddTelemetryArtifacts(t, spec.ServiceName)
+	if spec.Retry != nil {
+		p := getRetryPolicy(t)
+		if spec.Retry.InitialInterval > 0 {
+			p.InitialInterval = spec.Retry.InitialInterval
+		}
+		if spec.Retry.MaxInterval > 0 {
+			p.MaxInterval = spec.Retry.MaxInterval
+		}
+		if spec.Retry.MaxElapsedTime > 0 {
+			p.MaxElapsedTime = spec.Retry.MaxElapsedTime
+		}
+		useRetryPolicy(t, p)
+	}
+
+	if spec.WarmUp != nil {
+		opts := WarmUpOptions{Requests: spec.WarmUp.Requests, FirstSpan: spec.WarmUp.FirstSpan, Delay: spec.WarmUp.Delay}
+		switch {
+		case spec.WarmUp.Request != nil:
+			opts.Request = toSampleRequest(t, *spec.WarmUp.Request)
+		case len(spec.Requests) > 0:
+			opts.Request = toSampleRequest(t, spec.Requests[0])
+		}
+		WarmUp(t, spec.ServiceName, opts)
+	}
+
+	// the span contexts sent with the requests, asserted once all the requests were sent
+	contexts := make(map[int]*SpanContext)
+	for i, r := range spec.Requests {
+		req := toSampleRequest(t, r)
+		if r.Propagation != nil {
+			contexts[i] = NewSpanContext()
+			req.WithSpanContext(r.Propagation.Format, contexts[i])
+		}
+		InvokeSampleRequest(t, req)
+	}
+	for i, r := range spec.Requests {
+		if c, found := contexts[i]; found {
+			run(TraceSignal, "propagation/"+r.Propagation.Format+"/"+r.Propagation.Span, func(t TestingT) {
+				AssertSpanContinuesContext(t, NewTraceTestCase(spec.ServiceName, r.Propagation.Span), c)
+			})
+		}
+	}
+
+	if spec.Resource != nil {
+		run("", "resource", func(t TestingT) {
+			assertResourceSpec(t, spec, asserted)
+		})
+	}
+
+	if spec.ResourceEnv != nil {
+		run("", "resource-env", func(t TestingT) {
+			for _, r := range specResources(t, spec, asserted) {
+				AssertResourceFromEnv(t, r, spec.ServiceName, spec.ResourceEnv.Attributes)
+			}
+		})
+	}
+
+	for _, s := range spec.Spans {
+		run(TraceSignal, "span/"+s.Name, func(t TestingT) {
+			AssertSpanWithAttributeExists(t, toTraceTestCase(t, spec.ServiceName, s))
+		})
+	}
+
+	for i, tr := range spec.Traces {
+		run(TraceSignal, fmt.Sprintf("trace/%d", i), func(t TestingT) {
+			tcs := make([]*TraceTestCase, 0, len(tr.Spans))
+			for _, s := range tr.Spans {
+				tcs = append(tcs, toTraceTestCase(t, spec.ServiceName, s))
+			}
+			AssertTraceSpans(t, NewTraceSpansTestCase(spec.ServiceName, tr.SpanCount, tcs...))
+		})
+	}
+
+	for i, ss := range spec.SpanSets {
+		run(TraceSignal, fmt.Sprintf("span-set/%d", i), func(t TestingT) {
+			tc := NewSpanSetTestCase(spec.ServiceName, ss.Instrumentation)
+			for _, alt := range append([][]SpanSpec{ss.Spans}, ss.OneOf...) {
+				if len(alt) == 0 {
+					continue
+				}
+				tcs := make([]*TraceTestCase, 0, len(alt))
+				for _, s := range alt {
+					tcs = append(tcs, toTraceTestCase(t, spec.ServiceName, s))
+				}
+				tc.WithSpans(tcs...)
+			}
+			AssertSpanSet(t, tc)
+		})
+	}
+
+	for _, name := range spec.AbsentSpans {
+		run(TraceSignal, "absent-span/"+name, func(t TestingT) {
+			AssertNoSpan(t, spec.ServiceName, name)
+		})
+	}
+
+	for _, s := range spec.Sampling {
+		run(TraceSignal, "sampling/"+s.Span, func(t TestingT) {
+			tc := NewSamplingTestCase(spec.ServiceName, s.Span, s.Ratio, s.Total)
+			if s.Request != nil {
+				tc.WithRequest(toSampleRequest(t, *s.Request))
+			}
+			if s.StdDevs > 0 {
+				tc.WithStdDevs(s.StdDevs)
+			}
+			AssertSamplingRatio(t, tc)
+		})
+	}
+
+	if len(spec.TailSampling) > 0 {
+		run(TraceSignal, "tail-sampling", func(t TestingT) {
+			tc := NewTailSamplingTestCase(spec.ServiceName)
+			for _, st := range spec.TailSampling {
+				tc.WithTraces(ScenarioTrace{
+					SpanName:   st.Span,
+					Error:      st.Error,
+					Duration:   st.Duration,
+					Attributes: toSentAttributes(t, st.Attributes),
+					Sampled:    st.Sampled,
+					Count:      st.Count,
+				})
+			}
+			AssertTailSampling(t, tc)
+		})
+	}
+
+	for _, p := range spec.Propagation {
+		run(TraceSignal, "propagation/"+p.From.Span+"->"+p.To.Span, func(t TestingT) {
+			tc := NewPropagationTestCase(p.From.toTraceTestCase(spec.ServiceName), p.To.toTraceTestCase(spec.ServiceName))
+			entries := make(map[string]any, len(p.Baggage))
+			for k, v := range p.Baggage {
+				entries[k] = v
+			}
+			if p.ClientServer {
+				tc.AsClientServer()
+			}
+			AssertPropagation(t, tc.WithBaggage(toAttributes(t, entries)...))
+		})
+	}
+
+	if p := spec.Pipeline; p != nil {
+		run(TraceSignal, "pipeline", func(t TestingT) {
+			url := p.EmittedUrl
+			if url == "" {
+				url = getConfig(t).OtlpBackendUrl
+			}
+			tc := NewPipelineTestCase(spec.ServiceName, NewOtlpBackend(url)).
+				WithDroppedSpans(p.DroppedSpans...).
+				WithAddedAttributes(toAttributes(t, p.AddedAttributes)...).
+				WithRemovedAttributes(p.RemovedAttributes...).
+				WithResourceAttributes(toAttributes(t, p.ResourceAttributes)...).
+				WithAttributeActions(p.AttributeActions...)
+			if p.AttributesProcessor != "" {
+				config := p.CollectorConfig
+				if config == "" {
+					config = filepath.Join("..", "collector-config.yaml")
+				}
+				actions, err := LoadAttributeActions(config, p.AttributesProcessor)
+				if err != nil {
+					t.Fatalf("Failed loading the attributes processor: %v", err)
+				}
+				tc.WithAttributeActions(actions...)
+			}
+			AssertPipeline(t, tc)
+		})
+	}
+
+	if spec.Topology != nil {
+		run(TraceSignal, "topology", func(t TestingT) {
+			tc := NewTopologyTestCase(spec.ServiceName, spec.Topology.Span)
+			for _, tier := range spec.Topology.Tiers {
+				tc.WithTier(CollectorTier{
+					Name:               tier.Name,
+					SpanAttributes:     toAttributes(t, tier.Attributes),
+					ResourceAttributes: toAttributes(t, tier.ResourceAttributes),
+				})
+			}
+			AssertTopology(t, tc)
+		})
+	}
+
+	if g := spec.ServiceGraph; g != nil {
+		run(TraceSignal, "service-graph", func(t TestingT) {
+			tc := NewServiceGraphTestCase(append([]string{spec.ServiceName}, g.Services...)...)
+			for _, p := range g.Paths {
+				tc.WithPath(p...)
+			}
+			for _, e := range g.Edges {
+				fromKind, toKind := otlptrace.Span_SPAN_KIND_CLIENT, otlptrace.Span_SPAN_KIND_SERVER
+				if e.FromKind != "" {
+					fromKind = spanKinds[e.FromKind]
+				}
+				if e.ToKind != "" {
+					toKind = spanKinds[e.ToKind]
+				}
+				tc.WithEdgeKinds(e.From, e.To, fromKind, toKind)
+			}
+			if g.Exact {
+				tc.Exactly()
+			}
+			AssertServiceGraph(t, tc)
+		})
+	}
+
+	if len(spec.Dependencies) > 0 {
+		run(TraceSignal, "dependencies", func(t TestingT) {
+			tc := NewDependenciesTestCase()
+			for _, d := range spec.Dependencies {
+				parent, child, minCalls := d.Parent, d.Child, d.MinCalls
+				if parent == "" {
+					parent = spec.ServiceName
+				}
+				if child == "" {
+					child = spec.ServiceName
+				}
+				if minCalls == 0 {
+					minCalls = 1
+				}
+				tc.WithDependency(parent, child, minCalls)
+			}
+			AssertDependencies(t, tc)
+		})
+	}
+
+	if asserted(MetricsSignal) {
+		rm := GetMetricsWithRetry(t, spec.ServiceName)
+
+		var metrics []*otlpmetrics.Metric
+		for _, sm := range rm.GetScopeMetrics() {
+			metrics = append(metrics, sm.GetMetrics()...)
+		}
+
+		for _, m := range spec.Metrics {
+			run(MetricsSignal, "metric/"+m.Name, func(t TestingT) {
+				assertMetricSpec(t, spec.ServiceName, m, metrics)
+			})
+		}
+	}
+
+	if v := spec.Views; v != nil {
+		run(MetricsSignal, "views", func(t TestingT) {
+			tc := NewViewTestCase(spec.ServiceName).WithDropped(v.Dropped...)
+			for _, r := range v.Renamed {
+				tc.WithRenamed(r.From, r.To)
+			}
+			for name, a := range v.Aggregations {
+				tc.WithAggregation(name, metricAggregations[a])
+			}
+			AssertViews(t, tc)
+		})
+	}
+
+	if spec.MetricUnits {
+		run(MetricsSignal, "metric-units", func(t TestingT) {
+			AssertMetricUnits(t, GetMetricsWithRetry(t, spec.ServiceName))
+		})
+	}
+
+	for _, q := range spec.PromQL {
+		run(MetricsSignal, "promql/"+q.Query, func(t TestingT) {
+			tc := NewPromQLTestCase(q.Query)
+			if q.Min != nil {
+				tc.WithMin(*q.Min)
+			}
+			if q.Max != nil {
+				tc.WithMax(*q.Max)
+			}
+			if q.Range > 0 {
+				tc.WithRange(q.Range, q.Step)
+			}
+			AssertPromQL(t, tc)
+		})
+	}
+
+	for _, l := range spec.Logs {
+		body, ok := l.Body.(string)
+		name := body
+		if !ok {
+			name = "structured"
+		}
+		run(LogsSignal, "log/"+name, func(t TestingT) {
+			var tc *LogTestCase
+			if ok {
+				tc = NewLogTestCase(spec.ServiceName, l.Severity, body, l.WithTrace, toAttributes(t, l.Attributes)...)
+			} else {
+				tc = NewStructuredLogTestCase(spec.ServiceName, l.Severity, toLogBody(t, l.Body), l.WithTrace, toAttributes(t, l.Attributes)...)
+			}
+			if l.SeverityNumber != "" {
+				tc.WithSeverityNumber(l.SeverityNumber)
+			}
+			if l.Scope != "" {
+				tc.WithScope(l.Scope)
+			}
+			if l.Span != "" {
+				tc.WithSpan(NewTraceTestCase(spec.ServiceName, l.Span))
+			}
+			AssertLogWithAttributeExists(t, tc)
+		})
+	}
+
+	for _, e := range spec.LogEvents {
+		run(LogsSignal, "log-event/"+e.Name, func(t TestingT) {
+			AssertLogEvent(t, NewLogEventTestCase(spec.ServiceName, e.Name, toAttributes(t, e.Attributes)...).WithRequiredAttributes(e.Required...))
+		})
+	}
+
+	if spec.CompleteTraces {
+		run(TraceSignal, "complete-traces", func(t TestingT) {
+			tc := NewCompleteTracesTestCase(spec.ServiceName)
+			if spec.ServiceGraph != nil {
+				tc.WithServices(spec.ServiceGraph.Services...)
+			}
+			for _, c := range contexts {
+				tc.WithRemoteParents(c)
+			}
+			AssertCompleteTraces(t, tc)
+		})
+	}
+
+	if spec.Timestamps {
+		run(TraceSignal, "timestamps", func(t TestingT) {
+			AssertTraceTimestamps(t, GetTraceWithRetry(t, spec.ServiceName))
+		})
+	}
+
+	if spec.IDs {
+		run("", "ids", func(t TestingT) {
+			assertIDsSpec(t, spec, asserted)
+		})
+	}
+
+	if spec.Truncation {
+		run("", "truncation", func(t TestingT) {
+			assertTruncationSpec(t, spec, asserted)
+		})
+	}
+
+	// after the telemetry was found, so the exports already happened
+	if spec.Auth != "" {
+		run("", "auth", func(t TestingT) {
+			AssertExporterAuthenticated(t, spec.Auth)
+		})
+	}
+	if spec.ExporterEnv != nil {
+		run("", "exporter-env", func(t TestingT) {
+			r := exportRecorder(t)
+			if r == nil {
+				t.Skip("The exporters of the sample were not pointed to a capture endpoint, see UseExporterCapture")
+			}
+			AssertExporterConfig(t, r, spec.ServiceName, spec.ExporterEnv.ExporterConfig)
+		})
+	}
+
+	// the golden file covers all the signals
+	if spec.Golden != "" && len(signals) == 0 {
+		run("", "golden", func(t TestingT) {
+			AssertGolden(t, spec.ServiceName, spec.Golden)
+		})
+	}
+	return results
+}
+
+func toSampleRequest(t TestingT, r RequestSpec) *SampleRequest {
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req := NewSampleRequest(strings.ToUpper(method), r.Path).WithExpectedStatus(r.Status)
+	for k, v := range r.Headers {
+		req.WithHeader(k, v)
+	}
+	for k, v := range r.Query {
+		req.WithQuery(k, v)
+	}
+
+	switch {
+	case r.Json != nil:
+		body, err := json.Marshal(r.Json)
+		if err != nil {
+			t.Fatalf("Invalid JSON body for request %s %s: %v", method, r.Path, err)
+		}
+		req.WithJsonBody(string(body))
+	case r.Body != "":
+		req.body = r.Body
+	}
+	return req
+}
+
+func toTraceTestCase(t TestingT, serviceName string, s SpanSpec) *TraceTestCase {
+	tc := NewTraceTestCase(serviceName, s.Name, toAttributes(t, s.Attributes)...).
+		WithParent(s.Parent).
+		WithScope(s.Scope)
+	for _, e := range s.Events {
+		tc.WithEvent(e.Name, toAttributes(t, e.Attributes)...)
+	}
+	if s.Kind != "" {
+		tc.WithKind(spanKinds[s.Kind])
+	}
+	if s.Status != nil {
+		tc.WithStatus(statusCodes[s.Status.Code], s.Status.Description)
+	}
+	if s.Duration != nil {
+		tc.WithDuration(s.Duration.Min, s.Duration.Max)
+	}
+	for k, typ := range s.AttributeTypes {
+		tc.WithAttributeType(k, AttributeType(typ))
+	}
+	tc.WithoutAttributes(s.AbsentAttributes...)
+	for _, l := range s.Links {
+		sn := l.ServiceName
+		if sn == "" {
+			sn = serviceName
+		}
+		tc.WithLink(sn, l.Span, toAttributes(t, l.Attributes)...)
+	}
+	return tc
+}
+
+func (s SpanRefSpec) toTraceTestCase(serviceName string) *TraceTestCase {
+	if s.ServiceName != "" {
+		serviceName = s.ServiceName
+	}
+	return NewTraceTestCase(serviceName, s.Span)
+}
+
+// Reports whether the spec declares telemetry of the signal
+func (s *Spec) declaresSignal(signal string) bool {
+	switch signal {
+	case TraceSignal:
+		return len(s.Spans) > 0 || len(s.Traces) > 0 || len(s.SpanSets) > 0
+	case MetricsSignal:
+		return len(s.Metrics) > 0
+	case LogsSignal:
+		return len(s.Logs) > 0 || len(s.LogEvents) > 0
+	}
+	return false
+}
+
+// Asserts the trace and span ids of each asserted signal
+func assertIDsSpec(t TestingT, spec *Spec, asserted func(signal string) bool) {
+	if asserted(TraceSignal) {
+		AssertTraceIDs(t, GetTraceWithRetry(t, spec.ServiceName))
+	}
+	if asserted(MetricsSignal) {
+		AssertMetricsIDs(t, GetMetricsWithRetry(t, spec.ServiceName))
+	}
+	if asserted(LogsSignal) {
+		AssertLogsIDs(t, GetLogsWithRetry(t, spec.ServiceName))
+	}
+}
+
+// Asserts nothing was dropped from the asserted spans and logs, nor from the resources of the asserted signals
+func assertTruncationSpec(t TestingT, spec *Spec, asserted func(signal string) bool) {
+	if asserted(TraceSignal) {
+		AssertTraceNotTruncated(t, GetTraceWithRetry(t, spec.ServiceName))
+	}
+	if asserted(MetricsSignal) {
+		AssertResourceNotTruncated(t, GetMetricsWithRetry(t, spec.ServiceName).GetResource())
+	}
+	if asserted(LogsSignal) {
+		AssertLogsNotTruncated(t, GetLogsWithRetry(t, spec.ServiceName))
+	}
+}
+
+// Returns the resource of each asserted signal, or of the traces if none is
+func specResources(t TestingT, spec *Spec, asserted func(signal string) bool) []*otlpresource.Resource {
+	var resources []*otlpresource.Resource
+	if asserted(TraceSignal) {
+		resources = append(resources, GetTraceWithRetry(t, spec.ServiceName).GetResource())
+	}
+	if asserted(MetricsSignal) {
+		resources = append(resources, GetMetricsWithRetry(t, spec.ServiceName).GetResource())
+	}
+	if asserted(LogsSignal) {
+		resources = append(resources, GetLogsWithRetry(t, spec.ServiceName).GetResource())
+	}
+	if len(resources) == 0 {
+		resources = append(resources, GetTraceWithRetry(t, spec.ServiceName).GetResource())
+	}
+	return resources
+}
+
+// Asserts the resource of each asserted signal
+func assertResourceSpec(t TestingT, spec *Spec, asserted func(signal string) bool) {
+	var resources []*otlpresource.Resource
+	if asserted(TraceSignal) {
+		rs := GetTraceWithRetry(t, spec.ServiceName)
+		resources = append(resources, rs.GetResource())
+		if spec.Resource.SemconvVersion != "" {
+			AssertTraceSchemaUrl(t, rs, spec.Resource.SemconvVersion)
+		}
+	}
+	if asserted(MetricsSignal) {
+		rm := GetMetricsWithRetry(t, spec.ServiceName)
+		resources = append(resources, rm.GetResource())
+		if spec.Resource.SemconvVersion != "" {
+			AssertMetricsSchemaUrl(t, rm, spec.Resource.SemconvVersion)
+		}
+	}
+	if asserted(LogsSignal) {
+		rl := GetLogsWithRetry(t, spec.ServiceName)
+		resources = append(resources, rl.GetResource())
+		if spec.Resource.SemconvVersion != "" {
+			AssertLogsSchemaUrl(t, rl, spec.Resource.SemconvVersion)
+		}
+	}
+
+	attrs := toAttributes(t, spec.Resource.Attributes)
+	detected := DetectedResourceFromEnv()
+	for _, r := range resources {
+		AssertSdkResource(t, r, spec.ServiceName, spec.Resource.SdkLanguage)
+		AssertResourceAttributes(t, r, attrs...)
+		AssertDetectedResource(t, r, detected, spec.Resource.Detectors...)
+	}
+	AssertSameService(t, resources...)
+}
+
+var observableKinds = map[string]ObservableKind{
+	counterMetricType:       ObservableCounter,
+	upDownCounterMetricType: ObservableUpDownCounter,
+	gaugeMetricType:         ObservableGauge,
+}
+
+func assertMetricSpec(t TestingT, serviceName string, m MetricSpec, metrics []*otlpmetrics.Metric) {
+	attrs := toAttributes(t, m.Attributes)
+	if m.AttributeKeys != nil || m.AttributeSets != nil || m.AbsentAttributes != nil || m.MaxDataPoints > 0 {
+		tc := NewMetricAttributesTestCase(m.Name).WithoutAttributes(m.AbsentAttributes...).WithMaxDataPoints(m.MaxDataPoints)
+		if m.AttributeKeys != nil {
+			tc.WithKeys(m.AttributeKeys...)
+		}
+		for _, set := range m.AttributeSets {
+			tc.WithAttributeSet(toAttributes(t, set)...)
+		}
+		AssertMetricAttributes(t, tc, metrics)
+	}
+	if m.Observable {
+		tc := NewObservableTestCase(serviceName, m.Name, observableKinds[m.Type], attrs...)
+		if m.Cycles > 0 {
+			tc.WithCycles(m.Cycles)
+		}
+		AssertObservable(t, tc)
+	}
+	if m.Temporality != "" {
+		AssertTemporality(t, findMetric(t, metrics, m.Name), temporalities[m.Temporality])
+	}
+
+	switch m.Type {
+	case counterMetricType:
+		if m.Min != nil {
+			switch v := m.Min.(type) {
+			case int:
+				AssertCounterAtLeast(t, NewMetricTestCase(m.Name, m.Description, m.Unit, int64(v), attrs...), metrics)
+			case float64:
+				AssertCounterAtLeast(t, NewMetricTestCase(m.Name, m.Description, m.Unit, v, attrs...), metrics)
+			default:
+				t.Fatalf("Invalid min %v for metric %s", m.Min, m.Name)
+			}
+			return
+		}
+		switch v := m.Value.(type) {
+		case int:
+			AssertCounter(t, NewMetricTestCase(m.Name, m.Description, m.Unit, int64(v), attrs...), metrics)
+		case float64:
+			AssertCounter(t, NewMetricTestCase(m.Name, m.Description, m.Unit, v, attrs...), metrics)
+		default:
+			t.Fatalf("Invalid value %v for metric %s", m.Value, m.Name)
+		}
+	case upDownCounterMetricType:
+		if m.Min != nil || m.Max != nil {
+			min, max := metricRange(t, m)
+			AssertUpDownCounterInRange(t, NewMetricRangeTestCase(m.Name, m.Description, m.Unit, min, max, attrs...), metrics)
+			return
+		}
+		switch v := m.Value.(type) {
+		case int:
+			AssertUpDownCounter(t, NewMetricTestCase(m.Name, m.Description, m.Unit, int64(v), attrs...), metrics)
+		case float64:
+			AssertUpDownCounter(t, NewMetricTestCase(m.Name, m.Description, m.Unit, v, attrs...), metrics)
+		default:
+			t.Fatalf("Invalid value %v for metric %s", m.Value, m.Name)
+		}
+	case gaugeMetricType:
+		if m.Min != nil || m.Max != nil {
+			min, max := metricRange(t, m)
+			AssertGaugeInRange(t, NewMetricRangeTestCase(m.Name, m.Description, m.Unit, min, max, attrs...), metrics)
+			return
+		}
+		switch v := m.Value.(type) {
+		case int:
+			AssertGauge(t, NewMetricTestCase(m.Name, m.Description, m.Unit, float64(v), attrs...), metrics)
+		case float64:
+			AssertGauge(t, NewMetricTestCase(m.Name, m.Description, m.Unit, v, attrs...), metrics)
+		default:
+			t.Fatalf("Invalid value %v for metric %s", m.Value, m.Name)
+		}
+	case histogramMetricType:
+		tc := NewHistogramTestCase(m.Name, m.Description, m.Unit, attrs...)
+		if m.Count != nil {
+			tc.WithCount(*m.Count)
+		}
+		if m.Sum != nil {
+			tc.WithSum(*m.Sum)
+		}
+		if m.Bounds != nil {
+			tc.WithBounds(m.Bounds...)
+		}
+		if m.Buckets != nil {
+			tc.WithBuckets(m.Buckets.Bounds, m.Buckets.Counts)
+		}
+		AssertHistogram(t, tc, metrics)
+		if m.Exemplars {
+			AssertHistogramExemplars(t, serviceName, tc, metrics)
+		}
+	case exponentialHistogramMetricType:
+		tc := NewExponentialHistogramTestCase(m.Name, m.Description, m.Unit, attrs...)
+		if m.Count != nil {
+			tc.WithCount(*m.Count)
+		}
+		if m.Sum != nil {
+			tc.WithSum(*m.Sum)
+		}
+		if m.Scale != nil {
+			tc.WithScale(*m.Scale)
+		}
+		if m.MaxScale != nil {
+			tc.WithMaxScale(*m.MaxScale)
+		}
+		if m.ZeroCount != nil {
+			tc.WithZeroCount(*m.ZeroCount)
+		}
+		if m.Positive != nil {
+			tc.WithPositiveBuckets(m.Positive.Offset, m.Positive.Counts...)
+		}
+		if m.Negative != nil {
+			tc.WithNegativeBuckets(m.Negative.Offset, m.Negative.Counts...)
+		}
+		AssertExponentialHistogram(t, tc, metrics)
+	}
+}
+
+// The min and max of the metric, unbounded when not set
+func metricRange(t TestingT, m MetricSpec) (float64, float64) {
+	bound := func(v any, def float64) float64 {
+		switch n := v.(type) {
+		case nil:
+			return def
+		case int:
+			return float64(n)
+		case float64:
+			return n
+		}
+		t.Fatalf("Invalid bound %v for metric %s", v, m.Name)
+		return 0
+	}
+	return bound(m.Min, math.Inf(-1)), bound(m.Max, math.Inf(1))
+}
+
+// Converts the attributes declared in the spec into OTLP attributes, sorted by key
+func toAttributes(t TestingT, attributes map[string]any) []*otlpcommon.KeyValue {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	res := make([]*otlpcommon.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		if p, ok := attributes[k].(map[string]any); ok {
+			kv, err := toPatternAttribute(k, p)
+			if err != nil {
+				t.Fatalf("Invalid value for attribute %s: %v", k, err)
+			}
+			res = append(res, kv)
+			continue
+		}
+		v, err := toAnyValue(attributes[k])
+		if err != nil {
+			t.Fatalf("Invalid value for attribute %s: %v", k, err)
+		}
+		res = append(res, &otlpcommon.KeyValue{Key: k, Value: v})
+	}
+	return res
+}
+
+// Attributes of the telemetry the harness sends itself, which can't be patterns
+func toSentAttributes(t TestingT, attributes map[string]any) []*otlpcommon.KeyValue {
+	res := toAttributes(t, attributes)
+	for _, kv := range res {
+		if isAttributePattern(kv) {
+			t.Fatalf("Invalid value for attribute %s: patterns are only supported in expected attributes", kv.GetKey())
+		}
+	}
+	return res
+}
+
+// An expected value given as a pattern, e.g. {regex: ^http://.*/helloworld$} or {contains: /helloworld}
+func toPatternAttribute(key string, p map[string]any) (*otlpcommon.KeyValue, error) {
+	if len(p) == 1 {
+		if re, ok := p["regex"].(string); ok {
+			if _, err := regexp.Compile(re); err != nil {
+				return nil, err
+			}
+			return RegexAttribute(key, re), nil
+		}
+		if sub, ok := p["contains"].(string); ok {
+			return ContainsAttribute(key, sub), nil
+		}
+	}
+	return nil, fmt.Errorf("a pattern must be either {regex: <regular expression>} or {contains: <substring>}, got %v", p)
+}
+
+// The expected structured body of a log, whose maps are either patterns or nested fields
+func toLogBody(t TestingT, v any) *otlpcommon.AnyValue {
+	switch val := v.(type) {
+	case map[string]any:
+		_, re := val["regex"]
+		_, sub := val["contains"]
+		if len(val) == 1 && (re || sub) {
+			kv, err := toPatternAttribute("", val)
+			if err != nil {
+				t.Fatalf("Invalid value in log body: %v", err)
+			}
+			return kv.GetValue()
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fields := make([]*otlpcommon.KeyValue, 0, len(keys))
+		for _, k := range keys {
+			fields = append(fields, &otlpcommon.KeyValue{Key: k, Value: toLogBody(t, val[k])})
+		}
+		return MapValue(fields...)
+	case []any:
+		values := make([]*otlpcommon.AnyValue, 0, len(val))
+		for _, e := range val {
+			values = append(values, toLogBody(t, e))
+		}
+		return ArrayValue(values...)
+	}
+	res, err := toAnyValue(v)
+	if err != nil {
+		t.Fatalf("Invalid value in log body: %v", err)
+	}
+	return res
+}
+
+func toAnyValue(v any) (*otlpcommon.AnyValue, error) {
+	switch val := v.(type) {
+	case string:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: val}}, nil
+	case bool:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_BoolValue{BoolValue: val}}, nil
+	case int:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: int64(val)}}, nil
+	case int64:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_IntValue{IntValue: val}}, nil
+	case float64:
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_DoubleValue{DoubleValue: val}}, nil
+	case []any:
+		arr := &otlpcommon.ArrayValue{}
+		for _, e := range val {
+			ev, err := toAnyValue(e)
+			if err != nil {
+				return nil, err
+			}
+			arr.Values = append(arr.Values, ev)
+		}
+		return &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_ArrayValue{ArrayValue: arr}}, nil
+	case []string:
+		return StringSliceAttribute("", val...).GetValue(), nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", v)
+	}
+}
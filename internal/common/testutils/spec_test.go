@@ -0,0 +1,57 @@
+package testutils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// An OTLP JSON line as read by the file back-end, with base64 ids
+const specTestTraces = `{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"spec-test"}}]},` +
+	`"scopeSpans":[{"scope":{"name":"spec-test"},"spans":[{"traceId":"W4qlotLIcugyHPNzCNad8g==","spanId":"BRWBvzy1XBM=",` +
+	`"name":"HelloWorldSpan","kind":1,"startTimeUnixNano":"1714644000000000000","endTimeUnixNano":"1714644001000000000",` +
+	`"attributes":[{"key":"foo","value":{"stringValue":"bar"}}]}]}]}]}`
+
+func TestAssertSpecSignals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	if err := os.WriteFile(path, []byte(specTestTraces+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	RegisterTraceBackend("spec-test", func(*Config) TraceBackend { return NewOtlpFileBackend(path) })
+	t.Cleanup(func() {
+		backendsMu.Lock()
+		defer backendsMu.Unlock()
+		delete(traceBackends, "spec-test")
+	})
+
+	c := *GetConfig()
+	c.TraceBackend = "spec-test"
+	// nothing listens there: asserting the metrics or the logs would fail
+	c.OtlpBackendUrl = "http://localhost:1"
+	UseConfig(t, &c)
+
+	spec := &Spec{
+		ServiceName: "spec-test",
+		Retry:       &RetrySpec{InitialInterval: time.Millisecond, MaxElapsedTime: 10 * time.Millisecond},
+		Spans:       []SpanSpec{{Name: "HelloWorldSpan", Attributes: map[string]any{"foo": "bar"}}},
+		Metrics:     []MetricSpec{{Name: "requests", Type: "counter"}},
+		Logs:        []LogSpec{{Severity: "INFO", Body: "hello"}},
+		IDs:         true,
+		Golden:      "golden.json",
+	}
+	results := AssertSpec(t, spec, TraceSignal)
+
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Name)
+		if !r.Passed {
+			t.Errorf("%s failed", r.Name)
+		}
+	}
+	// the ids of the metrics and logs are not asserted, and the golden file covers all the signals
+	if want := []string{"span/HelloWorldSpan", "ids"}; !slices.Equal(names, want) {
+		t.Errorf("got the assertions %v, want %v", names, want)
+	}
+}
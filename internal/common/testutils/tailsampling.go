@@ -0,0 +1,149 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// A kind of trace generated by a tail sampling scenario, e.g. the traces of failed requests
+type ScenarioTrace struct {
+	// The name of the root span. Defaults to tail-sampling
+	SpanName string
+	// Sets the error status on the root span
+	Error bool
+	// The duration of the root span, e.g. above the threshold of a latency policy
+	Duration   time.Duration
+	Attributes []*otlpcommon.KeyValue
+	// Whether the sampling policy is expected to keep the traces of this kind
+	Sampled bool
+	// How many traces of this kind are generated. Defaults to 1
+	Count int
+}
+
+// A scenario for a collector with a tail sampling processor: a mix of traces is sent
+// to the collector, of which only the ones matching the sampling policy must reach the back-end
+type TailSamplingTestCase struct {
+	serviceName string
+	traces      []ScenarioTrace
+}
+
+// Creates a scenario whose traces are generated for the service, i.e. with it as their service.name
+func NewTailSamplingTestCase(serviceName string) *TailSamplingTestCase {
+	return &TailSamplingTestCase{serviceName: serviceName}
+}
+
+func (tc *TailSamplingTestCase) WithTraces(traces ...ScenarioTrace) *TailSamplingTestCase {
+	tc.traces = append(tc.traces, traces...)
+	return tc
+}
+
+// Sends the traces of the scenario to the OTLP/HTTP receiver of the collector (-collector-url), then asserts
+// the sampled ones reach the back-end and the others don't. As the tail sampling processor decides once its
+// decision_wait elapsed, the retry policy should allow for it
+func AssertTailSampling(t TestingT, tc *TailSamplingTestCase) {
+	var sampled, dropped []*SpanContext
+	names := make(map[string]string)
+
+	req := &coltracepb.ExportTraceServiceRequest{}
+	rs := &otlptrace.ResourceSpans{
+		Resource:   &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{StringAttribute("service.name", tc.serviceName)}},
+		ScopeSpans: []*otlptrace.ScopeSpans{{Scope: &otlpcommon.InstrumentationScope{Name: "otel-recipes/tail-sampling"}}},
+	}
+	req.ResourceSpans = append(req.ResourceSpans, rs)
+
+	now := time.Now()
+	for _, st := range tc.traces {
+		count := max(st.Count, 1)
+		for i := 0; i < count; i++ {
+			c := NewSpanContext()
+			span := scenarioSpan(st, c, now)
+			rs.ScopeSpans[0].Spans = append(rs.ScopeSpans[0].Spans, span)
+			names[string(c.TraceID)] = span.Name
+
+			if st.Sampled {
+				sampled = append(sampled, c)
+			} else {
+				dropped = append(dropped, c)
+			}
+		}
+	}
+
+	sendToCollector(t, req)
+	Logger(t).Info("Sent the scenario traces to the collector", "sampled", len(sampled), "dropped", len(dropped))
+
+	var exported *otlptrace.ResourceSpans
+	var missing []*SpanContext
+	Eventually(t, "Sampled traces", func() bool {
+		exported = getTrace(t, tc.serviceName, TraceQueryOptions{})
+		missing = missing[:0]
+		for _, c := range sampled {
+			if findSpanByID(exported, c.TraceID, c.SpanID) == nil {
+				missing = append(missing, c)
+			}
+		}
+		return len(missing) == 0
+	})
+
+	for _, c := range missing {
+		assert.Fail(t, "Trace not sampled", "Trace %s with root span %s was expected to be sampled",
+			hex.EncodeToString(c.TraceID), names[string(c.TraceID)])
+	}
+	// the traces are decided together, so the dropped ones would have been exported by now
+	for _, c := range dropped {
+		assert.Nil(t, findSpanByID(exported, c.TraceID, c.SpanID), "Trace %s with root span %s was expected to be dropped",
+			hex.EncodeToString(c.TraceID), names[string(c.TraceID)])
+	}
+}
+
+func scenarioSpan(st ScenarioTrace, c *SpanContext, end time.Time) *otlptrace.Span {
+	name := st.SpanName
+	if name == "" {
+		name = "tail-sampling"
+	}
+	span := &otlptrace.Span{
+		TraceId:           c.TraceID,
+		SpanId:            c.SpanID,
+		Name:              name,
+		Kind:              otlptrace.Span_SPAN_KIND_SERVER,
+		StartTimeUnixNano: uint64(end.Add(-st.Duration).UnixNano()),
+		EndTimeUnixNano:   uint64(end.UnixNano()),
+		Attributes:        st.Attributes,
+	}
+	if st.Error {
+		span.Status = &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR, Message: "generated error"}
+	}
+	return span
+}
+
+func sendToCollector(t TestingT, req *coltracepb.ExportTraceServiceRequest) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed serializing the traces: %v", err)
+	}
+
+	u := strings.TrimSuffix(getConfig(t).CollectorUrl, "/") + "/v1/traces"
+	r, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Invalid collector address: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/x-protobuf")
+
+	res, resBody, err := doHttp(r)
+	if err == nil && res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("status code %d: %s", res.StatusCode, resBody)
+	}
+	if err != nil {
+		t.Fatalf("Failed sending the traces to the collector at %s: %v", u, err)
+	}
+}
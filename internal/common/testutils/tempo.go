@@ -0,0 +1,108 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Max number of traces returned by the Tempo search
+const tempoSearchLimit int = 20
+
+func init() {
+	RegisterTraceBackend("tempo", func(c *Config) TraceBackend { return NewTempoBackend(c.TempoUrl) })
+}
+
+// TraceBackend for Grafana Tempo. Traces are searched via /api/search and
+// then fetched one by one via /api/traces/{traceID}
+type TempoBackend struct {
+	uri string
+}
+
+func NewTempoBackend(uri string) *TempoBackend {
+	return &TempoBackend{uri: uri}
+}
+
+type tempoSearchResponse struct {
+	Traces []struct {
+		TraceID string `json:"traceID"`
+	} `json:"traces"`
+}
+
+func (b *TempoBackend) GetTraces(serviceName string, opts TraceQueryOptions) (*otlptrace.ResourceSpans, error) {
+	ids, err := b.searchTraces(serviceName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []*otlptrace.ResourceSpans
+	for _, id := range ids {
+		td, err := b.getTrace(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, rs := range td.GetResourceSpans() {
+			if getServiceName(rs.GetResource()) == serviceName {
+				all = append(all, rs)
+			}
+		}
+	}
+	return mergeResourceSpans(all), nil
+}
+
+func (b *TempoBackend) searchTraces(serviceName string, opts TraceQueryOptions) ([]string, error) {
+	// tags are in logfmt, e.g.: service.name=myapp name=HelloWorldSpan
+	tags := fmt.Sprintf("service.name=%s", serviceName)
+	if opts.SpanName != "" {
+		tags += fmt.Sprintf(" name=%s", opts.SpanName)
+	}
+
+	q := url.Values{}
+	q.Set("tags", tags)
+	start, end := opts.window(time.Now())
+	q.Set("limit", fmt.Sprint(opts.limit(tempoSearchLimit)))
+	q.Set("start", fmt.Sprint(start.Unix()))
+	q.Set("end", fmt.Sprint(end.Unix()))
+
+	body, err := b.get(fmt.Sprintf("%s/api/search?%s", b.uri, q.Encode()), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	var res tempoSearchResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("error reading search payload from Tempo: %w", err)
+	}
+
+	ids := make([]string, 0, len(res.Traces))
+	for _, tr := range res.Traces {
+		ids = append(ids, tr.TraceID)
+	}
+	return ids, nil
+}
+
+// Tempo's protobuf trace (tempopb.Trace) has the same wire format as the OTLP TracesData
+func (b *TempoBackend) getTrace(traceID string) (*otlptrace.TracesData, error) {
+	body, err := b.get(fmt.Sprintf("%s/api/traces/%s", b.uri, traceID), "application/protobuf")
+	if err != nil {
+		return nil, err
+	}
+
+	td := &otlptrace.TracesData{}
+	if err := proto.Unmarshal(body, td); err != nil {
+		return nil, fmt.Errorf("error reading trace %s payload from Tempo: %w", traceID, err)
+	}
+	return td, nil
+}
+
+func (b *TempoBackend) get(uri, accept string) ([]byte, error) {
+	body, err := httpGet(uri, accept)
+	if err != nil {
+		return nil, fmt.Errorf("failed calling Tempo: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,47 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"testing"
+	"time"
+)
+
+// The test the assertions report to. Implemented by *testing.T, and by the reporters of the programs
+// running the assertions outside go test, e.g. the otel-recipes CLI
+type TestingT interface {
+	Name() string
+	Helper()
+	Cleanup(f func())
+	// The time the test must be done by, e.g. go test -timeout. The retries stop before it
+	Deadline() (deadline time.Time, ok bool)
+	TempDir() string
+
+	Log(args ...any)
+	Logf(format string, args ...any)
+	Error(args ...any)
+	Errorf(format string, args ...any)
+	Fatal(args ...any)
+	Fatalf(format string, args ...any)
+	FailNow()
+	Failed() bool
+	Skip(args ...any)
+	Skipped() bool
+}
+
+// A TestingT running the subtests of AssertSpec, one per assertion. Only implemented by the reporters
+// other than *testing.T, whose Run takes a func(*testing.T)
+type Runner interface {
+	TestingT
+	// Runs f as a subtest of the test and reports whether it passed
+	Run(name string, f func(t TestingT)) bool
+}
+
+func runSubtest(t TestingT, name string, f func(t TestingT)) bool {
+	switch r := t.(type) {
+	case *testing.T:
+		return r.Run(name, func(t *testing.T) { f(t) })
+	case Runner:
+		return r.Run(name, f)
+	}
+	t.Fatalf("Cannot run the subtest %s: %T does not implement Runner", name, t)
+	return false
+}
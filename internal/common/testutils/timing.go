@@ -0,0 +1,100 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Tolerance applied to the timing assertions. Spans of different processes are timed with
+// different clocks and some back-ends (e.g. Zipkin) store the timestamps with microsecond precision
+var clockSkewTolerance = flag.Duration("clock-skew-tolerance", 5*time.Millisecond, "Tolerance applied when asserting span durations and timestamps")
+
+// Returns the duration of the span, or 0 if the span has not ended
+func SpanDuration(span *otlptrace.Span) time.Duration {
+	if span.EndTimeUnixNano < span.StartTimeUnixNano {
+		return 0
+	}
+	return time.Duration(span.EndTimeUnixNano - span.StartTimeUnixNano)
+}
+
+func spanStartTime(span *otlptrace.Span) time.Time {
+	return time.Unix(0, int64(span.StartTimeUnixNano))
+}
+
+func spanEndTime(span *otlptrace.Span) time.Time {
+	return time.Unix(0, int64(span.EndTimeUnixNano))
+}
+
+// Asserts the span took at least min and, if max is not 0, at most max.
+// E.g. a recipe sleeping for 100ms inside a span can assert a min of 100ms
+func AssertSpanDuration(t TestingT, span *otlptrace.Span, min, max time.Duration) {
+	if !assert.NotZero(t, span.StartTimeUnixNano, "Span %s has no start time", span.Name) ||
+		!assert.GreaterOrEqual(t, span.EndTimeUnixNano, span.StartTimeUnixNano, "Span %s ends before it starts", span.Name) {
+		return
+	}
+
+	d := SpanDuration(span)
+	assert.GreaterOrEqual(t, d, min-*clockSkewTolerance, "Span %s took %v, expected at least %v", span.Name, d, min)
+	if max > 0 {
+		assert.LessOrEqual(t, d, max+*clockSkewTolerance, "Span %s took %v, expected at most %v", span.Name, d, max)
+	}
+}
+
+// Asserts the child span started and ended within the time of the parent span
+func AssertSpanWithinParent(t TestingT, child, parent *otlptrace.Span) {
+	tolerance := *clockSkewTolerance
+	assert.False(t, spanStartTime(child).Before(spanStartTime(parent).Add(-tolerance)),
+		"Span %s started before its parent %s", child.Name, parent.Name)
+	assert.False(t, spanEndTime(child).After(spanEndTime(parent).Add(tolerance)),
+		"Span %s ended after its parent %s", child.Name, parent.Name)
+}
+
+// Asserts the span has a start and an end time, does not end before it starts and was timed during the run:
+// not before the trace start of the configuration, if set (see TraceStartNow), nor in the future. The clock of
+// the sample may be ahead of the one of the tests by the clock skew of the containers
+func AssertSpanTimestamps(t TestingT, span *otlptrace.Span) {
+	t.Helper()
+	if span.GetStartTimeUnixNano() == 0 || span.GetEndTimeUnixNano() == 0 {
+		t.Errorf("Span %s has no start or end time", span.GetName())
+		return
+	}
+	if span.GetEndTimeUnixNano() < span.GetStartTimeUnixNano() {
+		t.Errorf("Span %s ends %v before it starts", span.GetName(), time.Duration(span.GetStartTimeUnixNano()-span.GetEndTimeUnixNano()))
+	}
+	if v := runWindowViolation(t, span); v != "" {
+		t.Errorf("Span %s %s", span.GetName(), v)
+	}
+}
+
+// Describes how the span was timed outside the run, or returns an empty string
+func runWindowViolation(t TestingT, span *otlptrace.Span) string {
+	start, end := spanStartTime(span), spanEndTime(span)
+	if runStart := traceQuery(t, TraceQueryOptions{}).Start; !runStart.IsZero() && start.Before(runStart.Add(-*clockSkewTolerance)) {
+		return fmt.Sprintf("started at %s, before the run started at %s", formatTimestamp(start), formatTimestamp(runStart))
+	}
+	if now := time.Now(); end.After(now.Add(traceClockSkew)) {
+		return fmt.Sprintf("ended at %s, %v in the future. Is the clock of the sample ahead?", formatTimestamp(end), end.Sub(now).Round(time.Millisecond))
+	}
+	return ""
+}
+
+func formatTimestamp(ts time.Time) string {
+	return ts.UTC().Format(time.RFC3339Nano)
+}
+
+// Asserts the timestamps of all the spans, see AssertSpanTimestamps, and that each span started and ended within
+// its parent, if exported. Meant for samples whose spans all end before their parents, unlike e.g. the spans of
+// background work outliving the request that started it
+func AssertTraceTimestamps(t TestingT, rs *otlptrace.ResourceSpans) {
+	t.Helper()
+	for _, s := range allSpans(rs) {
+		AssertSpanTimestamps(t, s)
+		if parent := findSpanByID(rs, s.GetTraceId(), s.GetParentSpanId()); parent != nil {
+			AssertSpanWithinParent(t, s, parent)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// The names of the files written by GenerateCerts
+const (
+	CAFileName         string = "ca.crt"
+	ServerCertFileName string = "server.crt"
+	ServerKeyFileName  string = "server.key"
+	ClientCertFileName string = "client.crt"
+	ClientKeyFileName  string = "client.key"
+)
+
+const (
+	certsValidity    time.Duration = 24 * time.Hour
+	handshakeTimeout time.Duration = 5 * time.Second
+)
+
+// Test certificates for a TLS or mTLS OTLP export, all issued by a CA created for the test
+type Certs struct {
+	// The folder of the files, which can be mounted in the containers of the collector and the sample
+	Dir string
+	CA  *x509.CertPool
+}
+
+func (c *Certs) File(name string) string {
+	return filepath.Join(c.Dir, name)
+}
+
+// Generates a CA, a server certificate valid for the hosts and localhost, e.g. the collector-otel-recipes
+// alias of the collector, and a client certificate for mTLS. They are removed once the test completes
+func GenerateCerts(t TestingT, hosts ...string) *Certs {
+	dir := t.TempDir()
+	// the containers don't run as the user of the test
+	if err := os.Chmod(dir, 0o755); err != nil {
+		t.Fatalf("Failed generating the certificates: %v", err)
+	}
+
+	caKey, caCert, err := newCert(nil, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "otel-recipes test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, dir, CAFileName, "")
+	if err == nil {
+		server := &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "otel-recipes collector"},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		for _, h := range append(hosts, "localhost", "127.0.0.1") {
+			if ip := net.ParseIP(h); ip != nil {
+				server.IPAddresses = append(server.IPAddresses, ip)
+			} else {
+				server.DNSNames = append(server.DNSNames, h)
+			}
+		}
+		_, _, err = newCert(caKey, caCert, server, dir, ServerCertFileName, ServerKeyFileName)
+	}
+	if err == nil {
+		_, _, err = newCert(caKey, caCert, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "otel-recipes sample"},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}, dir, ClientCertFileName, ClientKeyFileName)
+	}
+	if err != nil {
+		t.Fatalf("Failed generating the certificates: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	return &Certs{Dir: dir, CA: pool}
+}
+
+// Creates the certificate from the template, signed by the parent or self-signed if nil, and writes it and
+// its key as PEM. The key is not written if keyFile is empty
+func newCert(parentKey *ecdsa.PrivateKey, parent, template *x509.Certificate, dir, certFile, keyFile string) (*ecdsa.PrivateKey, *x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(certsValidity)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writePem(filepath.Join(dir, certFile), "CERTIFICATE", der); err != nil {
+		return nil, nil, err
+	}
+	if keyFile != "" {
+		keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writePem(filepath.Join(dir, keyFile), "PRIVATE KEY", keyDer); err != nil {
+			return nil, nil, err
+		}
+	}
+	return key, cert, nil
+}
+
+func writePem(path, typ string, der []byte) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o644)
+}
+
+// The environment variables configuring the OTLP exporter of the SDKs to trust the CA and, for mTLS, to
+// present the client certificate. dir is the folder the certificates are mounted at in the sample
+// container. Empty uses the files on the host
+func (c *Certs) ExporterEnv(dir string, mtls bool) []string {
+	if dir == "" {
+		dir = c.Dir
+	}
+	env := []string{"OTEL_EXPORTER_OTLP_CERTIFICATE=" + filepath.ToSlash(filepath.Join(dir, CAFileName))}
+	if mtls {
+		env = append(env,
+			"OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE="+filepath.ToSlash(filepath.Join(dir, ClientCertFileName)),
+			"OTEL_EXPORTER_OTLP_CLIENT_KEY="+filepath.ToSlash(filepath.Join(dir, ClientKeyFileName)))
+	}
+	return env
+}
+
+// A client configuration trusting the CA, presenting the client certificate if mtls is set
+func (c *Certs) ClientTLSConfig(mtls bool) (*tls.Config, error) {
+	cfg := &tls.Config{RootCAs: c.CA, MinVersion: tls.VersionTLS12}
+	if mtls {
+		cert, err := tls.LoadX509KeyPair(c.File(ClientCertFileName), c.File(ClientKeyFileName))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Asserts the OTLP receiver at addr, e.g. localhost:4317, only accepts TLS connections with a certificate
+// issued by the CA, and with mtls only from clients presenting the client certificate. Spans of the sample
+// found in the back-end then prove it exported them over TLS, instead of falling back to plaintext
+func AssertTLSEndpoint(t TestingT, addr string, c *Certs, mtls bool) {
+	t.Helper()
+	AssertPlaintextRejected(t, addr)
+
+	cfg, err := c.ClientTLSConfig(mtls)
+	if err != nil {
+		t.Fatalf("Failed loading the client certificate: %v", err)
+	}
+	if err := tlsHandshake(addr, cfg); err != nil {
+		t.Errorf("Failed the TLS handshake with %s: %v", addr, err)
+	}
+	if mtls {
+		cfg, _ := c.ClientTLSConfig(false)
+		if err := tlsHandshake(addr, cfg); err == nil {
+			t.Errorf("%s accepted a TLS connection without a client certificate, expected mTLS", addr)
+		}
+	}
+}
+
+// Asserts the OTLP receiver at addr, e.g. localhost:4318, accepts neither an OTLP/HTTP nor an OTLP/gRPC
+// export in plaintext
+func AssertPlaintextRejected(t TestingT, addr string) {
+	t.Helper()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Invalid address %s: %v", addr, err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	err = conn.Invoke(ctx, "/opentelemetry.proto.collector.trace.v1.TraceService/Export",
+		&coltracepb.ExportTraceServiceRequest{}, &coltracepb.ExportTraceServiceResponse{})
+	if err == nil {
+		t.Errorf("%s accepted a plaintext OTLP/gRPC export, expected TLS only", addr)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/v1/traces", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatalf("Invalid address %s: %v", addr, err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	res, body, err := doHttp(req)
+	if err != nil {
+		// e.g. the gRPC receivers close the connection
+		return
+	}
+	// the Go TLS servers answer plaintext requests with a 400
+	if res.StatusCode == http.StatusBadRequest && strings.Contains(string(body), "HTTPS") {
+		return
+	}
+	t.Errorf("%s accepted a plaintext OTLP/HTTP export (status code %d), expected TLS only", addr, res.StatusCode)
+}
+
+// Completes a TLS handshake with the server. With TLS 1.3 a server rejecting the client certificate only
+// tells so after the handshake of the client, so the connection is read from until it is idle
+func tlsHandshake(addr string, cfg *tls.Config) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	cfg = cfg.Clone()
+	cfg.ServerName = host
+	cfg.NextProtos = []string{"h2", "http/1.1"}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: handshakeTimeout}, "tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
+		return err
+	}
+	_, err = conn.Read(make([]byte, 1))
+	var ne net.Error
+	if err == nil || errors.As(err, &ne) && ne.Timeout() {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"strings"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// A tier of collectors the telemetry flows through on its way to the back-end, e.g. the agent next to the
+// sample and the gateway in front of the back-end. Each tier marks the spans it processes, e.g. via an
+// attributes or resource processor, so the spans found in the back-end tell which tiers they traversed
+type CollectorTier struct {
+	Name               string
+	SpanAttributes     []*otlpcommon.KeyValue
+	ResourceAttributes []*otlpcommon.KeyValue
+}
+
+// The tiers the spans of a service must traverse, e.g. agent -> gateway -> back-end
+type TopologyTestCase struct {
+	serviceName string
+	spanName    string
+	tiers       []CollectorTier
+}
+
+// Creates a test case for the spans of the service with the name, which can be a pattern. Empty is any span
+func NewTopologyTestCase(serviceName, spanName string) *TopologyTestCase {
+	if spanName == "" {
+		spanName = "*"
+	}
+	return &TopologyTestCase{serviceName: serviceName, spanName: spanName}
+}
+
+// Adds a tier, in the order the telemetry flows through them
+func (tc *TopologyTestCase) WithTier(tier CollectorTier) *TopologyTestCase {
+	tc.tiers = append(tc.tiers, tier)
+	return tc
+}
+
+// Asserts every span found traversed all the tiers, i.e. carries the attributes of each of them. A span
+// missing the attributes of a tier bypassed it, e.g. the sample exported straight to the gateway
+func AssertTopology(t TestingT, tc *TopologyTestCase) {
+	if len(tc.tiers) == 0 {
+		t.Fatalf("No collector tiers expected for %s", tc.serviceName)
+	}
+
+	var rs *otlptrace.ResourceSpans
+	var spans []*otlptrace.Span
+	found := Eventually(t, "Spans of "+tc.serviceName, func() bool {
+		rs = getTrace(t, tc.serviceName, spanQuery(tc.spanName))
+		spans = findSpans(rs, tc.spanName)
+		return len(spans) > 0
+	})
+	if !found {
+		t.Fatalf("Could not find span with name: %s. Spans of %s:\n%s", tc.spanName, tc.serviceName,
+			spansDiff([]*TraceTestCase{NewTraceTestCase(tc.serviceName, tc.spanName)}, allSpans(rs)))
+	}
+
+	var traversed []string
+	for _, tier := range tc.tiers {
+		if !hasAttributes(rs.GetResource().GetAttributes(), tier.ResourceAttributes) {
+			t.Errorf("The spans of %s did not traverse the %s tier, its resource attributes are missing:\n%s", tc.serviceName,
+				tier.Name, attributesDiff(rs.GetResource().GetAttributes(), tier.ResourceAttributes))
+			continue
+		}
+		bypassed := 0
+		var first *otlptrace.Span
+		for _, s := range spans {
+			if !hasAttributes(s.Attributes, tier.SpanAttributes) {
+				if first == nil {
+					first = s
+				}
+				bypassed++
+			}
+		}
+		if bypassed > 0 {
+			t.Errorf("%d of %d spans %s of %s did not traverse the %s tier (after %s). Attributes of span %s:\n%s",
+				bypassed, len(spans), tc.spanName, tc.serviceName, tier.Name, tierPath(traversed), first.Name,
+				attributesDiff(first.Attributes, tier.SpanAttributes))
+		}
+		traversed = append(traversed, tier.Name)
+	}
+}
+
+func tierPath(tiers []string) string {
+	if len(tiers) == 0 {
+		return "the sample"
+	}
+	return strings.Join(tiers, " -> ")
+}
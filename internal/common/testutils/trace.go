@@ -1,108 +1,428 @@
 package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
 
 import (
-	"fmt"
-	"io"
-	"net/http"
-	"testing"
-	"time"
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/stretchr/testify/assert"
 
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
 	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
-	"google.golang.org/protobuf/proto"
 )
 
-func AssertSpanWithAttributeExists(t *testing.T, tc *TraceTestCase) {
-	backoffSchedule := []time.Duration{
-		1 * time.Second,
-		3 * time.Second,
-		10 * time.Second,
-		15 * time.Second,
-		20 * time.Second,
-		30 * time.Second,
+// Asserts the service exported a span matching the test case. The span name can be a glob
+// pattern, where * matches any sequence of characters and ? a single one, e.g. "GET /api/*"
+func AssertSpanWithAttributeExists(t TestingT, tc *TraceTestCase) {
+	span, rs := findSpanWithRetry(t, tc)
+	assertSpan(t, tc, span, rs)
+}
+
+// Asserts the service exported a trace containing all the spans of the test case
+// and, if a span count is set, exactly that number of spans
+func AssertTraceSpans(t TestingT, tc *TraceSpansTestCase) {
+	var spans []*otlptrace.Span
+	var rs *otlptrace.ResourceSpans
+
+	// do some retries until the whole trace is exported
+	found := Eventually(t, "Trace", func() bool {
+		rs = getTrace(t, tc.serviceName, TraceQueryOptions{})
+		for _, trace := range groupSpansByTrace(rs) {
+			if tc.spanCount > 0 && len(trace) != tc.spanCount {
+				continue
+			}
+			if spans = matchTraceSpans(tc.spans, trace); spans != nil {
+				return true
+			}
+		}
+		return false
+	})
+
+	if !found {
+		t.Fatalf("Could not find a trace of %s with %d spans matching %v. Closest trace:\n%s",
+			tc.serviceName, tc.spanCount, spanNames(tc.spans), spansDiff(tc.spans, closestTrace(tc.spans, diffTraces(rs))))
 	}
 
-	// do some retries until we backend has it
-	var span *otlptrace.Span
-found:
-	for _, backoff := range backoffSchedule {
-		rs := GetTraceWithRetry(t, tc.serviceName)
-		for _, ss := range rs.ScopeSpans {
-			for _, s := range ss.Spans {
-				if s.Name == tc.spanName {
-					span = s
-					break found
-				}
+	for i, exp := range tc.spans {
+		assertSpan(t, exp, spans[i], rs)
+	}
+}
+
+func assertSpan(t TestingT, tc *TraceTestCase, span *otlptrace.Span, rs *otlptrace.ResourceSpans) {
+	AssertAttributes(t, "span "+span.Name, span.Attributes, tc.attributes...)
+	for key, typ := range tc.attributeTypes {
+		AssertAttributeType(t, span.Attributes, key, typ)
+	}
+	for _, key := range tc.absentAttributes {
+		AssertNoAttribute(t, span.Attributes, key)
+	}
+
+	AssertResourceAttributes(t, rs.GetResource(), tc.resourceAttributes...)
+	validateSemanticConventions(t, span)
+
+	if tc.scopeName != "" {
+		AssertSpanScope(t, rs, span, tc.scopeName)
+	}
+
+	if tc.kind != otlptrace.Span_SPAN_KIND_UNSPECIFIED {
+		AssertSpanKind(t, span, tc.kind)
+	}
+
+	if tc.status != nil {
+		AssertSpanStatus(t, span, tc.status.Code, tc.status.Message)
+	}
+
+	for _, e := range tc.events {
+		AssertSpanHasEvent(t, span, e.name, e.attributes...)
+	}
+
+	for _, l := range tc.links {
+		targets := findSpans(getTraceWithRetry(t, l.serviceName, spanQuery(l.spanName)), l.spanName)
+		link := findLink(span, targets)
+		if assert.NotNil(t, link, "Span %s has no link to span %s of %s", span.Name, l.spanName, l.serviceName) {
+			AssertAttributes(t, "the link of span "+span.Name, link.Attributes, l.attributes...)
+		}
+	}
+
+	if tc.parentSpanName != "" {
+		parent := findSpanByID(rs, span.TraceId, span.ParentSpanId)
+		if assert.NotNil(t, parent, "Could not find the parent of span %s", span.Name) {
+			assert.True(t, matchSpanName(tc.parentSpanName, parent.Name),
+				"Span %s has parent %s, expected %s", span.Name, parent.Name, tc.parentSpanName)
+			AssertSpanWithinParent(t, span, parent)
+		}
+	}
+
+	if tc.minDuration > 0 || tc.maxDuration > 0 {
+		AssertSpanDuration(t, span, tc.minDuration, tc.maxDuration)
+	}
+}
+
+// Asserts the service exported no span with the name, which can be a pattern as in NewTraceSpansTestCase.
+// Used by recipes dropping spans, e.g. via sampling or a filter processor. The absence is only checked
+// once spans of the service were found, so a span expected to be exported should be asserted first
+func AssertNoSpan(t TestingT, serviceName, spanName string) {
+	rs := GetTraceWithRetry(t, serviceName)
+	for _, ss := range rs.GetScopeSpans() {
+		for _, s := range ss.GetSpans() {
+			if matchSpanName(spanName, s.GetName()) {
+				t.Errorf("Span %s of %s was expected to be absent, found %s in trace %x", spanName, serviceName, s.GetName(), s.GetTraceId())
+			}
+		}
+	}
+}
+
+// Finds the first span with the given name exported by the sample
+func FindSpan(t TestingT, serviceName, spanName string) *otlptrace.Span {
+	span, _ := findSpanWithRetry(t, NewTraceTestCase(serviceName, spanName))
+	return span
+}
+
+// Asserts the child span is part of the same trace and has parent as its direct parent
+func AssertSpanParent(t TestingT, child, parent *otlptrace.Span) {
+	assert.Equal(t, parent.TraceId, child.TraceId, "Span %s is not in the same trace as %s", child.Name, parent.Name)
+	assert.Equal(t, parent.SpanId, child.ParentSpanId, "Span %s is not a child of %s", child.Name, parent.Name)
+}
+
+// Asserts the span recorded an event with the given name containing the attributes
+func AssertSpanHasEvent(t TestingT, span *otlptrace.Span, name string, attributes ...*otlpcommon.KeyValue) {
+	var event *otlptrace.Span_Event
+	for _, e := range span.Events {
+		if e.Name == name {
+			event = e
+			break
+		}
+	}
+
+	if !assert.NotNil(t, event, "Could not find event %s in span %s", name, span.Name) {
+		return
+	}
+
+	AssertAttributes(t, "event "+name+" of span "+span.Name, event.Attributes, attributes...)
+}
+
+// Asserts the span has a link pointing to the target span
+func AssertSpanLinkedTo(t TestingT, span, target *otlptrace.Span) {
+	assert.NotNil(t, findLink(span, []*otlptrace.Span{target}), "Span %s has no link to span %s", span.Name, target.Name)
+}
+
+func findLink(span *otlptrace.Span, targets []*otlptrace.Span) *otlptrace.Span_Link {
+	for _, l := range span.Links {
+		for _, target := range targets {
+			if bytes.Equal(l.TraceId, target.TraceId) && bytes.Equal(l.SpanId, target.SpanId) {
+				return l
 			}
 		}
-		t.Logf("Trace not found yet, retrying in %v\n", backoff)
-		time.Sleep(backoff)
 	}
+	return nil
+}
+
+// Asserts the span status code and description. The description is only
+// checked for the error status, as the spec ignores it for the others
+func AssertSpanStatus(t TestingT, span *otlptrace.Span, code otlptrace.Status_StatusCode, description string) {
+	assert.Equal(t, code, span.GetStatus().GetCode(), "Unexpected status code for span %s", span.Name)
+	if code == otlptrace.Status_STATUS_CODE_ERROR {
+		assert.Equal(t, description, span.GetStatus().GetMessage(), "Unexpected status description for span %s", span.Name)
+	}
+}
 
-	assert.NotNil(t, span)
-	assert.Equal(t, tc.attributes[0], span.Attributes[0])
-	assert.Contains(t, span.Attributes, tc.attributes[0])
+func AssertSpanKind(t TestingT, span *otlptrace.Span, kind otlptrace.Span_SpanKind) {
+	assert.Equal(t, formatSpanKind(kind), formatSpanKind(span.GetKind()), "Unexpected kind for span %s", span.Name)
+}
 
-	for _, exp := range tc.attributes {
-		assert.Contains(t, span.Attributes, exp)
+// Asserts the span was produced by the instrumentation scope with the given name. The name can be a pattern
+// as for the span names, e.g. io.opentelemetry.spring-webmvc-*, whose version varies with the agent
+func AssertSpanScope(t TestingT, rs *otlptrace.ResourceSpans, span *otlptrace.Span, scopeName string) {
+	scope := findSpanScope(rs, span)
+	if assert.NotNil(t, scope, "Could not find the instrumentation scope of span %s", span.Name) {
+		assert.True(t, matchSpanName(scopeName, scope.GetName()),
+			"Unexpected instrumentation scope for span %s: expected %s, actual %s", span.Name, scopeName, scope.GetName())
 	}
 }
 
-func GetTraceWithRetry(t *testing.T, serviceName string) *otlptrace.ResourceSpans {
-	backoffSchedule := []time.Duration{
-		1 * time.Second,
-		3 * time.Second,
-		10 * time.Second,
-		15 * time.Second,
-		20 * time.Second,
-		30 * time.Second,
+func findSpanScope(rs *otlptrace.ResourceSpans, span *otlptrace.Span) *otlpcommon.InstrumentationScope {
+	for _, ss := range rs.GetScopeSpans() {
+		for _, s := range ss.GetSpans() {
+			if s == span {
+				return ss.GetScope()
+			}
+		}
 	}
+	return nil
+}
 
+func AssertRootSpan(t TestingT, span *otlptrace.Span) {
+	assert.Empty(t, span.ParentSpanId, "Span %s is not a root span", span.Name)
+}
+
+func findSpanWithRetry(t TestingT, tc *TraceTestCase) (*otlptrace.Span, *otlptrace.ResourceSpans) {
+	var span *otlptrace.Span
 	var rs *otlptrace.ResourceSpans
 
 	// do some retries until we backend has it
-	for _, backoff := range backoffSchedule {
-		rs = GetTrace(t, serviceName)
+	query := spanQuery(tc.spanName).withTags(tc.attributes)
+	found := Eventually(t, "Trace", func() bool {
+		rs = getTrace(t, tc.serviceName, query)
+		span = nil
+		for _, s := range findSpans(rs, tc.spanName) {
+			// the parent may be exported later than the child
+			if tc.parentSpanName != "" && findSpanByID(rs, s.TraceId, s.ParentSpanId) == nil {
+				continue
+			}
+			// prefer a span with the expected attributes and kind, so the assertions
+			// still report the missing ones if there is none
+			if span == nil || tc.matches(s) && !tc.matches(span) {
+				span = s
+			}
+		}
+		return span != nil
+	})
 
-		if rs != nil {
-			break
+	if !found {
+		// the spans without the expected attributes, to show what they differ in
+		if len(query.Tags) > 0 {
+			rs = getTrace(t, tc.serviceName, spanQuery(tc.spanName))
 		}
+		t.Fatalf("Could not find span with name: %s. Spans of %s:\n%s", tc.spanName, tc.serviceName,
+			spansDiff([]*TraceTestCase{tc}, allSpans(rs)))
+	}
+	return span, rs
+}
 
-		t.Logf("Trace not found yet, retrying in %v\n", backoff)
-		time.Sleep(backoff)
+func findSpans(rs *otlptrace.ResourceSpans, spanName string) []*otlptrace.Span {
+	var res []*otlptrace.Span
+	for _, ss := range rs.GetScopeSpans() {
+		for _, s := range ss.GetSpans() {
+			if matchSpanName(spanName, s.Name) {
+				res = append(res, s)
+			}
+		}
 	}
+	return res
+}
 
-	if len(rs.ScopeSpans) == 0 {
-		t.Fatalf("Could not find traces for sample: %s", serviceName)
+// Matches each expected span to a different span of the trace, returning the matched
+// spans in the order of the expected ones or nil if any of them has no match
+func matchTraceSpans(expected []*TraceTestCase, trace []*otlptrace.Span) []*otlptrace.Span {
+	res := make([]*otlptrace.Span, 0, len(expected))
+	used := make(map[*otlptrace.Span]bool, len(trace))
+	for _, exp := range expected {
+		var match *otlptrace.Span
+		for _, s := range trace {
+			if !used[s] && matchSpanName(exp.spanName, s.Name) && exp.matches(s) {
+				match = s
+				break
+			}
+		}
+		if match == nil {
+			return nil
+		}
+		used[match] = true
+		res = append(res, match)
 	}
+	return res
+}
 
-	return rs
+// Groups the spans of the normalized copy of the traces by trace id, so the spans and their attributes are diffed
+// in the same order whatever the order of the back-end. The matching uses the exported order, see groupSpansByTrace
+func diffTraces(rs *otlptrace.ResourceSpans) [][]*otlptrace.Span {
+	return groupSpansByTrace(Normalization{}.Traces(rs))
 }
 
-func GetTrace(t *testing.T, serviceName string) *otlptrace.ResourceSpans {
-	t.Logf("Going to call OTLP backend to fetch trace for sample: %s", serviceName)
-	r, err := http.Get(fmt.Sprintf("%s/getotlp?signal=trace&servicename=%s", OtlpBackendUri, serviceName))
-	if err != nil {
-		t.Fatalf("Failed getting trace from OTLP backend: %v", err)
+// Groups the spans by trace id, keeping the order in which the traces were exported
+func groupSpansByTrace(rs *otlptrace.ResourceSpans) [][]*otlptrace.Span {
+	var traces [][]*otlptrace.Span
+	index := make(map[string]int)
+	for _, ss := range rs.GetScopeSpans() {
+		for _, s := range ss.GetSpans() {
+			i, found := index[string(s.TraceId)]
+			if !found {
+				i = len(traces)
+				index[string(s.TraceId)] = i
+				traces = append(traces, nil)
+			}
+			traces[i] = append(traces[i], s)
+		}
 	}
+	return traces
+}
 
-	t.Log("Received 200 response from OTLP backend")
+// Whether the span has the expected attributes and, if set, kind of the test case. The name is matched apart
+func (tc *TraceTestCase) matches(s *otlptrace.Span) bool {
+	return hasAttributes(s.GetAttributes(), tc.attributes) &&
+		(tc.kind == otlptrace.Span_SPAN_KIND_UNSPECIFIED || s.GetKind() == tc.kind)
+}
 
-	body, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
-	if err != nil {
-		t.Fatalf("Error reading payload from OTLP backend: %v", err)
+// Whether all the expected attributes are found in the actual ones
+func hasAttributes(actual, expected []*otlpcommon.KeyValue) bool {
+	for _, exp := range expected {
+		found := false
+		for _, kv := range actual {
+			if kv.GetKey() == exp.GetKey() && matchAttributeValue(exp.GetValue(), kv.GetValue()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// The regular expressions of the span name patterns, compiled once
+var spanNamePatterns sync.Map
+
+// Reports whether the span name matches the pattern. Besides exact names, the pattern
+// supports * to match any sequence of characters (including /) and ? to match one
+func matchSpanName(pattern, name string) bool {
+	if !isSpanNamePattern(pattern) {
+		return pattern == name
+	}
+	re, found := spanNamePatterns.Load(pattern)
+	if !found {
+		re, _ = spanNamePatterns.LoadOrStore(pattern, compileSpanNamePattern(pattern))
+	}
+	return re.(*regexp.Regexp).MatchString(name)
+}
+
+func compileSpanNamePattern(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
 	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
 
-	if len(body) == 0 {
+func isSpanNamePattern(spanName string) bool {
+	return strings.ContainsAny(spanName, "*?")
+}
+
+// The back-ends can only filter by exact span names, so patterns are matched after fetching
+func spanQuery(spanName string) TraceQueryOptions {
+	if isSpanNamePattern(spanName) {
+		return TraceQueryOptions{}
+	}
+	return TraceQueryOptions{SpanName: spanName}
+}
+
+// Adds the expected string attributes to the query. Patterns and the other types are matched after fetching
+func (o TraceQueryOptions) withTags(attributes []*otlpcommon.KeyValue) TraceQueryOptions {
+	for _, kv := range attributes {
+		sv, ok := kv.GetValue().GetValue().(*otlpcommon.AnyValue_StringValue)
+		if !ok {
+			continue
+		}
+		if o.Tags == nil {
+			o.Tags = make(map[string]string)
+		}
+		o.Tags[kv.GetKey()] = sv.StringValue
+	}
+	return o
+}
+
+func spanNames(tcs []*TraceTestCase) []string {
+	names := make([]string, 0, len(tcs))
+	for _, tc := range tcs {
+		names = append(names, tc.spanName)
+	}
+	return names
+}
+
+func findSpanByID(rs *otlptrace.ResourceSpans, traceID, spanID []byte) *otlptrace.Span {
+	if len(spanID) == 0 {
 		return nil
 	}
+	for _, ss := range rs.GetScopeSpans() {
+		for _, s := range ss.GetSpans() {
+			if bytes.Equal(s.TraceId, traceID) && bytes.Equal(s.SpanId, spanID) {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+func GetTraceWithRetry(t TestingT, serviceName string) *otlptrace.ResourceSpans {
+	return getTraceWithRetry(t, serviceName, TraceQueryOptions{})
+}
+
+func getTraceWithRetry(t TestingT, serviceName string, opts TraceQueryOptions) *otlptrace.ResourceSpans {
+	var rs *otlptrace.ResourceSpans
+
+	// do some retries until we backend has it
+	found := Eventually(t, "Trace", func() bool {
+		rs = getTrace(t, serviceName, opts)
+		return len(rs.GetScopeSpans()) > 0
+	})
+
+	if !found {
+		t.Fatalf("Could not find traces for sample: %s", serviceName)
+	}
+
+	return rs
+}
+
+func GetTrace(t TestingT, serviceName string) *otlptrace.ResourceSpans {
+	return getTrace(t, serviceName, TraceQueryOptions{})
+}
 
-	rs := &otlptrace.ResourceSpans{}
-	err = proto.Unmarshal(body, rs)
+func getTrace(t TestingT, serviceName string, opts TraceQueryOptions) *otlptrace.ResourceSpans {
+	Logger(t).Debug("Going to call the back-end to fetch traces", "backend", "trace", "service", serviceName)
+	rs, err := queryTraces(t, serviceName, opts)
 	if err != nil {
-		t.Fatalf("Error reading payload from OTLP backend: %v", err)
+		checkBackendError(t, "trace", err)
+		return nil
 	}
 	return rs
 }
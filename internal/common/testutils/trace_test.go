@@ -0,0 +1,31 @@
+package testutils
+
+import "testing"
+
+func TestMatchSpanName(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"GET /hello", "GET /hello", true},
+		{"GET /hello", "GET /hello/1", false},
+		{"GET *", "GET /hello/1", true},
+		{"GET *", "POST /hello", false},
+		{"GET /users/?", "GET /users/1", true},
+		{"GET /users/?", "GET /users/12", false},
+		{"*.Send", "grpc.Greeter.Send", true},
+		{"a.b", "axb", false},
+		{"(*)", "(x)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			// twice, the second time with the cached pattern
+			for i := 0; i < 2; i++ {
+				if got := matchSpanName(tt.pattern, tt.name); got != tt.want {
+					t.Errorf("matchSpanName(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -1,15 +1,40 @@
 package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
 
 import (
+	"time"
+
 	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
 )
 
 type TraceTestCase struct {
+	serviceName        string
+	spanName           string
+	attributes         []*otlpcommon.KeyValue
+	parentSpanName     string
+	events             []*EventTestCase
+	links              []*LinkTestCase
+	status             *otlptrace.Status
+	resourceAttributes []*otlpcommon.KeyValue
+	scopeName          string
+	minDuration        time.Duration
+	maxDuration        time.Duration
+	attributeTypes     map[string]AttributeType
+	absentAttributes   []string
+	kind               otlptrace.Span_SpanKind
+}
+
+type LinkTestCase struct {
 	serviceName string
 	spanName    string
 	attributes  []*otlpcommon.KeyValue
 }
 
+type EventTestCase struct {
+	name       string
+	attributes []*otlpcommon.KeyValue
+}
+
 func NewTraceTestCase(serviceName, spanName string, attributes ...*otlpcommon.KeyValue) *TraceTestCase {
 	return &TraceTestCase{
 		serviceName: serviceName,
@@ -18,6 +43,156 @@ func NewTraceTestCase(serviceName, spanName string, attributes ...*otlpcommon.Ke
 	}
 }
 
+// Adds attributes the span is expected to have, besides the ones of NewTraceTestCase
+func (tc *TraceTestCase) WithAttributes(attributes ...*otlpcommon.KeyValue) *TraceTestCase {
+	tc.attributes = append(tc.attributes, attributes...)
+	return tc
+}
+
+// Sets the name of the span expected to be the direct parent of the span
+func (tc *TraceTestCase) WithParent(spanName string) *TraceTestCase {
+	tc.parentSpanName = spanName
+	return tc
+}
+
+// Adds an event the span is expected to have recorded
+func (tc *TraceTestCase) WithEvent(name string, attributes ...*otlpcommon.KeyValue) *TraceTestCase {
+	tc.events = append(tc.events, &EventTestCase{name: name, attributes: attributes})
+	return tc
+}
+
+// Adds a link the span is expected to have to a span of the given service,
+// e.g. a consumer span linking to the span of the producer
+func (tc *TraceTestCase) WithLink(serviceName, spanName string, attributes ...*otlpcommon.KeyValue) *TraceTestCase {
+	tc.links = append(tc.links, &LinkTestCase{serviceName: serviceName, spanName: spanName, attributes: attributes})
+	return tc
+}
+
+// Sets the status the span is expected to have, e.g. STATUS_CODE_ERROR for failed operations
+func (tc *TraceTestCase) WithStatus(code otlptrace.Status_StatusCode, description string) *TraceTestCase {
+	tc.status = &otlptrace.Status{Code: code, Message: description}
+	return tc
+}
+
+// Sets the kind the span is expected to have, e.g. SPAN_KIND_SERVER for the spans of incoming requests
+func (tc *TraceTestCase) WithKind(kind otlptrace.Span_SpanKind) *TraceTestCase {
+	tc.kind = kind
+	return tc
+}
+
+// Sets the resource attributes the span is expected to be exported with
+func (tc *TraceTestCase) WithResourceAttributes(attributes ...*otlpcommon.KeyValue) *TraceTestCase {
+	tc.resourceAttributes = attributes
+	return tc
+}
+
+// Sets the name of the instrumentation scope (the tracer name) expected to have produced the span.
+// E.g. go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp
+func (tc *TraceTestCase) WithScope(name string) *TraceTestCase {
+	tc.scopeName = name
+	return tc
+}
+
+// Describes a whole trace: the number of spans it is expected to have and the spans
+// that must be part of it. Each expected span is matched to a different span of the trace
+type TraceSpansTestCase struct {
+	serviceName string
+	spanCount   int
+	spans       []*TraceTestCase
+}
+
+// Creates a test case for a trace of the service with exactly spanCount spans.
+// A spanCount of 0 only asserts the trace contains the given spans
+func NewTraceSpansTestCase(serviceName string, spanCount int, spans ...*TraceTestCase) *TraceSpansTestCase {
+	return &TraceSpansTestCase{
+		serviceName: serviceName,
+		spanCount:   spanCount,
+		spans:       spans,
+	}
+}
+
+// Expects the span to have the attribute with a value of the given type, whatever its value
+func (tc *TraceTestCase) WithAttributeType(key string, typ AttributeType) *TraceTestCase {
+	if tc.attributeTypes == nil {
+		tc.attributeTypes = make(map[string]AttributeType)
+	}
+	tc.attributeTypes[key] = typ
+	return tc
+}
+
+// Expects the span to not have the attributes, e.g. as they are removed by the collector
+func (tc *TraceTestCase) WithoutAttributes(keys ...string) *TraceTestCase {
+	tc.absentAttributes = append(tc.absentAttributes, keys...)
+	return tc
+}
+
+// Sets the bounds the span duration is expected to be within. A max of 0 means no upper bound
+func (tc *TraceTestCase) WithDuration(min, max time.Duration) *TraceTestCase {
+	tc.minDuration = min
+	tc.maxDuration = max
+	return tc
+}
+
+// A request flowing from a span of a service to a span of another, e.g. a frontend calling a backend
+type PropagationTestCase struct {
+	from         *TraceTestCase
+	to           *TraceTestCase
+	baggage      []*otlpcommon.KeyValue
+	clientServer bool
+}
+
+// Creates a test case asserting the span of the to service is in the trace of the span of the from service
+func NewPropagationTestCase(from, to *TraceTestCase) *PropagationTestCase {
+	return &PropagationTestCase{from: from, to: to}
+}
+
+// Sets the baggage entries set by the from service, which the to service is expected to read
+// into attributes of its span, e.g. via a baggage span processor
+func (tc *PropagationTestCase) WithBaggage(entries ...*otlpcommon.KeyValue) *PropagationTestCase {
+	tc.baggage = entries
+	return tc
+}
+
+// Expects the from span to be the client span of the call and the to span the server span handling it,
+// i.e. a direct child of the client span
+func (tc *PropagationTestCase) AsClientServer() *PropagationTestCase {
+	tc.clientServer = true
+	return tc
+}
+
+type SamplingTestCase struct {
+	serviceName string
+	spanName    string
+	ratio       float64
+	total       int
+	request     *SampleRequest
+	stdDevs     float64
+}
+
+// Creates a test case for a sample sampling the spans with the given name at the ratio, out of
+// a total of spans created. Without a request, the sample is expected to create the spans itself
+func NewSamplingTestCase(serviceName, spanName string, ratio float64, total int) *SamplingTestCase {
+	return &SamplingTestCase{
+		serviceName: serviceName,
+		spanName:    spanName,
+		ratio:       ratio,
+		total:       total,
+		stdDevs:     defaultSamplingStdDevs,
+	}
+}
+
+// Sends the request to the sample API total times, each creating one of the spans
+func (tc *SamplingTestCase) WithRequest(r *SampleRequest) *SamplingTestCase {
+	tc.request = r
+	return tc
+}
+
+// Sets how many standard deviations the sampled count may deviate from the expected one
+func (tc *SamplingTestCase) WithStdDevs(n float64) *SamplingTestCase {
+	tc.stdDevs = n
+	return tc
+}
+
 type Number interface {
 	int | int64 | float64
 }
@@ -40,15 +215,181 @@ func NewMetricTestCase[T Number](name, description, unit string, value T, attrib
 	}
 }
 
-type LogTestCase struct {
-	serviceName string
-	severity    string
-	body        string
+// A test case for a gauge or an UpDownCounter whose value varies between runs, expected within [min, max]
+type MetricRangeTestCase[T Number] struct {
+	metricName  string
+	description string
+	unit        string
+	min         T
+	max         T
 	attributes  []*otlpcommon.KeyValue
-	withTrace   bool
+}
+
+func NewMetricRangeTestCase[T Number](name, description, unit string, min, max T, attributes ...*otlpcommon.KeyValue) *MetricRangeTestCase[T] {
+	return &MetricRangeTestCase[T]{
+		metricName:  name,
+		description: description,
+		unit:        unit,
+		min:         min,
+		max:         max,
+		attributes:  attributes,
+	}
+}
+
+type HistogramTestCase struct {
+	metricName   string
+	description  string
+	unit         string
+	count        *uint64
+	sum          *float64
+	bounds       []float64
+	bucketCounts []uint64
+	attributes   []*otlpcommon.KeyValue
+}
+
+// Creates a test case for the histogram data point with the given attributes.
+// Only the fields set via the With* methods are asserted
+func NewHistogramTestCase(name, description, unit string, attributes ...*otlpcommon.KeyValue) *HistogramTestCase {
+	return &HistogramTestCase{
+		metricName:  name,
+		description: description,
+		unit:        unit,
+		attributes:  attributes,
+	}
+}
+
+// Sets the number of values recorded in the data point
+func (tc *HistogramTestCase) WithCount(count uint64) *HistogramTestCase {
+	tc.count = &count
+	return tc
+}
+
+// Sets the sum of the values recorded in the data point
+func (tc *HistogramTestCase) WithSum(sum float64) *HistogramTestCase {
+	tc.sum = &sum
+	return tc
+}
+
+// Sets the explicit bucket boundaries the histogram is expected to be aggregated with, e.g. the ones of a View,
+// without asserting the bucket counts. See DefaultHistogramBounds for the ones of the SDKs
+func (tc *HistogramTestCase) WithBounds(bounds ...float64) *HistogramTestCase {
+	tc.bounds = bounds
+	return tc
+}
+
+// Sets the explicit bucket boundaries and the count of each bucket. There is one more count
+// than boundaries, the last one being the bucket of the values above the last boundary
+func (tc *HistogramTestCase) WithBuckets(bounds []float64, counts []uint64) *HistogramTestCase {
+	tc.bounds = bounds
+	tc.bucketCounts = counts
+	return tc
+}
+
+type ExponentialHistogramTestCase struct {
+	metricName  string
+	description string
+	unit        string
+	count       *uint64
+	sum         *float64
+	scale       *int32
+	maxScale    *int32
+	zeroCount   *uint64
+	positive    *ExponentialBuckets
+	negative    *ExponentialBuckets
+	attributes  []*otlpcommon.KeyValue
+}
+
+// The buckets of one side of an exponential histogram data point. The bucket of counts[i] holds the values
+// in (base^(offset+i), base^(offset+i+1)], with base = 2^(2^-scale)
+type ExponentialBuckets struct {
+	Offset int32
+	Counts []uint64
+}
+
+// Creates a test case for the exponential histogram data point with the given attributes.
+// Only the fields set via the With* methods are asserted
+func NewExponentialHistogramTestCase(name, description, unit string, attributes ...*otlpcommon.KeyValue) *ExponentialHistogramTestCase {
+	return &ExponentialHistogramTestCase{
+		metricName:  name,
+		description: description,
+		unit:        unit,
+		attributes:  attributes,
+	}
+}
+
+// Sets the number of values recorded in the data point
+func (tc *ExponentialHistogramTestCase) WithCount(count uint64) *ExponentialHistogramTestCase {
+	tc.count = &count
+	return tc
+}
+
+// Sets the sum of the values recorded in the data point
+func (tc *ExponentialHistogramTestCase) WithSum(sum float64) *ExponentialHistogramTestCase {
+	tc.sum = &sum
+	return tc
+}
+
+// Sets the scale of the data point. The SDKs lower the scale as the recorded values spread, so it
+// depends on the values, see WithMaxScale
+func (tc *ExponentialHistogramTestCase) WithScale(scale int32) *ExponentialHistogramTestCase {
+	tc.scale = &scale
+	return tc
+}
+
+// Expects the scale to be at most the MaxScale of the aggregation configured by the recipe
+func (tc *ExponentialHistogramTestCase) WithMaxScale(scale int32) *ExponentialHistogramTestCase {
+	tc.maxScale = &scale
+	return tc
+}
+
+// Sets the number of values in the zero bucket
+func (tc *ExponentialHistogramTestCase) WithZeroCount(count uint64) *ExponentialHistogramTestCase {
+	tc.zeroCount = &count
+	return tc
+}
+
+// Sets the buckets of the positive values
+func (tc *ExponentialHistogramTestCase) WithPositiveBuckets(offset int32, counts ...uint64) *ExponentialHistogramTestCase {
+	tc.positive = &ExponentialBuckets{Offset: offset, Counts: counts}
+	return tc
+}
+
+// Sets the buckets of the negative values, the bucket of counts[i] holding the values in
+// [-base^(offset+i+1), -base^(offset+i))
+func (tc *ExponentialHistogramTestCase) WithNegativeBuckets(offset int32, counts ...uint64) *ExponentialHistogramTestCase {
+	tc.negative = &ExponentialBuckets{Offset: offset, Counts: counts}
+	return tc
+}
+
+type LogTestCase struct {
+	serviceName        string
+	severity           string
+	severityNumber     string
+	scopeName          string
+	body               *otlpcommon.AnyValue
+	attributes         []*otlpcommon.KeyValue
+	resourceAttributes []*otlpcommon.KeyValue
+	withTrace          bool
+	span               *TraceTestCase
 }
 
 func NewLogTestCase(serviceName, severity, body string, withTrace bool, attributes ...*otlpcommon.KeyValue) *LogTestCase {
+	return &LogTestCase{
+		serviceName: serviceName,
+		severity:    severity,
+		body:        &otlpcommon.AnyValue{Value: &otlpcommon.AnyValue_StringValue{StringValue: body}},
+		withTrace:   withTrace,
+		attributes:  attributes,
+	}
+}
+
+// Creates a test case for a log record with a structured body, e.g. of a structured logging bridge.
+// The fields of a map body are matched as a subset, recursively, so only the relevant ones are given:
+//
+//	tu.MapValue(tu.StringAttribute("msg", "order placed"), tu.MapAttribute("order", tu.IntAttribute("id", 42)))
+//
+// Arrays must have the same elements, in order, and the values can be patterns, see RegexAttribute
+func NewStructuredLogTestCase(serviceName, severity string, body *otlpcommon.AnyValue, withTrace bool, attributes ...*otlpcommon.KeyValue) *LogTestCase {
 	return &LogTestCase{
 		serviceName: serviceName,
 		severity:    severity,
@@ -57,3 +398,30 @@ func NewLogTestCase(serviceName, severity, body string, withTrace bool, attribut
 		attributes:  attributes,
 	}
 }
+
+// Sets the span the log record is expected to be emitted in, i.e. the log must carry
+// the trace id and span id of the span found for the trace test case
+func (tc *LogTestCase) WithSpan(span *TraceTestCase) *LogTestCase {
+	tc.span = span
+	return tc
+}
+
+// Expects the severity number of the log record to be within the range of the native level, e.g. WARN-WARN4
+// for the Warn level of logrus, or to be the severity number given by its short name, e.g. WARN2
+func (tc *LogTestCase) WithSeverityNumber(level string) *LogTestCase {
+	tc.severityNumber = level
+	return tc
+}
+
+// Sets the name of the instrumentation scope expected to have produced the log record, e.g. the logger name
+// or the one of the log bridge. The name can be a pattern as for the span names
+func (tc *LogTestCase) WithScope(name string) *LogTestCase {
+	tc.scopeName = name
+	return tc
+}
+
+// Sets the resource attributes the log record is expected to be exported with
+func (tc *LogTestCase) WithResourceAttributes(attributes ...*otlpcommon.KeyValue) *LogTestCase {
+	tc.resourceAttributes = attributes
+	return tc
+}
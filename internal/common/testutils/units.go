@@ -0,0 +1,121 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"fmt"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// Units commonly set instead of their UCUM code, which the semantic conventions and the Prometheus exporter
+// expect, see https://opentelemetry.io/docs/specs/semconv/general/metrics/#instrument-units
+var unitMistakes = map[string]string{
+	"nanoseconds":  "ns",
+	"microseconds": "us",
+	"milliseconds": "ms",
+	"millis":       "ms",
+	"seconds":      "s",
+	"second":       "s",
+	"sec":          "s",
+	"minutes":      "min",
+	"hours":        "h",
+	"bytes":        "By",
+	"byte":         "By",
+	"b":            "By",
+	"kb":           "kBy",
+	"kilobytes":    "kBy",
+	"mb":           "MBy",
+	"megabytes":    "MBy",
+	"percent":      "%",
+	"count":        "1",
+	"requests":     "{request}",
+}
+
+// The units of the Prometheus metric name suffixes added by the collector's Prometheus exporter
+var prometheusUnitSuffixes = map[string]string{
+	"nanoseconds":  "ns",
+	"microseconds": "us",
+	"milliseconds": "ms",
+	"seconds":      "s",
+	"minutes":      "min",
+	"hours":        "h",
+	"bytes":        "By",
+	"kilobytes":    "kBy",
+	"megabytes":    "MBy",
+	"ratio":        "1",
+	"percent":      "%",
+}
+
+// Asserts the unit and the description of the metric. A unit that is not a UCUM code, e.g. milliseconds
+// instead of ms, fails with the code to use
+func AssertMetricMetadata(t TestingT, m *otlpmetrics.Metric, unit, description string) {
+	t.Helper()
+	if m.GetUnit() != unit {
+		t.Errorf("Metric %s has the unit %q, expected %q%s", m.GetName(), m.GetUnit(), unit, unitHint(m.GetUnit()))
+	}
+	if m.GetDescription() != description {
+		t.Errorf("Metric %s has the description %q, expected %q", m.GetName(), m.GetDescription(), description)
+	}
+}
+
+// Asserts all the metrics of the export have UCUM units, e.g. for recipes demonstrating the instruments
+func AssertMetricUnits(t TestingT, rm *otlpmetrics.ResourceMetrics) {
+	t.Helper()
+	for _, sm := range rm.GetScopeMetrics() {
+		for _, m := range sm.GetMetrics() {
+			if v := unitViolation(m.GetUnit()); v != "" {
+				t.Errorf("Metric %s has the unit %q, %s", m.GetName(), m.GetUnit(), v)
+			}
+		}
+	}
+}
+
+// Describes why the unit is not a UCUM code, or returns an empty string
+func unitViolation(unit string) string {
+	if code, found := unitMistakes[strings.ToLower(unit)]; found && code != unit {
+		return fmt.Sprintf("use the UCUM code %q instead", code)
+	}
+	if strings.ContainsAny(unit, " \t") {
+		return "units don't contain spaces, annotations are written in braces, e.g. {request}"
+	}
+	return ""
+}
+
+func unitHint(unit string) string {
+	if v := unitViolation(unit); v != "" {
+		return ". The unit is not UCUM, " + v
+	}
+	return ""
+}
+
+// The unit of the Prometheus metric: the one of the OpenMetrics UNIT metadata when set, otherwise the one of
+// the suffix of its name, e.g. ms for http_server_duration_milliseconds. Empty if the name has no unit suffix
+func PrometheusUnit(mf *dto.MetricFamily) string {
+	if mf.GetUnit() != "" {
+		return mf.GetUnit()
+	}
+	name := mf.GetName()
+	for _, suffix := range []string{"_total", "_bucket", "_count", "_sum"} {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	if i := strings.LastIndex(name, "_"); i >= 0 {
+		return prometheusUnitSuffixes[name[i+1:]]
+	}
+	return ""
+}
+
+// Asserts the Prometheus metric has the unit, from its metadata or the suffix of its name, and the description
+func AssertPrometheusMetadata(t TestingT, families map[string]*dto.MetricFamily, name, unit, description string) {
+	t.Helper()
+	mf, found := families[name]
+	if !found {
+		t.Fatalf("Could not find Prometheus metric with name: %s", name)
+	}
+	if actual := PrometheusUnit(mf); actual != unit {
+		t.Errorf("Prometheus metric %s has the unit %q, expected %q", name, actual, unit)
+	}
+	if mf.GetHelp() != description {
+		t.Errorf("Prometheus metric %s has the description %q, expected %q", name, mf.GetHelp(), description)
+	}
+}
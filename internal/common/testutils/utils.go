@@ -1,27 +1,127 @@
 package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
 
 import (
+	"fmt"
 	"io"
 	"net/http"
-	"testing"
+	"net/url"
+	"strings"
 )
 
-func InvokeSampleApi(t *testing.T, url string) string {
-	t.Logf("Going to call the sample API: %s", url)
-	r, err := http.Get(url)
+func InvokeSampleApi(t TestingT, url string) string {
+	waitForSampleApi(t, url)
+	Logger(t).Info("Going to call the sample API", "url", url)
+	ctx, cancel := testContext(t)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("Invalid request to the sample API: %v", err)
+	}
+	_, body, err := doHttp(req)
 	if err != nil {
 		t.Fatalf("Failed calling the sample API: %v", err)
 	}
 
-	t.Log("Received 200 response from the sample API")
+	Logger(t).Info("Received 200 response from the sample API", "url", url)
+
+	return string(body)
+}
+
+// A request sent to the sample API to trigger the telemetry generation
+type SampleRequest struct {
+	method         string
+	path           string
+	headers        http.Header
+	query          url.Values
+	body           string
+	expectedStatus int
+	// Set by the builders given invalid arguments, reported once the request is sent
+	err error
+}
+
+// Creates a request for the given method and path of the sample API, e.g. NewSampleRequest(http.MethodPost, "/orders")
+func NewSampleRequest(method, path string) *SampleRequest {
+	return &SampleRequest{
+		method:  method,
+		path:    path,
+		headers: http.Header{},
+		query:   url.Values{},
+	}
+}
+
+func (r *SampleRequest) WithHeader(key, value string) *SampleRequest {
+	r.headers.Add(key, value)
+	return r
+}
+
+func (r *SampleRequest) WithQuery(key, value string) *SampleRequest {
+	r.query.Add(key, value)
+	return r
+}
+
+// Sets the request body, sent with the given content type
+func (r *SampleRequest) WithBody(contentType, body string) *SampleRequest {
+	r.headers.Set("Content-Type", contentType)
+	r.body = body
+	return r
+}
+
+func (r *SampleRequest) WithJsonBody(body string) *SampleRequest {
+	return r.WithBody("application/json", body)
+}
 
-	defer r.Body.Close()
+// Sets the status code the sample API is expected to answer with. By default any 2xx status is accepted
+func (r *SampleRequest) WithExpectedStatus(status int) *SampleRequest {
+	r.expectedStatus = status
+	return r
+}
 
-	//We Read the response body on the line below.
-	body, err := io.ReadAll(io.Reader(r.Body))
+// Sends the request to the sample API and returns the response body.
+// Fails the test if the response has an unexpected status code
+func InvokeSampleRequest(t TestingT, r *SampleRequest) string {
+	u := sampleApiUrl(getConfig(t), r.path)
+	waitForSampleApi(t, u)
+	Logger(t).Info("Going to call the sample API", "method", r.method, "url", u)
+	body, err := TryInvokeSampleRequest(t, r)
 	if err != nil {
-		t.Fatalf("Failed reading response body from the sample API: %v", err)
+		t.Fatal(err)
+	}
+	Logger(t).Info("Received the response from the sample API", "method", r.method, "url", u)
+	return body
+}
+
+// Same as InvokeSampleRequest, but returns the errors instead of failing the test and doesn't wait for
+// the sample to be ready, so it can be called from other goroutines, e.g. to send concurrent requests
+func TryInvokeSampleRequest(t TestingT, r *SampleRequest) (string, error) {
+	if r.err != nil {
+		return "", fmt.Errorf("invalid request to the sample API: %w", r.err)
+	}
+	u := sampleApiUrl(getConfig(t), r.path)
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
 	}
 
-	return string(body)
+	var body io.Reader
+	if r.body != "" {
+		body = strings.NewReader(r.body)
+	}
+	ctx, cancel := testContext(t)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, r.method, u, body)
+	if err != nil {
+		return "", fmt.Errorf("invalid request to the sample API: %w", err)
+	}
+	for k, v := range r.headers {
+		req.Header[k] = v
+	}
+
+	res, resBody, err := doHttp(req)
+	if err != nil {
+		return "", fmt.Errorf("failed calling the sample API: %w", err)
+	}
+	if r.expectedStatus != 0 && res.StatusCode != r.expectedStatus ||
+		r.expectedStatus == 0 && (res.StatusCode < 200 || res.StatusCode > 299) {
+		return "", fmt.Errorf("sample API answered %s %s with status %d: %s", r.method, u, res.StatusCode, resBody)
+	}
+	return string(resBody), nil
 }
@@ -0,0 +1,147 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import otlpmetrics "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+// The aggregations a View can configure, as exported
+type MetricAggregation int
+
+const (
+	AggregationSum MetricAggregation = iota
+	AggregationLastValue
+	AggregationExplicitBucketHistogram
+	AggregationExponentialHistogram
+)
+
+func (a MetricAggregation) String() string {
+	switch a {
+	case AggregationSum:
+		return "sum"
+	case AggregationLastValue:
+		return "last value"
+	case AggregationExplicitBucketHistogram:
+		return "explicit bucket histogram"
+	default:
+		return "exponential histogram"
+	}
+}
+
+// The aggregation the metric was exported with
+func metricAggregation(m *otlpmetrics.Metric) (MetricAggregation, bool) {
+	switch m.GetData().(type) {
+	case *otlpmetrics.Metric_Sum:
+		return AggregationSum, true
+	case *otlpmetrics.Metric_Gauge:
+		return AggregationLastValue, true
+	case *otlpmetrics.Metric_Histogram:
+		return AggregationExplicitBucketHistogram, true
+	case *otlpmetrics.Metric_ExponentialHistogram:
+		return AggregationExponentialHistogram, true
+	}
+	return 0, false
+}
+
+// The effects of the Views registered by a recipe on the exported metrics
+type ViewTestCase struct {
+	serviceName  string
+	renamed      [][2]string
+	dropped      []string
+	aggregations map[string]MetricAggregation
+}
+
+func NewViewTestCase(serviceName string) *ViewTestCase {
+	return &ViewTestCase{serviceName: serviceName, aggregations: make(map[string]MetricAggregation)}
+}
+
+// Expects the metric of the instrument to be exported as to, and no metric named from
+func (tc *ViewTestCase) WithRenamed(from, to string) *ViewTestCase {
+	tc.renamed = append(tc.renamed, [2]string{from, to})
+	return tc
+}
+
+// Expects no metric of the instruments, e.g. dropped by a View with the drop aggregation
+func (tc *ViewTestCase) WithDropped(names ...string) *ViewTestCase {
+	tc.dropped = append(tc.dropped, names...)
+	return tc
+}
+
+// Expects the metric to be exported with the aggregation, e.g. a histogram instrument aggregated as an
+// exponential histogram
+func (tc *ViewTestCase) WithAggregation(name string, aggregation MetricAggregation) *ViewTestCase {
+	tc.aggregations[name] = aggregation
+	return tc
+}
+
+// Asserts the exported metrics of the service reflect the Views: the renamed metrics and the ones with an
+// aggregation are fetched until found, then the metrics renamed or dropped must be absent. Returns the
+// metrics the assertions were made on
+func AssertViews(t TestingT, tc *ViewTestCase) []*otlpmetrics.Metric {
+	expected := make([]string, 0, len(tc.renamed)+len(tc.aggregations))
+	for _, r := range tc.renamed {
+		expected = append(expected, r[1])
+	}
+	for name := range tc.aggregations {
+		expected = append(expected, name)
+	}
+
+	var metrics []*otlpmetrics.Metric
+	var missing string
+	found := Eventually(t, "Metrics of the views", func() bool {
+		metrics = nil
+		for _, sm := range GetMetric(t, tc.serviceName).GetScopeMetrics() {
+			metrics = append(metrics, sm.GetMetrics()...)
+		}
+		missing = ""
+		for _, name := range expected {
+			if findMetricByName(metrics, name) == nil {
+				missing = name
+				return false
+			}
+		}
+		return len(metrics) > 0
+	})
+	if !found {
+		if missing != "" {
+			t.Fatalf("Could not find metric %s of service %s, is the View registered?", missing, tc.serviceName)
+		}
+		t.Fatalf("Could not find metrics of service %s", tc.serviceName)
+	}
+
+	for _, r := range tc.renamed {
+		if findMetricByName(metrics, r[0]) != nil {
+			t.Errorf("Metric %s is still exported, expected to be renamed to %s", r[0], r[1])
+		}
+	}
+	for _, name := range tc.dropped {
+		if findMetricByName(metrics, name) != nil {
+			t.Errorf("Metric %s is exported, expected to be dropped", name)
+		}
+	}
+	for name, exp := range tc.aggregations {
+		m := findMetricByName(metrics, name)
+		actual, ok := metricAggregation(m)
+		switch {
+		case !ok:
+			t.Errorf("Metric %s is exported as a %T, expected a %s", name, m.GetData(), exp)
+		case actual != exp:
+			t.Errorf("Metric %s is exported as a %s, expected a %s", name, actual, exp)
+		}
+	}
+	return metrics
+}
+
+// Asserts no metric has the name, e.g. of an instrument dropped by a View
+func AssertNoMetric(t TestingT, metrics []*otlpmetrics.Metric, name string) {
+	t.Helper()
+	if findMetricByName(metrics, name) != nil {
+		t.Errorf("Metric %s was expected to be absent", name)
+	}
+}
+
+func findMetricByName(metrics []*otlpmetrics.Metric, name string) *otlpmetrics.Metric {
+	for _, m := range metrics {
+		if m.GetName() == name {
+			return m
+		}
+	}
+	return nil
+}
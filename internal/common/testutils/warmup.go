@@ -0,0 +1,60 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"net/http"
+	"time"
+)
+
+// How a sample is warmed up before its telemetry is asserted, e.g. the Java and .NET samples whose first spans
+// arrive late while the JIT compiles the handlers and the SDK starts its exporter. The steps run in order:
+// the requests, the wait for the first span, then the delay
+type WarmUpOptions struct {
+	// Throwaway requests sent to the sample API. Their failures are only logged
+	Requests int
+	// The request sent. Defaults to GET /
+	Request *SampleRequest
+	// Waits until a span of the service is found in the back-end, i.e. the SDK exported at least once
+	FirstSpan bool
+	// Waited at the end of the warm-up
+	Delay time.Duration
+}
+
+// Warms up the sample of the service before the assertions. The telemetry of the warm-up stays in the back-ends,
+// which doesn't matter to the assertions finding spans, but is counted by the ones summing the metrics:
+//
+//	tu.WarmUp(t, "java.springboot.traces", tu.WarmUpOptions{Requests: 5, Request: tu.NewSampleRequest("GET", "/hello")})
+func WarmUp(t TestingT, serviceName string, opts WarmUpOptions) {
+	t.Helper()
+	if opts.Requests > 0 {
+		r := opts.Request
+		if r == nil {
+			r = NewSampleRequest(http.MethodGet, "/")
+		}
+		waitForSampleApi(t, sampleApiUrl(getConfig(t), r.path))
+		Logger(t).Info("Warming up the sample", "requests", opts.Requests, "method", r.method, "path", r.path)
+		for i := 0; i < opts.Requests; i++ {
+			if _, err := TryInvokeSampleRequest(t, r); err != nil {
+				Logger(t).Warn("Warm-up request failed", "attempt", i+1, "error", err)
+			}
+		}
+	}
+
+	if opts.FirstSpan {
+		found := Eventually(t, "First span of "+serviceName, func() bool {
+			rs, err := queryTraces(t, serviceName, TraceQueryOptions{})
+			if err != nil {
+				checkBackendError(t, "traces", err)
+				return false
+			}
+			return len(rs.GetScopeSpans()) > 0
+		})
+		if !found {
+			t.Fatalf("No span of %s was exported during the warm-up. Is the sample exporting to the collector?", serviceName)
+		}
+	}
+
+	if opts.Delay > 0 {
+		Logger(t).Info("Waiting for the sample to warm up", "delay", opts.Delay)
+		time.Sleep(opts.Delay)
+	}
+}
@@ -0,0 +1,231 @@
+package testutils // import "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	otlpcommon "go.opentelemetry.io/proto/otlp/common/v1"
+	otlpresource "go.opentelemetry.io/proto/otlp/resource/v1"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Max number of traces returned by the Zipkin query
+const zipkinQueryLimit int = 20
+
+func init() {
+	RegisterTraceBackend("zipkin", func(c *Config) TraceBackend { return NewZipkinBackend(c.ZipkinUrl) })
+}
+
+// TraceBackend for Zipkin. Traces are queried via /api/v2/traces and the
+// Zipkin v2 spans are mapped into OTLP spans, so assertions work the same.
+type ZipkinBackend struct {
+	uri string
+}
+
+func NewZipkinBackend(uri string) *ZipkinBackend {
+	return &ZipkinBackend{uri: uri}
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinAnnotation struct {
+	Timestamp uint64 `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// See https://zipkin.io/zipkin-api/#/default/get_traces
+type zipkinSpan struct {
+	TraceID       string             `json:"traceId"`
+	ID            string             `json:"id"`
+	ParentID      string             `json:"parentId"`
+	Name          string             `json:"name"`
+	Kind          string             `json:"kind"`
+	Timestamp     uint64             `json:"timestamp"`
+	Duration      uint64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint     `json:"localEndpoint"`
+	Annotations   []zipkinAnnotation `json:"annotations"`
+	Tags          map[string]string  `json:"tags"`
+}
+
+func (b *ZipkinBackend) GetTraces(serviceName string, opts TraceQueryOptions) (*otlptrace.ResourceSpans, error) {
+	q := url.Values{}
+	q.Set("serviceName", serviceName)
+	start, end := opts.window(time.Now())
+	q.Set("limit", fmt.Sprint(opts.limit(zipkinQueryLimit)))
+	q.Set("endTs", fmt.Sprint(end.UnixMilli()))
+	q.Set("lookback", fmt.Sprint(end.Sub(start).Milliseconds()))
+	if opts.SpanName != "" {
+		q.Set("spanName", opts.SpanName)
+	}
+
+	uri := fmt.Sprintf("%s/api/v2/traces?%s", b.uri, q.Encode())
+	body, err := httpGet(uri, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed calling Zipkin: %w", err)
+	}
+
+	var traces [][]zipkinSpan
+	if err := json.Unmarshal(body, &traces); err != nil {
+		return nil, fmt.Errorf("error reading payload from Zipkin: %w", err)
+	}
+
+	var spans []zipkinSpan
+	for _, tr := range traces {
+		for _, s := range tr {
+			// Zipkin lowercases the service names
+			if strings.EqualFold(s.LocalEndpoint.ServiceName, serviceName) {
+				spans = append(spans, s)
+			}
+		}
+	}
+	return toOtlpResourceSpans(serviceName, opts, spans)
+}
+
+func toOtlpResourceSpans(serviceName string, opts TraceQueryOptions, spans []zipkinSpan) (*otlptrace.ResourceSpans, error) {
+	if len(spans) == 0 {
+		return nil, nil
+	}
+
+	// spans are grouped by their instrumentation scope
+	scopes := make(map[string]*otlptrace.ScopeSpans)
+	for _, zs := range spans {
+		s, err := toOtlpSpan(zs)
+		if err != nil {
+			return nil, err
+		}
+
+		// Zipkin also lowercases the span names, restore the ones that were queried
+		if opts.SpanName != "" && s.Name == strings.ToLower(opts.SpanName) {
+			s.Name = opts.SpanName
+		}
+
+		scopeName := zs.Tags["otel.scope.name"]
+		if scopeName == "" {
+			scopeName = zs.Tags["otel.library.name"]
+		}
+		ss, found := scopes[scopeName]
+		if !found {
+			ss = &otlptrace.ScopeSpans{Scope: &otlpcommon.InstrumentationScope{Name: scopeName}}
+			scopes[scopeName] = ss
+		}
+		ss.Spans = append(ss.Spans, s)
+	}
+
+	rs := &otlptrace.ResourceSpans{
+		Resource: &otlpresource.Resource{Attributes: []*otlpcommon.KeyValue{StringAttribute("service.name", serviceName)}},
+	}
+	names := make([]string, 0, len(scopes))
+	for n := range scopes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		rs.ScopeSpans = append(rs.ScopeSpans, scopes[n])
+	}
+	return rs, nil
+}
+
+// Tags added by the OTel -> Zipkin translation that are mapped back into span fields
+var zipkinReservedTags = map[string]bool{
+	"otel.scope.name":         true,
+	"otel.scope.version":      true,
+	"otel.library.name":       true,
+	"otel.library.version":    true,
+	"otel.status_code":        true,
+	"otel.status_description": true,
+	"error":                   true,
+}
+
+func toOtlpSpan(zs zipkinSpan) (*otlptrace.Span, error) {
+	traceID, err := decodeZipkinID(zs.TraceID, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Zipkin trace id %s: %w", zs.TraceID, err)
+	}
+	spanID, err := decodeZipkinID(zs.ID, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Zipkin span id %s: %w", zs.ID, err)
+	}
+
+	s := &otlptrace.Span{
+		TraceId:           traceID,
+		SpanId:            spanID,
+		Name:              zs.Name,
+		Kind:              toOtlpSpanKind(zs.Kind),
+		StartTimeUnixNano: zs.Timestamp * 1000,
+		EndTimeUnixNano:   (zs.Timestamp + zs.Duration) * 1000,
+		Status:            toOtlpStatus(zs.Tags),
+	}
+
+	if zs.ParentID != "" {
+		if s.ParentSpanId, err = decodeZipkinID(zs.ParentID, 8); err != nil {
+			return nil, fmt.Errorf("invalid Zipkin parent span id %s: %w", zs.ParentID, err)
+		}
+	}
+
+	keys := make([]string, 0, len(zs.Tags))
+	for k := range zs.Tags {
+		if !zipkinReservedTags[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s.Attributes = append(s.Attributes, StringAttribute(k, zs.Tags[k]))
+	}
+
+	for _, a := range zs.Annotations {
+		s.Events = append(s.Events, &otlptrace.Span_Event{Name: a.Value, TimeUnixNano: a.Timestamp * 1000})
+	}
+	return s, nil
+}
+
+// Zipkin ids are hex encoded and trace ids may be either 64 or 128-bit
+func decodeZipkinID(id string, size int) ([]byte, error) {
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > size {
+		return nil, fmt.Errorf("id is longer than %d bytes", size)
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded, nil
+}
+
+func toOtlpSpanKind(kind string) otlptrace.Span_SpanKind {
+	switch kind {
+	case "SERVER":
+		return otlptrace.Span_SPAN_KIND_SERVER
+	case "CLIENT":
+		return otlptrace.Span_SPAN_KIND_CLIENT
+	case "PRODUCER":
+		return otlptrace.Span_SPAN_KIND_PRODUCER
+	case "CONSUMER":
+		return otlptrace.Span_SPAN_KIND_CONSUMER
+	default:
+		return otlptrace.Span_SPAN_KIND_INTERNAL
+	}
+}
+
+func toOtlpStatus(tags map[string]string) *otlptrace.Status {
+	switch {
+	case tags["otel.status_code"] == "ERROR", tags["error"] != "" && tags["otel.status_code"] == "":
+		msg := tags["otel.status_description"]
+		if msg == "" {
+			msg = tags["error"]
+		}
+		return &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_ERROR, Message: msg}
+	case tags["otel.status_code"] == "OK":
+		return &otlptrace.Status{Code: otlptrace.Status_STATUS_CODE_OK}
+	default:
+		return &otlptrace.Status{}
+	}
+}
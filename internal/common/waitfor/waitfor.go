@@ -0,0 +1,102 @@
+// Package waitfor implements readiness probes for the sample apps and the back-ends,
+// used before the assertions begin. All the probes poll until they succeed or the context is done.
+package waitfor // import "github.com/joaopgrassi/otel-recipes/internal/common/waitfor"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/dockerlogs"
+	"github.com/joaopgrassi/otel-recipes/internal/common/retry"
+)
+
+// Starts polling fast, as most services are up within a few seconds
+var pollPolicy = retry.Policy{
+	InitialInterval: 250 * time.Millisecond,
+	MaxInterval:     2 * time.Second,
+	Multiplier:      1.5,
+}
+
+// Bounds each probe, so a service accepting connections without answering is probed again
+const probeTimeout time.Duration = 5 * time.Second
+
+// Waits until the url answers with a status lower than 500. Connecting alone is not enough, as
+// docker accepts the connections of published ports before the process in the container listens
+func WaitForHTTP(ctx context.Context, url string) error {
+	return poll(ctx, url, func() error {
+		ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		r.Body.Close()
+		if r.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("status code %d", r.StatusCode)
+		}
+		return nil
+	})
+}
+
+// Waits until a TCP connection to the address, e.g. localhost:4317, can be opened
+func WaitForPort(ctx context.Context, addr string) error {
+	return poll(ctx, addr, func() error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// Waits until a line of the logs matches the pattern, e.g. "Started Application in". The logs
+// are fetched on each attempt, e.g. from the compose stack:
+//
+//	waitfor.WaitForLogLine(ctx, func(ctx context.Context) (string, error) { return stack.Logs(ctx, "app") }, "Now listening on")
+func WaitForLogLine(ctx context.Context, logs func(ctx context.Context) (string, error), pattern string) error {
+	re, err := regexp.Compile("(?m)" + pattern)
+	if err != nil {
+		return err
+	}
+	return poll(ctx, "log line "+pattern, func() error {
+		out, err := logs(ctx)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(out) {
+			return errors.New("no matching log line yet")
+		}
+		return nil
+	})
+}
+
+// Same as WaitForLogLine for the logs of a docker container, by its name or id, e.g. a sample container
+// of a compose file:
+//
+//	waitfor.WaitForContainerLogLine(ctx, "otel-recipes-app-1", "Now listening on")
+func WaitForContainerLogLine(ctx context.Context, container, pattern string) error {
+	return WaitForLogLine(ctx, func(ctx context.Context) (string, error) { return dockerlogs.Logs(ctx, container) }, pattern)
+}
+
+// Runs the probe until it succeeds, returning the last probe error if the context is done first
+func poll(ctx context.Context, what string, probe func() error) error {
+	var last error
+	err := retry.Do(ctx, pollPolicy, func() (bool, error) {
+		last = probe()
+		return last == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s not ready: %w (last error: %v)", what, err, last)
+	}
+	return nil
+}
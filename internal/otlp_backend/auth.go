@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The credentials the OTLP ingest endpoints require, set via the environment, e.g. to test the
+// recipes configuring the authentication of their exporters. No credentials accept all requests
+type authConfig struct {
+	// One of: bearer, basic, or empty
+	Scheme   string
+	token    string
+	username string
+	password string
+}
+
+// The outcome of the authentication of the ingest requests, returned by /getauth
+type authStats struct {
+	Scheme   string `json:"scheme"`
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	// Why the last rejected request was rejected, e.g. missing Authorization header
+	LastRejection string `json:"lastRejection,omitempty"`
+}
+
+var auth authConfig
+var stats authStats
+var statsMu sync.Mutex
+
+func loadAuthConfig() authConfig {
+	if token := os.Getenv("AUTH_BEARER_TOKEN"); token != "" {
+		return authConfig{Scheme: "bearer", token: token}
+	}
+	if user := os.Getenv("AUTH_BASIC_USERNAME"); user != "" {
+		return authConfig{Scheme: "basic", username: user, password: os.Getenv("AUTH_BASIC_PASSWORD")}
+	}
+	return authConfig{}
+}
+
+// Returns why the Authorization header doesn't carry the configured credentials, or empty if it does
+func (a authConfig) check(header string) string {
+	if header == "" {
+		return "missing Authorization header"
+	}
+	scheme, credentials, _ := strings.Cut(header, " ")
+	switch a.Scheme {
+	case "bearer":
+		if !strings.EqualFold(scheme, "Bearer") {
+			return "expected a Bearer token, got the " + scheme + " scheme"
+		}
+		if subtle.ConstantTimeCompare([]byte(credentials), []byte(a.token)) != 1 {
+			return "invalid bearer token"
+		}
+	case "basic":
+		if !strings.EqualFold(scheme, "Basic") {
+			return "expected Basic credentials, got the " + scheme + " scheme"
+		}
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return "invalid Basic credentials encoding"
+		}
+		user, password, _ := strings.Cut(string(decoded), ":")
+		if user != a.username || subtle.ConstantTimeCompare([]byte(password), []byte(a.password)) != 1 {
+			return "invalid username or password"
+		}
+	}
+	return ""
+}
+
+// Rejects the ingest requests without the configured credentials with a 401
+func requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auth.Scheme == "" {
+			next(w, r)
+			return
+		}
+		reason := auth.check(r.Header.Get("Authorization"))
+
+		statsMu.Lock()
+		if reason == "" {
+			stats.Accepted++
+		} else {
+			stats.Rejected++
+			stats.LastRejection = reason
+		}
+		statsMu.Unlock()
+
+		if reason != "" {
+			w.Header().Set("WWW-Authenticate", auth.Scheme)
+			http.Error(w, reason, http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Gets how many ingest requests were accepted and rejected by the authentication
+func getAuthStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	s := stats
+	s.Scheme = auth.Scheme
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
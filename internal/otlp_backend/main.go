@@ -4,6 +4,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"sync"
 
 	"github.com/golang/protobuf/proto"
 	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
@@ -15,6 +16,7 @@ import (
 )
 
 var resourceSpans map[string]*otlptrace.ResourceSpans
+var resourceSpansMu sync.Mutex
 var resourceMetrics map[string]*otlpmetrics.ResourceMetrics
 var resourceLogs map[string]*otlplogs.ResourceLogs
 
@@ -49,13 +51,26 @@ func postTrace(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if sn != "" {
-			resourceSpans[sn] = rs
+			storeResourceSpans(sn, rs)
 		} else {
 			slog.Warn("Could not find service name attribute in OTLP resource spans")
 		}
 	}
 }
 
+// Spans of a trace can be exported in different batches, e.g. when auto-instrumentation
+// libraries end their spans at different times, so they are accumulated per service
+func storeResourceSpans(serviceName string, rs *otlptrace.ResourceSpans) {
+	resourceSpansMu.Lock()
+	defer resourceSpansMu.Unlock()
+
+	if existing, found := resourceSpans[serviceName]; found {
+		existing.ScopeSpans = append(existing.ScopeSpans, rs.GetScopeSpans()...)
+		return
+	}
+	resourceSpans[serviceName] = rs
+}
+
 // OTLP HTTP receiver that stores all ResourceMetrics in-memory
 // used by the tests to assert the metrics produced by the sample apps
 func postMetrics(w http.ResponseWriter, r *http.Request) {
@@ -156,9 +171,11 @@ func getOtlpData(w http.ResponseWriter, r *http.Request) {
 	var res []byte
 	switch signal {
 	case "trace":
+		resourceSpansMu.Lock()
 		if rs, found := resourceSpans[serviceName]; found {
 			res = makeOtlpTraceResponse(rs)
 		}
+		resourceSpansMu.Unlock()
 	case "metrics":
 		if rm, found := resourceMetrics[serviceName]; found {
 			res = makeOtlpMetricResponse(rm)
@@ -183,7 +200,7 @@ func makeOtlpTraceResponse(rs *otlptrace.ResourceSpans) []byte {
 	}
 	data, err := proto.Marshal(rs)
 	if err != nil {
-		slog.Error("marshaling error: ", err)
+		slog.Error("marshaling error", "error", err)
 		return nil
 	}
 	return data
@@ -196,7 +213,7 @@ func makeOtlpMetricResponse(rm *otlpmetrics.ResourceMetrics) []byte {
 	}
 	data, err := proto.Marshal(rm)
 	if err != nil {
-		slog.Error("marshaling error: ", err)
+		slog.Error("marshaling error", "error", err)
 		return nil
 	}
 	return data
@@ -209,7 +226,7 @@ func makeOtlpLogResponse(rl *otlplogs.ResourceLogs) []byte {
 	}
 	data, err := proto.Marshal(rl)
 	if err != nil {
-		slog.Error("marshaling error: ", err)
+		slog.Error("marshaling error", "error", err)
 		return nil
 	}
 	return data
@@ -220,9 +237,13 @@ func main() {
 	resourceMetrics = make(map[string]*otlpmetrics.ResourceMetrics)
 	resourceLogs = make(map[string]*otlplogs.ResourceLogs)
 
-	http.HandleFunc("/v1/traces", postTrace)
-	http.HandleFunc("/v1/metrics", postMetrics)
-	http.HandleFunc("/v1/logs", postLogs)
+	auth = loadAuthConfig()
+	http.HandleFunc("/v1/traces", requireAuth(postTrace))
+	http.HandleFunc("/v1/metrics", requireAuth(postMetrics))
+	http.HandleFunc("/v1/logs", requireAuth(postLogs))
+
+	// GET endpoint called by the tests to assert the exporters sent the credentials required via the environment
+	http.HandleFunc("/getauth", getAuthStats)
 
 	// GET endpoint called by the tests to assert the exported OTLP metrics filtered by signal and service.name
 	http.HandleFunc("/getotlp", getOtlpData)
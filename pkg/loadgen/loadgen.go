@@ -0,0 +1,136 @@
+// Package loadgen fires concurrent requests at the sample API and reconciles them with the server spans
+// found in the back-end, catching samples that drop spans under load, e.g. with a too small batch queue,
+// or export them more than once:
+//
+//	loadgen.New("go.gin-api.traces", "/hello").
+//		WithRequests(200).WithConcurrency(20).
+//		Assert(t)
+//
+// Each request carries a new trace context, so its server span is told apart from the spans of other
+// requests, including the ones sent before the load. The sample must continue the propagated traces.
+package loadgen // import "github.com/joaopgrassi/otel-recipes/pkg/loadgen"
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	defaultRequests    int = 100
+	defaultConcurrency int = 10
+)
+
+// A load of requests to an endpoint of the sample API
+type Load struct {
+	serviceName string
+	method      string
+	path        string
+	spanName    string
+	requests    int
+	concurrency int
+	format      string
+}
+
+// Creates a load of GET requests to the path of the sample API, whose server spans are exported by the service
+func New(serviceName, path string) *Load {
+	return &Load{
+		serviceName: serviceName,
+		method:      http.MethodGet,
+		path:        path,
+		spanName:    "*",
+		requests:    defaultRequests,
+		concurrency: defaultConcurrency,
+		format:      "tracecontext",
+	}
+}
+
+// Sets the number of requests, i.e. of server spans expected. Defaults to 100
+func (l *Load) WithRequests(n int) *Load {
+	l.requests = n
+	return l
+}
+
+// Sets the number of requests in flight at once. Defaults to 10
+func (l *Load) WithConcurrency(n int) *Load {
+	l.concurrency = n
+	return l
+}
+
+func (l *Load) WithMethod(method string) *Load {
+	l.method = method
+	return l
+}
+
+// Sets the name of the server span, which can be a pattern, e.g. GET /hello. Defaults to any server span
+func (l *Load) WithSpanName(name string) *Load {
+	l.spanName = name
+	return l
+}
+
+// Sets the format the trace context is propagated with, one of: tracecontext, b3, b3multi, jaeger.
+// Defaults to tracecontext
+func (l *Load) WithPropagation(format string) *Load {
+	l.format = format
+	return l
+}
+
+// Fires the requests and returns the trace context sent with each of them. Fails the test if any
+// request failed, as its span may legitimately be missing
+func (l *Load) Run(t *testing.T) []*tu.SpanContext {
+	t.Helper()
+	if l.requests <= 0 || l.concurrency <= 0 {
+		t.Fatalf("The load of %s needs a positive number of requests and concurrency", l.path)
+	}
+
+	contexts := make([]*tu.SpanContext, l.requests)
+	errs := make([]error, l.requests)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < l.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				c := tu.NewSpanContext()
+				contexts[i] = c
+				_, errs[i] = tu.TryInvokeSampleRequest(t, tu.NewSampleRequest(l.method, l.path).WithSpanContext(l.format, c))
+			}
+		}()
+	}
+
+	// the first request waits for the sample to be ready
+	contexts[0] = tu.NewSpanContext()
+	tu.InvokeSampleRequest(t, tu.NewSampleRequest(l.method, l.path).WithSpanContext(l.format, contexts[0]))
+	for i := 1; i < l.requests; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			if failed == 0 {
+				t.Errorf("Request to %s failed: %v", l.path, err)
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		t.Fatalf("%d of %d requests to %s failed", failed, l.requests, l.path)
+	}
+	tu.Logger(t).Info("Sent the load to the sample API", "path", l.path, "requests", l.requests, "concurrency", l.concurrency)
+	return contexts
+}
+
+// Fires the requests and asserts exactly one server span per request arrives in the back-end
+func (l *Load) Assert(t *testing.T) {
+	t.Helper()
+	contexts := l.Run(t)
+	tc := tu.NewTraceTestCase(l.serviceName, l.spanName).WithKind(otlptrace.Span_SPAN_KIND_SERVER)
+	tu.AssertSpanPerTrace(t, tc, contexts)
+}
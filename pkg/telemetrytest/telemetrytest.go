@@ -0,0 +1,156 @@
+// Package telemetrytest is a fluent API over the assertions of the recipe tests, for recipe authors
+// writing their own Go tests:
+//
+//	telemetrytest.ExpectTrace("go.console.traces").
+//		WithSpan("HelloWorldSpan").WithAttr("foo", "bar").WithKind(telemetrytest.Internal).
+//		Assert(t)
+//
+// The telemetry is fetched from the back-ends configured via the flags of the testutils package.
+package telemetrytest // import "github.com/joaopgrassi/otel-recipes/pkg/telemetrytest"
+
+import (
+	"testing"
+	"time"
+
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	otlptrace "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+type SpanKind = otlptrace.Span_SpanKind
+
+const (
+	Internal SpanKind = otlptrace.Span_SPAN_KIND_INTERNAL
+	Server   SpanKind = otlptrace.Span_SPAN_KIND_SERVER
+	Client   SpanKind = otlptrace.Span_SPAN_KIND_CLIENT
+	Producer SpanKind = otlptrace.Span_SPAN_KIND_PRODUCER
+	Consumer SpanKind = otlptrace.Span_SPAN_KIND_CONSUMER
+)
+
+type StatusCode = otlptrace.Status_StatusCode
+
+const (
+	Unset StatusCode = otlptrace.Status_STATUS_CODE_UNSET
+	Ok    StatusCode = otlptrace.Status_STATUS_CODE_OK
+	Error StatusCode = otlptrace.Status_STATUS_CODE_ERROR
+)
+
+// The spans a service is expected to export
+type TraceExpectation struct {
+	serviceName string
+	spanCount   int
+	spans       []*SpanExpectation
+}
+
+type SpanExpectation struct {
+	trace *TraceExpectation
+	tc    *tu.TraceTestCase
+	// invalid attribute values, reported once the expectation is asserted
+	errs []error
+}
+
+// Starts the expectation of the spans exported by the service
+func ExpectTrace(serviceName string) *TraceExpectation {
+	return &TraceExpectation{serviceName: serviceName}
+}
+
+// Expects the trace to have exactly n spans, which also requires all the spans to be part of the same trace
+func (e *TraceExpectation) WithSpanCount(n int) *TraceExpectation {
+	e.spanCount = n
+	return e
+}
+
+// Adds a span to the expectation, which can be a pattern, e.g. GET /users/*.
+// The span is further described with the methods of the returned SpanExpectation
+func (e *TraceExpectation) WithSpan(name string) *SpanExpectation {
+	s := &SpanExpectation{trace: e, tc: tu.NewTraceTestCase(e.serviceName, name)}
+	e.spans = append(e.spans, s)
+	return s
+}
+
+// Asserts the spans are found. A single span is looked up in all the exported spans, while several
+// spans (or a span count) must be part of the same trace
+func (e *TraceExpectation) Assert(t *testing.T) {
+	t.Helper()
+	if len(e.spans) == 0 {
+		t.Fatalf("The trace expectation of %s has no spans", e.serviceName)
+	}
+
+	tcs := make([]*tu.TraceTestCase, 0, len(e.spans))
+	for _, s := range e.spans {
+		for _, err := range s.errs {
+			t.Errorf("Invalid expectation: %v", err)
+		}
+		tcs = append(tcs, s.tc)
+	}
+	if t.Failed() {
+		t.FailNow()
+	}
+
+	if len(tcs) == 1 && e.spanCount == 0 {
+		tu.AssertSpanWithAttributeExists(t, tcs[0])
+		return
+	}
+	tu.AssertTraceSpans(t, tu.NewTraceSpansTestCase(e.serviceName, e.spanCount, tcs...))
+}
+
+// Expects the span to have the attribute. The value can be string, bool, int, int64, float64 or []string
+func (s *SpanExpectation) WithAttr(key string, value any) *SpanExpectation {
+	kv, err := tu.Attribute(key, value)
+	if err != nil {
+		s.errs = append(s.errs, err)
+		return s
+	}
+	s.tc.WithAttributes(kv)
+	return s
+}
+
+// Expects the span to not have the attributes
+func (s *SpanExpectation) WithoutAttr(keys ...string) *SpanExpectation {
+	s.tc.WithoutAttributes(keys...)
+	return s
+}
+
+func (s *SpanExpectation) WithKind(kind SpanKind) *SpanExpectation {
+	s.tc.WithKind(kind)
+	return s
+}
+
+func (s *SpanExpectation) WithStatus(code StatusCode, description string) *SpanExpectation {
+	s.tc.WithStatus(code, description)
+	return s
+}
+
+// Expects the span to be the direct child of the span with the given name
+func (s *SpanExpectation) WithParent(spanName string) *SpanExpectation {
+	s.tc.WithParent(spanName)
+	return s
+}
+
+// Expects the span to be produced by the instrumentation scope, i.e. the tracer name
+func (s *SpanExpectation) WithScope(name string) *SpanExpectation {
+	s.tc.WithScope(name)
+	return s
+}
+
+// Expects the span to have recorded an event with the given name
+func (s *SpanExpectation) WithEvent(name string) *SpanExpectation {
+	s.tc.WithEvent(name)
+	return s
+}
+
+// Expects the span to last between min and max. A max of 0 means no upper bound
+func (s *SpanExpectation) WithDuration(min, max time.Duration) *SpanExpectation {
+	s.tc.WithDuration(min, max)
+	return s
+}
+
+// Adds another span to the trace expectation
+func (s *SpanExpectation) WithSpan(name string) *SpanExpectation {
+	return s.trace.WithSpan(name)
+}
+
+// Asserts the whole trace expectation the span belongs to
+func (s *SpanExpectation) Assert(t *testing.T) {
+	t.Helper()
+	s.trace.Assert(t)
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func TestLogGeneratedFromSample(t *testing.T) {
-	tu.InvokeSampleApi(t, "http://localhost:8080/helloworld")
+	tu.InvokeSampleApi(t, tu.SampleApiUrl("/helloworld"))
 
 	tc := tu.NewLogTestCase("csharp.aspnetapi.logs", "Information", "This is a info message {foo}", true, tu.StringAttribute("foo", "bar"))
 
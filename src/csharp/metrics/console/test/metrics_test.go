@@ -7,14 +7,5 @@ import (
 )
 
 func TestMetricsGeneratedFromSample(t *testing.T) {
-	rm := tu.GetMetricsWithRetry(t, "csharp.console.metrics")
-	m := rm.GetScopeMetrics()[0].Metrics
-
-	// Counter metric
-	ctc := tu.NewMetricTestCase("myCounter", "I count things", "1", int64(3), tu.StringAttribute("foo", "bar"))
-	tu.AssertCounter(t, ctc, m)
-
-	// Gauge metric
-	ctg := tu.NewMetricTestCase("myGauge", "I gauge things", "1", float64(3.5), tu.StringAttribute("foo", "bar"))
-	tu.AssertGauge(t, ctg, m)
+	tu.AssertSpecFile(t, tu.DefaultSpecFile)
 }
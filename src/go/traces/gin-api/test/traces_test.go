@@ -7,9 +7,24 @@ import (
 )
 
 func TestTraceGeneratedFromSample(t *testing.T) {
-	tu.InvokeSampleApi(t, "http://localhost:8080/helloworld")
+	tu.InvokeSampleApi(t, tu.SampleApiUrl("/helloworld"))
 
-	tc := tu.NewTraceTestCase("go.ginapi.traces", "HelloWorldSpan", tu.StringAttribute("foo", "bar"))
+	// HelloWorldSpan is created inside the span of the Gin auto-instrumentation
+	tc := tu.NewTraceTestCase("go.ginapi.traces", "HelloWorldSpan", tu.StringAttribute("foo", "bar")).
+		WithParent("/helloworld").
+		WithScope("go.ginapi.traces")
 
 	tu.AssertSpanWithAttributeExists(t, tc)
 }
+
+func TestTraceContainsAllSpans(t *testing.T) {
+	tu.InvokeSampleApi(t, tu.SampleApiUrl("/helloworld"))
+
+	// the server span name depends on the otelgin version, e.g. /helloworld or GET /helloworld
+	tc := tu.NewTraceSpansTestCase("go.ginapi.traces", 2,
+		tu.NewTraceTestCase("go.ginapi.traces", "*/helloworld"),
+		tu.NewTraceTestCase("go.ginapi.traces", "HelloWorldSpan", tu.StringAttribute("foo", "bar")).
+			WithParent("*/helloworld"))
+
+	tu.AssertTraceSpans(t, tc)
+}
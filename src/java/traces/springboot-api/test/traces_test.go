@@ -7,7 +7,7 @@ import (
 )
 
 func TestTraceGeneratedFromSample(t *testing.T) {
-	tu.InvokeSampleApi(t, "http://localhost:8080/helloworld")
+	tu.InvokeSampleApi(t, tu.SampleApiUrl("/helloworld"))
 
 	tc := tu.NewTraceTestCase("java.springbootapi.traces", "HelloWorldSpan", tu.StringAttribute("foo", "bar"))
 
@@ -29,11 +29,6 @@ func GetSpansByName(t *testing.T, serviceName string, spanName string) []*otlptr
 	return sl
 }
 
-func TestSampledSpansCount(t *testing.T) {
-	spans := GetSpansByName(t, serviceName, spanName)
-	assert.Equal(t, 1, len(spans))
-}
-
 func TestSampledSpansAttributes(t *testing.T) {
 	spans := GetSpansByName(t, serviceName, spanName)
 	for _, s := range spans {
@@ -42,3 +37,8 @@ func TestSampledSpansAttributes(t *testing.T) {
 		assert.Contains(t, s.Attributes, samplerAttribute)
 	}
 }
+
+func TestSampledSpansRatio(t *testing.T) {
+	// the app creates 10k spans, sampling 1 in every 1000 traces
+	tu.AssertSamplingRatio(t, tu.NewSamplingTestCase(serviceName, spanName, 1.0/1000, 10000))
+}
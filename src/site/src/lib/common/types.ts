@@ -22,6 +22,15 @@ export class Recipe {
 	tags?: string[];
 	steps: Step[];
 	dependencies: Dependency[];
+	verification?: Verification;
+}
+
+export class Verification {
+	status?: string;
+	verifiedAt?: string;
+	spans?: string[];
+	metrics?: string[];
+	logs?: number;
 }
 
 export class Step {
@@ -1,8 +1,11 @@
 module github.com/joaopgrassi/otel-recipes/test/jsonschema
 
-go 1.17
+go 1.22.1
 
-require github.com/xeipuuv/gojsonschema v1.2.0
+require (
+	github.com/xeipuuv/gojsonschema v1.2.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/stretchr/testify v1.7.0 // indirect
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// The fields of the recipefile.json the manifest must agree with
+type recipeFile struct {
+	ID         string `json:"id"`
+	LanguageID string `json:"languageId"`
+	Signal     string `json:"signal"`
+}
+
+// Validates every recipe.yaml of the repository against the manifest schema, and checks its expected
+// telemetry file exists and it agrees with the recipefile.json next to it
+func TestManifestSchema(t *testing.T) {
+	cwd, _ := os.Getwd()
+	root := filepath.Clean(filepath.Join(cwd, "..", ".."))
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + filepath.Join(root, "recipe-manifest-schema.json")))
+	if err != nil {
+		t.Fatalf("Failed loading the manifest schema: %v", err)
+	}
+
+	var manifests []string
+	err = filepath.WalkDir(filepath.Join(root, "src"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && (d.Name() == "node_modules" || d.Name() == "site") {
+			return filepath.SkipDir
+		}
+		if d.Name() == "recipe.yaml" {
+			manifests = append(manifests, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed finding the manifests: %v", err)
+	}
+	if len(manifests) == 0 {
+		t.Skip("No recipe.yaml found in src")
+	}
+
+	for _, path := range manifests {
+		rel, _ := filepath.Rel(root, filepath.Dir(path))
+		t.Run(filepath.ToSlash(rel), func(t *testing.T) {
+			validateManifest(t, schema, path)
+		})
+	}
+}
+
+func validateManifest(t *testing.T, schema *gojsonschema.Schema, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed reading the manifest: %v", err)
+	}
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("The manifest is not valid YAML: %v", err)
+	}
+
+	result, err := schema.Validate(gojsonschema.NewGoLoader(doc))
+	if err != nil {
+		t.Fatalf("Failed validating the manifest: %v", err)
+	}
+	if !result.Valid() {
+		t.Errorf("The manifest does not match the schema. See errors:")
+		for _, desc := range result.Errors() {
+			t.Logf("- %s", desc)
+		}
+		return
+	}
+
+	var m struct {
+		Name      string   `yaml:"name"`
+		Language  string   `yaml:"language"`
+		Signals   []string `yaml:"signals"`
+		Endpoints []any    `yaml:"endpoints"`
+		Expected  string   `yaml:"expected"`
+	}
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		t.Fatalf("Failed reading the manifest: %v", err)
+	}
+
+	dir := filepath.Dir(path)
+	expected := m.Expected
+	if expected == "" && len(m.Endpoints) > 0 {
+		// the endpoints are only called before asserting an expected telemetry file
+		expected = filepath.Join("test", "expected.yaml")
+	}
+	if expected != "" {
+		if strings.HasPrefix(filepath.Clean(expected), "..") || filepath.IsAbs(expected) {
+			t.Errorf("The expected telemetry file %s is not inside the recipe folder", expected)
+		} else if _, err := os.Stat(filepath.Join(dir, expected)); err != nil {
+			t.Errorf("The expected telemetry file %s does not exist", expected)
+		}
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "recipefile.json"))
+	if err != nil {
+		t.Fatalf("The manifest has no recipefile.json next to it: %v", err)
+	}
+	var r recipeFile
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Invalid recipefile.json: %v", err)
+	}
+	if m.Name != r.ID {
+		t.Errorf("The name %s differs from the id %s of the recipefile.json", m.Name, r.ID)
+	}
+	if m.Language != r.LanguageID {
+		t.Errorf("The language %s differs from the languageId %s of the recipefile.json", m.Language, r.LanguageID)
+	}
+	if !slices.Contains(m.Signals, r.Signal) {
+		t.Errorf("The signals %v miss the signal %s of the recipefile.json", m.Signals, r.Signal)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"slices"
+	"testing"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+var discover = flag.Bool("discover", false, "Validate all the recipes found in the src folder")
+var languageFilter = flag.String("lang", "", "Only validate the discovered recipes of the given languageId, e.g. go")
+var signalFilter = flag.String("signal", "", "Only validate the discovered recipes of the given signal. One of: traces, metrics, logs, profiles")
+
+// Finds the recipes with a test module matching the -lang and -signal filters
+func discoverSamples(root string) ([]sample, error) {
+	all, err := recipes.Discover(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []sample
+	for _, r := range all {
+		if *languageFilter != "" && r.LanguageID != *languageFilter || *signalFilter != "" && !slices.Contains(r.Signals(), *signalFilter) {
+			continue
+		}
+		samples = append(samples, sample{Path: r.Path(root)})
+	}
+	return samples, nil
+}
+
+// Runs the tests of the sample's own module, passing the addresses via environment variables
+// and returns the outcome of each of its tests
+func runSampleTests(t *testing.T, r *recipes.Recipe, c *tu.Config) []tu.AssertionResult {
+	results, output, err := recipes.RunTests(context.Background(), r, c)
+	t.Logf("Output of the tests in %s:\n%s", r.TestDir(), output)
+	if err != nil {
+		t.Errorf("Tests in %s failed: %v", r.TestDir(), err)
+	}
+	return results
+}
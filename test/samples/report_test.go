@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/report"
+)
+
+var reportFile = flag.String("report", "", "Path of the JSON report to write with the results of the samples")
+var junitFile = flag.String("junit", "", "Path of the JUnit XML report to write with the results of the samples")
+var htmlFile = flag.String("html", "", "Path of the HTML report to write with the results and the traces of the samples")
+var reportTelemetry = flag.Bool("report-telemetry", true, "Include the telemetry found in the back-ends in the JSON and HTML reports")
+
+func writeReports(t *testing.T, r *report.Report) {
+	for _, o := range []struct {
+		path  string
+		name  string
+		write func(io.Writer) error
+	}{
+		{*reportFile, "JSON", r.WriteJSON},
+		{*junitFile, "JUnit", r.WriteJUnit},
+		{*htmlFile, "HTML", r.WriteHTML},
+	} {
+		if o.path == "" {
+			continue
+		}
+		f, err := os.Create(o.path)
+		if err == nil {
+			err = o.write(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			t.Errorf("Failed writing the %s report: %v", o.name, err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/report"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+var reruns = flag.Int("reruns", 0, "Validate a failing sample again up to n times, each in a fresh process (and compose stack with -compose). Samples passing on a rerun are reported as flaky")
+var quarantineFile = flag.String("quarantine", "", "Path to a file listing the paths of known flaky samples, one per line. Their failures are reported without failing the run")
+var onlySample = flag.String("only-sample", "", "Only validate the sample with the path. Used to validate a sample again in a fresh process")
+
+// The flags of the runner not passed to the processes validating a sample again
+var rerunOwnFlags = []string{"test.run", "test.testlogfile", "report", "junit", "reruns", "quarantine", "only-sample"}
+
+// Whether the sample is validated in attempts run in other processes, instead of in this one
+func (s sample) rerun() bool {
+	return *onlySample == "" && (*reruns > 0 || s.Quarantine)
+}
+
+// Validates the sample in up to 1 + -reruns processes of the test binary, until an attempt passes. Each
+// process starts from a fresh state, e.g. its own compose stack, and reports the sample in a JSON report,
+// which becomes an attempt of the sample. Fails the test if all the attempts failed, unless it is quarantined
+func runAttempts(t *testing.T, s sample, sr *report.Sample) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Failed finding the test binary to rerun %s: %v", s.Path, err)
+	}
+	args := []string{"-test.run=^TestSamples$", "-only-sample=" + s.Path, "-reruns=0"}
+	flag.Visit(func(f *flag.Flag) {
+		for _, own := range rerunOwnFlags {
+			if f.Name == own {
+				return
+			}
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", f.Name, f.Value))
+	})
+
+	sr.Quarantined = s.Quarantine
+	for attempt := 1; attempt <= *reruns+1; attempt++ {
+		path := filepath.Join(t.TempDir(), fmt.Sprintf("attempt-%d.json", attempt))
+		output, err := exec.Command(exe, append(args, "-report="+path)...).CombinedOutput()
+
+		a, rerr := readAttempt(path)
+		if rerr != nil {
+			a = &report.Sample{Status: report.StatusFailed}
+		}
+		sr.AddAttempt(a)
+		if a.Status == report.StatusPassed || a.Status == report.StatusSkipped {
+			if attempt > 1 {
+				tu.Logger(t).Warn("The sample is flaky", "attempt", attempt)
+			}
+			return
+		}
+		tu.Logger(t).Warn("Attempt failed", "attempt", attempt, "attempts", *reruns+1, "error", err)
+		t.Logf("Output of attempt %d:\n%s", attempt, output)
+	}
+
+	if s.Quarantine {
+		tu.Logger(t).Info("The quarantined sample failed in all the attempts", "attempts", *reruns+1)
+		return
+	}
+	t.Errorf("Sample %s failed in all the %d attempts", s.Path, *reruns+1)
+}
+
+func readAttempt(path string) (*report.Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rep, err := report.ReadJSON(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(rep.Samples) != 1 {
+		return nil, fmt.Errorf("expected a single sample in %s, found %d", path, len(rep.Samples))
+	}
+	return rep.Samples[0], nil
+}
+
+// Marks the samples listed in the -quarantine file as quarantined. Empty lines and lines starting with # are ignored
+func applyQuarantine(t *testing.T, samples []sample) {
+	if *quarantineFile == "" {
+		return
+	}
+	f, err := os.Open(*quarantineFile)
+	if err != nil {
+		t.Fatalf("Failed reading the quarantine file: %v", err)
+	}
+	defer f.Close()
+
+	quarantined := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			quarantined[filepath.Clean(line)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Failed reading the quarantine file: %v", err)
+	}
+	for i := range samples {
+		if quarantined[filepath.Clean(samples[i].Path)] {
+			samples[i].Quarantine = true
+		}
+	}
+}
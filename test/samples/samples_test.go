@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/compose"
+	"github.com/joaopgrassi/otel-recipes/internal/common/containers"
+	"github.com/joaopgrassi/otel-recipes/internal/common/otlpsink"
+	"github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+	"github.com/joaopgrassi/otel-recipes/internal/common/report"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+	"gopkg.in/yaml.v3"
+)
+
+var startCompose = flag.Bool("compose", false, "Start the compose stack of each sample before validating it")
+var samplesFile = flag.String("samples", "", "Path to the YAML file listing the samples to validate and their addresses")
+
+// A sample to validate. The addresses not set fall back to the global configuration,
+// so samples sharing a back-end only need to set the address of their own API
+type sample struct {
+	// The folder of the recipe, relative to the repository root, e.g. src/go/traces/console
+	Path                  string `yaml:"path"`
+	OtlpBackendUrl        string `yaml:"otlpBackendUrl"`
+	SampleApiUrl          string `yaml:"sampleApiUrl"`
+	SampleGrpcUrl         string `yaml:"sampleGrpcUrl"`
+	PrometheusExporterUrl string `yaml:"prometheusExporterUrl"`
+	TempoUrl              string `yaml:"tempoUrl"`
+	ZipkinUrl             string `yaml:"zipkinUrl"`
+	// Known to be flaky: its failures are reported, but don't fail the run
+	Quarantine bool `yaml:"quarantine"`
+}
+
+type samplesConfig struct {
+	Samples []sample `yaml:"samples"`
+}
+
+// Validates all the samples concurrently. The number of samples validated at the
+// same time is limited by the go test -parallel flag
+func TestSamples(t *testing.T) {
+	cwd, _ := os.Getwd()
+	root := filepath.Clean(filepath.Join(cwd, "..", ".."))
+
+	samples := loadSamples(t, root)
+	if len(samples) == 0 {
+		t.Skip("No samples to validate. Set them with the -samples or -discover flags")
+	}
+
+	rep := &report.Report{}
+	t.Cleanup(func() { writeReports(t, rep) })
+
+	for _, s := range samples {
+		t.Run(s.Path, func(t *testing.T) {
+			t.Parallel()
+			tu.UseLogAttrs(t, "sample", s.Path)
+
+			// samples without a recipefile.json are still validated, just reported without their id
+			r, err := recipes.Load(filepath.Join(root, s.Path))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("Failed loading the recipe: %v", err)
+			}
+			sr := report.NewSample(r, s.Path)
+			start := time.Now()
+			t.Cleanup(func() {
+				sr.Finish(t, start)
+				rep.Add(sr)
+			})
+
+			if s.rerun() {
+				runAttempts(t, s, sr)
+				return
+			}
+
+			if versions := sdkVersions(root, s, r); *startCompose && len(versions) > 0 {
+				runSdkMatrix(t, root, s, r, sr, versions)
+				return
+			}
+			sr.AddAssertions(validateSample(t, root, s, r, sr, s.config()))
+		})
+	}
+}
+
+// Validates the sample with the configuration, after starting its compose stack with the options if -compose is set
+func validateSample(t *testing.T, root string, s sample, r *recipes.Recipe, sr *report.Sample, c *tu.Config, opts ...compose.Option) []tu.AssertionResult {
+	if r == nil {
+		r = &recipes.Recipe{Dir: filepath.Join(root, s.Path)}
+	}
+	if *startCompose && c.TraceStart == "" {
+		// the back-ends may keep the traces of the previous runs
+		c.TraceStart = tu.TraceStartNow()
+	}
+	if r.Manifest != nil && r.Manifest.Backend != "" {
+		c.TraceBackend = r.Manifest.Backend
+	}
+	tu.UseConfig(t, c)
+
+	var spec *tu.Spec
+	if r.SpecPath() != "" {
+		var err error
+		if spec, err = r.LoadSpec(c.SdkVersion); err != nil {
+			t.Fatalf("Failed loading the expected telemetry: %v", err)
+		}
+		if spec.ResourceEnv != nil {
+			opts = append(opts, compose.WithServiceEnv(spec.ResourceEnv.SampleService(), spec.ResourceEnv.Env(spec.ServiceName)...))
+		}
+		if spec.ExporterEnv != nil && *startCompose {
+			opts = append(opts, captureExports(t, spec.ExporterEnv)...)
+		}
+	}
+	if *startCompose {
+		compose.Up(t, r.Dir, opts...)
+	}
+
+	var results []tu.AssertionResult
+	if spec != nil {
+		results = tu.AssertSpec(t, spec)
+	} else {
+		// samples with assertions written in Go are validated by their own test module
+		results = runSampleTests(t, r, c)
+	}
+
+	if *reportTelemetry && sr.Recipe != "" {
+		if err := sr.AddTelemetry(tu.CaptureTelemetry(t, sr.Recipe)); err != nil {
+			tu.Logger(t).Warn("Failed adding the telemetry to the report", "error", err)
+		}
+	}
+	return results
+}
+
+// Points the exporters of the sample to an OTLP sink of the test, which becomes the back-end of the sample, so the
+// exports can be asserted to honor the configuration of the spec
+func captureExports(t *testing.T, e *tu.ExporterEnvSpec) []compose.Option {
+	sink := otlpsink.Capture(t)
+	endpoint := sink.Endpoint(containers.HostGateway, e.Protocol)
+	return []compose.Option{
+		compose.WithServiceEnv(e.SampleService(), e.Env(endpoint)...),
+		compose.WithExtraHosts(e.SampleService(), containers.HostGateway+":host-gateway"),
+	}
+}
+
+// Returns the samples listed in the -samples file followed by the discovered ones, if enabled
+func loadSamples(t *testing.T, root string) []sample {
+	var samples []sample
+	if *samplesFile != "" {
+		data, err := os.ReadFile(*samplesFile)
+		if err != nil {
+			t.Fatalf("Failed reading the samples file: %v", err)
+		}
+		var cfg samplesConfig
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			t.Fatalf("Invalid samples file %s: %v", *samplesFile, err)
+		}
+		samples = cfg.Samples
+	}
+
+	if *discover {
+		discovered, err := discoverSamples(root)
+		if err != nil {
+			t.Fatalf("Failed discovering the samples: %v", err)
+		}
+
+		listed := make(map[string]bool, len(samples))
+		for _, s := range samples {
+			listed[filepath.Clean(s.Path)] = true
+		}
+		for _, s := range discovered {
+			if !listed[filepath.Clean(s.Path)] {
+				samples = append(samples, s)
+			}
+		}
+	}
+	applyQuarantine(t, samples)
+
+	if *onlySample != "" {
+		for _, s := range samples {
+			if filepath.Clean(s.Path) == filepath.Clean(*onlySample) {
+				return []sample{s}
+			}
+		}
+		t.Fatalf("Sample %s is not listed nor discovered", *onlySample)
+	}
+	return samples
+}
+
+func (s sample) config() *tu.Config {
+	c := *tu.GetConfig()
+	for _, o := range []struct {
+		dst *string
+		v   string
+	}{
+		{&c.OtlpBackendUrl, s.OtlpBackendUrl},
+		{&c.SampleApiUrl, s.SampleApiUrl},
+		{&c.SampleGrpcUrl, s.SampleGrpcUrl},
+		{&c.PrometheusExporterUrl, s.PrometheusExporterUrl},
+		{&c.TempoUrl, s.TempoUrl},
+		{&c.ZipkinUrl, s.ZipkinUrl},
+	} {
+		if o.v != "" {
+			*o.dst = o.v
+		}
+	}
+	return &c
+}
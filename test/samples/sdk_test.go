@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/joaopgrassi/otel-recipes/internal/common/compose"
+	"github.com/joaopgrassi/otel-recipes/internal/common/recipes"
+	"github.com/joaopgrassi/otel-recipes/internal/common/report"
+	tu "github.com/joaopgrassi/otel-recipes/internal/common/testutils"
+)
+
+// The SDK versions declared in the expected telemetry file of the sample, if any
+func sdkVersions(root string, s sample, r *recipes.Recipe) []string {
+	if r == nil {
+		r = &recipes.Recipe{Dir: filepath.Join(root, s.Path)}
+	}
+	spec, err := r.LoadSpec("")
+	if err != nil {
+		// also for the samples validated by their own test module. Invalid files fail when asserted
+		return nil
+	}
+	return spec.SdkVersions
+}
+
+// Builds the sample with each SDK version in turn, passed as the SDK_VERSION variable of its compose file,
+// and validates it against the expected telemetry with the overrides of the version. The assertions are
+// reported per version, e.g. sdk-1.24.0/span/HelloWorldSpan
+func runSdkMatrix(t *testing.T, root string, s sample, r *recipes.Recipe, sr *report.Sample, versions []string) {
+	for _, v := range versions {
+		name := "sdk-" + v
+		passed := t.Run(name, func(t *testing.T) {
+			tu.UseLogAttrs(t, "sdkVersion", v)
+			c := s.config()
+			c.SdkVersion = v
+			results := validateSample(t, root, s, r, sr, c, compose.WithEnv("SDK_VERSION="+tu.SdkBuildArg(v)))
+			for i := range results {
+				results[i].Name = name + "/" + results[i].Name
+			}
+			sr.AddAssertions(results)
+		})
+		if !passed {
+			tu.Logger(t).Warn("The sample failed with the SDK version", "sdkVersion", v)
+		}
+	}
+}